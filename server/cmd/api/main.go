@@ -11,11 +11,14 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 
+	"hearcap/server/internal/calendar"
 	"hearcap/server/internal/config"
 	"hearcap/server/internal/database"
+	"hearcap/server/internal/decimal"
 	"hearcap/server/internal/engine"
 	"hearcap/server/internal/http/handlers"
 	"hearcap/server/internal/http/routes"
+	"hearcap/server/internal/models"
 	"hearcap/server/internal/services"
 	"hearcap/server/internal/tasks"
 )
@@ -64,8 +67,7 @@ func main() {
 	tradeRepo := services.NewGORMTradeHistoryRepository(db)
 	tickerRepo := services.NewGORMTickerRepository(db)
 
-	// Criar WebSocket handler primeiro (sem MatchingEngine por enquanto - pode ser nil)
-	var matchingEngine *engine.MatchingEngine = nil
+	// Criar WebSocket handler primeiro; o MatchingEngine é ligado depois
 	// Criar engine temporário apenas para inicializar o handler
 	tempEngine := engine.NewMarketDataEngine(
 		engine.MarketDataConfig{
@@ -77,7 +79,7 @@ func main() {
 		tickerRepo,
 		engine.NewNoOpMarketDataPublisher(), // temporário
 	)
-	marketDataWSHandler := handlers.NewMarketDataWSHandler(tempEngine, matchingEngine)
+	marketDataWSHandler := handlers.NewMarketDataWSHandler(tempEngine, nil)
 
 	// Criar publisher WebSocket
 	wsPublisher := handlers.NewWSPublisher(marketDataWSHandler)
@@ -97,6 +99,153 @@ func main() {
 	// Atualizar o engine do WS handler (sem recriar o handler)
 	marketDataWSHandler.SetMarketDataEngine(marketDataEngine)
 
+	// Matching engine: saldos na WalletEngine, ordens e fills em Postgres
+	walletRepo := services.NewGORMWalletRepository(db)
+	walletEngine := engine.NewWalletEngine(walletRepo, walletRepo, walletRepo, walletRepo, walletRepo)
+	userStream := handlers.NewUserStreamHandler(cfg.UserStreamSecret, cfg.UserStreamIssuerKey)
+	walletEngine.SetBalanceNotifier(userStream)
+	balances := engine.NewWalletBalanceService(walletEngine, nil, nil)
+	balances.SetDefaultQuote(cfg.QuoteAsset)
+	orderRepo := services.NewGORMOrderRepository(db)
+
+	// Calendário de dias úteis: ciclo T+N, agenda do clearing e pregão
+	cal := calendar.Continuous()
+	if cfg.CalendarFile != "" {
+		if cal, err = calendar.Load(cfg.CalendarFile); err != nil {
+			log.Fatalf("calendar: %v", err)
+		}
+	}
+
+	// Pós-trade: o clearing acumula as posições T+N e as liquida na wallet
+	// (única liquidação dos trades), com multas e buy-ins na conta da clearing
+	clearingRepo := services.NewGORMClearingRepository(db)
+	custody := engine.NewWalletCustodyService(walletEngine, cfg.ClearingAccount)
+	clearingEngine := engine.NewClearingEngine(clearingRepo, custody, nil, userStream, engine.ClearingConfig{
+		Mode:           engine.SettlementModeOffChain,
+		SettlementDays: cfg.SettlementDays,
+		Calendar:       cal,
+		DefaultQuote:   cfg.QuoteAsset,
+		FeeAccount:     cfg.FeeAccount,
+	})
+	clearingEngine.SetPriceFeed(marketDataEngine)
+	clearingCtx, stopClearing := context.WithCancel(context.Background())
+	defer stopClearing()
+	if err := clearingEngine.RecoverBatches(clearingCtx, time.Now()); err != nil {
+		log.Printf("clearing: erro ao retomar lotes de liquidação: %v", err)
+	}
+	clearingEngine.StartTPlusOneScheduler(clearingCtx, time.Hour)
+	postTrade := engine.NewPostTradePipeline(clearingEngine, nil, orderRepo, clearingRepo, engine.PostTradeConfig{})
+	if err := postTrade.Start(); err != nil {
+		log.Fatalf("post-trade: %v", err)
+	}
+	defer postTrade.Stop()
+
+	// Journal do matching engine: aberto antes do engine para fechar depois
+	// dele no shutdown
+	journal, err := engine.NewFileJournal(engine.JournalConfig{
+		Dir:           cfg.JournalDir,
+		SnapshotEvery: cfg.JournalSnapshotEvery,
+		SyncWrites:    cfg.JournalSyncWrites,
+	})
+	if err != nil {
+		log.Fatalf("journal: %v", err)
+	}
+	defer journal.Close()
+
+	matchingEngine := engine.NewMatchingEngine(orderRepo, balances, userStream, marketDataEngine)
+	defer matchingEngine.Stop()
+	matchingEngine.AttachJournal(journal)
+	matchingEngine.SetPostTrade(postTrade)
+	matchingEngine.SetCalendar(cal)
+	matchingEngine.SetAuctionConfig(engine.AuctionConfig{
+		Opening:   cfg.OpeningAuction,
+		Reopening: cfg.ReopeningAuction,
+	})
+
+	// Mercados: um por artista, com a especificação padrão da configuração.
+	// Os gravados mantêm especificação e status; só os novos são criados
+	instruments := engine.NewInstrumentRegistry(engine.Instrument{
+		QuoteAsset:  cfg.QuoteAsset,
+		TickSize:    mustDecimal("MARKET_TICK_SIZE", cfg.TickSize),
+		LotSize:     mustDecimal("MARKET_LOT_SIZE", cfg.LotSize),
+		MinNotional: mustDecimal("MARKET_MIN_NOTIONAL", cfg.MinNotional),
+	}, services.NewGORMInstrumentRepository(db))
+	if err := instruments.Load(); err != nil {
+		log.Fatalf("instruments: %v", err)
+	}
+	var symbols []string
+	if err := db.Model(&models.Artist{}).Pluck("symbol", &symbols).Error; err != nil {
+		log.Fatalf("instruments: %v", err)
+	}
+	feeAssets := make(map[string]string, len(symbols))
+	for _, symbol := range symbols {
+		feeAssets[symbol] = cfg.QuoteAsset
+		if _, ok := instruments.Get(symbol); ok {
+			continue
+		}
+		if err := instruments.CreateMarket(symbol); err != nil {
+			log.Fatalf("instruments: %s: %v", symbol, err)
+		}
+	}
+	matchingEngine.SetInstruments(instruments)
+
+	// Taxas maker/taker pelo volume em 30 dias, cobradas na liquidação
+	feeEngine := engine.NewFeeEngine(services.NewGORMFeeVolumeRepository(db), engine.FeeConfig{
+		QuoteAssets: feeAssets,
+	})
+	if err := feeEngine.SetSchedule("", []engine.FeeTier{{
+		Name:      "default",
+		MakerRate: mustDecimal("MAKER_FEE_RATE", cfg.MakerFeeRate),
+		TakerRate: mustDecimal("TAKER_FEE_RATE", cfg.TakerFeeRate),
+	}}); err != nil {
+		log.Fatalf("fees: %v", err)
+	}
+	matchingEngine.SetFeeEngine(feeEngine)
+
+	// Circuit breaker: o halt passa pelo registro de mercados
+	matchingEngine.SetCircuitBreaker(engine.NewCircuitBreakerEngine(engine.RiskConfig{
+		CircuitBreakerMovePercent: cfg.CircuitBreakerMovePercent,
+		CircuitBreakerWindow:      cfg.CircuitBreakerWindow,
+		CircuitBreakerHaltTime:    cfg.CircuitBreakerHaltTime,
+	}, instruments, userStream))
+
+	// Replay do journal antes de qualquer ordem nova; no fim dele o engine
+	// assume os status gravados no registro
+	if err := matchingEngine.Recover(); err != nil {
+		log.Fatalf("journal: erro no replay: %v", err)
+	}
+
+	engineCtx, stopEngine := context.WithCancel(context.Background())
+	defer stopEngine()
+	matchingEngine.StartExpirySweeper(engineCtx, cfg.SweepInterval)
+	matchingEngine.StartHaltSweeper(engineCtx, cfg.SweepInterval)
+	matchingEngine.StartAuctionSweeper(engineCtx, cfg.SweepInterval)
+	feeEngine.Start(engineCtx, cfg.SweepInterval)
+
+	// Ofertas primárias: o sweeper fecha as vencidas, retoma fechamentos
+	// interrompidos e ativa o mercado no registro
+	offeringRepo := services.NewGORMOfferingRepository(db)
+	listingEngine := engine.NewListingEngine(offeringRepo, nil, engine.NoOpGovernanceNotifier{}, nil, nil, instruments, engine.ListingEngineConfig{})
+	offeringEngine := engine.NewOfferingEngine(offeringRepo, listingEngine, walletEngine)
+	offeringEngine.StartClosingSweeper(engineCtx, cfg.SweepInterval)
+	go func() {
+		ticker := time.NewTicker(cfg.CheckpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-engineCtx.Done():
+				return
+			case <-ticker.C:
+				if err := matchingEngine.Checkpoint(); err != nil {
+					log.Printf("journal: erro no checkpoint: %v", err)
+				}
+			}
+		}
+	}()
+	marketDataWSHandler.SetMatchingEngine(matchingEngine)
+	orderHandler := handlers.NewOrderHandler(matchingEngine, orderRepo)
+	settlementHandler := handlers.NewSettlementHandler(clearingEngine)
+
 	// Criar REST handler
 	marketDataHandler := handlers.NewMarketDataHandler(marketDataEngine, matchingEngine)
 
@@ -104,6 +253,9 @@ func main() {
 		TradeHandler:        tradeHandler,
 		MarketDataHandler:   marketDataHandler,
 		MarketDataWSHandler: marketDataWSHandler,
+		OrderHandler:        orderHandler,
+		UserStreamHandler:   userStream,
+		SettlementHandler:   settlementHandler,
 	})
 
 	go func() {
@@ -128,3 +280,12 @@ func main() {
 
 	log.Println("HearCap Invest API finalizada")
 }
+
+// mustDecimal converte um valor decimal da configuração ou encerra o boot.
+func mustDecimal(key, value string) decimal.Decimal {
+	d, err := decimal.Parse(value)
+	if err != nil {
+		log.Fatalf("config: valor inválido para %s: %v", key, err)
+	}
+	return d
+}
@@ -0,0 +1,299 @@
+// Package calendar é o calendário de negociação: fuso horário, fim de semana,
+// feriados e horário do pregão. Liquidação (T+N), agendamento do clearing,
+// data ex de eventos corporativos e sessão do matching usam o mesmo
+// calendário.
+package calendar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCalendar indica arquivo de calendário malformado.
+var ErrInvalidCalendar = errors.New("invalid calendar")
+
+const dateLayout = "2006-01-02"
+
+// Calendar responde se um instante cai em dia útil e em horário de pregão,
+// sempre no fuso do calendário. Não é alterado depois de carregado; use
+// AddHoliday e SetSession só na montagem.
+type Calendar struct {
+	loc      *time.Location
+	weekend  map[time.Weekday]bool
+	holidays map[string]string // "2006-01-02" -> nome
+	// open/close são minutos desde a meia-noite local; session=false é
+	// pregão o dia inteiro.
+	session     bool
+	open, close int
+}
+
+// New cria um calendário no fuso loc com os dias de fim de semana dados,
+// sem feriados e com pregão o dia inteiro.
+func New(loc *time.Location, weekend ...time.Weekday) *Calendar {
+	if loc == nil {
+		loc = time.UTC
+	}
+	c := &Calendar{
+		loc:      loc,
+		weekend:  make(map[time.Weekday]bool),
+		holidays: make(map[string]string),
+	}
+	for _, d := range weekend {
+		c.weekend[d] = true
+	}
+	return c
+}
+
+// Continuous é o calendário sem fim de semana nem feriados, em UTC: todo dia
+// é útil e o pregão não fecha.
+func Continuous() *Calendar {
+	return New(time.UTC)
+}
+
+// AddHoliday marca o dia de date (no fuso do calendário) como feriado.
+func (c *Calendar) AddHoliday(date time.Time, name string) {
+	c.holidays[date.In(c.loc).Format(dateLayout)] = name
+}
+
+// SetSession define o pregão de open a close (desde a meia-noite local) em
+// cada dia útil.
+func (c *Calendar) SetSession(open, close time.Duration) error {
+	if open < 0 || close > 24*time.Hour || open >= close {
+		return fmt.Errorf("%w: session %s-%s", ErrInvalidCalendar, open, close)
+	}
+	c.session = true
+	c.open, c.close = int(open/time.Minute), int(close/time.Minute)
+	return nil
+}
+
+func (c *Calendar) Location() *time.Location {
+	return c.loc
+}
+
+// Date devolve a meia-noite (no fuso do calendário) do dia de t.
+func (c *Calendar) Date(t time.Time) time.Time {
+	y, m, d := t.In(c.loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, c.loc)
+}
+
+// SameDay diz se a e b caem no mesmo dia do calendário.
+func (c *Calendar) SameDay(a, b time.Time) bool {
+	return c.Date(a).Equal(c.Date(b))
+}
+
+// Holiday devolve o nome do feriado no dia de t.
+func (c *Calendar) Holiday(t time.Time) (string, bool) {
+	name, ok := c.holidays[t.In(c.loc).Format(dateLayout)]
+	return name, ok
+}
+
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	if c.weekend[t.In(c.loc).Weekday()] {
+		return false
+	}
+	_, holiday := c.Holiday(t)
+	return !holiday
+}
+
+// NextBusinessDay devolve o primeiro dia útil depois do dia de t.
+func (c *Calendar) NextBusinessDay(t time.Time) time.Time {
+	d := c.addDays(c.Date(t), 1)
+	for !c.IsBusinessDay(d) {
+		d = c.addDays(d, 1)
+	}
+	return d
+}
+
+// PrevBusinessDay devolve o último dia útil antes do dia de t.
+func (c *Calendar) PrevBusinessDay(t time.Time) time.Time {
+	d := c.addDays(c.Date(t), -1)
+	for !c.IsBusinessDay(d) {
+		d = c.addDays(d, -1)
+	}
+	return d
+}
+
+// AddBusinessDays devolve o n-ésimo dia útil a partir do dia de t (n < 0
+// volta). Um t fora de dia útil conta a partir do próximo dia útil (ou do
+// anterior, para n < 0), de modo que um trade no sábado com T+1 liquida na
+// terça.
+func (c *Calendar) AddBusinessDays(t time.Time, n int) time.Time {
+	d := c.Date(t)
+	if n >= 0 {
+		if !c.IsBusinessDay(d) {
+			d = c.NextBusinessDay(d)
+		}
+		for ; n > 0; n-- {
+			d = c.NextBusinessDay(d)
+		}
+		return d
+	}
+	if !c.IsBusinessDay(d) {
+		d = c.PrevBusinessDay(d)
+	}
+	for ; n < 0; n++ {
+		d = c.PrevBusinessDay(d)
+	}
+	return d
+}
+
+// ExDate devolve a data ex de um evento com data de registro record num
+// ciclo de liquidação T+settlementDays: o primeiro dia útil em que uma compra
+// já liquida depois do registro e, portanto, não leva o direito.
+func (c *Calendar) ExDate(record time.Time, settlementDays int) time.Time {
+	record = c.Date(record)
+	d := c.AddBusinessDays(record, -settlementDays)
+	for !c.AddBusinessDays(d, settlementDays).After(record) {
+		d = c.NextBusinessDay(d)
+	}
+	return d
+}
+
+// Session devolve abertura e fechamento do pregão no dia de t; ok é false
+// em dia não útil.
+func (c *Calendar) Session(t time.Time) (open, close time.Time, ok bool) {
+	if !c.IsBusinessDay(t) {
+		return time.Time{}, time.Time{}, false
+	}
+	day := c.Date(t)
+	if !c.session {
+		return day, c.addDays(day, 1), true
+	}
+	y, m, d := day.Date()
+	open = time.Date(y, m, d, c.open/60, c.open%60, 0, 0, c.loc)
+	close = time.Date(y, m, d, c.close/60, c.close%60, 0, 0, c.loc)
+	return open, close, true
+}
+
+// IsOpen diz se t está dentro do pregão.
+func (c *Calendar) IsOpen(t time.Time) bool {
+	open, close, ok := c.Session(t)
+	return ok && !t.Before(open) && t.Before(close)
+}
+
+// NextOpen devolve o próximo instante de abertura do pregão a partir de t
+// (o próprio t quando o pregão está aberto).
+func (c *Calendar) NextOpen(t time.Time) time.Time {
+	if c.IsOpen(t) {
+		return t
+	}
+	if open, _, ok := c.Session(t); ok && t.Before(open) {
+		return open
+	}
+	open, _, _ := c.Session(c.NextBusinessDay(t))
+	return open
+}
+
+// addDays soma dias de calendário pela data, sem depender de horário de verão.
+func (c *Calendar) addDays(day time.Time, n int) time.Time {
+	y, m, d := day.Date()
+	return time.Date(y, m, d+n, 0, 0, 0, 0, c.loc)
+}
+
+// calendarFile é o formato do arquivo carregado por Load:
+//
+//	{
+//	  "timezone": "America/Sao_Paulo",
+//	  "weekend": ["saturday", "sunday"],
+//	  "session": {"open": "10:00", "close": "17:00"},
+//	  "holidays": [{"date": "2026-12-25", "name": "Natal"}]
+//	}
+type calendarFile struct {
+	Timezone string   `json:"timezone"`
+	Weekend  []string `json:"weekend"`
+	Session  *struct {
+		Open  string `json:"open"`
+		Close string `json:"close"`
+	} `json:"session"`
+	Holidays []struct {
+		Date string `json:"date"`
+		Name string `json:"name"`
+	} `json:"holidays"`
+}
+
+// Load lê o calendário de um arquivo JSON (ver calendarFile).
+func Load(path string) (*Calendar, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse monta o calendário a partir do JSON de Load. Sem "timezone" o fuso é
+// UTC; sem "session" o pregão dura o dia inteiro.
+func Parse(data []byte) (*Calendar, error) {
+	var f calendarFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCalendar, err)
+	}
+
+	loc := time.UTC
+	if f.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(f.Timezone); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCalendar, err)
+		}
+	}
+
+	var weekend []time.Weekday
+	for _, name := range f.Weekend {
+		d, ok := parseWeekday(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: weekday %q", ErrInvalidCalendar, name)
+		}
+		weekend = append(weekend, d)
+	}
+	c := New(loc, weekend...)
+	if len(c.weekend) == 7 {
+		return nil, fmt.Errorf("%w: no business days", ErrInvalidCalendar)
+	}
+
+	if f.Session != nil {
+		open, err := parseClock(f.Session.Open)
+		if err != nil {
+			return nil, err
+		}
+		close, err := parseClock(f.Session.Close)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.SetSession(open, close); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, h := range f.Holidays {
+		date, err := time.ParseInLocation(dateLayout, h.Date, loc)
+		if err != nil {
+			return nil, fmt.Errorf("%w: holiday %q", ErrInvalidCalendar, h.Date)
+		}
+		c.AddHoliday(date, h.Name)
+	}
+	return c, nil
+}
+
+func parseWeekday(name string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(name, d.String()) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// parseClock lê "HH:MM" (aceita "24:00" como fim do dia).
+func parseClock(s string) (time.Duration, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	h, errH := strconv.Atoi(hh)
+	m, errM := strconv.Atoi(mm)
+	if !ok || errH != nil || errM != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("%w: time %q", ErrInvalidCalendar, s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
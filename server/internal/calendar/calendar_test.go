@@ -0,0 +1,188 @@
+package calendar
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// exampleCalendar carrega o calendar.example.json do servidor: São Paulo
+// (UTC-3), pregão das 10h às 17h e feriados de fim de 2026.
+func exampleCalendar(t *testing.T) *Calendar {
+	t.Helper()
+	c, err := Load("../../calendar.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func day(t *testing.T, c *Calendar, s string) time.Time {
+	t.Helper()
+	d, err := time.ParseInLocation(dateLayout, s, c.Location())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestAddBusinessDays(t *testing.T) {
+	c := exampleCalendar(t)
+	tests := []struct {
+		name string
+		from time.Time
+		n    int
+		want string
+	}{
+		{"skips a holiday monday", day(t, c, "2026-10-30"), 1, "2026-11-03"},
+		{"weekend trade counts from the next business day", day(t, c, "2026-10-31"), 1, "2026-11-04"},
+		{"skips a holiday friday and the weekend", day(t, c, "2026-11-19"), 1, "2026-11-23"},
+		{"zero on a holiday rolls forward", day(t, c, "2026-12-24"), 0, "2026-12-28"},
+		{"zero on a business day stays", day(t, c, "2026-11-04"), 0, "2026-11-04"},
+		{"backwards over a holiday", day(t, c, "2026-11-03"), -1, "2026-10-30"},
+		{"backwards from a sunday", day(t, c, "2026-11-01"), -1, "2026-10-29"},
+		// 01h UTC de terça ainda é segunda (feriado) em São Paulo
+		{"uses the calendar timezone", time.Date(2026, 11, 3, 1, 0, 0, 0, time.UTC), 0, "2026-11-03"},
+		{"uses the calendar timezone with n", time.Date(2026, 11, 3, 1, 0, 0, 0, time.UTC), 1, "2026-11-04"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.AddBusinessDays(tt.from, tt.n)
+			if want := day(t, c, tt.want); !got.Equal(want) {
+				t.Errorf("AddBusinessDays(%s, %d) = %s, want %s", tt.from, tt.n, got, want)
+			}
+		})
+	}
+}
+
+func TestExDate(t *testing.T) {
+	c := exampleCalendar(t)
+	tests := []struct {
+		record         string
+		settlementDays int
+		want           string
+	}{
+		{"2026-11-04", 0, "2026-11-05"},
+		{"2026-11-04", 1, "2026-11-04"},
+		{"2026-11-04", 2, "2026-11-03"},
+		{"2026-11-23", 1, "2026-11-23"},
+		{"2026-11-23", 2, "2026-11-19"},
+	}
+	for _, tt := range tests {
+		got := c.ExDate(day(t, c, tt.record), tt.settlementDays)
+		if want := day(t, c, tt.want); !got.Equal(want) {
+			t.Errorf("ExDate(%s, T+%d) = %s, want %s", tt.record, tt.settlementDays, got.Format(dateLayout), tt.want)
+		}
+		// quem compra na véspera da data ex ainda liquida até o registro
+		before := c.PrevBusinessDay(got)
+		if c.AddBusinessDays(before, tt.settlementDays).After(day(t, c, tt.record)) {
+			t.Errorf("ExDate(%s, T+%d): a buy on %s settles after the record date", tt.record, tt.settlementDays, before.Format(dateLayout))
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	c := exampleCalendar(t)
+	utc := func(month time.Month, d, h, m int) time.Time { return time.Date(2026, month, d, h, m, 0, 0, time.UTC) }
+	tests := []struct {
+		name     string
+		at       time.Time
+		open     bool
+		nextOpen time.Time
+	}{
+		{"before the open", utc(11, 3, 12, 59), false, utc(11, 3, 13, 0)},
+		{"at the open", utc(11, 3, 13, 0), true, utc(11, 3, 13, 0)},
+		{"during the session", utc(11, 3, 19, 59), true, utc(11, 3, 19, 59)},
+		{"at the close", utc(11, 3, 20, 0), false, utc(11, 4, 13, 0)},
+		{"holiday", utc(11, 2, 15, 0), false, utc(11, 3, 13, 0)},
+		{"after friday close to tuesday after a holiday", utc(10, 30, 20, 30), false, utc(11, 3, 13, 0)},
+		{"saturday", utc(11, 21, 15, 0), false, utc(11, 23, 13, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.IsOpen(tt.at); got != tt.open {
+				t.Errorf("IsOpen(%s) = %v, want %v", tt.at, got, tt.open)
+			}
+			if got := c.NextOpen(tt.at); !got.Equal(tt.nextOpen) {
+				t.Errorf("NextOpen(%s) = %s, want %s", tt.at, got.UTC(), tt.nextOpen)
+			}
+		})
+	}
+
+	if _, _, ok := c.Session(day(t, c, "2026-12-25")); ok {
+		t.Error("Session on Christmas ok = true, want false")
+	}
+	if name, ok := c.Holiday(day(t, c, "2026-12-25")); !ok || name != "Natal" {
+		t.Errorf("Holiday(2026-12-25) = %q, %v, want Natal", name, ok)
+	}
+}
+
+func TestContinuous(t *testing.T) {
+	c := Continuous()
+	sat := time.Date(2026, 10, 31, 23, 59, 0, 0, time.UTC)
+	if !c.IsBusinessDay(sat) || !c.IsOpen(sat) {
+		t.Fatal("continuous calendar closed on a saturday")
+	}
+	if got, want := c.AddBusinessDays(sat, 1), time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("AddBusinessDays(sat, 1) = %s, want %s", got, want)
+	}
+	open, close, ok := c.Session(sat)
+	if !ok || !open.Equal(c.Date(sat)) || close.Sub(open) != 24*time.Hour {
+		t.Fatalf("Session = %s-%s (%v), want the whole day", open, close, ok)
+	}
+}
+
+func TestBusinessDaysAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	c := New(loc, time.Saturday, time.Sunday)
+	// o domingo de 8/3/2026 tem 23h: a data seguinte continua à meia-noite
+	got := c.AddBusinessDays(time.Date(2026, 3, 6, 15, 0, 0, 0, loc), 1)
+	if want := time.Date(2026, 3, 9, 0, 0, 0, 0, loc); !got.Equal(want) {
+		t.Fatalf("AddBusinessDays across DST = %s, want %s", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Location() != time.UTC || !c.IsOpen(time.Date(2026, 11, 1, 3, 0, 0, 0, time.UTC)) {
+		t.Fatal("empty calendar is not a continuous UTC calendar")
+	}
+
+	c, err = Parse([]byte(`{"weekend": ["Friday", "SATURDAY"], "session": {"open": "00:00", "close": "24:00"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.IsBusinessDay(time.Date(2026, 10, 30, 12, 0, 0, 0, time.UTC)) || !c.IsBusinessDay(time.Date(2026, 11, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatal("weekday names not parsed case-insensitively")
+	}
+
+	invalid := []struct {
+		name, data string
+	}{
+		{"malformed json", `{"timezone": }`},
+		{"unknown timezone", `{"timezone": "Mars/Olympus"}`},
+		{"unknown weekday", `{"weekend": ["caturday"]}`},
+		{"no business days", `{"weekend": ["monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"]}`},
+		{"open after close", `{"session": {"open": "17:00", "close": "10:00"}}`},
+		{"hour out of range", `{"session": {"open": "10:00", "close": "25:00"}}`},
+		{"minute out of range", `{"session": {"open": "10:60", "close": "17:00"}}`},
+		{"clock without colon", `{"session": {"open": "1000", "close": "17:00"}}`},
+		{"bad holiday date", `{"holidays": [{"date": "25/12/2026", "name": "Natal"}]}`},
+	}
+	for _, tt := range invalid {
+		if _, err := Parse([]byte(tt.data)); !errors.Is(err, ErrInvalidCalendar) {
+			t.Errorf("%s: err = %v, want ErrInvalidCalendar", tt.name, err)
+		}
+	}
+
+	if _, err := Load("testdata/missing.json"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load(missing) err = %v, want os.ErrNotExist", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -22,6 +23,38 @@ type Config struct {
 	TradeImpactAlpha     float64
 	TradeImpactLiquidity float64
 	InitialUSDTBalance   float64
+	QuoteAsset           string
+	UserStreamSecret     string
+	UserStreamIssuerKey  string
+	CalendarFile         string
+	SettlementDays       int
+	ClearingAccount      string
+
+	// Journal do matching engine (replay no boot e checkpoints periódicos)
+	JournalDir           string
+	JournalSnapshotEvery int
+	JournalSyncWrites    bool
+	CheckpointInterval   time.Duration
+
+	// Especificação padrão dos mercados
+	TickSize    string
+	LotSize     string
+	MinNotional string
+
+	// Taxas maker/taker (frações do notional) e conta que as recebe
+	FeeAccount   string
+	MakerFeeRate string
+	TakerFeeRate string
+
+	// Circuit breaker e leilões
+	CircuitBreakerMovePercent float64
+	CircuitBreakerWindow      time.Duration
+	CircuitBreakerHaltTime    time.Duration
+	OpeningAuction            time.Duration
+	ReopeningAuction          time.Duration
+
+	// Intervalo das varreduras de expiração, halt e leilão
+	SweepInterval time.Duration
 }
 
 var (
@@ -46,6 +79,33 @@ func Load() *Config {
 			TradeImpactAlpha:     getEnvAsFloat("TRADE_IMPACT_ALPHA", 0.02),
 			TradeImpactLiquidity: getEnvAsFloat("TRADE_IMPACT_LIQUIDITY", 10000),
 			InitialUSDTBalance:   getEnvAsFloat("INITIAL_USDT_BALANCE", 1000),
+			QuoteAsset:           getEnv("QUOTE_ASSET", "USDT"),
+			UserStreamSecret:     getEnv("USER_STREAM_SECRET", ""),
+			UserStreamIssuerKey:  getEnv("USER_STREAM_ISSUER_KEY", ""),
+			CalendarFile:         getEnv("CALENDAR_FILE", ""),
+			SettlementDays:       getEnvAsInt("SETTLEMENT_DAYS", 1),
+			ClearingAccount:      getEnv("CLEARING_ACCOUNT", "clearing"),
+
+			JournalDir:           getEnv("JOURNAL_DIR", "data/journal"),
+			JournalSnapshotEvery: getEnvAsInt("JOURNAL_SNAPSHOT_EVERY", 1000),
+			JournalSyncWrites:    getEnvAsBool("JOURNAL_SYNC_WRITES", true),
+			CheckpointInterval:   getEnvAsDuration("JOURNAL_CHECKPOINT_INTERVAL", 10*time.Minute),
+
+			TickSize:    getEnv("MARKET_TICK_SIZE", "0.01"),
+			LotSize:     getEnv("MARKET_LOT_SIZE", "0"),
+			MinNotional: getEnv("MARKET_MIN_NOTIONAL", "0"),
+
+			FeeAccount:   getEnv("FEE_ACCOUNT", "fees"),
+			MakerFeeRate: getEnv("MAKER_FEE_RATE", "0.001"),
+			TakerFeeRate: getEnv("TAKER_FEE_RATE", "0.002"),
+
+			CircuitBreakerMovePercent: getEnvAsFloat("CIRCUIT_BREAKER_MOVE_PERCENT", 10),
+			CircuitBreakerWindow:      getEnvAsDuration("CIRCUIT_BREAKER_WINDOW", 5*time.Minute),
+			CircuitBreakerHaltTime:    getEnvAsDuration("CIRCUIT_BREAKER_HALT", 5*time.Minute),
+			OpeningAuction:            getEnvAsDuration("OPENING_AUCTION", 0),
+			ReopeningAuction:          getEnvAsDuration("REOPENING_AUCTION", time.Minute),
+
+			SweepInterval: getEnvAsDuration("SWEEP_INTERVAL", time.Second),
 		}
 	})
 
@@ -86,3 +146,31 @@ func getEnvAsFloat(key string, defaultValue float64) float64 {
 	log.Printf("config: valor inválido para %s, usando default %.2f\n", key, defaultValue)
 	return defaultValue
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	valStr := getEnv(key, "")
+	if valStr == "" {
+		return defaultValue
+	}
+
+	if val, err := strconv.ParseBool(valStr); err == nil {
+		return val
+	}
+
+	log.Printf("config: valor inválido para %s, usando default %t\n", key, defaultValue)
+	return defaultValue
+}
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	valStr := getEnv(key, "")
+	if valStr == "" {
+		return defaultValue
+	}
+
+	if val, err := time.ParseDuration(valStr); err == nil {
+		return val
+	}
+
+	log.Printf("config: valor inválido para %s, usando default %s\n", key, defaultValue)
+	return defaultValue
+}
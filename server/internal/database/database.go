@@ -46,18 +46,87 @@ func New(dsn string) (*gorm.DB, error) {
 
 // AutoMigrate garante a criação das tabelas essenciais.
 func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
-		&models.Artist{},
-		&models.Token{},
-		&models.Price{},
-		&models.Candle{},
-		&models.Playlist{},
-		&models.User{},
-		&models.Wallet{},
-		&models.Trade{},
-		// Market Data models
-		&models.MarketDataCandle{},
-		&models.MarketDataTradeEvent{},
-		&models.MarketDataTicker24h{},
-	)
+	if err := db.AutoMigrate(allModels...); err != nil {
+		return err
+	}
+	return widenDecimalColumns(db)
+}
+
+var allModels = []interface{}{
+	&models.Artist{},
+	&models.Token{},
+	&models.Price{},
+	&models.Candle{},
+	&models.Playlist{},
+	&models.User{},
+	&models.Wallet{},
+	&models.Trade{},
+	// Market Data models
+	&models.MarketDataCandle{},
+	&models.MarketDataTradeEvent{},
+	&models.MarketDataTicker24h{},
+	// Matching engine
+	&models.ExchangeOrder{},
+	&models.ExchangeFill{},
+	&models.ExchangeOrderGroup{},
+	&models.MarketInstrument{},
+	&models.FeeVolume{},
+	// Wallet engine
+	&models.WalletAsset{},
+	&models.WalletAccount{},
+	&models.WalletBalance{},
+	&models.LedgerEntry{},
+	&models.DepositRequest{},
+	&models.WithdrawalRequest{},
+	// Clearing / pós-trade
+	&models.ClearingPosition{},
+	&models.ClearingTrade{},
+	&models.SettlementBatch{},
+	&models.SettlementObligation{},
+	&models.PostTradeDeadLetter{},
+	// Listagens e ofertas primárias
+	&models.ListingApplication{},
+	&models.Offering{},
+	&models.OfferingBid{},
+}
+
+// decimalColumnType é o tipo das colunas de decimal.Decimal: 19 dígitos com 8
+// casas comportam toda a faixa do int64 interno.
+const decimalColumnType = "numeric(19,8)"
+
+// widenDecimalColumns alarga para numeric(19,8) as colunas decimais criadas
+// com tipos antigos (numeric(12,4), numeric(18,8)). O AutoMigrate do GORM não
+// altera colunas cujo tipo só difere na precisão declarada em type:.
+func widenDecimalColumns(db *gorm.DB) error {
+	for _, model := range allModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		columns, err := db.Migrator().ColumnTypes(model)
+		if err != nil {
+			return err
+		}
+		current := make(map[string]gorm.ColumnType, len(columns))
+		for _, col := range columns {
+			current[col.Name()] = col
+		}
+		for _, field := range stmt.Schema.Fields {
+			if string(field.DataType) != decimalColumnType {
+				continue
+			}
+			col, ok := current[field.DBName]
+			if !ok {
+				continue
+			}
+			if precision, scale, ok := col.DecimalSize(); ok && precision == 19 && scale == 8 {
+				continue
+			}
+			log.Printf("[Database] widening %s.%s to %s", stmt.Schema.Table, field.DBName, decimalColumnType)
+			if err := db.Migrator().AlterColumn(model, field.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
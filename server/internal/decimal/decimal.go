@@ -0,0 +1,502 @@
+// Package decimal implementa o número de ponto fixo usado para preços,
+// quantidades e saldos: um int64 em unidades de 10^-Scale. Soma, subtração e
+// comparação são exatas; Mul e Div arredondam para Scale casas (meio para
+// longe do zero) com intermediário de 128 bits. A faixa representável é
+// ±92.233.720.368,54775807 (cabe em numeric(19,8)).
+//
+// Nenhuma operação dá a volta silenciosamente: as versões Checked* devolvem
+// ErrOverflow e as demais entram em pânico com ErrOverflow. Código que opera
+// sobre valores vindos de fora (ordens, JSON, banco) usa as versões Checked*;
+// JSON e Scan já devolvem ErrOverflow fora da faixa.
+package decimal
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Scale é o número de casas decimais guardadas internamente; a precisão de
+// cada ativo (Asset.Decimals) é aplicada com Round/Truncate.
+const Scale = 8
+
+const unit = 100000000 // 10^Scale
+
+var (
+	ErrInvalid  = errors.New("decimal: invalid number")
+	ErrOverflow = errors.New("decimal: overflow")
+)
+
+var pow10 = [...]int64{1, 10, 100, 1000, 10000, 100000, 1000000, 10000000, 100000000}
+
+// Decimal é comparável com == e pode ser chave de map.
+type Decimal struct {
+	units int64
+}
+
+var (
+	Zero = Decimal{}
+	One  = Decimal{unit}
+)
+
+// FromUnits cria um Decimal a partir de unidades de 10^-Scale.
+func FromUnits(units int64) Decimal { return Decimal{units} }
+
+// FromInt cria um Decimal inteiro.
+func FromInt(n int64) Decimal { return FromUnits(unit).MulInt(n) }
+
+// FromFloat converte um float64, arredondando para Scale casas. Serve para
+// fatores e configurações; valores de dinheiro devem vir de Parse.
+func FromFloat(f float64) Decimal {
+	return must(CheckedFromFloat(f))
+}
+
+// CheckedFromFloat é FromFloat que devolve ErrOverflow fora da faixa (e
+// ErrInvalid para NaN).
+func CheckedFromFloat(f float64) (Decimal, error) {
+	if math.IsNaN(f) {
+		return Zero, ErrInvalid
+	}
+	u := math.Round(f * unit)
+	// 2^63 é exatamente representável; qualquer float >= ele não cabe
+	if u >= math.MaxInt64 || u < math.MinInt64 {
+		return Zero, ErrOverflow
+	}
+	return Decimal{int64(u)}, nil
+}
+
+// Parse lê a representação decimal ("-12.345"); mais de Scale casas é erro.
+func Parse(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Zero, ErrInvalid
+	}
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return Zero, ErrInvalid
+	}
+	if len(fracPart) > Scale {
+		// aceita zeros à direita além da escala (ex.: numeric(38,18))
+		if strings.Trim(fracPart[Scale:], "0") != "" {
+			return Zero, ErrInvalid
+		}
+		fracPart = fracPart[:Scale]
+	}
+
+	var whole, frac int64
+	var err error
+	if intPart != "" {
+		if intPart[0] == '-' || intPart[0] == '+' {
+			return Zero, ErrInvalid
+		}
+		if whole, err = strconv.ParseInt(intPart, 10, 64); err != nil {
+			if errors.Is(err, strconv.ErrRange) {
+				return Zero, ErrOverflow
+			}
+			return Zero, ErrInvalid
+		}
+	}
+	if fracPart != "" {
+		if frac, err = strconv.ParseInt(fracPart, 10, 64); err != nil || fracPart[0] == '-' || fracPart[0] == '+' {
+			return Zero, ErrInvalid
+		}
+		frac *= pow10[Scale-len(fracPart)]
+	}
+	if whole > (math.MaxInt64-frac)/unit {
+		return Zero, ErrOverflow
+	}
+	units := whole*unit + frac
+	if neg {
+		units = -units
+	}
+	return Decimal{units}, nil
+}
+
+// RequireFromString é Parse que entra em pânico; para constantes.
+func RequireFromString(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(fmt.Sprintf("decimal: %q: %v", s, err))
+	}
+	return d
+}
+
+// Units devolve o valor em unidades de 10^-Scale.
+func (d Decimal) Units() int64 { return d.units }
+
+func (d Decimal) Add(o Decimal) Decimal { return must(d.CheckedAdd(o)) }
+func (d Decimal) Sub(o Decimal) Decimal { return must(d.CheckedSub(o)) }
+func (d Decimal) Neg() Decimal          { return Decimal{-d.units} }
+
+// CheckedAdd soma devolvendo ErrOverflow em vez de dar a volta.
+func (d Decimal) CheckedAdd(o Decimal) (Decimal, error) {
+	sum := d.units + o.units
+	if (sum > d.units) != (o.units > 0) {
+		return Zero, ErrOverflow
+	}
+	return Decimal{sum}, nil
+}
+
+// CheckedSub subtrai devolvendo ErrOverflow em vez de dar a volta.
+func (d Decimal) CheckedSub(o Decimal) (Decimal, error) {
+	diff := d.units - o.units
+	if (diff < d.units) != (o.units > 0) {
+		return Zero, ErrOverflow
+	}
+	return Decimal{diff}, nil
+}
+
+func (d Decimal) Abs() Decimal {
+	if d.units < 0 {
+		return d.Neg()
+	}
+	return d
+}
+
+// Mul multiplica arredondando para Scale casas.
+func (d Decimal) Mul(o Decimal) Decimal { return must(d.CheckedMul(o)) }
+
+// CheckedMul é Mul que devolve ErrOverflow quando o produto sai da faixa.
+func (d Decimal) CheckedMul(o Decimal) (Decimal, error) {
+	u, err := muldiv(d.units, o.units, unit, true)
+	return Decimal{u}, err
+}
+
+// MulInt multiplica por um inteiro (exato).
+func (d Decimal) MulInt(n int64) Decimal {
+	hi, lo := bits.Mul64(abs64(d.units), abs64(n))
+	neg := (d.units < 0) != (n < 0)
+	if hi != 0 || lo > math.MaxInt64 && !(neg && lo == 1<<63) {
+		panic(ErrOverflow)
+	}
+	if neg {
+		return Decimal{int64(-lo)}
+	}
+	return Decimal{int64(lo)}
+}
+
+// Div divide arredondando para Scale casas. Divisão por zero entra em pânico.
+func (d Decimal) Div(o Decimal) Decimal { return must(d.CheckedDiv(o)) }
+
+// CheckedDiv é Div que devolve ErrInvalid na divisão por zero e ErrOverflow
+// quando o quociente sai da faixa.
+func (d Decimal) CheckedDiv(o Decimal) (Decimal, error) {
+	if o.units == 0 {
+		return Zero, ErrInvalid
+	}
+	u, err := muldiv(d.units, unit, o.units, true)
+	return Decimal{u}, err
+}
+
+// DivTrunc divide truncando em direção ao zero: o maior quociente cujo
+// produto pelo divisor não excede d (ex.: quantidade que cabe num orçamento).
+func (d Decimal) DivTrunc(o Decimal) Decimal {
+	if o.units == 0 {
+		panic("decimal: division by zero")
+	}
+	return Decimal{mustUnits(muldiv(d.units, unit, o.units, false))}
+}
+
+// MulDivTrunc calcula d*num/den truncando, sem arredondar o produto
+// intermediário (rateios que não podem exceder o total).
+func (d Decimal) MulDivTrunc(num, den Decimal) Decimal {
+	if den.units == 0 {
+		panic("decimal: division by zero")
+	}
+	return Decimal{mustUnits(muldiv(d.units, num.units, den.units, false))}
+}
+
+// MulFloat aplica um fator float64 (percentuais, proporções).
+func (d Decimal) MulFloat(f float64) Decimal { return d.Mul(FromFloat(f)) }
+
+// QuoFloat devolve d/o como float64, para razões e percentuais.
+func (d Decimal) QuoFloat(o Decimal) float64 {
+	return float64(d.units) / float64(o.units)
+}
+
+// muldiv calcula a*b/c com intermediário de 128 bits; round arredonda o
+// meio para longe do zero, senão trunca.
+func muldiv(a, b, c int64, round bool) (int64, error) {
+	neg := (a < 0) != (b < 0) != (c < 0)
+	ua, ub, uc := abs64(a), abs64(b), abs64(c)
+
+	hi, lo := bits.Mul64(ua, ub)
+	if hi >= uc {
+		return 0, ErrOverflow
+	}
+	q, r := bits.Div64(hi, lo, uc)
+	if round && r >= uc-r {
+		q++
+	}
+	if q > math.MaxInt64 {
+		return 0, ErrOverflow
+	}
+	if neg {
+		return -int64(q), nil
+	}
+	return int64(q), nil
+}
+
+// must e mustUnits convertem o erro das versões Checked* no pânico das
+// operações sem erro.
+func must(d Decimal, err error) Decimal {
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func mustUnits(u int64, err error) int64 {
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func abs64(n int64) uint64 {
+	if n < 0 {
+		return uint64(-n)
+	}
+	return uint64(n)
+}
+
+// Round arredonda para places casas (meio para longe do zero).
+func (d Decimal) Round(places int32) Decimal {
+	if places >= Scale {
+		return d
+	}
+	if places < 0 {
+		places = 0
+	}
+	step := pow10[Scale-places]
+	r := d.units % step
+	units := d.units - r
+	switch {
+	case r >= step-r && r > 0:
+		units += step
+	case -r >= step+r && r < 0:
+		units -= step
+	}
+	return Decimal{units}
+}
+
+// Truncate corta para places casas, em direção ao zero.
+func (d Decimal) Truncate(places int32) Decimal {
+	if places >= Scale {
+		return d
+	}
+	if places < 0 {
+		places = 0
+	}
+	step := pow10[Scale-places]
+	return Decimal{d.units - d.units%step}
+}
+
+// Floor arredonda para baixo no múltiplo de step (ex.: tick de preço).
+func (d Decimal) Floor(step Decimal) Decimal {
+	if step.units <= 0 {
+		return d
+	}
+	r := d.units % step.units
+	if r < 0 {
+		r += step.units
+	}
+	return Decimal{d.units - r}
+}
+
+// Ceil arredonda para cima no múltiplo de step.
+func (d Decimal) Ceil(step Decimal) Decimal {
+	if step.units <= 0 {
+		return d
+	}
+	return d.Neg().Floor(step).Neg()
+}
+
+// IsMultipleOf indica se d é múltiplo exato de step.
+func (d Decimal) IsMultipleOf(step Decimal) bool {
+	return step.units == 0 || d.units%step.units == 0
+}
+
+func (d Decimal) Cmp(o Decimal) int {
+	switch {
+	case d.units < o.units:
+		return -1
+	case d.units > o.units:
+		return 1
+	}
+	return 0
+}
+
+func (d Decimal) Sign() int                         { return d.Cmp(Zero) }
+func (d Decimal) IsZero() bool                      { return d.units == 0 }
+func (d Decimal) IsPositive() bool                  { return d.units > 0 }
+func (d Decimal) IsNegative() bool                  { return d.units < 0 }
+func (d Decimal) Equal(o Decimal) bool              { return d.units == o.units }
+func (d Decimal) LessThan(o Decimal) bool           { return d.units < o.units }
+func (d Decimal) LessThanOrEqual(o Decimal) bool    { return d.units <= o.units }
+func (d Decimal) GreaterThan(o Decimal) bool        { return d.units > o.units }
+func (d Decimal) GreaterThanOrEqual(o Decimal) bool { return d.units >= o.units }
+
+func Min(a, b Decimal) Decimal {
+	if a.units < b.units {
+		return a
+	}
+	return b
+}
+
+func Max(a, b Decimal) Decimal {
+	if a.units > b.units {
+		return a
+	}
+	return b
+}
+
+// Float64 converte para float64 (exibição e estatísticas).
+func (d Decimal) Float64() float64 {
+	return float64(d.units) / unit
+}
+
+// String devolve a forma canônica, sem zeros à direita ("12.5", "-0.001").
+func (d Decimal) String() string {
+	u := abs64(d.units)
+	whole, frac := u/unit, u%unit
+
+	var b strings.Builder
+	if d.units < 0 {
+		b.WriteByte('-')
+	}
+	b.WriteString(strconv.FormatUint(whole, 10))
+	if frac != 0 {
+		digits := strconv.FormatUint(frac, 10)
+		b.WriteByte('.')
+		b.WriteString(strings.Repeat("0", Scale-len(digits)))
+		b.WriteString(strings.TrimRight(digits, "0"))
+	}
+	return b.String()
+}
+
+// StringFixed formata com exatamente places casas (arredondando).
+func (d Decimal) StringFixed(places int32) string {
+	s := d.Round(places).String()
+	if places <= 0 {
+		return s
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	return whole + "." + frac + strings.Repeat("0", int(places)-len(frac))
+}
+
+// MarshalJSON grava como número JSON sem aspas, preservando os dígitos.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON aceita número ou string; notação científica é convertida
+// sem float e, como em Parse, casas além de Scale são erro.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		*d = Zero
+		return nil
+	}
+	s = strings.Trim(s, `"`)
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		if s, err = shiftExponent(s[:i], s[i+1:]); err != nil {
+			return err
+		}
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// maxExponent limita o expoente aceito em notação científica: além dele
+// nenhum valor não nulo cabe na faixa nem na escala.
+const maxExponent = 40
+
+// shiftExponent reescreve mantissa×10^exp sem expoente, deslocando a vírgula
+// nos dígitos; o resultado segue para Parse, sem passar por float.
+func shiftExponent(mantissa, exp string) (string, error) {
+	e, err := strconv.Atoi(exp)
+	if err != nil {
+		return "", ErrInvalid
+	}
+	if e > maxExponent || e < -maxExponent {
+		return "", ErrOverflow
+	}
+
+	sign := ""
+	if mantissa != "" && (mantissa[0] == '-' || mantissa[0] == '+') {
+		sign, mantissa = mantissa[:1], mantissa[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(mantissa, ".")
+	if intPart == "" && fracPart == "" {
+		return "", ErrInvalid
+	}
+	digits := intPart + fracPart
+	point := len(intPart) + e
+	if point < 0 {
+		digits = strings.Repeat("0", -point) + digits
+		point = 0
+	}
+	if point > len(digits) {
+		digits += strings.Repeat("0", point-len(digits))
+	}
+	return sign + "0" + digits[:point] + "." + digits[point:], nil
+}
+
+// Value grava como texto para colunas numeric, sem passar por float.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Scan lê colunas numeric (texto) e, por compatibilidade, float/int.
+func (d *Decimal) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*d = Zero
+	case []byte:
+		return d.Scan(string(v))
+	case string:
+		p, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*d = p
+	case float64:
+		f, err := CheckedFromFloat(v)
+		if err != nil {
+			return err
+		}
+		*d = f
+	case int64:
+		if v > math.MaxInt64/unit || v < math.MinInt64/unit {
+			return ErrOverflow
+		}
+		*d = FromInt(v)
+	default:
+		return fmt.Errorf("decimal: cannot scan %T", src)
+	}
+	return nil
+}
+
+// GormDataType define o tipo padrão da coluna quando o modelo não usa a tag type.
+func (Decimal) GormDataType() string {
+	return "numeric(19,8)"
+}
@@ -0,0 +1,185 @@
+package decimal
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+var (
+	maxDec = FromUnits(math.MaxInt64)
+	minDec = FromUnits(math.MinInt64)
+)
+
+func TestCheckedOverflow(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func() (Decimal, error)
+		want string
+		err  error
+	}{
+		{"add", func() (Decimal, error) { return RequireFromString("1.5").CheckedAdd(RequireFromString("2.25")) }, "3.75", nil},
+		{"add past max", func() (Decimal, error) { return maxDec.CheckedAdd(FromUnits(1)) }, "", ErrOverflow},
+		{"add past min", func() (Decimal, error) { return minDec.CheckedAdd(FromUnits(-1)) }, "", ErrOverflow},
+		{"sub", func() (Decimal, error) { return RequireFromString("1").CheckedSub(RequireFromString("2.5")) }, "-1.5", nil},
+		{"sub past min", func() (Decimal, error) { return minDec.CheckedSub(FromUnits(1)) }, "", ErrOverflow},
+		{"sub past max", func() (Decimal, error) { return maxDec.CheckedSub(FromUnits(-1)) }, "", ErrOverflow},
+		{"mul rounds half away", func() (Decimal, error) { return RequireFromString("0.00000001").CheckedMul(RequireFromString("0.5")) }, "0.00000001", nil},
+		{"mul negative", func() (Decimal, error) { return RequireFromString("-1.5").CheckedMul(RequireFromString("2")) }, "-3", nil},
+		{"mul past max", func() (Decimal, error) { return maxDec.CheckedMul(RequireFromString("2")) }, "", ErrOverflow},
+		{"mul of large", func() (Decimal, error) {
+			return RequireFromString("10000000000").CheckedMul(RequireFromString("10000000000"))
+		}, "", ErrOverflow},
+		{"div", func() (Decimal, error) { return RequireFromString("1").CheckedDiv(RequireFromString("3")) }, "0.33333333", nil},
+		{"div rounds", func() (Decimal, error) { return RequireFromString("2").CheckedDiv(RequireFromString("3")) }, "0.66666667", nil},
+		{"div by zero", func() (Decimal, error) { return One.CheckedDiv(Zero) }, "", ErrInvalid},
+		{"div past max", func() (Decimal, error) { return maxDec.CheckedDiv(RequireFromString("0.5")) }, "", ErrOverflow},
+		{"from float", func() (Decimal, error) { return CheckedFromFloat(0.1) }, "0.1", nil},
+		{"from float past max", func() (Decimal, error) { return CheckedFromFloat(1e11) }, "", ErrOverflow},
+		{"from NaN", func() (Decimal, error) { return CheckedFromFloat(math.NaN()) }, "", ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.op()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && got.String() != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUncheckedOverflowPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func()
+	}{
+		{"add", func() { maxDec.Add(FromUnits(1)) }},
+		{"sub", func() { minDec.Sub(FromUnits(1)) }},
+		{"mul", func() { maxDec.Mul(RequireFromString("1.1")) }},
+		{"mul int", func() { maxDec.MulInt(2) }},
+		{"div trunc", func() { maxDec.DivTrunc(RequireFromString("0.1")) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != ErrOverflow {
+					t.Fatalf("recovered %v, want ErrOverflow", r)
+				}
+			}()
+			tt.op()
+		})
+	}
+}
+
+func TestMulDivTrunc(t *testing.T) {
+	tests := []struct {
+		d, num, den, want string
+	}{
+		// rateio de 10 em três partes: a soma não passa do total
+		{"10", "1", "3", "3.33333333"},
+		{"10", "2", "3", "6.66666666"},
+		// produto intermediário fora da faixa, resultado dentro
+		{"90000000000", "90000000000", "90000000000", "90000000000"},
+		{"-10", "1", "3", "-3.33333333"},
+		{"0.00000001", "1", "2", "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.d+"*"+tt.num+"/"+tt.den, func(t *testing.T) {
+			got := RequireFromString(tt.d).MulDivTrunc(RequireFromString(tt.num), RequireFromString(tt.den))
+			if got.String() != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFloorCeil(t *testing.T) {
+	tests := []struct {
+		d, step, floor, ceil string
+	}{
+		{"10.37", "0.05", "10.35", "10.4"},
+		{"10.35", "0.05", "10.35", "10.35"},
+		{"-10.37", "0.05", "-10.4", "-10.35"},
+		{"0.00000007", "0.0000001", "0", "0.0000001"},
+		{"3.7", "1", "3", "4"},
+		// passo zero não arredonda
+		{"3.7", "0", "3.7", "3.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.d+"/"+tt.step, func(t *testing.T) {
+			d, step := RequireFromString(tt.d), RequireFromString(tt.step)
+			if got := d.Floor(step); got.String() != tt.floor {
+				t.Errorf("Floor = %s, want %s", got, tt.floor)
+			}
+			if got := d.Ceil(step); got.String() != tt.ceil {
+				t.Errorf("Ceil = %s, want %s", got, tt.ceil)
+			}
+		})
+	}
+}
+
+func TestIsMultipleOf(t *testing.T) {
+	tests := []struct {
+		d, step string
+		want    bool
+	}{
+		{"10.35", "0.05", true},
+		{"10.37", "0.05", false},
+		{"-0.3", "0.1", true},
+		{"0", "0.01", true},
+		{"1.00000001", "0.00000001", true},
+		{"5", "0", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.d+"/"+tt.step, func(t *testing.T) {
+			if got := RequireFromString(tt.d).IsMultipleOf(RequireFromString(tt.step)); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{`12.5`, "12.5", nil},
+		{`"-0.001"`, "-0.001", nil},
+		{`null`, "0", nil},
+		{`"1.000000000000"`, "1", nil},
+		{`1e3`, "1000", nil},
+		{`"1.5E-3"`, "0.0015", nil},
+		{`-2.5e+2`, "-250", nil},
+		// 0.1 exato, sem o ruído de float64
+		{`1e-1`, "0.1", nil},
+		{`12345678.9e-8`, "", ErrInvalid},
+		{`1e-8`, "0.00000001", nil},
+		{`1e-9`, "", ErrInvalid},
+		{`1e11`, "", ErrOverflow},
+		{`1e400`, "", ErrOverflow},
+		{`"92233720369"`, "", ErrOverflow},
+		{`"99999999999999999999"`, "", ErrOverflow},
+		{`1.2.3`, "", ErrInvalid},
+		{`e5`, "", ErrInvalid},
+		{`1e`, "", ErrInvalid},
+		{`"abc"`, "", ErrInvalid},
+		{`"--1"`, "", ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var d Decimal
+			err := d.UnmarshalJSON([]byte(tt.in))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && d.String() != tt.want {
+				t.Fatalf("got %s, want %s", d, tt.want)
+			}
+		})
+	}
+}
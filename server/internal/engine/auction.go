@@ -0,0 +1,274 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
+
+var (
+	ErrMarketInAuction = errors.New("market is in auction: only resting orders are accepted")
+	ErrInvalidAuction  = errors.New("auction duration must be positive")
+)
+
+// AuctionConfig define os leilões automáticos. Deve ser igual entre reinícios
+// para que o replay do journal reproduza as reaberturas.
+type AuctionConfig struct {
+	// Opening é a duração do leilão de abertura de um mercado criado no
+	// InstrumentRegistry (ActivateListing); zero abre direto em negociação
+	// contínua.
+	Opening time.Duration
+	// Reopening é a duração do leilão de reabertura após um halt; zero
+	// reabre direto.
+	Reopening time.Duration
+}
+
+// SetAuctionConfig liga os leilões de abertura e reabertura.
+func (me *MatchingEngine) SetAuctionConfig(cfg AuctionConfig) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.auction = cfg
+}
+
+func (me *MatchingEngine) auctionConfig() AuctionConfig {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	return me.auction
+}
+
+// StartAuction coloca o símbolo em leilão por d: ordens que podem repousar
+// acumulam no book sem executar e o preço indicativo é publicado a cada
+// mudança. O uncross acontece em RunAuctions depois do prazo.
+func (me *MatchingEngine) StartAuction(symbol string, d time.Duration) error {
+	if d <= 0 {
+		return ErrInvalidAuction
+	}
+	return me.submit(symbol, command{kind: cmdSetStatus, status: MarketStatusAuction, now: time.Now().Add(d)}).err
+}
+
+// openMarket abre um mercado recém-criado, passando pelo leilão de abertura
+// quando configurado.
+func (me *MatchingEngine) openMarket(symbol string) error {
+	if d := me.auctionConfig().Opening; d > 0 {
+		return me.StartAuction(symbol, d)
+	}
+	return me.applyMarketStatus(symbol, MarketStatusOpen)
+}
+
+// RunAuctions faz o uncross dos leilões cujo prazo terminou até now e devolve
+// quantos foram encerrados.
+func (me *MatchingEngine) RunAuctions(now time.Time) int {
+	me.mu.RLock()
+	var due []string
+	for symbol, ends := range me.auctionEnds {
+		if !ends.After(now) {
+			due = append(due, symbol)
+		}
+	}
+	me.mu.RUnlock()
+
+	total := 0
+	for _, symbol := range due {
+		total += me.submit(symbol, command{kind: cmdUncross, now: now}).count
+	}
+	return total
+}
+
+// StartAuctionSweeper encerra periodicamente os leilões vencidos.
+func (me *MatchingEngine) StartAuctionSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				me.RunAuctions(now)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// ---- execução dentro do sequenciador do símbolo ----
+
+// auctionResult é o resultado do cálculo de equilíbrio do book.
+type auctionResult struct {
+	price     decimal.Decimal
+	matched   decimal.Decimal
+	imbalance decimal.Decimal
+	side      Side
+}
+
+// equilibrium calcula o preço de leilão entre os níveis do book: o que
+// maximiza o volume executável; no empate, o de menor desequilíbrio, depois
+// o mais próximo de ref (último preço negociado) e por fim o menor. Conta a
+// quantidade total das ordens, inclusive a parte oculta de icebergs.
+func (ob *OrderBook) equilibrium(ref decimal.Decimal) (auctionResult, bool) {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+
+	bid, ask := ob.bids.first(), ob.asks.first()
+	if bid == nil || ask == nil || bid.ticks < ask.ticks {
+		return auctionResult{}, false
+	}
+
+	var candidates []*priceLevel
+	for _, ladder := range []*priceLadder{ob.bids, ob.asks} {
+		for node := ladder.head.next[0]; node != nil; node = node.next[0] {
+			if node.level.ticks >= ask.ticks && node.level.ticks <= bid.ticks {
+				candidates = append(candidates, node.level)
+			}
+		}
+	}
+
+	var best auctionResult
+	found := false
+	for _, level := range candidates {
+		var buy, sell decimal.Decimal
+		for node := ob.bids.head.next[0]; node != nil && node.level.ticks >= level.ticks; node = node.next[0] {
+			buy = buy.Add(node.level.remainingQty())
+		}
+		for node := ob.asks.head.next[0]; node != nil && node.level.ticks <= level.ticks; node = node.next[0] {
+			sell = sell.Add(node.level.remainingQty())
+		}
+
+		res := auctionResult{price: level.Price, matched: decimal.Min(buy, sell)}
+		switch {
+		case buy.GreaterThan(sell):
+			res.imbalance, res.side = buy.Sub(sell), SideBuy
+		case sell.GreaterThan(buy):
+			res.imbalance, res.side = sell.Sub(buy), SideSell
+		}
+		if !found || res.better(best, ref) {
+			best, found = res, true
+		}
+	}
+	return best, found
+}
+
+func (r auctionResult) better(than auctionResult, ref decimal.Decimal) bool {
+	if r.matched != than.matched {
+		return r.matched.GreaterThan(than.matched)
+	}
+	if r.imbalance != than.imbalance {
+		return r.imbalance.LessThan(than.imbalance)
+	}
+	if ref.IsPositive() {
+		d, dt := r.price.Sub(ref).Abs(), than.price.Sub(ref).Abs()
+		if d != dt {
+			return d.LessThan(dt)
+		}
+	}
+	return r.price.LessThan(than.price)
+}
+
+// enterAuction inicia o leilão até ends; a fila de um halt entra no book sem
+// executar.
+func (m *market) enterAuction(ends time.Time) {
+	m.auctionEnds = ends
+	if len(m.queued) > 0 {
+		m.releaseQueued()
+		return
+	}
+	m.publishIndicative()
+}
+
+// publishIndicative publica o preço indicativo e o desequilíbrio atuais.
+func (m *market) publishIndicative() {
+	res, _ := m.book.equilibrium(m.lastPrice)
+	ind := AuctionIndicative{
+		Symbol:        m.symbol,
+		Seq:           m.nextSeq(),
+		Price:         res.price,
+		MatchedQty:    res.matched,
+		ImbalanceQty:  res.imbalance,
+		ImbalanceSide: res.side,
+		EndsAt:        m.auctionEnds,
+		Timestamp:     time.Now(),
+	}
+	if m.marketData != nil {
+		m.marketData.OnAuctionIndicative(ind)
+	}
+}
+
+// uncross executa o leilão: todas as ordens que cruzam o preço de equilíbrio
+// executam a esse preço único, em prioridade preço-tempo. Em cada trade a
+// ordem mais recente é a agressora. Com announce, o resultado é publicado
+// como indicativo final (EndsAt zerado).
+func (m *market) uncross(announce bool) {
+	res, ok := m.book.equilibrium(m.lastPrice)
+	var matched decimal.Decimal
+	limit := priceToTicks(res.price)
+
+	for ok {
+		m.book.mu.Lock()
+		bid, ask := m.book.bids.first(), m.book.asks.first()
+		if bid == nil || ask == nil || bid.ticks < limit || ask.ticks > limit {
+			m.book.mu.Unlock()
+			break
+		}
+
+		buy, sell := bid.head, ask.head
+		taker, maker := buy, sell
+		if sell.CreatedAt.After(buy.CreatedAt) {
+			taker, maker = sell, buy
+		}
+		if taker.STP != STPNone && buy.UserID == sell.UserID {
+			m.book.mu.Unlock()
+			m.preventSelfTrade(taker, maker)
+			continue
+		}
+
+		qty := decimal.Min(buy.RemainingQty(), sell.RemainingQty())
+		for _, o := range []*Order{buy, sell} {
+			o.FilledQty = o.FilledQty.Add(qty)
+			if o.RemainingQty().IsZero() {
+				o.Status = OrderStatusFilled
+				m.book.unlinkLocked(o)
+			} else {
+				o.Status = OrderStatusPartFilled
+				m.book.consumeVisibleLocked(o, qty)
+			}
+		}
+		m.book.mu.Unlock()
+
+		for _, o := range []*Order{buy, sell} {
+			if o.Status == OrderStatusFilled {
+				m.forgetOrder(o)
+			}
+		}
+		m.recordTrade(taker, maker, res.price, qty)
+		matched = matched.Add(qty)
+	}
+
+	m.publishBook()
+	if !announce {
+		return
+	}
+	final := AuctionIndicative{
+		Symbol:     m.symbol,
+		Seq:        m.nextSeq(),
+		MatchedQty: matched,
+		Timestamp:  time.Now(),
+	}
+	if matched.IsPositive() {
+		final.Price = res.price
+	}
+	if m.marketData != nil {
+		m.marketData.OnAuctionIndicative(final)
+	}
+}
+
+// uncrossDue encerra o leilão em curso se o prazo terminou até now.
+func (m *market) uncrossDue(now time.Time) int {
+	if m.status != MarketStatusAuction || m.auctionEnds.After(now) {
+		return 0
+	}
+	if err := m.setStatus(MarketStatusOpen, now); err != nil {
+		return 0
+	}
+	return 1
+}
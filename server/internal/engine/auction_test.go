@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAuctionUncrossesAtSinglePrice(t *testing.T) {
+	me, repo, balances := newTestEngine(t)
+	fund(balances, "alice", "AAA")
+	fund(balances, "bob", "AAA")
+	if err := me.StartAuction("AAA", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	mustPlace(t, me, limit("bob", "AAA", SideBuy, "11", "2"))
+	mustPlace(t, me, limit("bob", "AAA", SideBuy, "10", "2"))
+	mustPlace(t, me, limit("alice", "AAA", SideSell, "9", "1"))
+	mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "2"))
+	if _, err := me.PlaceOrder(marketBuy("bob", "AAA", "1", "")); !errors.Is(err, ErrMarketInAuction) {
+		t.Fatalf("MARKET during auction err = %v, want ErrMarketInAuction", err)
+	}
+	if n := repo.tradeCount(); n != 0 {
+		t.Fatalf("trades before the uncross = %d, want 0", n)
+	}
+
+	if n := me.RunAuctions(time.Now()); n != 0 {
+		t.Fatalf("auctions closed before the deadline = %d, want 0", n)
+	}
+	if n := me.RunAuctions(time.Now().Add(2 * time.Hour)); n != 1 {
+		t.Fatalf("auctions closed = %d, want 1", n)
+	}
+
+	// 10 maximiza o volume: 4 de compra contra 3 de venda
+	total := d("0")
+	for _, tr := range repo.tradeList() {
+		if !tr.Price.Equal(d("10")) {
+			t.Fatalf("trade at %s, want every trade at 10", tr.Price)
+		}
+		total = total.Add(tr.Quantity)
+	}
+	if !total.Equal(d("3")) {
+		t.Fatalf("matched %s, want 3", total)
+	}
+	if status, _ := me.GetMarketStatus("AAA"); status != MarketStatusOpen {
+		t.Fatalf("status after uncross = %s, want OPEN", status)
+	}
+}
+
+func TestAuctionUncrossConsumesIcebergSlice(t *testing.T) {
+	tests := []struct {
+		name    string
+		display string
+		buy     string
+		// fatia visível do iceberg depois do uncross e se ele perdeu a
+		// prioridade para a ordem comum do mesmo nível
+		visible   string
+		requeued  bool
+		depthAsks string
+	}{
+		{"partial slice", "4", "3", "1", false, "2"},
+		{"slice consumed", "2", "5", "2", true, "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			me, repo, balances := newTestEngine(t)
+			for _, u := range []string{"ice", "plain", "bob"} {
+				fund(balances, u, "AAA")
+			}
+			if err := me.StartAuction("AAA", time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			req := limit("ice", "AAA", SideSell, "10", "10")
+			req.DisplayQty = d(tt.display)
+			ice := mustPlace(t, me, req)
+			plain := mustPlace(t, me, limit("plain", "AAA", SideSell, "10", "1"))
+			mustPlace(t, me, limit("bob", "AAA", SideBuy, "10", tt.buy))
+			me.RunAuctions(time.Now().Add(2 * time.Hour))
+
+			if got := repo.order(ice.ID); !got.FilledQty.Equal(d(tt.buy)) || !got.VisibleQty.Equal(d(tt.visible)) {
+				t.Fatalf("iceberg filled %s visible %s, want %s and %s", got.FilledQty, got.VisibleQty, tt.buy, tt.visible)
+			}
+			snap := me.GetOrderBookSnapshot("AAA", 5)
+			if len(snap.Asks) != 1 || !snap.Asks[0].Quantity.Equal(d(tt.depthAsks)) {
+				t.Fatalf("asks = %+v, want %s visible at 10", snap.Asks, tt.depthAsks)
+			}
+
+			mustPlace(t, me, limit("bob", "AAA", SideBuy, "10", "1"))
+			plainFilled := repo.order(plain.ID).Status == OrderStatusFilled
+			if plainFilled != tt.requeued {
+				t.Fatalf("plain order filled first = %v, want %v", plainFilled, tt.requeued)
+			}
+		})
+	}
+}
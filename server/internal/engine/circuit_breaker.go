@@ -3,6 +3,8 @@ package engine
 import (
 	"sync"
 	"time"
+
+	"hearcap/server/internal/decimal"
 )
 
 type CircuitBreakerEngine struct {
@@ -25,7 +27,7 @@ func NewCircuitBreakerEngine(cfg RiskConfig, marketRepo MarketStatusRepository,
 	}
 }
 
-func (c *CircuitBreakerEngine) OnTradeTick(symbol string, price float64, t time.Time) error {
+func (c *CircuitBreakerEngine) OnTradeTick(symbol string, price decimal.Decimal, t time.Time) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -55,16 +57,12 @@ func (c *CircuitBreakerEngine) OnTradeTick(symbol string, price float64, t time.
 	first := filtered[0].Price
 	low, high := first, first
 	for _, tick := range filtered {
-		if tick.Price < low {
-			low = tick.Price
-		}
-		if tick.Price > high {
-			high = tick.Price
-		}
+		low = decimal.Min(low, tick.Price)
+		high = decimal.Max(high, tick.Price)
 	}
 
-	moveUp := (high - first) / first * 100
-	moveDown := (first - low) / first * 100
+	moveUp := high.Sub(first).QuoFloat(first) * 100
+	moveDown := first.Sub(low).QuoFloat(first) * 100
 
 	if moveUp >= c.cfg.CircuitBreakerMovePercent || moveDown >= c.cfg.CircuitBreakerMovePercent {
 		until := t.Add(c.cfg.CircuitBreakerHaltTime)
@@ -2,15 +2,40 @@ package engine
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
 	"time"
 
+	"hearcap/server/internal/calendar"
+	"hearcap/server/internal/decimal"
+
 	"github.com/google/uuid"
 )
 
+// ErrBatchNotFound indica lote de liquidação inexistente.
+var ErrBatchNotFound = errors.New("settlement batch not found")
+
 type ClearingConfig struct {
-	Mode               SettlementMode
-	SettlementDelay    time.Duration
+	Mode SettlementMode
+	// SettlementDays é o ciclo T+N, contado em dias úteis de Calendar.
+	SettlementDays int
+	// Calendar define os dias úteis da liquidação (padrão:
+	// calendar.Continuous, todo dia é útil).
+	Calendar           *calendar.Calendar
 	EnableInstantChain bool
+	// BaseAssets/QuoteAssets mapeiam símbolo → ativo para o netting. Sem
+	// entrada, "BASE/QUOTE" é separado na barra e um símbolo simples usa
+	// DefaultQuote (padrão: símbolo + "_QUOTE").
+	BaseAssets   map[string]string
+	QuoteAssets  map[string]string
+	DefaultQuote string
+	// Fails é a política para obrigações não liquidadas (settlement_fails.go).
+	Fails FailsConfig
+	// FeeAccount é o participante que recebe as taxas dos trades (e paga os
+	// rebates) na liquidação. Obrigatório quando há FeeEngine.
+	FeeAccount string
 }
 
 type ClearingEngine struct {
@@ -18,10 +43,15 @@ type ClearingEngine struct {
 	custody    CustodyService
 	blockchain BlockchainService
 	eventBus   EventBus
+	prices     PriceFeed
 	config     ClearingConfig
 }
 
 func NewClearingEngine(repo ClearingRepository, custody CustodyService, blockchain BlockchainService, eventBus EventBus, cfg ClearingConfig) *ClearingEngine {
+	cfg.Fails = cfg.Fails.withDefaults()
+	if cfg.Calendar == nil {
+		cfg.Calendar = calendar.Continuous()
+	}
 	return &ClearingEngine{
 		repo:       repo,
 		custody:    custody,
@@ -31,60 +61,102 @@ func NewClearingEngine(repo ClearingRepository, custody CustodyService, blockcha
 	}
 }
 
+// OnTrade soma o trade às posições do comprador e do vendedor. As taxas do
+// trade (FeeEngine) são líquidas nas pernas em quote: o comprador entrega o
+// notional mais a sua taxa, o vendedor recebe o notional menos a sua, e a
+// soma vai para a posição de FeeAccount. Sem taxas nada muda.
+//
+// Os deltas entram de uma vez e marcados pelo ID do trade (ApplyTrade): uma
+// retentativa do pós-trade depois de uma falha não soma o trade de novo.
 func (ce *ClearingEngine) OnTrade(trade *Trade, buyUserID, sellUserID string) error {
 	settlementDate := ce.calcSettlementDate(trade.CreatedAt)
-	baseAsset, quoteAsset := parseSymbol(trade.Symbol)
+	baseAsset, quoteAsset := ce.assetsOf(trade.Symbol)
 
 	baseQty := trade.Quantity
-	quoteQty := trade.Price * trade.Quantity
+	quoteQty := trade.Price.Mul(trade.Quantity)
+	fees := trade.BuyerFee.Add(trade.SellerFee)
+	if !trade.BuyerFee.IsZero() || !trade.SellerFee.IsZero() {
+		if trade.FeeAsset != quoteAsset {
+			return fmt.Errorf("trade %s: fee asset %s is not the settlement asset %s", trade.ID, trade.FeeAsset, quoteAsset)
+		}
+		if ce.config.FeeAccount == "" {
+			return fmt.Errorf("trade %s: fees without a clearing fee account", trade.ID)
+		}
+	}
 
-	if err := ce.addToPosition(buyUserID, trade.Symbol, settlementDate, baseQty, -quoteQty); err != nil {
-		return err
+	now := time.Now()
+	delta := func(userID string, base, quote decimal.Decimal) *ClearingPosition {
+		return &ClearingPosition{
+			ID:             uuid.NewString(),
+			UserID:         userID,
+			Symbol:         trade.Symbol,
+			SettlementDate: settlementDate,
+			BaseDelta:      base,
+			QuoteDelta:     quote,
+			Status:         SettlementStatusPending,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
 	}
-	if err := ce.addToPosition(sellUserID, trade.Symbol, settlementDate, -baseQty, quoteQty); err != nil {
+	deltas := []*ClearingPosition{
+		delta(buyUserID, baseQty, quoteQty.Add(trade.BuyerFee).Neg()),
+		delta(sellUserID, baseQty.Neg(), quoteQty.Sub(trade.SellerFee)),
+	}
+	if !fees.IsZero() {
+		deltas = append(deltas, delta(ce.config.FeeAccount, decimal.Zero, fees))
+	}
+	applied, err := ce.repo.ApplyTrade(trade.ID, deltas)
+	if err != nil {
 		return err
 	}
 
-	if ce.config.EnableInstantChain {
+	if applied && ce.config.EnableInstantChain {
 		_ = ce.SettleInstantOnChain(trade, buyUserID, sellUserID, baseAsset, quoteAsset)
 	}
 
 	return nil
 }
 
+// calcSettlementDate devolve o dia útil T+N do trade (meia-noite no fuso do
+// calendário): todas as execuções de um dia caem na mesma posição e no mesmo
+// lote.
 func (ce *ClearingEngine) calcSettlementDate(tradeTime time.Time) time.Time {
-	return tradeTime.Add(ce.config.SettlementDelay)
+	return ce.config.Calendar.AddBusinessDays(tradeTime, ce.config.SettlementDays)
 }
 
-func (ce *ClearingEngine) addToPosition(userID, symbol string, settlementDate time.Time, baseDelta, quoteDelta float64) error {
-	pos, err := ce.repo.FindClearingPosition(userID, symbol, settlementDate)
-	if err != nil {
-		return err
+// assetsOf resolve os ativos base e quote de um símbolo.
+func (ce *ClearingEngine) assetsOf(symbol string) (base, quote string) {
+	base, quote = parseSymbol(symbol)
+	if a, ok := ce.config.BaseAssets[symbol]; ok {
+		base = a
 	}
-	now := time.Now()
-
-	if pos == nil {
-		pos = &ClearingPosition{
-			ID:             uuid.NewString(),
-			UserID:         userID,
-			Symbol:         symbol,
-			SettlementDate: settlementDate,
-			BaseDelta:      baseDelta,
-			QuoteDelta:     quoteDelta,
-			Status:         SettlementStatusPending,
-			CreatedAt:      now,
-			UpdatedAt:      now,
-		}
-		return ce.repo.SaveClearingPosition(pos)
+	if a, ok := ce.config.QuoteAssets[symbol]; ok {
+		quote = a
 	}
-
-	pos.BaseDelta += baseDelta
-	pos.QuoteDelta += quoteDelta
-	pos.UpdatedAt = now
-	return ce.repo.UpdateClearingPosition(pos)
+	if quote == "" {
+		quote = ce.config.DefaultQuote
+	}
+	if quote == "" {
+		quote = symbol + "_QUOTE"
+	}
+	return base, quote
 }
 
+// RunTPlusOneSettle liquida num único lote todas as posições vencidas até now,
+// com netting multilateral: para cada participante, os deltas de todos os
+// símbolos são somados por ativo e cada ativo se move uma vez. Uma obrigação
+// que falha vira um fail (ver RunFails) e marca como FAILED as posições do
+// participante; as demais seguem.
+//
+// O lote avança por fases gravadas (CLAIMING → SETTLING → CLOSED) e cada
+// perna na custódia leva uma chave de idempotência no ledger: lotes deixados
+// pela metade por uma queda são retomados antes do novo, sem repetir
+// movimentos.
 func (ce *ClearingEngine) RunTPlusOneSettle(ctx context.Context, now time.Time) error {
+	if err := ce.RecoverBatches(ctx, now); err != nil {
+		return err
+	}
+
 	positions, err := ce.repo.ListPositionsToSettle(now)
 	if err != nil {
 		return err
@@ -98,61 +170,342 @@ func (ce *ClearingEngine) RunTPlusOneSettle(ctx context.Context, now time.Time)
 		SettlementDate: now,
 		Mode:           ce.config.Mode,
 		Status:         SettlementStatusProcessing,
+		Phase:          BatchPhaseClaiming,
 		CreatedAt:      now,
 	}
 	if err := ce.repo.SaveSettlementBatch(batch); err != nil {
 		return err
 	}
+	return ce.resumeBatch(ctx, batch, now)
+}
 
-	for _, pos := range positions {
+// RecoverBatches conclui os lotes fora de BatchPhaseClosed, mais antigos
+// primeiro. Chame na subida, antes do scheduler; RunTPlusOneSettle também o
+// chama antes de abrir um lote novo.
+func (ce *ClearingEngine) RecoverBatches(ctx context.Context, now time.Time) error {
+	batches, err := ce.repo.ListOpenBatches()
+	if err != nil {
+		return err
+	}
+	for _, batch := range batches {
+		log.Printf("[Clearing] resuming settlement batch %s at %s", batch.ID, batch.Phase)
+		if err := ce.resumeBatch(ctx, batch, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ce *ClearingEngine) resumeBatch(ctx context.Context, batch *SettlementBatch, now time.Time) error {
+	if batch.Phase == BatchPhaseClaiming {
+		if err := ce.claimPositions(batch); err != nil {
+			return err
+		}
+	}
+	return ce.settleBatch(ctx, batch, now)
+}
+
+// claimPositions atribui ao lote as posições vencidas ainda pendentes, grava
+// as obrigações que faltam e passa o lote a SETTLING. O ID da obrigação deriva
+// de lote, participante e ativo, então a retomada reconhece as já gravadas.
+func (ce *ClearingEngine) claimPositions(batch *SettlementBatch) error {
+	pending, err := ce.repo.ListPositionsToSettle(batch.SettlementDate)
+	if err != nil {
+		return err
+	}
+	for _, pos := range pending {
+		pos.BatchID = batch.ID
+		pos.Status = SettlementStatusProcessing
+		pos.UpdatedAt = batch.CreatedAt
+		if err := ce.repo.UpdateClearingPosition(pos); err != nil {
+			return err
+		}
+	}
+
+	positions, err := ce.repo.ListPositionsByBatch(batch.ID)
+	if err != nil {
+		return err
+	}
+	saved, err := ce.repo.ListSettlementObligations(batch.ID)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool, len(saved))
+	for _, ob := range saved {
+		have[ob.ID] = true
+	}
+	obligations := ce.netPositions(batch.ID, positions, batch.CreatedAt)
+	for _, ob := range obligations {
+		if have[ob.ID] {
+			continue
+		}
+		if err := ce.repo.SaveSettlementObligation(ob); err != nil {
+			return err
+		}
+	}
+
+	ce.fillBatchStats(batch, positions, obligations)
+	batch.Phase = BatchPhaseSettling
+	return ce.repo.UpdateSettlementBatch(batch)
+}
+
+// settleBatch tenta as obrigações ainda pendentes do lote, gravando cada uma
+// antes da próxima, e fecha o lote.
+func (ce *ClearingEngine) settleBatch(ctx context.Context, batch *SettlementBatch, now time.Time) error {
+	positions, err := ce.repo.ListPositionsByBatch(batch.ID)
+	if err != nil {
+		return err
+	}
+	obligations, err := ce.repo.ListSettlementObligations(batch.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, ob := range obligations {
+		if ob.Status != SettlementStatusPending {
+			continue
+		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
 
-		if err := ce.settlePosition(pos); err != nil {
-			pos.Status = SettlementStatusFailed
-			pos.UpdatedAt = time.Now()
-			_ = ce.repo.UpdateClearingPosition(pos)
-			continue
+		ce.attemptObligation(ob, now)
+		ob.UpdatedAt = time.Now()
+		if err := ce.repo.UpdateSettlementObligation(ob); err != nil {
+			return err
 		}
+	}
 
-		pos.Status = SettlementStatusSettled
-		pos.UpdatedAt = time.Now()
-		_ = ce.repo.UpdateClearingPosition(pos)
+	return ce.finishBatch(batch, positions, obligations, time.Now())
+}
+
+// finishBatch deriva o status final do lote e das posições das obrigações:
+// SETTLED sem fails em aberto, FAILED se nenhuma obrigação foi liquidada e
+// PARTIAL nos demais casos. O lote só passa a CLOSED depois das posições.
+func (ce *ClearingEngine) finishBatch(batch *SettlementBatch, positions []*ClearingPosition, obligations []*SettlementObligation, now time.Time) error {
+	openUsers := make(map[string]bool)
+	failed, settled := 0, 0
+	for _, ob := range obligations {
+		switch {
+		case ob.open():
+			failed++
+			openUsers[ob.UserID] = true
+		case ob.Status == SettlementStatusSettled || ob.Status == SettlementStatusBoughtIn:
+			settled++
+		}
 	}
 
-	completed := time.Now()
-	batch.Status = SettlementStatusSettled
-	batch.CompletedAt = &completed
+	for _, pos := range positions {
+		status := SettlementStatusSettled
+		if openUsers[pos.UserID] {
+			status = SettlementStatusFailed
+		}
+		if pos.Status == status {
+			continue
+		}
+		pos.Status = status
+		pos.UpdatedAt = now
+		if err := ce.repo.UpdateClearingPosition(pos); err != nil {
+			return err
+		}
+	}
+
+	batch.FailedCount = failed
+	batch.ErrorMessage = nil
+	switch {
+	case failed == 0:
+		batch.Status = SettlementStatusSettled
+	case settled == 0:
+		batch.Status = SettlementStatusFailed
+	default:
+		batch.Status = SettlementStatusPartial
+	}
+	if failed > 0 {
+		msg := fmt.Sprintf("%d of %d obligations failed", failed, len(obligations))
+		batch.ErrorMessage = &msg
+	}
+	if batch.CompletedAt == nil {
+		batch.CompletedAt = &now
+	}
+	batch.Phase = BatchPhaseClosed
 	return ce.repo.UpdateSettlementBatch(batch)
 }
 
-func (ce *ClearingEngine) settlePosition(pos *ClearingPosition) error {
-	if err := ce.custody.ApplySettlement(pos.UserID, pos.Symbol, pos.BaseDelta, pos.QuoteDelta); err != nil {
-		return err
+// netPositions soma os deltas das posições por participante e ativo. O
+// resultado vem ordenado por usuário e ativo.
+func (ce *ClearingEngine) netPositions(batchID string, positions []*ClearingPosition, now time.Time) []*SettlementObligation {
+	byKey := make(map[[2]string]*SettlementObligation)
+	var result []*SettlementObligation
+	add := func(userID, asset string, delta decimal.Decimal) {
+		if delta.IsZero() {
+			return
+		}
+		key := [2]string{userID, asset}
+		ob, ok := byKey[key]
+		if !ok {
+			ob = &SettlementObligation{
+				ID:        obligationID(batchID, userID, asset),
+				BatchID:   batchID,
+				UserID:    userID,
+				Asset:     asset,
+				Status:    SettlementStatusPending,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			byKey[key] = ob
+			result = append(result, ob)
+		}
+		if delta.IsPositive() {
+			ob.Received = ob.Received.Add(delta)
+		} else {
+			ob.Delivered = ob.Delivered.Add(delta.Neg())
+		}
+		ob.Net = ob.Received.Sub(ob.Delivered)
 	}
 
-	if ce.config.Mode == SettlementModeOnChain || ce.config.Mode == SettlementModeHybrid {
-		baseAsset, quoteAsset := parseSymbol(pos.Symbol)
-		if pos.BaseDelta != 0 {
-			if err := ce.settleOnChain(pos.UserID, baseAsset, pos.BaseDelta); err != nil {
-				return err
-			}
+	for _, pos := range positions {
+		base, quote := ce.assetsOf(pos.Symbol)
+		add(pos.UserID, base, pos.BaseDelta)
+		add(pos.UserID, quote, pos.QuoteDelta)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].UserID != result[j].UserID {
+			return result[i].UserID < result[j].UserID
 		}
-		if pos.QuoteDelta != 0 {
-			if err := ce.settleOnChain(pos.UserID, quoteAsset, pos.QuoteDelta); err != nil {
-				return err
-			}
+		return result[i].Asset < result[j].Asset
+	})
+	return result
+}
+
+// obligationID é determinístico para que a retomada de um lote reconheça as
+// obrigações já gravadas.
+func obligationID(batchID, userID, asset string) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte("settlement/"+batchID+"/"+userID+"/"+asset)).String()
+}
+
+func (ce *ClearingEngine) fillBatchStats(batch *SettlementBatch, positions []*ClearingPosition, obligations []*SettlementObligation) {
+	batch.Symbols = nil
+	symbols := make(map[string]bool)
+	users := make(map[string]bool)
+	for _, pos := range positions {
+		symbols[pos.Symbol] = true
+		users[pos.UserID] = true
+	}
+	for symbol := range symbols {
+		batch.Symbols = append(batch.Symbols, symbol)
+	}
+	sort.Strings(batch.Symbols)
+	if len(batch.Symbols) == 1 {
+		batch.Symbol = batch.Symbols[0]
+	}
+	batch.PositionCount = len(positions)
+	batch.ParticipantCount = len(users)
+	batch.ObligationCount = len(obligations)
+}
+
+// settleObligation aplica a obrigação na custódia e, nos modos on-chain,
+// transfere ao participante o líquido que ele recebe. Sem CustodyService só a
+// parte on-chain é executada e a wallet não é movimentada.
+func (ce *ClearingEngine) settleObligation(ob *SettlementObligation) error {
+	if ce.custody != nil {
+		if err := ce.custody.SettleObligation(ob); err != nil {
+			return err
 		}
 	}
 
+	if ce.config.Mode == SettlementModeOnChain || ce.config.Mode == SettlementModeHybrid {
+		if ob.Net.IsPositive() {
+			return ce.settleOnChain(ob.UserID, ob.Asset, ob.Net)
+		}
+	}
 	return nil
 }
 
-func (ce *ClearingEngine) settleOnChain(userID, asset string, amount float64) error {
-	if ce.blockchain == nil || amount == 0 {
+// ListBatches lista os lotes de liquidação mais recentes.
+func (ce *ClearingEngine) ListBatches(limit int) ([]*SettlementBatch, error) {
+	return ce.repo.ListSettlementBatches(limit)
+}
+
+// BatchReport monta o relatório do lote: obrigações e totais por ativo.
+func (ce *ClearingEngine) BatchReport(batchID string) (*SettlementReport, error) {
+	batch, err := ce.findBatch(batchID)
+	if err != nil {
+		return nil, err
+	}
+	obligations, err := ce.repo.ListSettlementObligations(batchID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]*SettlementAssetStat)
+	var assets []string
+	for _, ob := range obligations {
+		st, ok := stats[ob.Asset]
+		if !ok {
+			st = &SettlementAssetStat{Asset: ob.Asset}
+			stats[ob.Asset] = st
+			assets = append(assets, ob.Asset)
+		}
+		st.Gross = st.Gross.Add(ob.Delivered)
+		if ob.Net.IsNegative() {
+			st.Net = st.Net.Add(ob.Net.Neg())
+		}
+		st.Participants++
+	}
+	sort.Strings(assets)
+
+	report := &SettlementReport{Batch: batch, Obligations: obligations}
+	for _, asset := range assets {
+		report.Assets = append(report.Assets, *stats[asset])
+	}
+	return report, nil
+}
+
+// ParticipantStatement monta o extrato de userID no lote.
+func (ce *ClearingEngine) ParticipantStatement(batchID, userID string) (*SettlementStatement, error) {
+	batch, err := ce.findBatch(batchID)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := ce.repo.ListPositionsByBatch(batchID)
+	if err != nil {
+		return nil, err
+	}
+	obligations, err := ce.repo.ListSettlementObligations(batchID)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &SettlementStatement{BatchID: batchID, UserID: userID, SettlementDate: batch.SettlementDate}
+	for _, pos := range positions {
+		if pos.UserID == userID {
+			st.Positions = append(st.Positions, pos)
+		}
+	}
+	for _, ob := range obligations {
+		if ob.UserID == userID {
+			st.Obligations = append(st.Obligations, ob)
+		}
+	}
+	return st, nil
+}
+
+func (ce *ClearingEngine) findBatch(batchID string) (*SettlementBatch, error) {
+	batch, err := ce.repo.FindSettlementBatch(batchID)
+	if err != nil {
+		return nil, err
+	}
+	if batch == nil {
+		return nil, ErrBatchNotFound
+	}
+	return batch, nil
+}
+
+func (ce *ClearingEngine) settleOnChain(userID, asset string, amount decimal.Decimal) error {
+	if ce.blockchain == nil || amount.IsZero() {
 		return nil
 	}
 
@@ -171,26 +524,37 @@ func (ce *ClearingEngine) SettleInstantOnChain(trade *Trade, buyUserID, sellUser
 	}
 
 	baseQty := trade.Quantity
-	quoteQty := trade.Price * trade.Quantity
+	quoteQty := trade.Price.Mul(trade.Quantity)
 
 	if err := ce.settleOnChain(buyUserID, baseAsset, baseQty); err != nil {
 		return err
 	}
-	if err := ce.settleOnChain(sellUserID, quoteAsset, quoteQty); err != nil {
+	if err := ce.settleOnChain(sellUserID, quoteAsset, quoteQty.Sub(trade.SellerFee)); err != nil {
 		return err
 	}
 	return nil
 }
 
+// StartTPlusOneScheduler roda a liquidação no primeiro tick de cada dia útil
+// do calendário (um tick perdido não pula o dia) e os fails a cada tick.
 func (ce *ClearingEngine) StartTPlusOneScheduler(ctx context.Context, interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	go func() {
 		defer ticker.Stop()
+		var lastRun time.Time
 		for {
 			select {
 			case now := <-ticker.C:
-				if now.Hour() == 0 {
-					_ = ce.RunTPlusOneSettle(ctx, now)
+				cal := ce.config.Calendar
+				if day := cal.Date(now); cal.IsBusinessDay(now) && !day.Equal(lastRun) {
+					if err := ce.RunTPlusOneSettle(ctx, now); err != nil {
+						log.Printf("[Clearing] settlement run failed: %v", err)
+					} else {
+						lastRun = day
+					}
+				}
+				if err := ce.RunFails(ctx, now); err != nil {
+					log.Printf("[Clearing] fails run failed: %v", err)
 				}
 			case <-ctx.Done():
 				return
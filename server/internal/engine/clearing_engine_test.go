@@ -0,0 +1,399 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
+
+// memClearingRepo guarda cópias, como um banco: alterações que não passam
+// por Save/Update se perdem numa "queda".
+type memClearingRepo struct {
+	mu          sync.Mutex
+	positions   map[string]ClearingPosition
+	batches     map[string]SettlementBatch
+	obligations map[string]SettlementObligation
+	// failObligationUpdates faz as próximas N gravações de obrigação falharem.
+	failObligationUpdates int
+	// trades são os trades já aplicados; failAfterApply faz o próximo
+	// ApplyTrade falhar depois de gravar (resposta perdida).
+	trades         map[string]bool
+	failAfterApply error
+}
+
+func newMemClearingRepo() *memClearingRepo {
+	return &memClearingRepo{
+		positions:   make(map[string]ClearingPosition),
+		trades:      make(map[string]bool),
+		batches:     make(map[string]SettlementBatch),
+		obligations: make(map[string]SettlementObligation),
+	}
+}
+
+func (r *memClearingRepo) ApplyTrade(tradeID string, deltas []*ClearingPosition) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.trades[tradeID] {
+		return false, nil
+	}
+	r.trades[tradeID] = true
+	for _, d := range deltas {
+		pos := *d
+		for id, cur := range r.positions {
+			if cur.UserID == d.UserID && cur.Symbol == d.Symbol && cur.SettlementDate.Equal(d.SettlementDate) && cur.Status == SettlementStatusPending {
+				pos = cur
+				pos.BaseDelta = pos.BaseDelta.Add(d.BaseDelta)
+				pos.QuoteDelta = pos.QuoteDelta.Add(d.QuoteDelta)
+				delete(r.positions, id)
+				break
+			}
+		}
+		r.positions[pos.ID] = pos
+	}
+	if r.failAfterApply != nil {
+		err := r.failAfterApply
+		r.failAfterApply = nil
+		return true, err
+	}
+	return true, nil
+}
+
+func (r *memClearingRepo) UpdateClearingPosition(pos *ClearingPosition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.positions[pos.ID] = *pos
+	return nil
+}
+
+func (r *memClearingRepo) listPositions(match func(ClearingPosition) bool) []*ClearingPosition {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*ClearingPosition
+	for _, pos := range r.positions {
+		if match(pos) {
+			p := pos
+			out = append(out, &p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (r *memClearingRepo) ListPositionsToSettle(before time.Time) ([]*ClearingPosition, error) {
+	return r.listPositions(func(p ClearingPosition) bool {
+		return p.Status == SettlementStatusPending && !p.SettlementDate.After(before)
+	}), nil
+}
+
+func (r *memClearingRepo) ListPositionsByBatch(batchID string) ([]*ClearingPosition, error) {
+	return r.listPositions(func(p ClearingPosition) bool { return p.BatchID == batchID }), nil
+}
+
+func (r *memClearingRepo) SaveSettlementBatch(batch *SettlementBatch) error {
+	return r.UpdateSettlementBatch(batch)
+}
+
+func (r *memClearingRepo) UpdateSettlementBatch(batch *SettlementBatch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches[batch.ID] = *batch
+	return nil
+}
+
+func (r *memClearingRepo) FindSettlementBatch(id string) (*SettlementBatch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.batches[id]
+	if !ok {
+		return nil, nil
+	}
+	return &b, nil
+}
+
+func (r *memClearingRepo) listBatches(match func(SettlementBatch) bool) []*SettlementBatch {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*SettlementBatch
+	for _, b := range r.batches {
+		if match(b) {
+			c := b
+			out = append(out, &c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+func (r *memClearingRepo) ListSettlementBatches(int) ([]*SettlementBatch, error) {
+	return r.listBatches(func(SettlementBatch) bool { return true }), nil
+}
+
+func (r *memClearingRepo) ListOpenBatches() ([]*SettlementBatch, error) {
+	return r.listBatches(func(b SettlementBatch) bool { return b.Phase != BatchPhaseClosed }), nil
+}
+
+func (r *memClearingRepo) SaveSettlementObligation(ob *SettlementObligation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.obligations[ob.ID] = *ob
+	return nil
+}
+
+func (r *memClearingRepo) UpdateSettlementObligation(ob *SettlementObligation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failObligationUpdates > 0 {
+		r.failObligationUpdates--
+		return errors.New("database unavailable")
+	}
+	r.obligations[ob.ID] = *ob
+	return nil
+}
+
+func (r *memClearingRepo) listObligations(match func(SettlementObligation) bool) []*SettlementObligation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*SettlementObligation
+	for _, ob := range r.obligations {
+		if match(ob) {
+			c := ob
+			out = append(out, &c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].UserID != out[j].UserID {
+			return out[i].UserID < out[j].UserID
+		}
+		return out[i].Asset < out[j].Asset
+	})
+	return out
+}
+
+func (r *memClearingRepo) ListSettlementObligations(batchID string) ([]*SettlementObligation, error) {
+	return r.listObligations(func(ob SettlementObligation) bool { return ob.BatchID == batchID }), nil
+}
+
+func (r *memClearingRepo) ListOpenObligations() ([]*SettlementObligation, error) {
+	return r.listObligations(func(ob SettlementObligation) bool { return ob.open() }), nil
+}
+
+// hookedCustody chama before antes de cada SettleObligation.
+type hookedCustody struct {
+	CustodyService
+	before func(ob *SettlementObligation)
+}
+
+func (c hookedCustody) SettleObligation(ob *SettlementObligation) error {
+	if c.before != nil {
+		c.before(ob)
+	}
+	return c.CustodyService.SettleObligation(ob)
+}
+
+func TestNetPositions(t *testing.T) {
+	ce := NewClearingEngine(newMemClearingRepo(), nil, nil, nil, ClearingConfig{DefaultQuote: "USD"})
+	pos := func(user, symbol, base, quote string) *ClearingPosition {
+		return &ClearingPosition{UserID: user, Symbol: symbol, BaseDelta: d(base), QuoteDelta: d(quote)}
+	}
+	obligations := ce.netPositions("b1", []*ClearingPosition{
+		pos("alice", "AAA", "2", "-20"),
+		pos("alice", "BBB", "-1", "15"),
+		pos("bob", "AAA", "-2", "20"),
+		pos("bob", "BBB/EUR", "1", "-15"),
+		pos("carol", "AAA", "0", "0"),
+	}, time.Now())
+
+	tests := []struct {
+		user, asset              string
+		delivered, received, net string
+	}{
+		{"alice", "AAA", "0", "2", "2"},
+		{"alice", "BBB", "1", "0", "-1"},
+		{"alice", "USD", "20", "15", "-5"},
+		{"bob", "AAA", "2", "0", "-2"},
+		{"bob", "BBB", "0", "1", "1"},
+		{"bob", "EUR", "15", "0", "-15"},
+		{"bob", "USD", "0", "20", "20"},
+	}
+	if len(obligations) != len(tests) {
+		t.Fatalf("got %d obligations, want %d", len(obligations), len(tests))
+	}
+	for i, tt := range tests {
+		ob := obligations[i]
+		if ob.UserID != tt.user || ob.Asset != tt.asset {
+			t.Fatalf("obligation %d = %s/%s, want %s/%s", i, ob.UserID, ob.Asset, tt.user, tt.asset)
+		}
+		if !ob.Delivered.Equal(d(tt.delivered)) || !ob.Received.Equal(d(tt.received)) || !ob.Net.Equal(d(tt.net)) {
+			t.Errorf("%s/%s = delivered %s received %s net %s, want %s %s %s",
+				tt.user, tt.asset, ob.Delivered, ob.Received, ob.Net, tt.delivered, tt.received, tt.net)
+		}
+		if ob.ID != obligationID("b1", tt.user, tt.asset) {
+			t.Errorf("%s/%s obligation ID is not deterministic", tt.user, tt.asset)
+		}
+	}
+}
+
+func TestSettlementBatchResumesWithoutDoubleSettling(t *testing.T) {
+	tests := []struct {
+		name  string
+		crash func(repo *memClearingRepo, cancel context.CancelFunc) func(*SettlementObligation)
+	}{
+		{"obligation not saved after the move", func(repo *memClearingRepo, _ context.CancelFunc) func(*SettlementObligation) {
+			repo.failObligationUpdates = 1
+			return nil
+		}},
+		{"context canceled mid batch", func(_ *memClearingRepo, cancel context.CancelFunc) func(*SettlementObligation) {
+			return func(*SettlementObligation) { cancel() }
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wallet, mw := newTestWallet()
+			mw.set("alice", "AAA", decimal.Zero, d("2"))
+			mw.set("bob", "USD", decimal.Zero, d("20"))
+
+			repo := newMemClearingRepo()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			custody := hookedCustody{CustodyService: NewWalletCustodyService(wallet, "clearing")}
+			custody.before = tt.crash(repo, cancel)
+			ce := NewClearingEngine(repo, custody, nil, nil, ClearingConfig{DefaultQuote: "USD"})
+
+			now := time.Now()
+			trade := &Trade{Symbol: "AAA", Price: d("10"), Quantity: d("2"), CreatedAt: now.Add(-time.Hour)}
+			if err := ce.OnTrade(trade, "bob", "alice"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := ce.RunTPlusOneSettle(ctx, now); err == nil {
+				t.Fatal("first run succeeded, want the simulated crash")
+			}
+			open, _ := repo.ListOpenBatches()
+			if len(open) != 1 || open[0].Phase != BatchPhaseSettling {
+				t.Fatalf("open batches = %+v, want one in SETTLING", open)
+			}
+
+			custody.before = nil
+			ce = NewClearingEngine(repo, custody, nil, nil, ClearingConfig{DefaultQuote: "USD"})
+			if err := ce.RunTPlusOneSettle(context.Background(), now); err != nil {
+				t.Fatal(err)
+			}
+
+			batches, _ := repo.ListSettlementBatches(10)
+			if len(batches) != 1 || batches[0].Phase != BatchPhaseClosed || batches[0].Status != SettlementStatusSettled {
+				t.Fatalf("batches = %+v, want one CLOSED and SETTLED", batches)
+			}
+			want := []struct {
+				user, asset   string
+				avail, locked string
+			}{
+				{"alice", "AAA", "0", "0"},
+				{"alice", "USD", "20", "0"},
+				{"bob", "AAA", "2", "0"},
+				{"bob", "USD", "0", "0"},
+			}
+			for _, w := range want {
+				avail, locked := mw.get(w.user, w.asset)
+				if !avail.Equal(d(w.avail)) || !locked.Equal(d(w.locked)) {
+					t.Errorf("%s %s = %s/%s, want %s/%s", w.user, w.asset, avail, locked, w.avail, w.locked)
+				}
+			}
+		})
+	}
+}
+
+func TestObligationReleaseFailureEntersFails(t *testing.T) {
+	wallet, mw := newTestWallet()
+	// travou 30 e entrega 20 líquidos: 10 voltam ao disponível
+	mw.set("alice", "USD", decimal.Zero, d("30"))
+	mw.failPost = func(entry *LedgerEntry) error {
+		if strings.HasSuffix(entry.Key, ":release") {
+			return errors.New("ledger unavailable")
+		}
+		return nil
+	}
+	ce := NewClearingEngine(newMemClearingRepo(), NewWalletCustodyService(wallet, "clearing"), nil, nil, ClearingConfig{DefaultQuote: "USD"})
+	ob := &SettlementObligation{ID: "ob1", UserID: "alice", Asset: "USD", Delivered: d("30"), Received: d("10"), Net: d("-20")}
+
+	now := time.Now()
+	if ce.attemptObligation(ob, now) {
+		t.Fatal("obligation settled although the release failed")
+	}
+	if ob.Status != SettlementStatusPartial || ob.NextAttemptAt == nil {
+		t.Fatalf("obligation = %s (next attempt %v), want PARTIAL with a retry scheduled", ob.Status, ob.NextAttemptAt)
+	}
+
+	mw.failPost = nil
+	if !ce.attemptObligation(ob, now) {
+		t.Fatalf("retry failed: %v", *ob.ErrorMessage)
+	}
+	if avail, locked := mw.get("alice", "USD"); !avail.Equal(d("10")) || !locked.IsZero() {
+		t.Fatalf("alice USD = %s/%s, want 10/0", avail, locked)
+	}
+}
+
+func TestClearingNetsFeesFromSettlementLegs(t *testing.T) {
+	wallet, mw := newTestWallet()
+	mw.set("alice", "AAA", decimal.Zero, d("2"))
+	mw.set("bob", "USD", d("1"), d("20"))
+
+	repo := newMemClearingRepo()
+	ce := NewClearingEngine(repo, NewWalletCustodyService(wallet, "clearing"), nil, nil, ClearingConfig{DefaultQuote: "USD", FeeAccount: "fees"})
+
+	now := time.Now()
+	trade := &Trade{ID: "t1", Symbol: "AAA", Price: d("10"), Quantity: d("2"), BuyerFee: d("0.04"), SellerFee: d("0.02"), FeeAsset: "USD", CreatedAt: now.Add(-time.Hour)}
+	if err := ce.OnTrade(trade, "bob", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ce.RunTPlusOneSettle(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user, asset, avail, locked string
+	}{
+		{"alice", "AAA", "0", "0"},
+		{"alice", "USD", "19.98", "0"},
+		{"bob", "AAA", "2", "0"},
+		{"bob", "USD", "0.96", "0"},
+		{"fees", "USD", "0.06", "0"},
+	}
+	for _, tt := range tests {
+		avail, locked := mw.get(tt.user, tt.asset)
+		if !avail.Equal(d(tt.avail)) || !locked.Equal(d(tt.locked)) {
+			t.Errorf("%s %s = %s/%s, want %s/%s", tt.user, tt.asset, avail, locked, tt.avail, tt.locked)
+		}
+	}
+
+	other := &Trade{ID: "t2", Symbol: "AAA", Price: d("10"), Quantity: d("1"), BuyerFee: d("0.02"), FeeAsset: "EUR", CreatedAt: now}
+	if err := ce.OnTrade(other, "bob", "alice"); err == nil {
+		t.Fatal("OnTrade accepted fees in an asset other than the settlement quote")
+	}
+}
+
+func TestClearingAppliesTradeOnce(t *testing.T) {
+	repo := newMemClearingRepo()
+	ce := NewClearingEngine(repo, nil, nil, nil, ClearingConfig{DefaultQuote: "USD"})
+
+	trade := &Trade{ID: "t1", Symbol: "AAA", Price: d("10"), Quantity: d("2"), CreatedAt: time.Now()}
+	for i := 0; i < 2; i++ {
+		if err := ce.OnTrade(trade, "bob", "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	next := &Trade{ID: "t2", Symbol: "AAA", Price: d("10"), Quantity: d("1"), CreatedAt: trade.CreatedAt}
+	if err := ce.OnTrade(next, "bob", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	positions := repo.listPositions(func(p ClearingPosition) bool { return p.UserID == "bob" })
+	if len(positions) != 1 || !positions[0].BaseDelta.Equal(d("3")) || !positions[0].QuoteDelta.Equal(d("-30")) {
+		t.Fatalf("bob positions = %+v, want one position of 3 AAA / -30 USD", positions)
+	}
+}
@@ -1,6 +1,10 @@
 package engine
 
-import "time"
+import (
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
 
 type SettlementMode int
 
@@ -17,6 +21,25 @@ const (
 	SettlementStatusProcessing SettlementStatus = "PROCESSING"
 	SettlementStatusSettled    SettlementStatus = "SETTLED"
 	SettlementStatusFailed     SettlementStatus = "FAILED"
+	// PARTIAL: obrigação entregue em parte, ou lote com parte das obrigações
+	// em aberto.
+	SettlementStatusPartial SettlementStatus = "PARTIAL"
+	// BOUGHT_IN: fail encerrado por buy-in, cobrado em dinheiro do faltoso.
+	SettlementStatusBoughtIn SettlementStatus = "BOUGHT_IN"
+)
+
+// SettlementBatchPhase é a etapa de um lote em RunTPlusOneSettle. Cada etapa
+// é gravada antes da seguinte; um lote fora de BatchPhaseClosed é retomado
+// por RecoverBatches.
+type SettlementBatchPhase string
+
+const (
+	// CLAIMING: lote criado, posições vencidas sendo atribuídas a ele.
+	BatchPhaseClaiming SettlementBatchPhase = "CLAIMING"
+	// SETTLING: obrigações gravadas, sendo liquidadas.
+	BatchPhaseSettling SettlementBatchPhase = "SETTLING"
+	// CLOSED: todas as obrigações tentadas e status final calculado.
+	BatchPhaseClosed SettlementBatchPhase = "CLOSED"
 )
 
 type ClearingPosition struct {
@@ -24,21 +47,100 @@ type ClearingPosition struct {
 	UserID         string
 	Symbol         string
 	SettlementDate time.Time
-	BaseDelta      float64
-	QuoteDelta     float64
-	Status         SettlementStatus
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	BaseDelta      decimal.Decimal
+	QuoteDelta     decimal.Decimal
+	// BatchID é o lote que liquidou a posição (vazio enquanto pendente).
+	BatchID   string
+	Status    SettlementStatus
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 type SettlementBatch struct {
-	ID             string
+	ID string
+	// Symbol é o mercado do lote quando ele cobre um só símbolo; num ciclo
+	// multilateral com vários símbolos fica vazio e Symbols lista todos.
 	Symbol         string
+	Symbols        []string
 	SettlementDate time.Time
 	Mode           SettlementMode
 
+	PositionCount    int
+	ParticipantCount int
+	ObligationCount  int
+	FailedCount      int
+
 	Status       SettlementStatus
+	Phase        SettlementBatchPhase
 	CreatedAt    time.Time
 	CompletedAt  *time.Time
 	ErrorMessage *string
 }
+
+// SettlementObligation é o resultado do netting multilateral de um
+// participante num ativo: o que ele entrega e recebe no ciclo, somado entre
+// todos os símbolos, vira um único movimento Net.
+type SettlementObligation struct {
+	ID      string
+	BatchID string
+	UserID  string
+	Asset   string
+	// Delivered e Received são os brutos do ciclo (positivos); Net =
+	// Received - Delivered.
+	Delivered decimal.Decimal
+	Received  decimal.Decimal
+	Net       decimal.Decimal
+	// Settled é quanto de |Net| já foi movido (entregas parciais).
+	Settled decimal.Decimal
+	Status  SettlementStatus
+
+	// Controle de fails: tentativas, próxima retentativa, início do fail,
+	// multas já cobradas (no ativo quote) e custo do buy-in.
+	Attempts      int
+	NextAttemptAt *time.Time
+	FailedSince   *time.Time
+	Penalties     decimal.Decimal
+	PenaltyUntil  *time.Time
+	BuyInCost     decimal.Decimal
+
+	ErrorMessage *string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// Outstanding é o que falta mover da obrigação.
+func (ob *SettlementObligation) Outstanding() decimal.Decimal {
+	return decimal.Max(ob.Net.Abs().Sub(ob.Settled), decimal.Zero)
+}
+
+// open indica fail ainda não resolvido.
+func (ob *SettlementObligation) open() bool {
+	return ob.Status == SettlementStatusFailed || ob.Status == SettlementStatusPartial
+}
+
+// SettlementAssetStat resume um ativo no lote: Gross é o total bruto
+// entregue e Net o total que de fato se move depois do netting.
+type SettlementAssetStat struct {
+	Asset        string
+	Gross        decimal.Decimal
+	Net          decimal.Decimal
+	Participants int
+}
+
+// SettlementReport é o relatório de um lote: estatísticas por ativo e todas
+// as obrigações.
+type SettlementReport struct {
+	Batch       *SettlementBatch
+	Assets      []SettlementAssetStat
+	Obligations []*SettlementObligation
+}
+
+// SettlementStatement é o extrato de um participante num lote: as posições
+// por símbolo e o líquido por ativo.
+type SettlementStatement struct {
+	BatchID        string
+	UserID         string
+	SettlementDate time.Time
+	Positions      []*ClearingPosition
+	Obligations    []*SettlementObligation
+}
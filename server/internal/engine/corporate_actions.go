@@ -3,6 +3,9 @@ package engine
 import (
 	"time"
 
+	"hearcap/server/internal/calendar"
+	"hearcap/server/internal/decimal"
+
 	"github.com/google/uuid"
 )
 
@@ -39,7 +42,7 @@ type CorporateAction struct {
 	ExDate           time.Time
 	PaymentDate      time.Time
 
-	DividendPerShare float64
+	DividendPerShare decimal.Decimal
 	DividendAsset    string
 
 	SplitNumerator   int
@@ -47,7 +50,7 @@ type CorporateAction struct {
 
 	RightsRatioNumerator   int
 	RightsRatioDenominator int
-	SubscriptionPrice      float64
+	SubscriptionPrice      decimal.Decimal
 	SubscriptionAsset      string
 	SubscriptionEnd        time.Time
 
@@ -59,19 +62,32 @@ type CorporateActionEngine struct {
 	repo    CorporateActionRepository
 	holders HolderPositionService
 	notify  GovernanceNotificationService
+
+	calendar       *calendar.Calendar
+	settlementDays int
 }
 
 func NewCorporateActionEngine(repo CorporateActionRepository, holders HolderPositionService, notify GovernanceNotificationService) *CorporateActionEngine {
 	return &CorporateActionEngine{
-		repo:    repo,
-		holders: holders,
-		notify:  notify,
+		repo:           repo,
+		holders:        holders,
+		notify:         notify,
+		calendar:       calendar.Continuous(),
+		settlementDays: 1,
 	}
 }
 
+// SetCalendar define o calendário das datas do evento e o ciclo T+N da
+// liquidação, usado para derivar a data ex da data de registro (padrão:
+// calendar.Continuous e T+1).
+func (cae *CorporateActionEngine) SetCalendar(cal *calendar.Calendar, settlementDays int) {
+	cae.calendar = cal
+	cae.settlementDays = settlementDays
+}
+
 type ScheduleDividendRequest struct {
 	Symbol           string
-	DividendPerShare float64
+	DividendPerShare decimal.Decimal
 	DividendAsset    string
 	RecordDate       time.Time
 	PaymentDate      time.Time
@@ -89,6 +105,7 @@ func (cae *CorporateActionEngine) ScheduleCashDividend(req ScheduleDividendReque
 		DividendPerShare: req.DividendPerShare,
 		DividendAsset:    req.DividendAsset,
 		RecordDate:       req.RecordDate,
+		ExDate:           cae.calendar.ExDate(req.RecordDate, cae.settlementDays),
 		PaymentDate:      req.PaymentDate,
 		AnnouncementDate: now,
 		CreatedAt:        now,
@@ -107,7 +124,7 @@ func (cae *CorporateActionEngine) ProcessRecordDate(now time.Time) error {
 		return err
 	}
 	for _, ca := range actions {
-		if !sameDay(ca.RecordDate, now) || ca.Status != CAStatusPlanned {
+		if !cae.calendar.SameDay(ca.RecordDate, now) || ca.Status != CAStatusPlanned {
 			continue
 		}
 		ca.Status = CAStatusRecordDate
@@ -123,7 +140,7 @@ func (cae *CorporateActionEngine) ProcessPaymentDate(now time.Time) error {
 		return err
 	}
 	for _, ca := range actions {
-		if !sameDay(ca.PaymentDate, now) || ca.Status == CAStatusCompleted {
+		if !cae.calendar.SameDay(ca.PaymentDate, now) || ca.Status == CAStatusCompleted {
 			continue
 		}
 		if err := cae.processActionPayment(ca); err != nil {
@@ -142,8 +159,8 @@ func (cae *CorporateActionEngine) processActionPayment(ca *CorporateAction) erro
 	switch ca.Type {
 	case CorporateActionDividendCash, CorporateActionDividendToken:
 		for _, h := range holders {
-			amount := h.Quantity * ca.DividendPerShare
-			if amount <= 0 {
+			amount := h.Quantity.Mul(ca.DividendPerShare)
+			if !amount.IsPositive() {
 				continue
 			}
 			if err := cae.holders.ApplyCashDividend(h.UserID, ca.DividendAsset, amount); err != nil {
@@ -155,8 +172,7 @@ func (cae *CorporateActionEngine) processActionPayment(ca *CorporateAction) erro
 			if ca.SplitDenominator == 0 {
 				continue
 			}
-			ratio := float64(ca.SplitNumerator) / float64(ca.SplitDenominator)
-			newQty := h.Quantity * ratio
+			newQty := h.Quantity.MulInt(int64(ca.SplitNumerator)).Div(decimal.FromInt(int64(ca.SplitDenominator)))
 			if err := cae.holders.ApplyStockDividendOrSplit(h.UserID, ca.Symbol, h.Quantity, newQty); err != nil {
 				return err
 			}
@@ -166,9 +182,8 @@ func (cae *CorporateActionEngine) processActionPayment(ca *CorporateAction) erro
 			if ca.RightsRatioDenominator == 0 {
 				continue
 			}
-			ratio := float64(ca.RightsRatioNumerator) / float64(ca.RightsRatioDenominator)
-			rightsQty := h.Quantity * ratio
-			if rightsQty <= 0 {
+			rightsQty := h.Quantity.MulInt(int64(ca.RightsRatioNumerator)).Div(decimal.FromInt(int64(ca.RightsRatioDenominator)))
+			if !rightsQty.IsPositive() {
 				continue
 			}
 			if err := cae.holders.GrantRights(h.UserID, ca.Symbol, rightsQty, ca.SubscriptionPrice, ca.SubscriptionAsset); err != nil {
@@ -181,9 +196,3 @@ func (cae *CorporateActionEngine) processActionPayment(ca *CorporateAction) erro
 	ca.UpdatedAt = time.Now()
 	return cae.repo.UpdateCorporateAction(ca)
 }
-
-func sameDay(a, b time.Time) bool {
-	y1, m1, d1 := a.Date()
-	y2, m2, d2 := b.Date()
-	return y1 == y2 && m1 == m2 && d1 == d2
-}
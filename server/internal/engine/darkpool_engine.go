@@ -5,6 +5,8 @@ import (
 	"sort"
 	"time"
 
+	"hearcap/server/internal/decimal"
+
 	"github.com/google/uuid"
 )
 
@@ -20,6 +22,7 @@ type DarkPoolEngine struct {
 	blockchain BlockchainService
 	marketData *MarketDataEngine
 	config     DarkPoolEngineConfig
+	fees       *FeeEngine
 }
 
 func NewDarkPoolEngine(repo DarkPoolRepository, refPrice ReferencePriceService, clearing *ClearingEngine, blockchain BlockchainService, marketData *MarketDataEngine, cfg DarkPoolEngineConfig) *DarkPoolEngine {
@@ -33,17 +36,23 @@ func NewDarkPoolEngine(repo DarkPoolRepository, refPrice ReferencePriceService,
 	}
 }
 
+// SetFeeEngine liga o cálculo de taxas aos block trades; a cobrança vem com
+// o trade enviado ao clearing.
+func (dpe *DarkPoolEngine) SetFeeEngine(fe *FeeEngine) {
+	dpe.fees = fe
+}
+
 type CreateDarkPoolRequest struct {
 	Name        string
 	Symbol      string
 	OwnerID     string
 	Type        DarkPoolType
-	MinBlockQty float64
+	MinBlockQty decimal.Decimal
 	PricingMode string
 }
 
 func (dpe *DarkPoolEngine) CreatePool(req CreateDarkPoolRequest) (*DarkPool, error) {
-	if req.MinBlockQty <= 0 {
+	if !req.MinBlockQty.IsPositive() {
 		return nil, errors.New("min block qty must be > 0")
 	}
 	now := time.Now()
@@ -70,9 +79,9 @@ type DarkPoolOrderRequest struct {
 	UserID    string
 	Symbol    string
 	Side      Side
-	Quantity  float64
-	MinQty    float64
-	PriceHint *float64
+	Quantity  decimal.Decimal
+	MinQty    decimal.Decimal
+	PriceHint *decimal.Decimal
 }
 
 func (dpe *DarkPoolEngine) PlaceDarkOrder(req DarkPoolOrderRequest) (*DarkPoolOrder, error) {
@@ -86,7 +95,7 @@ func (dpe *DarkPoolEngine) PlaceDarkOrder(req DarkPoolOrderRequest) (*DarkPoolOr
 	if pool.Symbol != req.Symbol {
 		return nil, errors.New("symbol mismatch")
 	}
-	if req.Quantity < pool.MinBlockQty {
+	if req.Quantity.LessThan(pool.MinBlockQty) {
 		return nil, errors.New("quantity below min block size")
 	}
 
@@ -101,7 +110,7 @@ func (dpe *DarkPoolEngine) PlaceDarkOrder(req DarkPoolOrderRequest) (*DarkPoolOr
 		MinQty:    req.MinQty,
 		PriceHint: req.PriceHint,
 		Status:    DarkPoolOrderStatusNew,
-		FilledQty: 0,
+		FilledQty: decimal.Zero,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
@@ -141,17 +150,17 @@ func (dpe *DarkPoolEngine) matchInPool(pool *DarkPool, incoming *DarkPoolOrder)
 	})
 
 	for _, other := range candidates {
-		if incoming.FilledQty >= incoming.Quantity {
+		if incoming.FilledQty.GreaterThanOrEqual(incoming.Quantity) {
 			break
 		}
-		remainingIncoming := incoming.Quantity - incoming.FilledQty
-		remainingOther := other.Quantity - other.FilledQty
-		size := min(remainingIncoming, remainingOther)
+		remainingIncoming := incoming.Quantity.Sub(incoming.FilledQty)
+		remainingOther := other.Quantity.Sub(other.FilledQty)
+		size := decimal.Min(remainingIncoming, remainingOther)
 
-		if incoming.MinQty > 0 && size < incoming.MinQty {
+		if incoming.MinQty.IsPositive() && size.LessThan(incoming.MinQty) {
 			continue
 		}
-		if other.MinQty > 0 && size < other.MinQty {
+		if other.MinQty.IsPositive() && size.LessThan(other.MinQty) {
 			continue
 		}
 
@@ -173,7 +182,7 @@ func (dpe *DarkPoolEngine) matchInPool(pool *DarkPool, incoming *DarkPoolOrder)
 	return nil
 }
 
-func (dpe *DarkPoolEngine) determineBlockPrice(pool *DarkPool, symbol string) (float64, error) {
+func (dpe *DarkPoolEngine) determineBlockPrice(pool *DarkPool, symbol string) (decimal.Decimal, error) {
 	switch pool.PricingMode {
 	case "MIDPOINT", "NBBO_MID":
 		return dpe.refPrice.GetMidPrice(symbol)
@@ -182,7 +191,7 @@ func (dpe *DarkPoolEngine) determineBlockPrice(pool *DarkPool, symbol string) (f
 	}
 }
 
-func (dpe *DarkPoolEngine) createBlockTrade(pool *DarkPool, o1, o2 *DarkPoolOrder, price, qty float64) (*BlockTrade, error) {
+func (dpe *DarkPoolEngine) createBlockTrade(pool *DarkPool, o1, o2 *DarkPoolOrder, price, qty decimal.Decimal) (*BlockTrade, error) {
 	now := time.Now()
 	var buyer, seller *DarkPoolOrder
 	if o1.Side == SideBuy {
@@ -193,16 +202,16 @@ func (dpe *DarkPoolEngine) createBlockTrade(pool *DarkPool, o1, o2 *DarkPoolOrde
 		seller = o1
 	}
 
-	buyer.FilledQty += qty
-	seller.FilledQty += qty
+	buyer.FilledQty = buyer.FilledQty.Add(qty)
+	seller.FilledQty = seller.FilledQty.Add(qty)
 
-	if buyer.FilledQty >= buyer.Quantity {
+	if buyer.FilledQty.GreaterThanOrEqual(buyer.Quantity) {
 		buyer.Status = DarkPoolOrderStatusFilled
 	} else {
 		buyer.Status = DarkPoolOrderStatusPartFilled
 	}
 
-	if seller.FilledQty >= seller.Quantity {
+	if seller.FilledQty.GreaterThanOrEqual(seller.Quantity) {
 		seller.Status = DarkPoolOrderStatusFilled
 	} else {
 		seller.Status = DarkPoolOrderStatusPartFilled
@@ -229,6 +238,10 @@ func (dpe *DarkPoolEngine) createBlockTrade(pool *DarkPool, o1, o2 *DarkPoolOrde
 		CreatedAt: now,
 	}
 
+	if dpe.fees != nil {
+		dpe.fees.AssessBlockTrade(bt)
+	}
+
 	if err := dpe.repo.SaveBlockTrade(bt); err != nil {
 		return nil, err
 	}
@@ -256,8 +269,13 @@ func (dpe *DarkPoolEngine) forwardToClearing(bt *BlockTrade) error {
 	trade := &Trade{
 		ID:        bt.ID,
 		Symbol:    bt.Symbol,
+		BuyerID:   bt.BuyerID,
+		SellerID:  bt.SellerID,
 		Price:     bt.Price,
 		Quantity:  bt.Quantity,
+		BuyerFee:  bt.BuyerFee,
+		SellerFee: bt.SellerFee,
+		FeeAsset:  bt.FeeAsset,
 		CreatedAt: bt.CreatedAt,
 	}
 	return dpe.clearing.OnTrade(trade, bt.BuyerID, bt.SellerID)
@@ -299,11 +317,11 @@ func (dpe *DarkPoolEngine) AggregateAndPublishVolumes(from, to time.Time, report
 				Symbol: bt.Symbol,
 				From:   from,
 				To:     to,
-				Volume: 0,
+				Volume: decimal.Zero,
 				Trades: 0,
 			}
 		}
-		aggregates[k].Volume += bt.Quantity
+		aggregates[k].Volume = aggregates[k].Volume.Add(bt.Quantity)
 		aggregates[k].Trades++
 	}
 
@@ -1,6 +1,10 @@
 package engine
 
-import "time"
+import (
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
 
 type DarkPoolType string
 
@@ -23,7 +27,7 @@ type DarkPool struct {
 	Symbol      string
 	OwnerID     string
 	Type        DarkPoolType
-	MinBlockQty float64
+	MinBlockQty decimal.Decimal
 	Status      DarkPoolStatus
 	PricingMode string
 	CreatedAt   time.Time
@@ -45,11 +49,11 @@ type DarkPoolOrder struct {
 	UserID    string
 	Symbol    string
 	Side      Side
-	Quantity  float64
-	MinQty    float64
-	PriceHint *float64
+	Quantity  decimal.Decimal
+	MinQty    decimal.Decimal
+	PriceHint *decimal.Decimal
 	Status    DarkPoolOrderStatus
-	FilledQty float64
+	FilledQty decimal.Decimal
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
@@ -58,10 +62,13 @@ type BlockTrade struct {
 	ID             string
 	PoolID         string
 	Symbol         string
-	Price          float64
-	Quantity       float64
+	Price          decimal.Decimal
+	Quantity       decimal.Decimal
 	BuyerID        string
 	SellerID       string
+	BuyerFee       decimal.Decimal
+	SellerFee      decimal.Decimal
+	FeeAsset       string
 	ReportedToLit  bool
 	ReportedAt     *time.Time
 	OnChainSettled bool
@@ -0,0 +1,14 @@
+package engine
+
+// NoOpEventBus descarta os eventos do MatchingEngine. Os feeds públicos já
+// saem pelo MarketDataEngine; use-o enquanto não houver canal privado.
+type NoOpEventBus struct{}
+
+func NewNoOpEventBus() *NoOpEventBus {
+	return &NoOpEventBus{}
+}
+
+func (NoOpEventBus) PublishOrderBookUpdate(string, OrderBookSnapshot) error { return nil }
+func (NoOpEventBus) PublishTrade(*Trade) error                              { return nil }
+func (NoOpEventBus) PublishOrderEvent(*OrderEvent) error                    { return nil }
+func (NoOpEventBus) PublishOrderUpdate(*Order) error                        { return nil }
@@ -0,0 +1,383 @@
+package engine
+
+import (
+	"sync"
+	"testing"
+
+	"hearcap/server/internal/decimal"
+)
+
+// memRepo guarda a última versão de cada ordem, grupo e trade.
+type memRepo struct {
+	mu     sync.Mutex
+	orders map[string]*Order
+	groups map[string]*OrderGroup
+	trades []*Trade
+	// onSave, se definido, roda em SaveOrder (para provocar falhas).
+	onSave func(order *Order)
+	// saveTradeErr, se definido, é devolvido por SaveTrade.
+	saveTradeErr error
+	// saveGroupErr, se definido, é devolvido por SaveOrderGroup.
+	saveGroupErr error
+	// saveOrderErr, se definido, decide o erro de cada SaveOrder.
+	saveOrderErr func(order *Order) error
+}
+
+func newMemRepo() *memRepo {
+	return &memRepo{
+		orders: make(map[string]*Order),
+		groups: make(map[string]*OrderGroup),
+	}
+}
+
+func (r *memRepo) SaveOrder(order *Order) error {
+	if r.onSave != nil {
+		r.onSave(order)
+	}
+	if r.saveOrderErr != nil {
+		if err := r.saveOrderErr(order); err != nil {
+			return err
+		}
+	}
+	return r.UpdateOrder(order)
+}
+
+func (r *memRepo) UpdateOrder(order *Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.orders[order.ID] = order.clone()
+	return nil
+}
+
+func (r *memRepo) SaveTrade(trade *Trade, orders ...*Order) error {
+	r.mu.Lock()
+	if r.saveTradeErr != nil {
+		r.mu.Unlock()
+		return r.saveTradeErr
+	}
+	t := *trade
+	r.trades = append(r.trades, &t)
+	r.mu.Unlock()
+	for _, o := range orders {
+		_ = r.UpdateOrder(o)
+	}
+	return nil
+}
+
+func (r *memRepo) SaveOrderGroup(group *OrderGroup) error {
+	if r.saveGroupErr != nil {
+		return r.saveGroupErr
+	}
+	return r.UpdateOrderGroup(group)
+}
+
+func (r *memRepo) UpdateOrderGroup(group *OrderGroup) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.groups[group.ID] = group.clone()
+	return nil
+}
+
+func (r *memRepo) tradeCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.trades)
+}
+
+func (r *memRepo) FindTrade(id string) (*Trade, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.trades {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memRepo) tradeList() []*Trade {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Trade(nil), r.trades...)
+}
+
+func (r *memRepo) order(id string) *Order {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.orders[id]
+}
+
+// memBalances é um BalanceService (e ReceivableBalanceService) em memória; o
+// símbolo recebido é a chave do ativo (o quote chega como símbolo + "_QUOTE").
+type memBalances struct {
+	mu       sync.Mutex
+	avail    map[string]decimal.Decimal
+	locked   map[string]decimal.Decimal
+	reserved map[string]decimal.Decimal
+	// reserveErr, se definido, é devolvido pelas reservas de recebível.
+	reserveErr error
+}
+
+func newMemBalances() *memBalances {
+	return &memBalances{
+		avail:    make(map[string]decimal.Decimal),
+		locked:   make(map[string]decimal.Decimal),
+		reserved: make(map[string]decimal.Decimal),
+	}
+}
+
+func balanceKey(userID, asset string) string { return userID + "|" + asset }
+
+func (b *memBalances) deposit(userID, asset string, amount decimal.Decimal) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	k := balanceKey(userID, asset)
+	b.avail[k] = b.avail[k].Add(amount)
+}
+
+func (b *memBalances) get(userID, asset string) (avail, locked decimal.Decimal) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	k := balanceKey(userID, asset)
+	return b.avail[k], b.locked[k]
+}
+
+func (b *memBalances) canLock(userID, asset string, amount decimal.Decimal) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.avail[balanceKey(userID, asset)].GreaterThanOrEqual(amount)
+}
+
+func (b *memBalances) lock(userID, asset string, amount decimal.Decimal) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	k := balanceKey(userID, asset)
+	if b.avail[k].LessThan(amount) {
+		return ErrInsufficientQuote
+	}
+	b.avail[k] = b.avail[k].Sub(amount)
+	b.locked[k] = b.locked[k].Add(amount)
+	return nil
+}
+
+func (b *memBalances) release(userID, asset string, amount decimal.Decimal) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	k := balanceKey(userID, asset)
+	b.locked[k] = b.locked[k].Sub(amount)
+	b.avail[k] = b.avail[k].Add(amount)
+	return nil
+}
+
+func (b *memBalances) getReserved(userID, asset string) decimal.Decimal {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reserved[balanceKey(userID, asset)]
+}
+
+func (b *memBalances) reserve(userID, asset string, amount decimal.Decimal) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.reserveErr != nil {
+		return b.reserveErr
+	}
+	k := balanceKey(userID, asset)
+	b.reserved[k] = b.reserved[k].Add(amount)
+	return nil
+}
+
+func (b *memBalances) releaseReserved(userID, asset string, amount decimal.Decimal) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	k := balanceKey(userID, asset)
+	pending := decimal.Min(amount, b.reserved[k])
+	b.reserved[k] = b.reserved[k].Sub(pending)
+	rest := amount.Sub(pending)
+	b.locked[k] = b.locked[k].Sub(rest)
+	b.avail[k] = b.avail[k].Add(rest)
+	return nil
+}
+
+func (b *memBalances) LockReceivableBase(u, s string, q decimal.Decimal) error {
+	return b.reserve(u, s, q)
+}
+func (b *memBalances) LockReceivableQuote(u, s string, q decimal.Decimal) error {
+	return b.reserve(u, s, q)
+}
+func (b *memBalances) ReleaseReceivableBase(u, s string, q decimal.Decimal) error {
+	return b.releaseReserved(u, s, q)
+}
+func (b *memBalances) ReleaseReceivableQuote(u, s string, q decimal.Decimal) error {
+	return b.releaseReserved(u, s, q)
+}
+
+func (b *memBalances) CanLockBase(u, s string, q decimal.Decimal) bool   { return b.canLock(u, s, q) }
+func (b *memBalances) CanLockQuote(u, s string, q decimal.Decimal) bool  { return b.canLock(u, s, q) }
+func (b *memBalances) LockBase(u, s string, q decimal.Decimal) error     { return b.lock(u, s, q) }
+func (b *memBalances) LockQuote(u, s string, q decimal.Decimal) error    { return b.lock(u, s, q) }
+func (b *memBalances) ReleaseBase(u, s string, q decimal.Decimal) error  { return b.release(u, s, q) }
+func (b *memBalances) ReleaseQuote(u, s string, q decimal.Decimal) error { return b.release(u, s, q) }
+
+type nopEvents struct{}
+
+func (nopEvents) PublishOrderBookUpdate(string, OrderBookSnapshot) error { return nil }
+func (nopEvents) PublishTrade(*Trade) error                              { return nil }
+func (nopEvents) PublishOrderEvent(*OrderEvent) error                    { return nil }
+func (nopEvents) PublishOrderUpdate(*Order) error                        { return nil }
+
+// newTestEngine cria um MatchingEngine com repositório e saldos em memória.
+func newTestEngine(t testing.TB) (*MatchingEngine, *memRepo, *memBalances) {
+	t.Helper()
+	repo, balances := newMemRepo(), newMemBalances()
+	me := NewMatchingEngine(repo, balances, nopEvents{}, nil)
+	t.Cleanup(me.Stop)
+	return me, repo, balances
+}
+
+func d(s string) decimal.Decimal { return decimal.RequireFromString(s) }
+
+// fund credita base e quote suficientes para o usuário operar em symbol.
+func fund(b *memBalances, userID, symbol string) {
+	b.deposit(userID, symbol, d("1000000"))
+	b.deposit(userID, symbol+"_QUOTE", d("1000000"))
+}
+
+func limit(userID, symbol string, side Side, price, qty string) NewOrderRequest {
+	return NewOrderRequest{
+		UserID:   userID,
+		Symbol:   symbol,
+		Side:     side,
+		Type:     OrderTypeLimit,
+		Price:    d(price),
+		Quantity: d(qty),
+	}
+}
+
+func mustPlace(t testing.TB, me *MatchingEngine, req NewOrderRequest) *Order {
+	t.Helper()
+	order, err := me.PlaceOrder(req)
+	if err != nil {
+		t.Fatalf("PlaceOrder(%s %s %s@%s): %v", req.Side, req.Type, req.Quantity, req.Price, err)
+	}
+	return order
+}
+
+// memWallet implementa AssetRepository, WalletRepository e LedgerRepository
+// para montar uma WalletEngine real em memória.
+type memWallet struct {
+	mu       sync.Mutex
+	accounts map[string]*WalletAccount
+	balances map[string]Balance
+	entries  []LedgerEntry
+	keys     map[string]LedgerEntry
+	// failPost, se definido, pode recusar um PostEntry.
+	failPost func(entry *LedgerEntry) error
+}
+
+func newMemWallet() *memWallet {
+	return &memWallet{
+		accounts: make(map[string]*WalletAccount),
+		balances: make(map[string]Balance),
+		keys:     make(map[string]LedgerEntry),
+	}
+}
+
+// newTestWallet devolve uma WalletEngine sobre memWallet.
+func newTestWallet() (*WalletEngine, *memWallet) {
+	mw := newMemWallet()
+	return NewWalletEngine(mw, mw, mw, nil, nil), mw
+}
+
+func (w *memWallet) GetAsset(string) (*Asset, error) { return nil, nil }
+func (w *memWallet) ListAssets() ([]*Asset, error)   { return nil, nil }
+func (w *memWallet) SaveAsset(*Asset) error          { return nil }
+func (w *memWallet) UpdateAsset(*Asset) error        { return nil }
+func (w *memWallet) GetAccount(u, a string) (*WalletAccount, error) {
+	return w.GetOrCreateAccount(u, a)
+}
+
+func (w *memWallet) GetOrCreateAccount(userID, asset string) (*WalletAccount, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	k := balanceKey(userID, asset)
+	if acc, ok := w.accounts[k]; ok {
+		return acc, nil
+	}
+	acc := &WalletAccount{ID: k, UserID: userID, Asset: asset}
+	w.accounts[k] = acc
+	return acc, nil
+}
+
+func (w *memWallet) GetBalance(accountID string) (*Balance, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	bal, ok := w.balances[accountID]
+	if !ok {
+		return nil, nil
+	}
+	return &bal, nil
+}
+
+func (w *memWallet) SaveBalance(b *Balance) error { return w.UpdateBalance(b) }
+
+func (w *memWallet) UpdateBalance(b *Balance) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.balances[b.AccountID] = *b
+	return nil
+}
+
+func (w *memWallet) SaveEntry(entry *LedgerEntry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.entries = append(w.entries, *entry)
+	if entry.Key != "" {
+		w.keys[entry.Key] = *entry
+	}
+	return nil
+}
+
+func (w *memWallet) ListEntriesByAccount(string, int) ([]*LedgerEntry, error) { return nil, nil }
+
+func (w *memWallet) FindEntryByKey(key string) (*LedgerEntry, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if e, ok := w.keys[key]; ok {
+		return &e, nil
+	}
+	return nil, nil
+}
+
+func (w *memWallet) PostEntry(entry *LedgerEntry, bal *Balance) error {
+	if w.failPost != nil {
+		if err := w.failPost(entry); err != nil {
+			return err
+		}
+	}
+	if err := w.UpdateBalance(bal); err != nil {
+		return err
+	}
+	return w.SaveEntry(entry)
+}
+
+// set define o saldo de userID em asset.
+func (w *memWallet) set(userID, asset string, avail, locked decimal.Decimal) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	k := balanceKey(userID, asset)
+	w.accounts[k] = &WalletAccount{ID: k, UserID: userID, Asset: asset}
+	w.balances[k] = Balance{AccountID: k, Available: avail, Locked: locked}
+}
+
+func (w *memWallet) get(userID, asset string) (avail, locked decimal.Decimal) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	bal := w.balances[balanceKey(userID, asset)]
+	return bal.Available, bal.Locked
+}
+
+func (r *memRepo) group(id string) *OrderGroup {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.groups[id]
+}
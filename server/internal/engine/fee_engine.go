@@ -0,0 +1,314 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
+
+var ErrInvalidFeeSchedule = errors.New("invalid fee schedule")
+
+// feeVolumeWindow é a janela de volume que define o tier da conta.
+const feeVolumeWindow = 30 * 24 * time.Hour
+
+// FeeTier é a faixa de taxas para contas com volume em 30 dias (em quote) a
+// partir de MinVolume. Taxas são frações do notional; MakerRate negativa é um
+// rebate pago pela conta de taxas.
+type FeeTier struct {
+	Name      string
+	MinVolume decimal.Decimal
+	MakerRate decimal.Decimal
+	TakerRate decimal.Decimal
+}
+
+// FeeVolumeRepository guarda o volume negociado por conta para o cálculo do
+// tier.
+type FeeVolumeRepository interface {
+	AddVolume(userID string, at time.Time, notional decimal.Decimal) error
+	VolumeSince(userID string, since time.Time) (decimal.Decimal, error)
+}
+
+type FeeConfig struct {
+	// QuoteAssets mapeia o mercado ao ativo em que as taxas são cobradas
+	// (padrão: símbolo + "_QUOTE"). Precisa ser o ativo quote da liquidação:
+	// é o ClearingEngine quem cobra as taxas.
+	QuoteAssets map[string]string
+}
+
+// FeeEngine calcula as taxas maker/taker de cada trade lit e block trade,
+// pelo tier da conta no mercado, e as grava no trade. Nada é lançado na
+// wallet aqui: o ClearingEngine desconta as taxas das pernas em quote da
+// liquidação e as credita à sua FeeAccount.
+//
+// O tier sai de um cache do volume em 30 dias de cada conta, nunca do
+// repositório, porque o cálculo roda no sequenciador. O worker de Start grava
+// o volume dos trades e recarrega o cache; uma conta que ainda não está no
+// cache paga o primeiro tier até ser carregada.
+type FeeEngine struct {
+	volumes FeeVolumeRepository
+	cfg     FeeConfig
+
+	mu sync.RWMutex
+	// schedules por mercado; "" é a tabela padrão.
+	schedules map[string][]FeeTier
+	// cached é o volume em 30 dias por conta, como o worker o leu.
+	cached map[string]decimal.Decimal
+
+	feedMu  sync.Mutex
+	pending []feeVolume
+	misses  map[string]struct{}
+	signal  chan struct{}
+}
+
+// feeVolume é o notional de um trade a somar ao volume de uma conta.
+type feeVolume struct {
+	userID   string
+	at       time.Time
+	notional decimal.Decimal
+}
+
+func NewFeeEngine(volumes FeeVolumeRepository, cfg FeeConfig) *FeeEngine {
+	return &FeeEngine{
+		volumes:   volumes,
+		cfg:       cfg,
+		schedules: make(map[string][]FeeTier),
+		cached:    make(map[string]decimal.Decimal),
+		misses:    make(map[string]struct{}),
+		signal:    make(chan struct{}, 1),
+	}
+}
+
+// SetSchedule define os tiers do mercado (symbol vazio = padrão). Precisa de
+// um tier com MinVolume zero.
+func (fe *FeeEngine) SetSchedule(symbol string, tiers []FeeTier) error {
+	sorted := append([]FeeTier(nil), tiers...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].MinVolume.LessThan(sorted[j].MinVolume) })
+	if len(sorted) == 0 || !sorted[0].MinVolume.IsZero() {
+		return ErrInvalidFeeSchedule
+	}
+	for _, t := range sorted {
+		if t.TakerRate.IsNegative() || t.MakerRate.Add(t.TakerRate).IsNegative() {
+			return ErrInvalidFeeSchedule
+		}
+	}
+
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	fe.schedules[symbol] = sorted
+	return nil
+}
+
+// TierFor devolve o tier da conta no mercado pelo volume em cache. Uma conta
+// fora do cache fica com o primeiro tier e é carregada pelo worker.
+func (fe *FeeEngine) TierFor(userID, symbol string) FeeTier {
+	fe.mu.RLock()
+	tiers, ok := fe.schedules[symbol]
+	if !ok {
+		tiers = fe.schedules[""]
+	}
+	volume, cached := fe.cached[userID]
+	fe.mu.RUnlock()
+	if len(tiers) == 0 {
+		return FeeTier{}
+	}
+	if !cached {
+		fe.feedMu.Lock()
+		fe.misses[userID] = struct{}{}
+		fe.feedMu.Unlock()
+		fe.wake()
+	}
+
+	tier := tiers[0]
+	for _, t := range tiers[1:] {
+		if volume.GreaterThanOrEqual(t.MinVolume) {
+			tier = t
+		}
+	}
+	return tier
+}
+
+func (fe *FeeEngine) feeAsset(symbol string) string {
+	if a, ok := fe.cfg.QuoteAssets[symbol]; ok {
+		return a
+	}
+	return symbol + "_QUOTE"
+}
+
+// AssessTrade grava no trade do MatchingEngine as taxas das duas pontas (o
+// lado TakerSide paga a taxa taker, o outro a maker). Um trade já avaliado
+// (FeeAsset preenchido) não é recalculado nem soma volume de novo.
+func (fe *FeeEngine) AssessTrade(trade *Trade) {
+	if trade.FeeAsset != "" {
+		return
+	}
+	maker := SideBuy
+	if trade.TakerSide == SideBuy {
+		maker = SideSell
+	}
+	trade.BuyerFee, trade.SellerFee = fe.assess(trade.Symbol, trade.BuyerID, trade.SellerID, maker, trade.Price.Mul(trade.Quantity), trade.CreatedAt)
+	trade.FeeAsset = fe.feeAsset(trade.Symbol)
+}
+
+// AssessBlockTrade grava as taxas de um block trade negociado no dark pool:
+// sem agressor, as duas pontas pagam a taxa taker.
+func (fe *FeeEngine) AssessBlockTrade(bt *BlockTrade) {
+	if bt.FeeAsset != "" {
+		return
+	}
+	bt.BuyerFee, bt.SellerFee = fe.assess(bt.Symbol, bt.BuyerID, bt.SellerID, "", bt.Price.Mul(bt.Quantity), bt.CreatedAt)
+	bt.FeeAsset = fe.feeAsset(bt.Symbol)
+}
+
+// assess calcula a taxa de cada ponta pelo tier anterior ao trade (maker é o
+// lado que paga a taxa maker; vazio = nenhum) e enfileira o notional para o
+// volume das duas contas.
+func (fe *FeeEngine) assess(symbol, buyerID, sellerID string, maker Side, notional decimal.Decimal, at time.Time) (buyerFee, sellerFee decimal.Decimal) {
+	buyerTier, sellerTier := fe.TierFor(buyerID, symbol), fe.TierFor(sellerID, symbol)
+	buyerRate, sellerRate := buyerTier.TakerRate, sellerTier.TakerRate
+	switch maker {
+	case SideBuy:
+		buyerRate = buyerTier.MakerRate
+	case SideSell:
+		sellerRate = sellerTier.MakerRate
+	}
+
+	fe.feedMu.Lock()
+	fe.pending = append(fe.pending,
+		feeVolume{userID: buyerID, at: at, notional: notional},
+		feeVolume{userID: sellerID, at: at, notional: notional})
+	fe.feedMu.Unlock()
+	fe.wake()
+	return notional.Mul(buyerRate), notional.Mul(sellerRate)
+}
+
+func (fe *FeeEngine) wake() {
+	select {
+	case fe.signal <- struct{}{}:
+	default:
+	}
+}
+
+// Start inicia o worker que grava o volume dos trades avaliados e mantém o
+// cache de tiers: as contas tocadas são relidas a cada lote gravado e todas
+// as do cache a cada refresh, para que a janela de 30 dias avance. Volume que
+// não pôde ser gravado é retentado no próximo ciclo.
+func (fe *FeeEngine) Start(ctx context.Context, refresh time.Duration) {
+	ticker := time.NewTicker(refresh)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-fe.signal:
+				fe.flush(false)
+			case <-ticker.C:
+				fe.flush(true)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// flush grava o volume pendente e recarrega do repositório as contas tocadas
+// (all: todas as do cache).
+func (fe *FeeEngine) flush(all bool) {
+	fe.feedMu.Lock()
+	pending, misses := fe.pending, fe.misses
+	fe.pending, fe.misses = nil, make(map[string]struct{})
+	fe.feedMu.Unlock()
+
+	reload := misses
+	for i, v := range pending {
+		if err := fe.volumes.AddVolume(v.userID, v.at, v.notional); err != nil {
+			log.Printf("[Fees] volume for %s failed: %v", v.userID, err)
+			fe.feedMu.Lock()
+			fe.pending = append(pending[i:len(pending):len(pending)], fe.pending...)
+			fe.feedMu.Unlock()
+			break
+		}
+		reload[v.userID] = struct{}{}
+	}
+	if all {
+		fe.mu.RLock()
+		for userID := range fe.cached {
+			reload[userID] = struct{}{}
+		}
+		fe.mu.RUnlock()
+	}
+
+	since := time.Now().Add(-feeVolumeWindow)
+	for userID := range reload {
+		volume, err := fe.volumes.VolumeSince(userID, since)
+		if err != nil {
+			log.Printf("[Fees] volume lookup for %s failed: %v", userID, err)
+			continue
+		}
+		fe.mu.Lock()
+		fe.cached[userID] = volume
+		fe.mu.Unlock()
+	}
+}
+
+// MemoryFeeVolumes é um FeeVolumeRepository em memória com baldes diários.
+type MemoryFeeVolumes struct {
+	mu   sync.Mutex
+	days map[string]map[time.Time]decimal.Decimal
+}
+
+func NewMemoryFeeVolumes() *MemoryFeeVolumes {
+	return &MemoryFeeVolumes{days: make(map[string]map[time.Time]decimal.Decimal)}
+}
+
+func (v *MemoryFeeVolumes) AddVolume(userID string, at time.Time, notional decimal.Decimal) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	buckets, ok := v.days[userID]
+	if !ok {
+		buckets = make(map[time.Time]decimal.Decimal)
+		v.days[userID] = buckets
+	}
+	day := at.UTC().Truncate(24 * time.Hour)
+	buckets[day] = buckets[day].Add(notional)
+	// descarta baldes fora da janela
+	for d := range buckets {
+		if d.Before(day.Add(-feeVolumeWindow)) {
+			delete(buckets, d)
+		}
+	}
+	return nil
+}
+
+func (v *MemoryFeeVolumes) VolumeSince(userID string, since time.Time) (decimal.Decimal, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var total decimal.Decimal
+	for day, vol := range v.days[userID] {
+		if !day.Before(since.UTC().Truncate(24 * time.Hour)) {
+			total = total.Add(vol)
+		}
+	}
+	return total, nil
+}
+
+// SetFeeEngine liga o cálculo de taxas a cada trade executado. As taxas são
+// calculadas no sequenciador, antes de o trade ir ao journal (o replay as
+// reaproveita), e cobradas pelo clearing na liquidação.
+func (me *MatchingEngine) SetFeeEngine(fe *FeeEngine) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.fees = fe
+}
+
+func (me *MatchingEngine) assessFees(trade *Trade) {
+	me.mu.RLock()
+	fe := me.fees
+	me.mu.RUnlock()
+	if fe != nil {
+		fe.AssessTrade(trade)
+	}
+}
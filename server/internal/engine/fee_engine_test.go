@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
+
+// countedVolumes conta as leituras e pode falhar as gravações do repositório.
+type countedVolumes struct {
+	*MemoryFeeVolumes
+	lookups int
+	failAdd error
+}
+
+func (v *countedVolumes) AddVolume(userID string, at time.Time, notional decimal.Decimal) error {
+	if v.failAdd != nil {
+		return v.failAdd
+	}
+	return v.MemoryFeeVolumes.AddVolume(userID, at, notional)
+}
+
+func (v *countedVolumes) VolumeSince(userID string, since time.Time) (decimal.Decimal, error) {
+	v.lookups++
+	return v.MemoryFeeVolumes.VolumeSince(userID, since)
+}
+
+func newTestFeeEngine(t *testing.T) (*FeeEngine, *countedVolumes) {
+	t.Helper()
+	volumes := &countedVolumes{MemoryFeeVolumes: NewMemoryFeeVolumes()}
+	fe := NewFeeEngine(volumes, FeeConfig{QuoteAssets: map[string]string{"AAA": "USD"}})
+	if err := fe.SetSchedule("", []FeeTier{
+		{Name: "base", MakerRate: d("0.001"), TakerRate: d("0.002")},
+		{Name: "vip", MinVolume: d("1000"), MakerRate: d("-0.0005"), TakerRate: d("0.001")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return fe, volumes
+}
+
+func testTrade(id string) *Trade {
+	return &Trade{ID: id, Symbol: "AAA", BuyerID: "buyer", SellerID: "seller", TakerSide: SideBuy, Price: d("10"), Quantity: d("10"), CreatedAt: time.Now()}
+}
+
+func TestFeeTierComesFromCache(t *testing.T) {
+	fe, volumes := newTestFeeEngine(t)
+	_ = volumes.MemoryFeeVolumes.AddVolume("seller", time.Now(), d("5000"))
+
+	// fora do cache: primeiro tier, sem ler o repositório
+	first := testTrade("t1")
+	fe.AssessTrade(first)
+	if volumes.lookups != 0 {
+		t.Fatalf("AssessTrade read the repository %d times", volumes.lookups)
+	}
+	if !first.BuyerFee.Equal(d("0.2")) || !first.SellerFee.Equal(d("0.1")) || first.FeeAsset != "USD" {
+		t.Fatalf("first trade fees = %s/%s %s, want 0.2/0.1 USD", first.BuyerFee, first.SellerFee, first.FeeAsset)
+	}
+
+	fe.flush(false)
+	lookups := volumes.lookups
+	second := testTrade("t2")
+	fe.AssessTrade(second)
+	if volumes.lookups != lookups {
+		t.Fatal("AssessTrade read the repository after the cache was loaded")
+	}
+	// o vendedor, maker com volume de vip, recebe rebate
+	if !second.BuyerFee.Equal(d("0.2")) || !second.SellerFee.Equal(d("-0.05")) {
+		t.Fatalf("second trade fees = %s/%s, want 0.2 and a -0.05 rebate", second.BuyerFee, second.SellerFee)
+	}
+}
+
+func TestFeeAssessmentRecordsVolumeOnce(t *testing.T) {
+	fe, volumes := newTestFeeEngine(t)
+	trade := testTrade("t1")
+	fe.AssessTrade(trade)
+	fe.AssessTrade(trade)
+	fe.flush(false)
+
+	for _, u := range []string{"buyer", "seller"} {
+		if v, _ := volumes.MemoryFeeVolumes.VolumeSince(u, time.Time{}); !v.Equal(d("100")) {
+			t.Fatalf("%s volume = %s, want 100 recorded once", u, v)
+		}
+	}
+}
+
+func TestFeeVolumeRetriedAfterFailure(t *testing.T) {
+	fe, volumes := newTestFeeEngine(t)
+	volumes.failAdd = errors.New("db down")
+	fe.AssessTrade(testTrade("t1"))
+	fe.flush(false)
+	if v, _ := volumes.MemoryFeeVolumes.VolumeSince("buyer", time.Time{}); !v.IsZero() {
+		t.Fatalf("buyer volume = %s while the repository fails", v)
+	}
+
+	volumes.failAdd = nil
+	fe.flush(false)
+	for _, u := range []string{"buyer", "seller"} {
+		if v, _ := volumes.MemoryFeeVolumes.VolumeSince(u, time.Time{}); !v.Equal(d("100")) {
+			t.Fatalf("%s volume = %s, want 100 after the retry", u, v)
+		}
+	}
+}
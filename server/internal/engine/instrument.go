@@ -0,0 +1,451 @@
+package engine
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
+
+var (
+	ErrUnknownMarket        = errors.New("unknown market")
+	ErrMarketNotOpen        = errors.New("market is not open for trading")
+	ErrMarketDelisted       = errors.New("market is delisted")
+	ErrInvalidInstrument    = errors.New("invalid instrument specification")
+	ErrPriceNotOnTick       = errors.New("price is not a multiple of the tick size")
+	ErrQtyNotOnLot          = errors.New("quantity is not a multiple of the lot size")
+	ErrQtyBelowMinimum      = errors.New("quantity below market minimum")
+	ErrQtyAboveMaximum      = errors.New("quantity above market maximum")
+	ErrNotionalBelowMinimum = errors.New("order notional below market minimum")
+)
+
+// Instrument é a especificação de negociação de um mercado. Campos zerados
+// não restringem (ex.: MaxQty 0 = sem máximo).
+type Instrument struct {
+	Symbol     string
+	BaseAsset  string
+	QuoteAsset string
+
+	TickSize    decimal.Decimal
+	LotSize     decimal.Decimal
+	MinQty      decimal.Decimal
+	MaxQty      decimal.Decimal
+	MinNotional decimal.Decimal
+
+	Status    MarketStatus
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// InstrumentRegistry guarda as especificações dos mercados e implementa
+// MarketRegistry: ActivateListing cria o mercado com a especificação padrão,
+// que pode ser ajustada depois via Register.
+//
+// Com InstrumentRepository, cada mudança (especificação ou status) é gravada
+// antes de valer e Load restaura o registro na subida: um halt ou delist
+// sobrevive ao reinício.
+type InstrumentRegistry struct {
+	repo InstrumentRepository
+	// writeMu serializa as mudanças, gravadas fora de mu para não segurar as
+	// leituras do sequenciador durante o acesso ao repositório.
+	writeMu     sync.Mutex
+	mu          sync.RWMutex
+	defaults    Instrument
+	instruments map[string]*Instrument
+	watchers    []func(symbol string, from, to MarketStatus)
+}
+
+// NewInstrumentRegistry usa defaults (tick, lote, mínimos e QuoteAsset) para
+// os mercados criados por CreateMarket. repo pode ser nil (só memória).
+func NewInstrumentRegistry(defaults Instrument, repo InstrumentRepository) *InstrumentRegistry {
+	return &InstrumentRegistry{
+		repo:        repo,
+		defaults:    defaults,
+		instruments: make(map[string]*Instrument),
+	}
+}
+
+// Load carrega os mercados gravados no repositório, sem avisar os watchers.
+// Chame antes de ligar o registro ao engine.
+func (r *InstrumentRegistry) Load() error {
+	if r.repo == nil {
+		return nil
+	}
+	stored, err := r.repo.ListInstruments()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, inst := range stored {
+		r.instruments[inst.Symbol] = inst
+	}
+	return nil
+}
+
+// Register define ou substitui a especificação de um mercado. Um mercado já
+// existente mantém o status; um novo abre como OPEN se Status vier vazio.
+func (r *InstrumentRegistry) Register(spec Instrument) error {
+	if err := spec.validateSpec(); err != nil {
+		return err
+	}
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	now := time.Now()
+	if cur, ok := r.Get(spec.Symbol); ok {
+		spec.Status = cur.Status
+		spec.CreatedAt = cur.CreatedAt
+	} else {
+		if spec.Status == "" {
+			spec.Status = MarketStatusOpen
+		}
+		spec.CreatedAt = now
+	}
+	if spec.BaseAsset == "" {
+		spec.BaseAsset = spec.Symbol
+	}
+	spec.UpdatedAt = now
+	return r.store(&spec)
+}
+
+// CreateMarket abre um mercado novo com a especificação padrão (os watchers
+// recebem from vazio) ou reabre um existente.
+func (r *InstrumentRegistry) CreateMarket(symbol string) error {
+	r.writeMu.Lock()
+	if _, ok := r.Get(symbol); ok {
+		r.writeMu.Unlock()
+		return r.setStatus(symbol, MarketStatusOpen)
+	}
+
+	now := time.Now()
+	spec := r.defaults
+	spec.Symbol = symbol
+	spec.BaseAsset = symbol
+	spec.Status = MarketStatusOpen
+	spec.CreatedAt = now
+	spec.UpdatedAt = now
+	err := r.store(&spec)
+	r.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range r.watcherList() {
+		fn(symbol, "", MarketStatusOpen)
+	}
+	return nil
+}
+
+func (r *InstrumentRegistry) SuspendMarket(symbol string) error {
+	return r.setStatus(symbol, MarketStatusSuspended)
+}
+
+func (r *InstrumentRegistry) ResumeMarket(symbol string) error {
+	return r.setStatus(symbol, MarketStatusOpen)
+}
+
+func (r *InstrumentRegistry) DelistMarket(symbol string) error {
+	return r.setStatus(symbol, MarketStatusDelisted)
+}
+
+// GetMarketStatus e SetMarketStatus implementam MarketStatusRepository, para
+// que o CircuitBreakerEngine marque halts no registro.
+func (r *InstrumentRegistry) GetMarketStatus(symbol string) (MarketStatus, error) {
+	inst, ok := r.Get(symbol)
+	if !ok {
+		return "", ErrUnknownMarket
+	}
+	return inst.Status, nil
+}
+
+func (r *InstrumentRegistry) SetMarketStatus(symbol string, status MarketStatus) error {
+	if !validMarketStatus(status) {
+		return ErrInvalidMarketStatus
+	}
+	return r.setStatus(symbol, status)
+}
+
+// Watch registra fn para ser chamada, fora do lock, a cada mudança de status.
+// Um mercado criado por CreateMarket chega com from vazio.
+func (r *InstrumentRegistry) Watch(fn func(symbol string, from, to MarketStatus)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.watchers = append(r.watchers, fn)
+}
+
+func (r *InstrumentRegistry) watcherList() []func(string, MarketStatus, MarketStatus) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]func(string, MarketStatus, MarketStatus){}, r.watchers...)
+}
+
+func (r *InstrumentRegistry) setStatus(symbol string, status MarketStatus) error {
+	r.writeMu.Lock()
+	inst, ok := r.Get(symbol)
+	if !ok {
+		r.writeMu.Unlock()
+		return ErrUnknownMarket
+	}
+	if inst.Status == status {
+		r.writeMu.Unlock()
+		return nil
+	}
+	if inst.Status == MarketStatusDelisted {
+		r.writeMu.Unlock()
+		return ErrMarketDelisted
+	}
+	from := inst.Status
+	inst.Status = status
+	inst.UpdatedAt = time.Now()
+	err := r.store(&inst)
+	r.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range r.watcherList() {
+		fn(symbol, from, status)
+	}
+	return nil
+}
+
+// store grava inst no repositório e só então o publica no registro. Chamado
+// com writeMu.
+func (r *InstrumentRegistry) store(inst *Instrument) error {
+	if r.repo != nil {
+		if err := r.repo.SaveInstrument(inst); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.instruments[inst.Symbol] = inst
+	return nil
+}
+
+// Get devolve uma cópia da especificação do mercado.
+func (r *InstrumentRegistry) Get(symbol string) (Instrument, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	inst, ok := r.instruments[symbol]
+	if !ok {
+		return Instrument{}, false
+	}
+	return *inst, true
+}
+
+// List devolve os mercados ordenados por símbolo.
+func (r *InstrumentRegistry) List() []Instrument {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Instrument, 0, len(r.instruments))
+	for _, inst := range r.instruments {
+		out = append(out, *inst)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out
+}
+
+func (i *Instrument) validateSpec() error {
+	if i.Symbol == "" || i.TickSize.IsNegative() || i.LotSize.IsNegative() ||
+		i.MinQty.IsNegative() || i.MaxQty.IsNegative() || i.MinNotional.IsNegative() {
+		return ErrInvalidInstrument
+	}
+	if i.MaxQty.IsPositive() && i.MaxQty.LessThan(i.MinQty) {
+		return ErrInvalidInstrument
+	}
+	return nil
+}
+
+func (i *Instrument) checkPrice(price decimal.Decimal) error {
+	if price.IsPositive() && !price.IsMultipleOf(i.TickSize) {
+		return ErrPriceNotOnTick
+	}
+	return nil
+}
+
+func (i *Instrument) checkQty(qty decimal.Decimal) error {
+	if !qty.IsMultipleOf(i.LotSize) {
+		return ErrQtyNotOnLot
+	}
+	if qty.LessThan(i.MinQty) {
+		return ErrQtyBelowMinimum
+	}
+	if i.MaxQty.IsPositive() && qty.GreaterThan(i.MaxQty) {
+		return ErrQtyAboveMaximum
+	}
+	return nil
+}
+
+func (i *Instrument) checkNotional(notional decimal.Decimal) error {
+	if notional.LessThan(i.MinNotional) {
+		return ErrNotionalBelowMinimum
+	}
+	return nil
+}
+
+// validateOrder confere a ordem contra a especificação. O notional de MARKET
+// por quantidade só é conhecido ao percorrer o book (sizeMarketOrder).
+func (i *Instrument) validateOrder(order *Order) error {
+	for _, p := range []decimal.Decimal{order.Price, order.StopPrice, order.TrailingAmount} {
+		if err := i.checkPrice(p); err != nil {
+			return err
+		}
+	}
+
+	if order.QuoteQty.IsPositive() {
+		return i.checkNotional(order.QuoteQty)
+	}
+	if err := i.checkQty(order.Quantity); err != nil {
+		return err
+	}
+	if order.DisplayQty.IsPositive() && !order.DisplayQty.IsMultipleOf(i.LotSize) {
+		return ErrQtyNotOnLot
+	}
+
+	ref := order.Price
+	if ref.IsZero() {
+		ref = order.StopPrice
+	}
+	if ref.IsPositive() {
+		notional, err := orderNotional(ref, order.Quantity)
+		if err != nil {
+			return err
+		}
+		return i.checkNotional(notional)
+	}
+	return nil
+}
+
+// SetInstruments liga o registro de mercados ao engine: PlaceOrder, grupos e
+// amend passam a validar tick, lote, limites de quantidade e notional mínimo,
+// e as mudanças de status do registro (suspensão, delist, halt) chegam aos
+// sequenciadores. Sem registro qualquer preço e quantidade são aceitos.
+//
+// Com journal, ligue o registro entre AttachJournal e Recover: o replay usa
+// tick e lote do registro, e os status só são levados aos sequenciadores
+// depois dele (syncInstruments), para não gravar no journal comandos
+// anteriores aos que ainda serão reaplicados.
+func (me *MatchingEngine) SetInstruments(reg *InstrumentRegistry) {
+	me.mu.Lock()
+	me.instruments = reg
+	me.mu.Unlock()
+
+	reg.Watch(func(symbol string, from, to MarketStatus) {
+		if !me.instrumentsLive() {
+			return
+		}
+		if from == "" {
+			_ = me.openMarket(symbol)
+			return
+		}
+		_ = me.applyMarketStatus(symbol, to)
+	})
+	if me.instrumentsLive() {
+		me.syncInstruments()
+	}
+}
+
+// instrumentsLive diz se as mudanças do registro já podem ir aos
+// sequenciadores: com journal, só depois do Recover.
+func (me *MatchingEngine) instrumentsLive() bool {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	return me.journal == nil || me.recovered
+}
+
+// syncInstruments leva aos sequenciadores o status do registro, que prevalece
+// sobre o do journal: uma mudança gravada no registro pouco antes de uma
+// queda pode não ter chegado ao sequenciador. Um leilão em curso não é
+// interrompido por um OPEN do registro.
+func (me *MatchingEngine) syncInstruments() {
+	me.mu.RLock()
+	reg := me.instruments
+	me.mu.RUnlock()
+	if reg == nil {
+		return
+	}
+	for _, inst := range reg.List() {
+		if cur, _ := me.GetMarketStatus(inst.Symbol); cur == MarketStatusAuction && inst.Status == MarketStatusOpen {
+			continue
+		}
+		if err := me.applyMarketStatus(inst.Symbol, inst.Status); err != nil {
+			log.Printf("[Matching] %s: registry status %s not applied: %v", inst.Symbol, inst.Status, err)
+		}
+	}
+}
+
+// instrument devolve a especificação do símbolo; ok=false sem registro.
+func (me *MatchingEngine) instrument(symbol string) (Instrument, bool, error) {
+	me.mu.RLock()
+	reg := me.instruments
+	me.mu.RUnlock()
+	if reg == nil {
+		return Instrument{}, false, nil
+	}
+	inst, ok := reg.Get(symbol)
+	if !ok {
+		return Instrument{}, false, ErrUnknownMarket
+	}
+	return inst, true, nil
+}
+
+// checkInstrument valida uma ordem nova contra o mercado do seu símbolo.
+func (me *MatchingEngine) checkInstrument(order *Order) error {
+	inst, ok, err := me.instrument(order.Symbol)
+	if !ok {
+		return err
+	}
+	return inst.validateOrder(order)
+}
+
+// lotSize é o lote do mercado (zero = sem restrição), usado para arredondar
+// quantidades derivadas de valores em quote.
+func (m *market) lotSize() decimal.Decimal {
+	inst, ok, _ := m.engine.instrument(m.symbol)
+	if !ok {
+		return decimal.Zero
+	}
+	return inst.LotSize
+}
+
+// tickSize é o tick do mercado (zero = sem restrição), usado para arredondar
+// preços derivados, como o gatilho de um trailing stop.
+func (m *market) tickSize() decimal.Decimal {
+	inst, ok, _ := m.engine.instrument(m.symbol)
+	if !ok {
+		return decimal.Zero
+	}
+	return inst.TickSize
+}
+
+// priceStep é o menor incremento de preço do mercado (reprecificação post-only).
+func (m *market) priceStep() decimal.Decimal {
+	if inst, ok, _ := m.engine.instrument(m.symbol); ok && inst.TickSize.IsPositive() {
+		return inst.TickSize
+	}
+	return repriceTick
+}
+
+// checkAmend valida o novo preço/quantidade de um amend contra o mercado.
+func (m *market) checkAmend(price, qty decimal.Decimal) error {
+	inst, ok, err := m.engine.instrument(m.symbol)
+	if !ok {
+		return err
+	}
+	if err := inst.checkPrice(price); err != nil {
+		return err
+	}
+	if err := inst.checkQty(qty); err != nil {
+		return err
+	}
+	notional, err := orderNotional(price, qty)
+	if err != nil {
+		return err
+	}
+	return inst.checkNotional(notional)
+}
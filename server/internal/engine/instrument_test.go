@@ -0,0 +1,245 @@
+package engine
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// memInstruments é um InstrumentRepository em memória que guarda cópias.
+type memInstruments struct {
+	mu      sync.Mutex
+	stored  map[string]Instrument
+	failErr error
+}
+
+func newMemInstruments() *memInstruments {
+	return &memInstruments{stored: make(map[string]Instrument)}
+}
+
+func (r *memInstruments) SaveInstrument(inst *Instrument) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failErr != nil {
+		return r.failErr
+	}
+	r.stored[inst.Symbol] = *inst
+	return nil
+}
+
+func (r *memInstruments) ListInstruments() ([]*Instrument, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*Instrument
+	for _, inst := range r.stored {
+		inst := inst
+		out = append(out, &inst)
+	}
+	return out, nil
+}
+
+func newInstrumentEngine(t *testing.T) (*MatchingEngine, *memBalances, *InstrumentRegistry) {
+	t.Helper()
+	me, _, balances := newTestEngine(t)
+	reg := NewInstrumentRegistry(Instrument{QuoteAsset: "BRL"}, nil)
+	if err := reg.Register(Instrument{
+		Symbol:      "AAA",
+		TickSize:    d("0.05"),
+		LotSize:     d("1"),
+		MinQty:      d("2"),
+		MaxQty:      d("100"),
+		MinNotional: d("25"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	me.SetInstruments(reg)
+	return me, balances, reg
+}
+
+func TestPlaceOrderChecksInstrument(t *testing.T) {
+	tests := []struct {
+		name string
+		req  NewOrderRequest
+		want error
+	}{
+		{"conforming", limit("bob", "AAA", SideBuy, "12.35", "3"), nil},
+		{"off tick", limit("bob", "AAA", SideBuy, "12.33", "3"), ErrPriceNotOnTick},
+		{"off lot", limit("bob", "AAA", SideBuy, "12.35", "2.5"), ErrQtyNotOnLot},
+		{"below min qty", limit("bob", "AAA", SideBuy, "20", "1"), ErrQtyBelowMinimum},
+		{"above max qty", limit("bob", "AAA", SideBuy, "10", "101"), ErrQtyAboveMaximum},
+		{"below min notional", limit("bob", "AAA", SideBuy, "10", "2"), ErrNotionalBelowMinimum},
+		{"stop off tick", NewOrderRequest{UserID: "bob", Symbol: "AAA", Side: SideBuy, Type: OrderTypeStop, StopPrice: d("12.01"), Quantity: d("3")}, ErrPriceNotOnTick},
+		{"quote below min notional", marketBuy("bob", "AAA", "", "20"), ErrNotionalBelowMinimum},
+		{"unknown market", limit("bob", "ZZZ", SideBuy, "10", "3"), ErrUnknownMarket},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			me, balances, _ := newInstrumentEngine(t)
+			fund(balances, "bob", "AAA")
+			if _, err := me.PlaceOrder(tt.req); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmendChecksInstrument(t *testing.T) {
+	me, balances, _ := newInstrumentEngine(t)
+	fund(balances, "bob", "AAA")
+	order := mustPlace(t, me, limit("bob", "AAA", SideBuy, "10", "3"))
+
+	_, err := me.AmendOrder(AmendOrderRequest{OrderID: order.ID, UserID: "bob", NewPrice: d("10.02")})
+	if !errors.Is(err, ErrPriceNotOnTick) {
+		t.Fatalf("amend off tick err = %v, want ErrPriceNotOnTick", err)
+	}
+	_, err = me.AmendOrder(AmendOrderRequest{OrderID: order.ID, UserID: "bob", NewQuantity: d("2")})
+	if !errors.Is(err, ErrNotionalBelowMinimum) {
+		t.Fatalf("amend below notional err = %v, want ErrNotionalBelowMinimum", err)
+	}
+}
+
+func TestInstrumentRegistry(t *testing.T) {
+	reg := NewInstrumentRegistry(Instrument{QuoteAsset: "BRL", TickSize: d("0.01"), LotSize: d("1")}, nil)
+	var changes []string
+	reg.Watch(func(symbol string, from, to MarketStatus) {
+		changes = append(changes, symbol+":"+string(from)+">"+string(to))
+	})
+
+	if err := reg.CreateMarket("BBB"); err != nil {
+		t.Fatal(err)
+	}
+	inst, ok := reg.Get("BBB")
+	if !ok || inst.BaseAsset != "BBB" || inst.QuoteAsset != "BRL" || !inst.TickSize.Equal(d("0.01")) || inst.Status != MarketStatusOpen {
+		t.Fatalf("created market = %+v, want the defaults and OPEN", inst)
+	}
+
+	// Register ajusta a especificação sem mexer no status
+	if err := reg.SuspendMarket("BBB"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register(Instrument{Symbol: "BBB", TickSize: d("0.05")}); err != nil {
+		t.Fatal(err)
+	}
+	if inst, _ := reg.Get("BBB"); inst.Status != MarketStatusSuspended || !inst.TickSize.Equal(d("0.05")) {
+		t.Fatalf("after Register = %s tick %s, want SUSPENDED tick 0.05", inst.Status, inst.TickSize)
+	}
+
+	if err := reg.DelistMarket("BBB"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.ResumeMarket("BBB"); !errors.Is(err, ErrMarketDelisted) {
+		t.Fatalf("resume after delist err = %v, want ErrMarketDelisted", err)
+	}
+	if err := reg.SuspendMarket("ZZZ"); !errors.Is(err, ErrUnknownMarket) {
+		t.Fatalf("suspend unknown err = %v, want ErrUnknownMarket", err)
+	}
+	if err := reg.Register(Instrument{Symbol: "CCC", MinQty: d("5"), MaxQty: d("1")}); !errors.Is(err, ErrInvalidInstrument) {
+		t.Fatalf("register max < min err = %v, want ErrInvalidInstrument", err)
+	}
+
+	want := []string{"BBB:>OPEN", "BBB:OPEN>SUSPENDED", "BBB:SUSPENDED>DELISTED"}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("changes = %v, want %v", changes, want)
+		}
+	}
+}
+
+func TestInstrumentRegistryPersists(t *testing.T) {
+	repo := newMemInstruments()
+	reg := NewInstrumentRegistry(Instrument{QuoteAsset: "BRL", LotSize: d("1")}, repo)
+	if err := reg.CreateMarket("AAA"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register(Instrument{Symbol: "BBB", TickSize: d("0.01")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.SetMarketStatus("AAA", MarketStatusHalted); err != nil {
+		t.Fatal(err)
+	}
+
+	// uma mudança que não é gravada não vale
+	repo.failErr = errors.New("db down")
+	if err := reg.DelistMarket("BBB"); !errors.Is(err, repo.failErr) {
+		t.Fatalf("DelistMarket err = %v, want the save error", err)
+	}
+	if inst, _ := reg.Get("BBB"); inst.Status != MarketStatusOpen {
+		t.Fatalf("BBB = %s after a failed save, want OPEN", inst.Status)
+	}
+	repo.failErr = nil
+
+	loaded := NewInstrumentRegistry(Instrument{}, repo)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	aaa, ok := loaded.Get("AAA")
+	if !ok || aaa.Status != MarketStatusHalted || !aaa.LotSize.Equal(d("1")) || aaa.QuoteAsset != "BRL" {
+		t.Fatalf("AAA after Load = %+v, want HALTED with the default spec", aaa)
+	}
+	if bbb, _ := loaded.Get("BBB"); bbb.Status != MarketStatusOpen || !bbb.TickSize.Equal(d("0.01")) {
+		t.Fatalf("BBB after Load = %+v, want OPEN with tick 0.01", bbb)
+	}
+}
+
+func TestRecoverAppliesRegistryStatus(t *testing.T) {
+	dir := t.TempDir()
+	repo := newMemInstruments()
+
+	j, err := NewFileJournal(JournalConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	me, _, balances := newTestEngine(t)
+	me.AttachJournal(j)
+	reg := NewInstrumentRegistry(Instrument{QuoteAsset: "BRL"}, repo)
+	if err := reg.CreateMarket("AAA"); err != nil {
+		t.Fatal(err)
+	}
+	me.SetInstruments(reg)
+	if err := me.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	fund(balances, "alice", "AAA")
+	mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "5"))
+
+	// o halt foi gravado no registro, mas a queda veio antes do sequenciador
+	halted := repo.stored["AAA"]
+	halted.Status = MarketStatusHalted
+	repo.stored["AAA"] = halted
+	want := me.GetOrderBookSnapshot("AAA", 10)
+	me.Stop()
+	j.Close()
+
+	j2, err := NewFileJournal(JournalConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j2.Close() })
+	recovered, _, balances2 := newTestEngine(t)
+	recovered.AttachJournal(j2)
+	reg2 := NewInstrumentRegistry(Instrument{}, repo)
+	if err := reg2.Load(); err != nil {
+		t.Fatal(err)
+	}
+	recovered.SetInstruments(reg2)
+	if symbols := recovered.marketSymbols(); len(symbols) != 0 {
+		t.Fatalf("SetInstruments started %v before the replay", symbols)
+	}
+
+	if err := recovered.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := recovered.GetMarketStatus("AAA"); status != MarketStatusHalted {
+		t.Fatalf("AAA after Recover = %s, want HALTED from the registry", status)
+	}
+	if got := recovered.GetOrderBookSnapshot("AAA", 10); len(got.Asks) != len(want.Asks) {
+		t.Fatalf("book after Recover = %+v, want %+v", got, want)
+	}
+	fund(balances2, "bob", "AAA")
+	if _, err := recovered.PlaceOrder(limit("bob", "AAA", SideBuy, "10", "1")); !errors.Is(err, ErrMarketHalted) {
+		t.Fatalf("PlaceOrder err = %v, want ErrMarketHalted", err)
+	}
+}
@@ -1,47 +1,97 @@
 package engine
 
-import "time"
+import (
+	"time"
 
-// Repository abstrai persistência de ordens e trades.
+	"hearcap/server/internal/decimal"
+)
+
+// Repository abstrai persistência de ordens e trades. UpdateOrder deve gravar
+// a ordem mesmo que ainda não exista (o replay regrava o estado final).
 type Repository interface {
 	SaveOrder(order *Order) error
 	UpdateOrder(order *Order) error
-	SaveTrade(trade *Trade) error
+	// SaveTrade grava o trade junto com o estado das ordens executadas, numa
+	// única transação.
+	SaveTrade(trade *Trade, orders ...*Order) error
+	SaveOrderGroup(group *OrderGroup) error
+	UpdateOrderGroup(group *OrderGroup) error
 }
 
 // BalanceService coordena travas e verificações de saldo.
 type BalanceService interface {
-	CanLockBase(userID, symbol string, qty float64) bool
-	CanLockQuote(userID, symbol string, notional float64) bool
-	LockBase(userID, symbol string, qty float64) error
-	LockQuote(userID, symbol string, notional float64) error
-	ReleaseBase(userID, symbol string, qty float64) error
-	ReleaseQuote(userID, symbol string, notional float64) error
+	CanLockBase(userID, symbol string, qty decimal.Decimal) bool
+	CanLockQuote(userID, symbol string, notional decimal.Decimal) bool
+	LockBase(userID, symbol string, qty decimal.Decimal) error
+	LockQuote(userID, symbol string, notional decimal.Decimal) error
+	ReleaseBase(userID, symbol string, qty decimal.Decimal) error
+	ReleaseQuote(userID, symbol string, notional decimal.Decimal) error
+}
+
+// ReceivableBalanceService é implementado pelos BalanceService que travam
+// saldo ainda a receber de trades executados e não liquidados: a reserva vira
+// trava quando a liquidação credita o ativo. As saídas de um bracket são
+// travadas assim contra a execução da entrada.
+type ReceivableBalanceService interface {
+	LockReceivableBase(userID, symbol string, qty decimal.Decimal) error
+	LockReceivableQuote(userID, symbol string, notional decimal.Decimal) error
+	// ReleaseReceivable* desfazem a reserva: primeiro a parte ainda não
+	// liquidada, depois a já liquidada (que volta ao disponível).
+	ReleaseReceivableBase(userID, symbol string, qty decimal.Decimal) error
+	ReleaseReceivableQuote(userID, symbol string, notional decimal.Decimal) error
 }
 
 // EventBus publica atualizações de book e trades em tempo real.
 type EventBus interface {
 	PublishOrderBookUpdate(symbol string, snapshot OrderBookSnapshot) error
 	PublishTrade(trade *Trade) error
+	PublishOrderEvent(ev *OrderEvent) error
+	// PublishOrderUpdate recebe uma cópia da ordem a cada mudança de estado
+	// (aceite, execução, cancelamento, expiração, amend).
+	PublishOrderUpdate(order *Order) error
 }
 
 // Repositório específico da camada de clearing.
 type ClearingRepository interface {
-	SaveClearingPosition(pos *ClearingPosition) error
+	// ApplyTrade soma numa única transação os deltas de um trade às posições
+	// PENDING de mesmo usuário, símbolo e data (criando as que faltam, com os
+	// dados do delta) e marca o trade como aplicado. Um trade já aplicado não
+	// muda nada e devolve applied false.
+	ApplyTrade(tradeID string, deltas []*ClearingPosition) (applied bool, err error)
 	UpdateClearingPosition(pos *ClearingPosition) error
-	FindClearingPosition(userID, symbol string, settlementDate time.Time) (*ClearingPosition, error)
 	ListPositionsToSettle(beforeOrEqual time.Time) ([]*ClearingPosition, error)
 	SaveSettlementBatch(batch *SettlementBatch) error
 	UpdateSettlementBatch(batch *SettlementBatch) error
-}
-
+	FindSettlementBatch(id string) (*SettlementBatch, error)
+	ListSettlementBatches(limit int) ([]*SettlementBatch, error)
+	ListPositionsByBatch(batchID string) ([]*ClearingPosition, error)
+	SaveSettlementObligation(ob *SettlementObligation) error
+	UpdateSettlementObligation(ob *SettlementObligation) error
+	ListSettlementObligations(batchID string) ([]*SettlementObligation, error)
+	// ListOpenBatches lista os lotes fora de BatchPhaseClosed, mais antigos
+	// primeiro.
+	ListOpenBatches() ([]*SettlementBatch, error)
+	// ListOpenObligations lista as obrigações em fail (FAILED ou PARTIAL).
+	ListOpenObligations() ([]*SettlementObligation, error)
+}
+
+// CustodyService efetiva a obrigação líquida de um participante num ativo.
+// Delivered é o bruto que ele entrega no ciclo (travado pelas ordens).
 type CustodyService interface {
-	ApplySettlement(userID, symbol string, baseDelta, quoteDelta float64) error
+	// SettleObligation move o que falta (Outstanding) e soma em ob.Settled o
+	// que conseguiu mover; entrega incompleta devolve ErrFailToDeliver. Deve
+	// ser idempotente por ob.ID e ob.Attempts: repetir a chamada depois de uma
+	// queda, antes de ob ser gravada, não move o ativo de novo.
+	SettleObligation(ob *SettlementObligation) error
+	// ChargeFail cobra de userID uma multa ou buy-in, lançada como typ no
+	// ledger a favor da conta da clearing, e devolve o valor cobrado. Com key
+	// já lançada não cobra de novo e devolve o valor da primeira cobrança.
+	ChargeFail(userID, asset string, amount decimal.Decimal, typ LedgerEntryType, ref, key string) (decimal.Decimal, error)
 }
 
 type BlockchainService interface {
 	GetSettlementAddress(userID, asset string) (string, error)
-	Transfer(asset, from, to string, amount float64) (string, error)
+	Transfer(asset, from, to string, amount decimal.Decimal) (string, error)
 }
 
 // -------- Governance / Listing --------
@@ -80,6 +130,22 @@ type MarketRegistry interface {
 	DelistMarket(symbol string) error
 }
 
+// -------- Primary Offering --------
+
+type OfferingRepository interface {
+	SaveOffering(o *Offering) error
+	UpdateOffering(o *Offering) error
+	FindOfferingByID(id string) (*Offering, error)
+	// ListOfferingsToClose devolve as ofertas OPEN com fim até before e as
+	// que ficaram em ALLOCATING (fechamento interrompido).
+	ListOfferingsToClose(before time.Time) ([]*Offering, error)
+
+	SaveBid(b *OfferingBid) error
+	UpdateBid(b *OfferingBid) error
+	FindBidByID(id string) (*OfferingBid, error)
+	ListBids(offeringID string) ([]*OfferingBid, error)
+}
+
 // -------- Corporate Actions --------
 
 type CorporateActionRepository interface {
@@ -92,14 +158,14 @@ type CorporateActionRepository interface {
 type HolderPosition struct {
 	UserID   string
 	Symbol   string
-	Quantity float64
+	Quantity decimal.Decimal
 }
 
 type HolderPositionService interface {
 	GetHoldersOnRecordDate(symbol string, recordDate time.Time) ([]HolderPosition, error)
-	ApplyCashDividend(userID, asset string, amount float64) error
-	ApplyStockDividendOrSplit(userID, symbol string, oldQty, newQty float64) error
-	GrantRights(userID, symbol string, rightsQty float64, subscriptionPrice float64, subscriptionAsset string) error
+	ApplyCashDividend(userID, asset string, amount decimal.Decimal) error
+	ApplyStockDividendOrSplit(userID, symbol string, oldQty, newQty decimal.Decimal) error
+	GrantRights(userID, symbol string, rightsQty decimal.Decimal, subscriptionPrice decimal.Decimal, subscriptionAsset string) error
 }
 
 // -------- Dark Pools / ATS --------
@@ -122,7 +188,7 @@ type DarkPoolRepository interface {
 }
 
 type ReferencePriceService interface {
-	GetMidPrice(symbol string) (float64, error)
+	GetMidPrice(symbol string) (decimal.Decimal, error)
 }
 
 type DarkPoolReportingService interface {
@@ -134,7 +200,7 @@ type DarkPoolVolumeAggregate struct {
 	Symbol string
 	From   time.Time
 	To     time.Time
-	Volume float64
+	Volume decimal.Decimal
 	Trades int64
 }
 
@@ -154,11 +220,11 @@ type MarginRepository interface {
 }
 
 type PriceFeed interface {
-	GetLastPrice(symbol string) (float64, error)
+	GetLastPrice(symbol string) (decimal.Decimal, error)
 }
 
 type RiskNotificationService interface {
-	NotifyRiskEvent(userID string, symbol string, msg string) error
+	NotifyRiskEvent(userID, symbol, eventType, msg string) error
 	NotifyMarketHalt(symbol string, reason string) error
 	NotifyMarketResume(symbol string) error
 }
@@ -189,9 +255,19 @@ type WalletRepository interface {
 	UpdateBalance(b *Balance) error
 }
 
+// BalanceNotifier recebe o saldo de cada conta alterada pela WalletEngine.
+type BalanceNotifier interface {
+	NotifyBalance(userID, asset string, bal Balance) error
+}
+
 type LedgerRepository interface {
 	SaveEntry(entry *LedgerEntry) error
 	ListEntriesByAccount(accountID string, limit int) ([]*LedgerEntry, error)
+	// FindEntryByKey devolve o lançamento com a chave de idempotência key
+	// (nil, nil se não existe).
+	FindEntryByKey(key string) (*LedgerEntry, error)
+	// PostEntry grava o lançamento e o saldo da conta numa única transação.
+	PostEntry(entry *LedgerEntry, bal *Balance) error
 }
 
 type DepositRepository interface {
@@ -206,6 +282,44 @@ type WithdrawalRepository interface {
 	FindWithdrawalByID(id string) (*WithdrawalRequest, error)
 }
 
+// -------- Post-trade --------
+
+// OrderLookup resolve as ordens de um trade que não traz os usuários.
+type OrderLookup interface {
+	FindOrder(id string) (*Order, error)
+}
+
+// TradeLookup é implementado pelos Repository que consultam trades gravados;
+// Recover o usa para gravar e enviar ao pós-trade os trades do replay que
+// não chegaram ao Repository antes do crash.
+type TradeLookup interface {
+	FindTrade(id string) (*Trade, error)
+}
+
+// PostTradeOutbox é implementado pelos OrderLookup que guardam, junto de cada
+// trade gravado, a etapa do pós-trade que falta executar. O
+// PostTradePipeline grava o avanço de cada etapa e, no Start, retoma os
+// trades pendentes (gravados antes de um restart sem concluir o pós-trade).
+type PostTradeOutbox interface {
+	ListPendingPostTrades() ([]*PendingPostTrade, error)
+	// SetPostTradeStage grava a próxima etapa do trade; "" o dá por concluído.
+	SetPostTradeStage(tradeID string, stage PostTradeStage) error
+}
+
+// PendingPostTrade é um trade do outbox e a etapa em que ele parou.
+type PendingPostTrade struct {
+	Trade *Trade
+	Stage PostTradeStage
+}
+
+// PostTradeDeadLetterRepository guarda os trades que esgotaram as tentativas
+// do pós-trade.
+type PostTradeDeadLetterRepository interface {
+	SaveDeadLetter(f *PostTradeFailure) error
+	ListDeadLetters(limit int) ([]*PostTradeFailure, error)
+	DeleteDeadLetter(tradeID string) error
+}
+
 // -------- Market Data --------
 
 type CandleRepository interface {
@@ -231,4 +345,12 @@ type MarketDataPublisher interface {
 	PublishTrade(ev *TradeEvent) error
 	PublishCandle(c *Candle) error
 	PublishOrderBook(snapshot OrderBookSnapshot) error
+	PublishAuction(ind *AuctionIndicative) error
+}
+
+// InstrumentRepository persiste a especificação e o status dos mercados do
+// InstrumentRegistry.
+type InstrumentRepository interface {
+	SaveInstrument(inst *Instrument) error
+	ListInstruments() ([]*Instrument, error)
 }
@@ -0,0 +1,428 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
+
+var ErrJournalCorrupted = errors.New("journal segment corrupted")
+
+type JournalRecordKind string
+
+const (
+	JournalPlace       JournalRecordKind = "PLACE"
+	JournalCancel      JournalRecordKind = "CANCEL"
+	JournalAmend       JournalRecordKind = "AMEND"
+	JournalTrigger     JournalRecordKind = "TRIGGER"
+	JournalExpire      JournalRecordKind = "EXPIRE"
+	JournalPlaceGroup  JournalRecordKind = "PLACE_GROUP"
+	JournalCancelGroup JournalRecordKind = "CANCEL_GROUP"
+	JournalStatus      JournalRecordKind = "STATUS"
+	JournalUncross     JournalRecordKind = "UNCROSS"
+	// JournalReject marca que o comando RefLSN falhou e não deve ser reaplicado.
+	JournalReject JournalRecordKind = "REJECT"
+	// JournalTrade guarda um trade executado pelo comando RefLSN, para que o
+	// replay o recrie com o mesmo ID, horário e taxas.
+	JournalTrade JournalRecordKind = "TRADE"
+	// JournalAck marca que o comando RefLSN terminou: travas e liberações de
+	// saldo já foram aplicadas e o replay não deve repeti-las.
+	JournalAck JournalRecordKind = "ACK"
+)
+
+// JournalRecord é um comando aceito pelo sequenciador de um símbolo, gravado
+// antes da execução para permitir replay determinístico.
+type JournalRecord struct {
+	LSN    uint64            `json:"lsn"`
+	RefLSN uint64            `json:"ref_lsn,omitempty"`
+	Symbol string            `json:"symbol"`
+	Kind   JournalRecordKind `json:"kind"`
+
+	Order   *Order             `json:"order,omitempty"`
+	Group   *OrderGroup        `json:"group,omitempty"`
+	Orders  []*Order           `json:"orders,omitempty"`
+	OrderID string             `json:"order_id,omitempty"`
+	UserID  string             `json:"user_id,omitempty"`
+	Amend   *AmendOrderRequest `json:"amend,omitempty"`
+	Price   decimal.Decimal    `json:"price,omitempty"`
+	Status  MarketStatus       `json:"status,omitempty"`
+	Trade   *Trade             `json:"trade,omitempty"`
+	Time    time.Time          `json:"time"`
+}
+
+type JournalConfig struct {
+	Dir string
+	// SegmentSize limita o tamanho de cada arquivo de segmento (bytes).
+	SegmentSize int64
+	// SnapshotEvery define a cada quantos comandos um símbolo grava snapshot.
+	SnapshotEvery int
+	// SyncWrites faz fsync a cada registro antes do ack.
+	SyncWrites bool
+}
+
+// FileJournal grava registros em segmentos append-only no disco local. Cada
+// registro é [tamanho uint32][crc32 uint32][payload JSON].
+type FileJournal struct {
+	cfg JournalConfig
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	lastLSN uint64
+}
+
+const (
+	segmentExt         = ".log"
+	defaultSegmentSize = 64 << 20
+	recordHeaderSize   = 8
+)
+
+func NewFileJournal(cfg JournalConfig) (*FileJournal, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("journal dir is required")
+	}
+	if cfg.SegmentSize <= 0 {
+		cfg.SegmentSize = defaultSegmentSize
+	}
+	if err := os.MkdirAll(filepath.Join(cfg.Dir, "snapshots"), 0o755); err != nil {
+		return nil, err
+	}
+
+	j := &FileJournal{cfg: cfg}
+	if err := j.openTail(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// openTail posiciona o journal no fim do último segmento, descartando um
+// registro final incompleto (escrita interrompida por crash).
+func (j *FileJournal) openTail() error {
+	segments, err := j.segments()
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return j.rotate(1)
+	}
+
+	last := segments[len(segments)-1]
+	var validEnd int64
+	err = readSegment(last, func(rec JournalRecord, end int64) error {
+		j.lastLSN = rec.LSN
+		validEnd = end
+		return nil
+	}, true)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(last, os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(validEnd); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(validEnd, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	j.file = f
+	j.size = validEnd
+
+	if j.lastLSN == 0 && len(segments) > 1 {
+		// segmento final vazio: o último LSN está no anterior
+		prev := segments[len(segments)-2]
+		return readSegment(prev, func(rec JournalRecord, _ int64) error {
+			j.lastLSN = rec.LSN
+			return nil
+		}, false)
+	}
+	return nil
+}
+
+// Append grava o registro com o próximo LSN e devolve o LSN atribuído.
+func (j *FileJournal) Append(rec JournalRecord) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	rec.LSN = j.lastLSN + 1
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return 0, err
+	}
+
+	if j.size > 0 && j.size+int64(len(payload))+recordHeaderSize > j.cfg.SegmentSize {
+		if err := j.rotate(rec.LSN); err != nil {
+			return 0, err
+		}
+	}
+
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[recordHeaderSize:], payload)
+
+	if _, err := j.file.Write(buf); err != nil {
+		return 0, err
+	}
+	if j.cfg.SyncWrites {
+		if err := j.file.Sync(); err != nil {
+			return 0, err
+		}
+	}
+
+	j.size += int64(len(buf))
+	j.lastLSN = rec.LSN
+	return rec.LSN, nil
+}
+
+// Replay percorre todos os registros com LSN > afterLSN em ordem.
+func (j *FileJournal) Replay(afterLSN uint64, fn func(rec JournalRecord) error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	segments, err := j.segments()
+	if err != nil {
+		return err
+	}
+	for i, seg := range segments {
+		// pula segmentos inteiramente cobertos por snapshot
+		if i+1 < len(segments) && segmentFirstLSN(segments[i+1]) <= afterLSN+1 {
+			continue
+		}
+		tolerateTail := i == len(segments)-1
+		err := readSegment(seg, func(rec JournalRecord, _ int64) error {
+			if rec.LSN <= afterLSN {
+				return nil
+			}
+			return fn(rec)
+		}, tolerateTail)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune remove segmentos cujos registros são todos <= uptoLSN.
+func (j *FileJournal) Prune(uptoLSN uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	segments, err := j.segments()
+	if err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(segments); i++ {
+		if segmentFirstLSN(segments[i+1]) > uptoLSN+1 {
+			break
+		}
+		if err := os.Remove(segments[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *FileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+func (j *FileJournal) rotate(firstLSN uint64) error {
+	if j.file != nil {
+		if err := j.file.Sync(); err != nil {
+			return err
+		}
+		if err := j.file.Close(); err != nil {
+			return err
+		}
+	}
+	name := filepath.Join(j.cfg.Dir, fmt.Sprintf("%020d%s", firstLSN, segmentExt))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	j.file = f
+	j.size = 0
+	return nil
+}
+
+func (j *FileJournal) segments() ([]string, error) {
+	entries, err := os.ReadDir(j.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), segmentExt) {
+			continue
+		}
+		out = append(out, filepath.Join(j.cfg.Dir, e.Name()))
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func segmentFirstLSN(path string) uint64 {
+	var lsn uint64
+	fmt.Sscanf(strings.TrimSuffix(filepath.Base(path), segmentExt), "%d", &lsn)
+	return lsn
+}
+
+// readSegment chama fn para cada registro íntegro. Com tolerateTail, um
+// registro final truncado ou com checksum inválido encerra a leitura sem erro.
+func readSegment(path string, fn func(rec JournalRecord, end int64) error, tolerateTail bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	header := make([]byte, recordHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if err == io.ErrUnexpectedEOF && tolerateTail {
+				return nil
+			}
+			return ErrJournalCorrupted
+		}
+		size := binary.BigEndian.Uint32(header[0:4])
+		sum := binary.BigEndian.Uint32(header[4:8])
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if tolerateTail {
+				return nil
+			}
+			return ErrJournalCorrupted
+		}
+		if crc32.ChecksumIEEE(payload) != sum {
+			if tolerateTail && isTail(r) {
+				return nil
+			}
+			return ErrJournalCorrupted
+		}
+
+		var rec JournalRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return ErrJournalCorrupted
+		}
+		offset += recordHeaderSize + int64(size)
+		if err := fn(rec, offset); err != nil {
+			return err
+		}
+	}
+}
+
+func isTail(r *bufio.Reader) bool {
+	_, err := r.Peek(1)
+	return err == io.EOF
+}
+
+// ---- snapshots ----
+
+// marketSnapshot guarda o estado de um símbolo até o registro LSN: ordens em
+// repouso na ordem preço-tempo (bids e depois asks) e STOPs pendentes.
+type marketSnapshot struct {
+	Symbol string `json:"symbol"`
+	LSN    uint64 `json:"lsn"`
+	Seq    uint64 `json:"seq"`
+	// LastPrice é a referência inicial de trailing stops.
+	LastPrice decimal.Decimal `json:"last_price"`
+	Resting   []*Order        `json:"resting"`
+	Stops     []*Order        `json:"stops"`
+	Groups    []*OrderGroup   `json:"groups"`
+	// Status e Queued (ordens aguardando o fim de um halt).
+	Status MarketStatus `json:"status,omitempty"`
+	Queued []*Order     `json:"queued,omitempty"`
+	// AuctionEnds é o fim do leilão em curso (Status AUCTION).
+	AuctionEnds time.Time `json:"auction_ends"`
+}
+
+type snapshotEnvelope struct {
+	Checksum uint32          `json:"checksum"`
+	Data     json.RawMessage `json:"data"`
+}
+
+func (j *FileJournal) snapshotPath(symbol string) string {
+	name := strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(symbol)
+	return filepath.Join(j.cfg.Dir, "snapshots", name+".json")
+}
+
+// WriteSnapshot grava o snapshot de forma atômica (arquivo temporário + rename).
+func (j *FileJournal) writeSnapshot(snap *marketSnapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	env, err := json.Marshal(snapshotEnvelope{Checksum: crc32.ChecksumIEEE(data), Data: data})
+	if err != nil {
+		return err
+	}
+
+	path := j.snapshotPath(snap.Symbol)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, env, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (j *FileJournal) loadSnapshots() ([]*marketSnapshot, error) {
+	dir := filepath.Join(j.cfg.Dir, "snapshots")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*marketSnapshot
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var env snapshotEnvelope
+		if err := json.Unmarshal(raw, &env); err != nil {
+			return nil, err
+		}
+		if crc32.ChecksumIEEE(env.Data) != env.Checksum {
+			return nil, fmt.Errorf("snapshot %s: checksum mismatch", e.Name())
+		}
+		var snap marketSnapshot
+		if err := json.Unmarshal(env.Data, &snap); err != nil {
+			return nil, err
+		}
+		out = append(out, &snap)
+	}
+	return out, nil
+}
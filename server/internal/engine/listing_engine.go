@@ -4,9 +4,13 @@ import (
 	"errors"
 	"time"
 
+	"hearcap/server/internal/decimal"
+
 	"github.com/google/uuid"
 )
 
+var ErrListingNotFound = errors.New("listing not found")
+
 type ListingEvaluationResult struct {
 	ArtistID       string
 	Eligible       bool
@@ -20,11 +24,11 @@ type IPOApplicationRequest struct {
 	Symbol           string
 	Name             string
 	Offering         OfferingType
-	InitialPrice     float64
-	TotalSupply      float64
+	InitialPrice     decimal.Decimal
+	TotalSupply      decimal.Decimal
 	FreeFloatPercent float64
-	MinRaiseUSD      float64
-	MaxRaiseUSD      float64
+	MinRaiseUSD      decimal.Decimal
+	MaxRaiseUSD      decimal.Decimal
 	ProspectusURL    string
 	ExtraDocsURL     []string
 	Notes            string
@@ -45,6 +49,13 @@ type ListingEngine struct {
 	config    ListingEngineConfig
 }
 
+// NoOpGovernanceNotifier descarta as notificações de listagem, para quando
+// não há canal de governança configurado.
+type NoOpGovernanceNotifier struct{}
+
+func (NoOpGovernanceNotifier) NotifyListingSubmitted(*ListingApplication) error     { return nil }
+func (NoOpGovernanceNotifier) NotifyListingStatusChanged(*ListingApplication) error { return nil }
+
 func NewListingEngine(
 	listings ListingRepository,
 	metrics ArtistMetricsService,
@@ -241,7 +252,7 @@ func (le *ListingEngine) ActivateListing(listingID string) (*ListingApplication,
 	if err != nil {
 		return nil, err
 	}
-	if app.Status != ListingStatusApproved {
+	if app.Status != ListingStatusApproved && app.Status != ListingStatusOffering {
 		return nil, errors.New("listing not approved")
 	}
 
@@ -1,6 +1,10 @@
 package engine
 
-import "time"
+import (
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
 
 type ListingStatus string
 
@@ -9,6 +13,7 @@ const (
 	ListingStatusSubmitted   ListingStatus = "SUBMITTED"
 	ListingStatusUnderReview ListingStatus = "UNDER_REVIEW"
 	ListingStatusApproved    ListingStatus = "APPROVED"
+	ListingStatusOffering    ListingStatus = "OFFERING"
 	ListingStatusRejected    ListingStatus = "REJECTED"
 	ListingStatusActive      ListingStatus = "ACTIVE"
 	ListingStatusSuspended   ListingStatus = "SUSPENDED"
@@ -50,11 +55,11 @@ type ListingApplication struct {
 	Offering OfferingType
 	Status   ListingStatus
 
-	InitialPrice     float64
-	TotalSupply      float64
+	InitialPrice     decimal.Decimal
+	TotalSupply      decimal.Decimal
 	FreeFloatPercent float64
-	MinRaiseUSD      float64
-	MaxRaiseUSD      float64
+	MinRaiseUSD      decimal.Decimal
+	MaxRaiseUSD      decimal.Decimal
 
 	ProspectusURL string
 	ExtraDocsURL  []string
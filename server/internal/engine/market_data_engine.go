@@ -3,6 +3,8 @@ package engine
 import (
 	"sync"
 	"time"
+
+	"hearcap/server/internal/decimal"
 )
 
 type MarketDataConfig struct {
@@ -22,6 +24,9 @@ type MarketDataEngine struct {
 
 	muBooks    sync.RWMutex
 	cacheBooks map[string]OrderBookSnapshot
+
+	muAuctions    sync.RWMutex
+	cacheAuctions map[string]AuctionIndicative
 }
 
 func NewMarketDataEngine(cfg MarketDataConfig, candles CandleRepository, trades TradeHistoryRepository, tickers TickerRepository, publisher MarketDataPublisher) *MarketDataEngine {
@@ -39,6 +44,8 @@ func NewMarketDataEngine(cfg MarketDataConfig, candles CandleRepository, trades
 		publisher:    publisher,
 		cacheTickers: make(map[string]*Ticker24h),
 		cacheBooks:   make(map[string]OrderBookSnapshot),
+
+		cacheAuctions: make(map[string]AuctionIndicative),
 	}
 }
 
@@ -87,6 +94,43 @@ func (m *MarketDataEngine) GetOrderBook(symbol string) (OrderBookSnapshot, bool)
 	return cloneOrderBookSnapshot(snap), true
 }
 
+// OnAuctionIndicative guarda e publica o preço indicativo de um leilão; o
+// cache é limpo quando o leilão termina (Price e EndsAt zerados).
+func (m *MarketDataEngine) OnAuctionIndicative(ind AuctionIndicative) {
+	if ind.Symbol == "" {
+		return
+	}
+
+	m.muAuctions.Lock()
+	if ind.EndsAt.IsZero() {
+		delete(m.cacheAuctions, ind.Symbol)
+	} else {
+		m.cacheAuctions[ind.Symbol] = ind
+	}
+	m.muAuctions.Unlock()
+
+	if m.publisher != nil {
+		_ = m.publisher.PublishAuction(&ind)
+	}
+}
+
+// GetAuctionIndicative devolve o último indicativo do leilão em curso.
+func (m *MarketDataEngine) GetAuctionIndicative(symbol string) (AuctionIndicative, bool) {
+	m.muAuctions.RLock()
+	defer m.muAuctions.RUnlock()
+	ind, ok := m.cacheAuctions[symbol]
+	return ind, ok
+}
+
+// GetLastPrice devolve o último preço do ticker 24h; implementa PriceFeed.
+func (m *MarketDataEngine) GetLastPrice(symbol string) (decimal.Decimal, error) {
+	t, err := m.GetTicker(symbol)
+	if err != nil || t == nil {
+		return decimal.Zero, err
+	}
+	return t.LastPrice, nil
+}
+
 func (m *MarketDataEngine) GetTicker(symbol string) (*Ticker24h, error) {
 	m.muTickers.RLock()
 	if t, ok := m.cacheTickers[symbol]; ok {
@@ -158,15 +202,11 @@ func (m *MarketDataEngine) updateCandleForInterval(ev *TradeEvent, interval Cand
 		return m.createNewCandle(ev, interval, start, end)
 	}
 
-	if ev.Price > c.High {
-		c.High = ev.Price
-	}
-	if ev.Price < c.Low {
-		c.Low = ev.Price
-	}
+	c.High = decimal.Max(c.High, ev.Price)
+	c.Low = decimal.Min(c.Low, ev.Price)
 
 	c.Close = ev.Price
-	c.Volume += ev.Quantity
+	c.Volume = c.Volume.Add(ev.Quantity)
 	c.Trades++
 	c.UpdatedAt = ev.Timestamp
 
@@ -218,15 +258,15 @@ func (m *MarketDataEngine) updateTicker(ev *TradeEvent) error {
 			HighPrice:   ev.Price,
 			LowPrice:    ev.Price,
 			Volume:      ev.Quantity,
-			QuoteVolume: ev.Price * ev.Quantity,
+			QuoteVolume: ev.Price.Mul(ev.Quantity),
 			Trades:      1,
 			OpenTime:    windowStart,
 			CloseTime:   ev.Timestamp,
 			UpdatedAt:   ev.Timestamp,
 		}
-		t.PriceChange = t.LastPrice - t.OpenPrice
-		if t.OpenPrice != 0 {
-			t.PriceChangePercent = t.PriceChange / t.OpenPrice * 100
+		t.PriceChange = t.LastPrice.Sub(t.OpenPrice)
+		if !t.OpenPrice.IsZero() {
+			t.PriceChangePercent = t.PriceChange.QuoFloat(t.OpenPrice) * 100
 		}
 		m.cacheTickers[ev.Symbol] = t
 		if m.tickers != nil {
@@ -241,21 +281,17 @@ func (m *MarketDataEngine) updateTicker(ev *TradeEvent) error {
 	}
 
 	t.LastPrice = ev.Price
-	if ev.Price > t.HighPrice {
-		t.HighPrice = ev.Price
-	}
-	if ev.Price < t.LowPrice {
-		t.LowPrice = ev.Price
-	}
-	t.Volume += ev.Quantity
-	t.QuoteVolume += ev.Price * ev.Quantity
+	t.HighPrice = decimal.Max(t.HighPrice, ev.Price)
+	t.LowPrice = decimal.Min(t.LowPrice, ev.Price)
+	t.Volume = t.Volume.Add(ev.Quantity)
+	t.QuoteVolume = t.QuoteVolume.Add(ev.Price.Mul(ev.Quantity))
 	t.Trades++
 	t.CloseTime = ev.Timestamp
 	t.UpdatedAt = ev.Timestamp
 
-	t.PriceChange = t.LastPrice - t.OpenPrice
-	if t.OpenPrice != 0 {
-		t.PriceChangePercent = t.PriceChange / t.OpenPrice * 100
+	t.PriceChange = t.LastPrice.Sub(t.OpenPrice)
+	if !t.OpenPrice.IsZero() {
+		t.PriceChangePercent = t.PriceChange.QuoFloat(t.OpenPrice) * 100
 	}
 
 	if m.tickers != nil {
@@ -299,6 +335,7 @@ func alignToInterval(ts time.Time, interval CandleInterval) (time.Time, time.Tim
 func cloneOrderBookSnapshot(snap OrderBookSnapshot) OrderBookSnapshot {
 	copySnap := OrderBookSnapshot{
 		Symbol: snap.Symbol,
+		Seq:    snap.Seq,
 	}
 	if len(snap.Bids) > 0 {
 		copySnap.Bids = append(copySnap.Bids, snap.Bids...)
@@ -1,6 +1,10 @@
 package engine
 
-import "time"
+import (
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
 
 type TradeSource string
 
@@ -12,8 +16,8 @@ const (
 type TradeEvent struct {
 	ID        string
 	Symbol    string
-	Price     float64
-	Quantity  float64
+	Price     decimal.Decimal
+	Quantity  decimal.Decimal
 	Side      Side
 	Source    TradeSource
 	Timestamp time.Time
@@ -36,11 +40,11 @@ type Candle struct {
 	OpenTime  time.Time
 	CloseTime time.Time
 
-	Open   float64
-	High   float64
-	Low    float64
-	Close  float64
-	Volume float64
+	Open   decimal.Decimal
+	High   decimal.Decimal
+	Low    decimal.Decimal
+	Close  decimal.Decimal
+	Volume decimal.Decimal
 	Trades int64
 
 	CreatedAt time.Time
@@ -50,16 +54,16 @@ type Candle struct {
 type Ticker24h struct {
 	Symbol string
 
-	LastPrice float64
-	OpenPrice float64
-	HighPrice float64
-	LowPrice  float64
+	LastPrice decimal.Decimal
+	OpenPrice decimal.Decimal
+	HighPrice decimal.Decimal
+	LowPrice  decimal.Decimal
 
-	Volume      float64
-	QuoteVolume float64
+	Volume      decimal.Decimal
+	QuoteVolume decimal.Decimal
 	Trades      int64
 
-	PriceChange        float64
+	PriceChange        decimal.Decimal
 	PriceChangePercent float64
 
 	OpenTime  time.Time
@@ -67,3 +71,21 @@ type Ticker24h struct {
 	UpdatedAt time.Time
 }
 
+// AuctionIndicative é o estado indicativo de um leilão em curso, republicado a
+// cada mudança do book. No uncross é publicado uma última vez com EndsAt
+// zerado, trazendo o preço de abertura e o volume executado.
+type AuctionIndicative struct {
+	Symbol string
+	Seq    uint64
+
+	// Price é o preço que maximizaria o volume executado se o leilão
+	// terminasse agora (zero se compras e vendas não cruzam).
+	Price      decimal.Decimal
+	MatchedQty decimal.Decimal
+	// ImbalanceQty é a quantidade que sobraria em Price do lado ImbalanceSide.
+	ImbalanceQty  decimal.Decimal
+	ImbalanceSide Side
+
+	EndsAt    time.Time
+	Timestamp time.Time
+}
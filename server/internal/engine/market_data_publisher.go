@@ -13,17 +13,17 @@ func NewNoOpMarketDataPublisher() *NoOpMarketDataPublisher {
 }
 
 func (p *NoOpMarketDataPublisher) PublishTicker(t *Ticker24h) error {
-	log.Printf("[MarketData] Ticker updated: %s @ %.2f (%.2f%%)", t.Symbol, t.LastPrice, t.PriceChangePercent)
+	log.Printf("[MarketData] Ticker updated: %s @ %s (%.2f%%)", t.Symbol, t.LastPrice, t.PriceChangePercent)
 	return nil
 }
 
 func (p *NoOpMarketDataPublisher) PublishTrade(ev *TradeEvent) error {
-	log.Printf("[MarketData] Trade: %s %s %.2f @ %.2f (source: %s)", ev.Symbol, ev.Side, ev.Quantity, ev.Price, ev.Source)
+	log.Printf("[MarketData] Trade: %s %s %s @ %s (source: %s)", ev.Symbol, ev.Side, ev.Quantity, ev.Price, ev.Source)
 	return nil
 }
 
 func (p *NoOpMarketDataPublisher) PublishCandle(c *Candle) error {
-	log.Printf("[MarketData] Candle: %s %s O:%.2f H:%.2f L:%.2f C:%.2f V:%.2f", c.Symbol, c.Interval, c.Open, c.High, c.Low, c.Close, c.Volume)
+	log.Printf("[MarketData] Candle: %s %s O:%s H:%s L:%s C:%s V:%s", c.Symbol, c.Interval, c.Open, c.High, c.Low, c.Close, c.Volume)
 	return nil
 }
 
@@ -32,3 +32,7 @@ func (p *NoOpMarketDataPublisher) PublishOrderBook(snapshot OrderBookSnapshot) e
 	return nil
 }
 
+func (p *NoOpMarketDataPublisher) PublishAuction(ind *AuctionIndicative) error {
+	log.Printf("[MarketData] Auction: %s indicative %s matched %s imbalance %s %s", ind.Symbol, ind.Price, ind.MatchedQty, ind.ImbalanceQty, ind.ImbalanceSide)
+	return nil
+}
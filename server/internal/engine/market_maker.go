@@ -3,14 +3,16 @@ package engine
 import (
 	"math/rand"
 	"time"
+
+	"hearcap/server/internal/decimal"
 )
 
 type MarketMakerConfig struct {
 	UserID       string
 	Symbol       string
-	BasePrice    float64
+	BasePrice    decimal.Decimal
 	Spread       float64
-	OrderSize    float64
+	OrderSize    decimal.Decimal
 	RefreshDelay time.Duration
 }
 
@@ -18,6 +20,9 @@ type MarketMaker struct {
 	engine *MatchingEngine
 	cfg    MarketMakerConfig
 	stop   chan struct{}
+
+	// ordens cotadas no último refresh, canceladas antes de recotar
+	live []string
 }
 
 func NewMarketMaker(engine *MatchingEngine, cfg MarketMakerConfig) *MarketMaker {
@@ -52,25 +57,42 @@ func (mm *MarketMaker) Stop() {
 }
 
 func (mm *MarketMaker) quote() {
-	base := mm.cfg.BasePrice * (1 + (rand.Float64()-0.5)*0.01)
-	bid := base * (1 - mm.cfg.Spread)
-	ask := base * (1 + mm.cfg.Spread)
+	mm.cancelLive()
 
-	_, _ = mm.engine.PlaceOrder(NewOrderRequest{
+	base := mm.cfg.BasePrice.MulFloat(1 + (rand.Float64()-0.5)*0.01)
+	bid := base.MulFloat(1 - mm.cfg.Spread)
+	ask := base.MulFloat(1 + mm.cfg.Spread)
+
+	if order, err := mm.engine.PlaceOrder(NewOrderRequest{
 		UserID:   mm.cfg.UserID,
 		Symbol:   mm.cfg.Symbol,
 		Side:     SideBuy,
 		Type:     OrderTypeLimit,
 		Price:    bid,
 		Quantity: mm.cfg.OrderSize,
-	})
+		// cotações novas substituem as antigas em vez de executar contra elas
+		STP: STPCancelOldest,
+	}); err == nil {
+		mm.live = append(mm.live, order.ID)
+	}
 
-	_, _ = mm.engine.PlaceOrder(NewOrderRequest{
+	if order, err := mm.engine.PlaceOrder(NewOrderRequest{
 		UserID:   mm.cfg.UserID,
 		Symbol:   mm.cfg.Symbol,
 		Side:     SideSell,
 		Type:     OrderTypeLimit,
 		Price:    ask,
 		Quantity: mm.cfg.OrderSize,
-	})
+		STP:      STPCancelOldest,
+	}); err == nil {
+		mm.live = append(mm.live, order.ID)
+	}
+}
+
+func (mm *MarketMaker) cancelLive() {
+	for _, id := range mm.live {
+		// ordens já executadas retornam erro e são simplesmente descartadas
+		_, _ = mm.engine.CancelOrder(id, mm.cfg.UserID)
+	}
+	mm.live = mm.live[:0]
 }
@@ -0,0 +1,211 @@
+package engine
+
+import (
+	"errors"
+
+	"hearcap/server/internal/decimal"
+)
+
+var (
+	ErrInvalidQuoteQty = errors.New("quote quantity is only valid for MARKET orders without quantity")
+	ErrNoLiquidity     = errors.New("no liquidity within market protection price")
+)
+
+// defaultMarketProtection é o desvio máximo, em fração do melhor preço do
+// lado oposto, que uma ordem MARKET aceita executar.
+var defaultMarketProtection = decimal.RequireFromString("0.05")
+
+// SetMarketProtection define o desvio máximo (ex.: 0.05 = 5%) aceito por
+// ordens MARKET a partir do melhor preço do lado oposto. Deve ser igual entre
+// reinícios para que o replay do journal reproduza as execuções.
+func (me *MatchingEngine) SetMarketProtection(pct decimal.Decimal) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.marketProtection = pct
+}
+
+func (me *MatchingEngine) marketProtectionPct() decimal.Decimal {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	return me.marketProtection
+}
+
+// stopProtectionPrice é o preço pelo qual se trava uma compra condicional que
+// vira MARKET: o gatilho acrescido da proteção.
+func (m *market) stopProtectionPrice(order *Order) decimal.Decimal {
+	return order.StopPrice.Mul(decimal.One.Add(m.engine.marketProtectionPct()))
+}
+
+// protectionTicks devolve o pior preço (em ticks) que uma ordem MARKET do
+// lado informado aceita agora; ok=false se o lado oposto está vazio.
+func (m *market) protectionTicks(side Side) (int64, bool) {
+	pct := m.engine.marketProtectionPct()
+	if side == SideBuy {
+		ask, ok := m.book.bestAsk()
+		if !ok {
+			return 0, false
+		}
+		return priceToTicks(ask.Mul(decimal.One.Add(pct))), true
+	}
+	bid, ok := m.book.bestBid()
+	if !ok {
+		return 0, false
+	}
+	return priceToTicks(bid.Mul(decimal.One.Sub(pct))), true
+}
+
+// walk percorre o lado oposto ao da ordem até limitTicks e devolve quantidade
+// e notional executáveis, parando em maxQty e/ou maxQuote (0 = sem limite) ou
+// antes de o notional sair da faixa do decimal. Quantidades limitadas por
+// maxQuote são arredondadas para baixo no lote.
+func (ob *OrderBook) walk(side Side, limitTicks int64, maxQty, maxQuote, lot decimal.Decimal) (qty, quote decimal.Decimal) {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+
+	ladder := ob.asks
+	if side == SideSell {
+		ladder = ob.bids
+	}
+	for node := ladder.head.next[0]; node != nil; node = node.next[0] {
+		level := node.level
+		if !crosses(side, limitTicks, level.ticks) {
+			break
+		}
+		take := level.remainingQty()
+		if maxQty.IsPositive() {
+			take = decimal.Min(take, maxQty.Sub(qty))
+		}
+		if maxQuote.IsPositive() {
+			take = decimal.Min(take, maxQuote.Sub(quote).DivTrunc(level.Price).Floor(lot))
+		}
+		if !take.IsPositive() {
+			break
+		}
+		cost, err := take.CheckedMul(level.Price)
+		if err != nil {
+			break
+		}
+		total, err := quote.CheckedAdd(cost)
+		if err != nil {
+			break
+		}
+		qty = qty.Add(take)
+		quote = total
+	}
+	return qty, quote
+}
+
+// sizeMarketOrder resolve quantidade e custo de uma ordem MARKET a partir do
+// book atual dentro do preço de proteção. Para ordens por valor (QuoteQty)
+// define Quantity; o custo devolvido é o que uma compra trava em quote.
+func (m *market) sizeMarketOrder(order *Order) (decimal.Decimal, error) {
+	limit, ok := m.protectionTicks(order.Side)
+	if !ok {
+		return decimal.Zero, ErrNoLiquidity
+	}
+
+	lot := m.lotSize()
+	var qty, quote decimal.Decimal
+	if order.QuoteQty.IsPositive() {
+		qty, quote = m.book.walk(order.Side, limit, decimal.Zero, order.QuoteQty, lot)
+		if order.TimeInForce == TimeInForceFOK && quote.LessThan(order.QuoteQty) {
+			return decimal.Zero, ErrFOKNotFillable
+		}
+		order.Quantity = qty
+	} else {
+		qty, quote = m.book.walk(order.Side, limit, order.RemainingQty(), decimal.Zero, lot)
+	}
+	if !qty.IsPositive() {
+		return decimal.Zero, ErrNoLiquidity
+	}
+	if quote.GreaterThan(maxOrderValue) {
+		return decimal.Zero, ErrOrderTooLarge
+	}
+	if inst, ok, _ := m.engine.instrument(m.symbol); ok {
+		if err := inst.checkNotional(quote); err != nil {
+			return decimal.Zero, err
+		}
+	}
+	return quote, nil
+}
+
+// validateQuoteQty confere ordens por valor: só MARKET, sem Quantity (que é
+// derivada do book no momento da execução).
+func validateQuoteQty(order *Order) error {
+	if order.QuoteQty.IsZero() {
+		return nil
+	}
+	if order.QuoteQty.IsNegative() || !order.Quantity.IsZero() || order.Type != OrderTypeMarket {
+		return ErrInvalidQuoteQty
+	}
+	return nil
+}
+
+// limitTicks é o limite de preço do matching: o preço da LIMIT ou o preço de
+// proteção da MARKET (ok=false se não há lado oposto).
+func (m *market) limitTicks(order *Order) (int64, bool) {
+	if order.execType() == OrderTypeMarket {
+		return m.protectionTicks(order.Side)
+	}
+	return priceToTicks(order.Price), true
+}
+
+// fillableQty é a quantidade do book executável agora pela ordem (FOK).
+func (m *market) fillableQty(order *Order) decimal.Decimal {
+	limit, ok := m.limitTicks(order)
+	if !ok {
+		return decimal.Zero
+	}
+	return m.book.crossingQty(order, limit)
+}
+
+// quoteLock devolve onde está a trava em quote da ordem de compra: na própria
+// ordem ou no grupo OCO/bracket que a detém.
+func (m *market) quoteLock(order *Order) *decimal.Decimal {
+	if group, ok := m.groups[order.GroupID]; ok && group.EntryOrderID != order.ID {
+		return &group.LockedQuote
+	}
+	return &order.LockedQuote
+}
+
+// consumeQuote abate da trava da compra o notional executado (debitado depois
+// pela liquidação) e devolve a sobra de quem executou abaixo do travado: tudo
+// quando a ordem termina, o excedente sobre Price*restante numa LIMIT parcial.
+func (m *market) consumeQuote(order *Order, notional decimal.Decimal) {
+	lock := m.quoteLock(order)
+	*lock = decimal.Max(lock.Sub(notional), decimal.Zero)
+	switch {
+	case order.Status == OrderStatusFilled:
+		_ = m.releaseQuote(order, order.LockedQuote)
+	case order.execType() == OrderTypeLimit:
+		_ = m.releaseQuote(order, order.LockedQuote.Sub(order.Price.Mul(order.RemainingQty())))
+	}
+}
+
+// releaseQuote devolve amount da trava em quote da própria ordem.
+func (m *market) releaseQuote(order *Order, amount decimal.Decimal) error {
+	if !amount.IsPositive() || m.groupHoldsLock(order) {
+		return nil
+	}
+	amount = decimal.Min(amount, order.LockedQuote)
+	order.LockedQuote = order.LockedQuote.Sub(amount)
+	return m.balances.ReleaseQuote(order.UserID, order.Symbol+"_QUOTE", amount)
+}
+
+// fillQty limita a quantidade de uma execução pela trava (MARKET de compra) e
+// pelo valor alvo (ordens por QuoteQty), arredondando para baixo no lote.
+func (m *market) fillQty(order *Order, qty, price decimal.Decimal) decimal.Decimal {
+	if order.QuoteQty.IsPositive() {
+		left := order.QuoteQty.Sub(order.FilledQuote)
+		if qty.Mul(price).GreaterThan(left) {
+			qty = left.DivTrunc(price).Floor(m.lotSize())
+		}
+	}
+	if order.Side == SideBuy && order.execType() == OrderTypeMarket {
+		budget := *m.quoteLock(order)
+		if qty.Mul(price).GreaterThan(budget) {
+			qty = budget.DivTrunc(price).Floor(m.lotSize())
+		}
+	}
+	return decimal.Max(qty, decimal.Zero)
+}
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+func marketBuy(userID, symbol, qty, quoteQty string) NewOrderRequest {
+	req := NewOrderRequest{UserID: userID, Symbol: symbol, Side: SideBuy, Type: OrderTypeMarket}
+	if qty != "" {
+		req.Quantity = d(qty)
+	}
+	if quoteQty != "" {
+		req.QuoteQty = d(quoteQty)
+	}
+	return req
+}
+
+func TestMarketBuyLocksWalkedQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		req  NewOrderRequest
+		// quantidade executada e quote que segue travado até a liquidação
+		filled string
+		locked string
+	}{
+		{"by quantity", marketBuy("bob", "AAA", "2", ""), "2", "20.2"},
+		{"by quote", marketBuy("bob", "AAA", "", "15.1"), "1.5", "15.1"},
+		// 10.5 no pior nível passa da proteção de 5% sobre 10
+		{"capped by protection", marketBuy("bob", "AAA", "3", ""), "2", "20.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			me, repo, balances := newTestEngine(t)
+			fund(balances, "alice", "AAA")
+			balances.deposit("bob", "AAA_QUOTE", d("100"))
+			mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "1"))
+			mustPlace(t, me, limit("alice", "AAA", SideSell, "10.2", "1"))
+			mustPlace(t, me, limit("alice", "AAA", SideSell, "10.6", "1"))
+
+			order := mustPlace(t, me, tt.req)
+			if got := repo.order(order.ID).FilledQty; !got.Equal(d(tt.filled)) {
+				t.Fatalf("filled = %s, want %s", got, tt.filled)
+			}
+			avail, locked := balances.get("bob", "AAA_QUOTE")
+			if !locked.Equal(d(tt.locked)) || !avail.Add(locked).Equal(d("100")) {
+				t.Fatalf("bob quote = %s/%s, want %s locked and the rest refunded", avail, locked, tt.locked)
+			}
+		})
+	}
+}
+
+func TestLimitBuyReleasesPriceImprovement(t *testing.T) {
+	me, _, balances := newTestEngine(t)
+	fund(balances, "alice", "AAA")
+	balances.deposit("bob", "AAA_QUOTE", d("30"))
+	mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "2"))
+
+	// trava 12 * 2 = 24, executa a 10: os 4 de sobra voltam ao disponível
+	mustPlace(t, me, limit("bob", "AAA", SideBuy, "12", "2"))
+	if avail, locked := balances.get("bob", "AAA_QUOTE"); !avail.Equal(d("10")) || !locked.Equal(d("20")) {
+		t.Fatalf("bob quote = %s/%s, want 10/20", avail, locked)
+	}
+}
+
+func TestMarketOrderValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		req  NewOrderRequest
+		want error
+	}{
+		{"empty book", marketBuy("bob", "BBB", "1", ""), ErrNoLiquidity},
+		{"quote and quantity", marketBuy("bob", "AAA", "1", "10"), ErrInvalidQuoteQty},
+		{"quote on limit", NewOrderRequest{UserID: "bob", Symbol: "AAA", Side: SideBuy, Type: OrderTypeLimit, Price: d("10"), QuoteQty: d("10")}, ErrInvalidQuoteQty},
+		{"quote beyond balance", marketBuy("bob", "AAA", "", "1000"), ErrInsufficientQuote},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			me, _, balances := newTestEngine(t)
+			fund(balances, "alice", "AAA")
+			balances.deposit("bob", "AAA_QUOTE", d("100"))
+			balances.deposit("bob", "BBB_QUOTE", d("100"))
+			mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "200"))
+
+			if _, err := me.PlaceOrder(tt.req); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if avail, _ := balances.get("bob", "AAA_QUOTE"); !avail.Equal(d("100")) {
+				t.Fatalf("bob quote available = %s, want 100", avail)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"hearcap/server/internal/calendar"
+)
+
+var (
+	ErrMarketHalted        = errors.New("market is halted")
+	ErrInvalidMarketStatus = errors.New("invalid market status")
+	ErrMarketClosed        = errors.New("market is closed outside trading session")
+)
+
+// HaltPolicy define o que acontece com ordens novas enquanto o mercado está
+// HALTED.
+type HaltPolicy string
+
+const (
+	// HaltReject recusa a ordem com ErrMarketHalted (padrão).
+	HaltReject HaltPolicy = "REJECT"
+	// HaltQueue aceita ordens que podem repousar (LIMIT GTC/GTD e
+	// condicionais), trava o saldo e as envia ao matching na reabertura, em
+	// ordem de chegada.
+	HaltQueue HaltPolicy = "QUEUE"
+)
+
+// SetHaltPolicy define a política de ordens durante halts. Deve ser igual
+// entre reinícios para que o replay do journal reproduza a fila.
+func (me *MatchingEngine) SetHaltPolicy(policy HaltPolicy) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.haltPolicy = policy
+}
+
+func (me *MatchingEngine) haltPolicyMode() HaltPolicy {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	return me.haltPolicy
+}
+
+// SetCalendar restringe ordens novas ao pregão do calendário: fora dele
+// PlaceOrder recusa com ErrMarketClosed, antes do journal, e cancelamentos
+// continuam aceitos. Sem calendário o mercado não fecha.
+func (me *MatchingEngine) SetCalendar(cal *calendar.Calendar) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.calendar = cal
+}
+
+func (me *MatchingEngine) checkSession(at time.Time) error {
+	me.mu.RLock()
+	cal := me.calendar
+	me.mu.RUnlock()
+	if cal != nil && !cal.IsOpen(at) {
+		return ErrMarketClosed
+	}
+	return nil
+}
+
+// GetMarketStatus implementa MarketStatusRepository com o status aplicado
+// pelo sequenciador do símbolo.
+func (me *MatchingEngine) GetMarketStatus(symbol string) (MarketStatus, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	if status, ok := me.statuses[symbol]; ok {
+		return status, nil
+	}
+	return MarketStatusOpen, nil
+}
+
+// SetMarketStatus implementa MarketStatusRepository: com InstrumentRegistry
+// ligado, o status passa por ele (e volta ao engine pelo Watch); sem ele, vai
+// direto ao sequenciador. Assim o engine pode ser o marketRepo do
+// CircuitBreakerEngine.
+func (me *MatchingEngine) SetMarketStatus(symbol string, status MarketStatus) error {
+	me.mu.RLock()
+	reg := me.instruments
+	me.mu.RUnlock()
+	if reg != nil {
+		return reg.SetMarketStatus(symbol, status)
+	}
+	return me.applyMarketStatus(symbol, status)
+}
+
+// applyMarketStatus envia a mudança de status ao sequenciador do símbolo.
+// Leilões começam por StartAuction; OPEN durante um leilão antecipa o uncross.
+func (me *MatchingEngine) applyMarketStatus(symbol string, status MarketStatus) error {
+	if !validMarketStatus(status) {
+		return ErrInvalidMarketStatus
+	}
+	if cur, _ := me.GetMarketStatus(symbol); cur == status {
+		return nil
+	}
+	return me.submit(symbol, command{kind: cmdSetStatus, status: status, now: time.Now()}).err
+}
+
+func (me *MatchingEngine) storeMarketStatus(symbol string, status MarketStatus, auctionEnds time.Time) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.statuses[symbol] = status
+	if status == MarketStatusAuction {
+		me.auctionEnds[symbol] = auctionEnds
+	} else {
+		delete(me.auctionEnds, symbol)
+	}
+}
+
+func validMarketStatus(status MarketStatus) bool {
+	switch status {
+	case MarketStatusOpen, MarketStatusHalted, MarketStatusSuspended, MarketStatusDelisted:
+		return true
+	}
+	return false
+}
+
+// SetCircuitBreaker liga o circuit breaker: cada trade executado alimenta
+// OnTradeTick numa goroutine própria, fora do sequenciador. O halt volta ao
+// engine pelo MarketStatusRepository do breaker, que deve ser o próprio
+// engine ou o InstrumentRegistry ligado a ele.
+func (me *MatchingEngine) SetCircuitBreaker(cb *CircuitBreakerEngine) {
+	me.mu.Lock()
+	start := me.breaker == nil && cb != nil
+	me.breaker = cb
+	me.mu.Unlock()
+	if start {
+		go me.runBreakerFeed()
+	}
+}
+
+func (me *MatchingEngine) circuitBreaker() *CircuitBreakerEngine {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	return me.breaker
+}
+
+// feedBreaker enfileira o preço de um trade para o circuit breaker sem
+// bloquear o sequenciador.
+func (me *MatchingEngine) feedBreaker(symbol string, trade *Trade) {
+	if me.circuitBreaker() == nil {
+		return
+	}
+	me.tickMu.Lock()
+	me.ticks = append(me.ticks, PriceTick{Symbol: symbol, Price: trade.Price, Timestamp: trade.CreatedAt})
+	me.tickMu.Unlock()
+	select {
+	case me.tickSignal <- struct{}{}:
+	default:
+	}
+}
+
+func (me *MatchingEngine) runBreakerFeed() {
+	for {
+		select {
+		case <-me.tickSignal:
+		case <-me.quit:
+			return
+		}
+		me.tickMu.Lock()
+		ticks := me.ticks
+		me.ticks = nil
+		me.tickMu.Unlock()
+
+		cb := me.circuitBreaker()
+		for _, t := range ticks {
+			_ = cb.OnTradeTick(t.Symbol, t.Price, t.Timestamp)
+		}
+	}
+}
+
+// reopenIfDue consulta o circuit breaker para reabrir um símbolo cujo halt
+// expirou (CanTrade grava OPEN no MarketStatusRepository).
+func (me *MatchingEngine) reopenIfDue(symbol string, now time.Time) {
+	cb := me.circuitBreaker()
+	if cb == nil {
+		return
+	}
+	if status, _ := me.GetMarketStatus(symbol); status == MarketStatusHalted {
+		cb.CanTrade(symbol, now)
+	}
+}
+
+// StartHaltSweeper reabre periodicamente os mercados cujo halt do circuit
+// breaker expirou, liberando ordens enfileiradas mesmo sem novo fluxo.
+func (me *MatchingEngine) StartHaltSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				for _, symbol := range me.marketSymbols() {
+					me.reopenIfDue(symbol, now)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// ---- execução dentro do sequenciador do símbolo ----
+
+func marketStatusError(status MarketStatus) error {
+	switch status {
+	case MarketStatusHalted:
+		return ErrMarketHalted
+	case MarketStatusSuspended:
+		return ErrMarketNotOpen
+	case MarketStatusDelisted:
+		return ErrMarketDelisted
+	case MarketStatusAuction:
+		return ErrMarketInAuction
+	}
+	return nil
+}
+
+// admission decide se uma ordem nova entra no matching (queue=false), vai
+// para a fila do halt (queue=true) ou é recusada. Em leilão só entram ordens
+// que podem repousar.
+func (m *market) admission(order *Order) (queue bool, err error) {
+	if m.status == MarketStatusOpen {
+		return false, nil
+	}
+	queueable := order.restsInBook() || order.isConditional()
+	if m.status == MarketStatusAuction && queueable {
+		return false, nil
+	}
+	if m.status == MarketStatusHalted && queueable && m.engine.haltPolicyMode() == HaltQueue {
+		return true, nil
+	}
+	return false, marketStatusError(m.status)
+}
+
+// setStatus aplica a transição de status do símbolo em at (fim do leilão,
+// para AUCTION; horário do pedido nos demais). A saída de um halt passa pelo
+// leilão de reabertura quando configurado; a abertura faz o uncross do book
+// e envia a fila do halt ao matching; o delist cancela todas as ordens e
+// grupos, devolvendo o saldo travado.
+func (m *market) setStatus(status MarketStatus, at time.Time) error {
+	if m.status == MarketStatusDelisted && status != MarketStatusDelisted {
+		return ErrMarketDelisted
+	}
+	if status == MarketStatusOpen && m.status == MarketStatusHalted {
+		if d := m.engine.auctionConfig().Reopening; d > 0 {
+			status, at = MarketStatusAuction, at.Add(d)
+		}
+	}
+	prev := m.status
+	m.status = status
+	m.auctionEnds = time.Time{}
+	if status == MarketStatusAuction {
+		m.auctionEnds = at
+	}
+	if !m.replaying {
+		m.engine.storeMarketStatus(m.symbol, status, m.auctionEnds)
+	}
+
+	switch status {
+	case MarketStatusOpen:
+		m.uncross(prev == MarketStatusAuction)
+		m.triggerOnPrint()
+		m.releaseQueued()
+	case MarketStatusAuction:
+		m.enterAuction(at)
+	case MarketStatusDelisted:
+		m.cancelAll()
+	}
+	return nil
+}
+
+// releaseQueued envia as ordens recebidas durante o halt ao matching (ou ao
+// book do leilão). Post-only que cruzariam na reabertura são canceladas.
+func (m *market) releaseQueued() {
+	for len(m.queued) > 0 && (m.status == MarketStatusOpen || m.status == MarketStatusAuction) {
+		order := m.queued[0]
+		if err := m.checkPostOnly(order); err != nil {
+			_ = m.pullOrder(order, OrderStatusCanceled)
+			continue
+		}
+		m.queued = m.queued[1:]
+		m.route(order)
+	}
+}
+
+func (m *market) removeQueued(order *Order) bool {
+	for i, o := range m.queued {
+		if o == order {
+			m.queued = append(m.queued[:i], m.queued[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// cancelAll encerra grupos e ordens ativas do símbolo (delist).
+func (m *market) cancelAll() {
+	for _, id := range m.groupIDs() {
+		if group, ok := m.groups[id]; ok {
+			_, _ = m.cancelGroup(id, group.UserID)
+		}
+	}
+	var active []*Order
+	for _, order := range m.orders {
+		active = append(active, order)
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].Seq < active[j].Seq })
+	for _, order := range active {
+		_ = m.pullOrder(order, OrderStatusCanceled)
+	}
+}
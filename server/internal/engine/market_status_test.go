@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMarketStatusGatesOrderEntry(t *testing.T) {
+	tests := []struct {
+		status MarketStatus
+		want   error
+	}{
+		{MarketStatusHalted, ErrMarketHalted},
+		{MarketStatusSuspended, ErrMarketNotOpen},
+		{MarketStatusDelisted, ErrMarketDelisted},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			me, _, balances := newTestEngine(t)
+			fund(balances, "bob", "AAA")
+			resting := mustPlace(t, me, limit("bob", "AAA", SideBuy, "9", "1"))
+
+			if err := me.SetMarketStatus("AAA", tt.status); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := me.PlaceOrder(limit("bob", "AAA", SideBuy, "10", "1")); !errors.Is(err, tt.want) {
+				t.Fatalf("PlaceOrder err = %v, want %v", err, tt.want)
+			}
+			// cancelamentos seguem aceitos (no delist a ordem já saiu)
+			if tt.status != MarketStatusDelisted {
+				if _, err := me.CancelOrder(resting.ID, "bob"); err != nil {
+					t.Fatalf("CancelOrder while %s: %v", tt.status, err)
+				}
+			}
+		})
+	}
+}
+
+func TestHaltQueueReleasesOnReopen(t *testing.T) {
+	me, repo, balances := newTestEngine(t)
+	me.SetHaltPolicy(HaltQueue)
+	fund(balances, "alice", "AAA")
+	balances.deposit("bob", "AAA_QUOTE", d("100"))
+	mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "2"))
+
+	if err := me.SetMarketStatus("AAA", MarketStatusHalted); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := me.PlaceOrder(marketBuy("bob", "AAA", "1", "")); !errors.Is(err, ErrMarketHalted) {
+		t.Fatalf("MARKET during halt err = %v, want ErrMarketHalted", err)
+	}
+	queued := mustPlace(t, me, limit("bob", "AAA", SideBuy, "10", "2"))
+	if _, locked := balances.get("bob", "AAA_QUOTE"); !locked.Equal(d("20")) {
+		t.Fatalf("queued order locked %s, want 20", locked)
+	}
+	if n := repo.tradeCount(); n != 0 {
+		t.Fatalf("trades during halt = %d, want 0", n)
+	}
+
+	if err := me.SetMarketStatus("AAA", MarketStatusOpen); err != nil {
+		t.Fatal(err)
+	}
+	if s := repo.order(queued.ID).Status; s != OrderStatusFilled {
+		t.Fatalf("queued order after reopen = %s, want FILLED", s)
+	}
+}
+
+func TestDelistCancelsRestingOrders(t *testing.T) {
+	me, repo, balances := newTestEngine(t)
+	fund(balances, "alice", "AAA")
+	balances.deposit("bob", "AAA_QUOTE", d("100"))
+	ask := mustPlace(t, me, limit("alice", "AAA", SideSell, "12", "2"))
+	bid := mustPlace(t, me, limit("bob", "AAA", SideBuy, "10", "3"))
+
+	if err := me.SetMarketStatus("AAA", MarketStatusDelisted); err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range []*Order{ask, bid} {
+		if s := repo.order(o.ID).Status; s != OrderStatusCanceled {
+			t.Fatalf("order %s after delist = %s, want CANCELED", o.ID, s)
+		}
+	}
+	if avail, locked := balances.get("bob", "AAA_QUOTE"); !avail.Equal(d("100")) || !locked.IsZero() {
+		t.Fatalf("bob quote = %s/%s, want 100/0", avail, locked)
+	}
+	if _, locked := balances.get("alice", "AAA"); !locked.IsZero() {
+		t.Fatalf("alice base locked = %s, want 0", locked)
+	}
+	if err := me.SetMarketStatus("AAA", MarketStatusOpen); !errors.Is(err, ErrMarketDelisted) {
+		t.Fatalf("reopen after delist err = %v, want ErrMarketDelisted", err)
+	}
+}
+
+func TestCircuitBreakerHaltsOnTradeMove(t *testing.T) {
+	me, _, balances := newTestEngine(t)
+	cb := NewCircuitBreakerEngine(RiskConfig{
+		CircuitBreakerWindow:      time.Minute,
+		CircuitBreakerMovePercent: 10,
+		CircuitBreakerHaltTime:    time.Hour,
+	}, me, nil)
+	me.SetCircuitBreaker(cb)
+	fund(balances, "alice", "AAA")
+	fund(balances, "bob", "AAA")
+
+	mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "1"))
+	mustPlace(t, me, limit("alice", "AAA", SideSell, "12", "1"))
+	mustPlace(t, me, limit("bob", "AAA", SideBuy, "10", "1"))
+	mustPlace(t, me, limit("bob", "AAA", SideBuy, "12", "1"))
+
+	// o breaker roda fora do sequenciador: espera o halt chegar
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if status, _ := me.GetMarketStatus("AAA"); status == MarketStatusHalted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("market not halted after a 20% move")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := me.PlaceOrder(limit("bob", "AAA", SideBuy, "12", "1")); !errors.Is(err, ErrMarketHalted) {
+		t.Fatalf("PlaceOrder after the breaker err = %v, want ErrMarketHalted", err)
+	}
+}
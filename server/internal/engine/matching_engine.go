@@ -1,338 +1,1119 @@
 package engine
 
 import (
+	"context"
 	"errors"
-	"sort"
+	"fmt"
 	"sync"
 	"time"
 
+	"hearcap/server/internal/calendar"
+	"hearcap/server/internal/decimal"
+
 	"github.com/google/uuid"
 )
 
+var (
+	ErrOrderNotFound  = errors.New("order not found")
+	ErrOrderNotOwned  = errors.New("order does not belong to user")
+	ErrOrderNotActive = errors.New("order is no longer active")
+	ErrInvalidAmend   = errors.New("invalid amend request")
+
+	ErrInvalidOrder      = errors.New("invalid order side or type")
+	ErrInvalidQuantity   = errors.New("quantity must be > 0")
+	ErrInvalidPrice      = errors.New("limit price must be > 0")
+	ErrInsufficientBase  = errors.New("insufficient base balance")
+	ErrInsufficientQuote = errors.New("insufficient quote balance")
+
+	ErrInvalidTimeInForce = errors.New("invalid time in force for order type")
+	ErrInvalidExpireAt    = errors.New("GTD orders require a future expire time")
+	ErrPostOnlyWouldCross = errors.New("post-only order would cross the book")
+	ErrFOKNotFillable     = errors.New("FOK order cannot be fully filled")
+	ErrInvalidSTPMode     = errors.New("invalid self-trade prevention mode")
+	ErrInvalidDisplayQty  = errors.New("display quantity requires a resting LIMIT order smaller than quantity")
+	ErrOrderTooLarge      = errors.New("order price, quantity or notional exceeds the supported range")
+)
+
+// maxOrderValue limita preço, quantidades e notional de uma ordem. A faixa do
+// decimal (~9,2e10) fica ~90x acima, então trava com proteção, acumulados e
+// taxas de uma ordem aceita não estouram.
+var maxOrderValue = decimal.FromInt(1_000_000_000)
+
+// repriceTick é o passo usado para reposicionar ordens post-only que cruzariam
+// em mercados sem especificação de tick.
+var repriceTick = decimal.RequireFromString("0.0001")
+
+// MatchingEngine roteia cada comando para o sequenciador do seu símbolo: uma
+// goroutine por símbolo aplica place/cancel/amend/trigger em ordem, de modo
+// que o matching é determinístico e não precisa de locks entre etapas.
+//
+// Repository, BalanceService, EventBus e MarketDataEngine são chamados de
+// dentro do sequenciador e não devem chamar o MatchingEngine de volta de
+// forma síncrona.
 type MatchingEngine struct {
 	repo       Repository
 	balances   BalanceService
 	events     EventBus
 	marketData *MarketDataEngine
 
-	mu    sync.RWMutex
-	books map[string]*OrderBook
+	mu           sync.RWMutex
+	markets      map[string]*market
+	orderSymbols map[string]string
+	groupSymbols map[string]string
+	accountSTP   map[string]STPMode
+	// marketProtection é o desvio máximo aceito por ordens MARKET.
+	marketProtection decimal.Decimal
+	instruments      *InstrumentRegistry
+	// statuses espelha o status aplicado por cada sequenciador.
+	statuses   map[string]MarketStatus
+	haltPolicy HaltPolicy
+	// calendar limita ordens novas ao horário do pregão (nil: sempre aberto).
+	calendar *calendar.Calendar
+	// auction configura os leilões automáticos; auctionEnds espelha o fim
+	// dos leilões em curso.
+	auction     AuctionConfig
+	auctionEnds map[string]time.Time
+
+	breaker    *CircuitBreakerEngine
+	fees       *FeeEngine
+	postTrade  *PostTradePipeline
+	tickMu     sync.Mutex
+	ticks      []PriceTick
+	tickSignal chan struct{}
 
-	stopOrders []*Order
+	journal       *FileJournal
+	snapshotEvery int
+	// recovered marca o fim do Recover (ver SetInstruments).
+	recovered bool
+
+	quit     chan struct{}
+	stopOnce sync.Once
 }
 
 func NewMatchingEngine(repo Repository, balances BalanceService, events EventBus, marketData *MarketDataEngine) *MatchingEngine {
 	return &MatchingEngine{
-		repo:       repo,
-		balances:   balances,
-		events:     events,
-		marketData: marketData,
-		books:      make(map[string]*OrderBook),
+		repo:         repo,
+		balances:     balances,
+		events:       events,
+		marketData:   marketData,
+		markets:      make(map[string]*market),
+		orderSymbols: make(map[string]string),
+		groupSymbols: make(map[string]string),
+		accountSTP:   make(map[string]STPMode),
+		statuses:     make(map[string]MarketStatus),
+		auctionEnds:  make(map[string]time.Time),
+		haltPolicy:   HaltReject,
+		tickSignal:   make(chan struct{}, 1),
+		quit:         make(chan struct{}),
+
+		marketProtection: defaultMarketProtection,
 	}
 }
 
-func (me *MatchingEngine) getBook(symbol string) *OrderBook {
+func (me *MatchingEngine) getMarket(symbol string) *market {
+	me.mu.RLock()
+	m, ok := me.markets[symbol]
+	me.mu.RUnlock()
+	if ok {
+		return m
+	}
+
 	me.mu.Lock()
 	defer me.mu.Unlock()
+	if m, ok := me.markets[symbol]; ok {
+		return m
+	}
+	m = newMarket(me, symbol)
+	me.markets[symbol] = m
+	go m.run(me.quit)
+	return m
+}
 
-	book, ok := me.books[symbol]
-	if !ok {
-		book = NewOrderBook(symbol)
-		me.books[symbol] = book
+// marketSymbols lista os símbolos com sequenciador ativo.
+func (me *MatchingEngine) marketSymbols() []string {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	symbols := make([]string, 0, len(me.markets))
+	for symbol := range me.markets {
+		symbols = append(symbols, symbol)
 	}
-	return book
+	return symbols
+}
+
+func (me *MatchingEngine) getBook(symbol string) *OrderBook {
+	return me.getMarket(symbol).book
+}
+
+// Stop encerra os sequenciadores; comandos posteriores retornam ErrEngineStopped.
+func (me *MatchingEngine) Stop() {
+	me.stopOnce.Do(func() { close(me.quit) })
 }
 
 func (me *MatchingEngine) PlaceOrder(req NewOrderRequest) (*Order, error) {
-	if req.Quantity <= 0 {
-		return nil, errors.New("quantity must be > 0")
+	if !req.Quantity.IsPositive() && req.QuoteQty.IsZero() {
+		return nil, ErrInvalidQuantity
+	}
+	if !validSide(req.Side) || !validOrderType(req.Type) {
+		return nil, ErrInvalidOrder
+	}
+	if err := validatePrice(req.Type, req.Price); err != nil {
+		return nil, err
+	}
+	if err := validateBounds(req.Price, req.StopPrice, req.Quantity, req.QuoteQty, req.DisplayQty, req.TrailingAmount); err != nil {
+		return nil, err
 	}
 
 	order := &Order{
-		ID:        uuid.NewString(),
-		UserID:    req.UserID,
-		Symbol:    req.Symbol,
-		Side:      req.Side,
-		Type:      req.Type,
-		Price:     req.Price,
-		StopPrice: req.StopPrice,
-		Quantity:  req.Quantity,
-		Status:    OrderStatusNew,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:         uuid.NewString(),
+		UserID:     req.UserID,
+		Symbol:     req.Symbol,
+		Side:       req.Side,
+		Type:       req.Type,
+		Price:      req.Price,
+		StopPrice:  req.StopPrice,
+		Quantity:   req.Quantity,
+		QuoteQty:   req.QuoteQty,
+		DisplayQty: req.DisplayQty,
+
+		TrailingAmount:  req.TrailingAmount,
+		TrailingPercent: req.TrailingPercent,
+
+		TimeInForce: req.TimeInForce,
+		ExpireAt:    req.ExpireAt,
+		PostOnly:    req.PostOnly,
+		STP:         req.STP,
+		Status:      OrderStatusNew,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
 	}
 
-	if err := me.preCheckAndLock(order); err != nil {
+	if err := validateTimeInForce(order); err != nil {
 		return nil, err
 	}
-
-	if err := me.repo.SaveOrder(order); err != nil {
+	if err := validateConditional(order); err != nil {
 		return nil, err
 	}
+	if err := validateIceberg(order); err != nil {
+		return nil, err
+	}
+	if err := validateQuoteQty(order); err != nil {
+		return nil, err
+	}
+	if err := validateNotional(order); err != nil {
+		return nil, err
+	}
+	if err := me.checkInstrument(order); err != nil {
+		return nil, err
+	}
+	if err := me.checkSession(order.CreatedAt); err != nil {
+		return nil, err
+	}
+	if order.STP == STPNone {
+		order.STP = me.accountSTPMode(order.UserID)
+	}
+	if !validSTPMode(order.STP) {
+		return nil, ErrInvalidSTPMode
+	}
+	me.reopenIfDue(order.Symbol, order.CreatedAt)
 
-	if order.Type == OrderTypeStop {
-		me.stopOrders = append(me.stopOrders, order)
-		return order, nil
+	me.indexOrder(order)
+	res := me.submit(order.Symbol, command{kind: cmdPlace, order: order})
+	if res.err != nil {
+		me.unindexOrder(order.ID)
+		return nil, res.err
 	}
+	return res.order, nil
+}
 
-	if err := me.match(order); err != nil {
-		return nil, err
+// CancelOrder retira uma ordem ativa (em repouso no book ou STOP pendente)
+// e devolve o saldo ainda travado para o usuário.
+func (me *MatchingEngine) CancelOrder(orderID, userID string) (*Order, error) {
+	symbol, ok := me.orderSymbol(orderID)
+	if !ok {
+		return nil, ErrOrderNotFound
 	}
+	res := me.submit(symbol, command{kind: cmdCancel, orderID: orderID, userID: userID})
+	return res.order, res.err
+}
 
-	snapshot := me.getBook(order.Symbol).Snapshot(50)
-	_ = me.events.PublishOrderBookUpdate(order.Symbol, snapshot)
+type AmendOrderRequest struct {
+	OrderID     string
+	UserID      string
+	NewPrice    decimal.Decimal
+	NewQuantity decimal.Decimal
+}
 
-	// Notificar MarketDataEngine do snapshot atualizado
-	if me.marketData != nil {
-		me.marketData.OnOrderBookSnapshot(snapshot)
+// AmendOrder altera preço e/ou quantidade total de uma ordem LIMIT em repouso
+// (cancel/replace). Mudança de preço ou aumento de quantidade fazem a ordem
+// perder a prioridade de tempo; redução de quantidade no mesmo preço mantém.
+func (me *MatchingEngine) AmendOrder(req AmendOrderRequest) (*Order, error) {
+	if err := validateBounds(req.NewPrice, req.NewQuantity); err != nil {
+		return nil, err
 	}
+	if _, err := orderNotional(req.NewPrice, req.NewQuantity); err != nil {
+		return nil, err
+	}
+	symbol, ok := me.orderSymbol(req.OrderID)
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	res := me.submit(symbol, command{kind: cmdAmend, amend: req})
+	return res.order, res.err
+}
 
-	return order, nil
+// TriggerStops avalia as ordens STOP pendentes do símbolo contra lastPrice e
+// devolve quantas foram disparadas.
+func (me *MatchingEngine) TriggerStops(symbol string, lastPrice decimal.Decimal) int {
+	return me.submit(symbol, command{kind: cmdTrigger, price: lastPrice}).count
 }
 
-func (me *MatchingEngine) preCheckAndLock(order *Order) error {
-	baseSymbol := order.Symbol
-	quoteSymbol := order.Symbol + "_QUOTE"
+// ExpireOrders encerra as ordens GTD cujo prazo venceu até now.
+func (me *MatchingEngine) ExpireOrders(now time.Time) int {
+	expired := 0
+	for _, symbol := range me.marketSymbols() {
+		expired += me.submit(symbol, command{kind: cmdExpire, now: now}).count
+	}
+	return expired
+}
 
-	if order.Side == SideSell {
-		if !me.balances.CanLockBase(order.UserID, baseSymbol, order.Quantity) {
-			return errors.New("insufficient base balance")
+// StartExpirySweeper roda ExpireOrders periodicamente até o contexto encerrar.
+func (me *MatchingEngine) StartExpirySweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				me.ExpireOrders(now)
+			case <-ctx.Done():
+				return
+			}
 		}
-		return me.balances.LockBase(order.UserID, baseSymbol, order.Quantity)
-	}
+	}()
+}
+
+func (me *MatchingEngine) GetOrderBookSnapshot(symbol string, depth int) OrderBookSnapshot {
+	return me.getBook(symbol).Snapshot(depth)
+}
 
-	notional := order.Price * order.Quantity
-	if order.Type == OrderTypeMarket && notional == 0 {
-		// fallback se preço não veio
-		notional = order.Quantity
+// SetAccountSTP define o modo de self-trade prevention usado pelas ordens do
+// usuário que não informam um modo próprio. STPNone remove o padrão.
+func (me *MatchingEngine) SetAccountSTP(userID string, mode STPMode) error {
+	if !validSTPMode(mode) {
+		return ErrInvalidSTPMode
 	}
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if mode == STPNone {
+		delete(me.accountSTP, userID)
+		return nil
+	}
+	me.accountSTP[userID] = mode
+	return nil
+}
+
+func (me *MatchingEngine) accountSTPMode(userID string) STPMode {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	return me.accountSTP[userID]
+}
 
-	if !me.balances.CanLockQuote(order.UserID, quoteSymbol, notional) {
-		return errors.New("insufficient quote balance")
+func validSTPMode(mode STPMode) bool {
+	switch mode {
+	case STPNone, STPCancelNewest, STPCancelOldest, STPCancelBoth, STPDecrementAndCancel:
+		return true
 	}
-	return me.balances.LockQuote(order.UserID, quoteSymbol, notional)
+	return false
 }
 
-func (me *MatchingEngine) match(order *Order) error {
-	book := me.getBook(order.Symbol)
-	if order.Side == SideBuy {
-		return me.matchBuy(book, order)
+func validSide(side Side) bool {
+	return side == SideBuy || side == SideSell
+}
+
+func validOrderType(typ OrderType) bool {
+	switch typ {
+	case OrderTypeMarket, OrderTypeLimit, OrderTypeStop, OrderTypeStopLimit,
+		OrderTypeTrailingStop, OrderTypeTakeProfit, OrderTypeTakeProfitLimit:
+		return true
 	}
-	return me.matchSell(book, order)
+	return false
 }
 
-func (me *MatchingEngine) matchBuy(book *OrderBook, buy *Order) error {
-	for buy.RemainingQty() > 0 {
-		book.mu.RLock()
-		var askPrices []float64
-		for price := range book.asks {
-			askPrices = append(askPrices, price)
-		}
-		book.mu.RUnlock()
+func (me *MatchingEngine) indexOrder(order *Order) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.orderSymbols[order.ID] = order.Symbol
+}
 
-		if len(askPrices) == 0 {
-			break
-		}
-		sort.Float64s(askPrices)
-		bestAsk := askPrices[0]
+func (me *MatchingEngine) unindexOrder(orderID string) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	delete(me.orderSymbols, orderID)
+}
 
-		if buy.Type == OrderTypeLimit && bestAsk > buy.Price {
-			break
+func (me *MatchingEngine) orderSymbol(orderID string) (string, bool) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	symbol, ok := me.orderSymbols[orderID]
+	return symbol, ok
+}
+
+// validatePrice exige preço limite positivo nas ordens que têm limite; sem
+// isso uma LIMIT a preço zero ou negativo entraria no journal e no book.
+func validatePrice(typ OrderType, price decimal.Decimal) error {
+	switch typ {
+	case OrderTypeLimit, OrderTypeStopLimit, OrderTypeTakeProfitLimit:
+		if !price.IsPositive() {
+			return ErrInvalidPrice
 		}
+	}
+	return nil
+}
 
-		book.mu.Lock()
-		level := book.asks[bestAsk]
-		if level == nil || len(level.Orders) == 0 {
-			book.mu.Unlock()
-			continue
+// validateBounds rejeita valores acima de maxOrderValue antes de o comando
+// chegar ao journal: um valor fora da faixa travaria o sequenciador em todo
+// replay.
+func validateBounds(values ...decimal.Decimal) error {
+	for _, v := range values {
+		if v.Abs().GreaterThan(maxOrderValue) {
+			return ErrOrderTooLarge
 		}
+	}
+	return nil
+}
 
-		sell := level.Orders[0]
-		qty := min(buy.RemainingQty(), sell.RemainingQty())
-		price := bestAsk
+// validateNotional limita o notional pelo preço de referência da ordem (o
+// limite, senão o gatilho). MARKET por quantidade é conferida ao percorrer o
+// book (sizeMarketOrder).
+func validateNotional(order *Order) error {
+	ref := order.Price
+	if ref.IsZero() {
+		ref = order.StopPrice
+	}
+	_, err := orderNotional(ref, order.Quantity)
+	return err
+}
 
-		buy.FilledQty += qty
-		sell.FilledQty += qty
+// orderNotional calcula price*qty e devolve ErrOrderTooLarge se o resultado
+// sair da faixa ou passar de maxOrderValue.
+func orderNotional(price, qty decimal.Decimal) (decimal.Decimal, error) {
+	notional, err := price.CheckedMul(qty)
+	if err != nil || notional.Abs().GreaterThan(maxOrderValue) {
+		return decimal.Zero, ErrOrderTooLarge
+	}
+	return notional, nil
+}
 
-		if sell.RemainingQty() == 0 {
-			sell.Status = OrderStatusFilled
-			level.Orders = level.Orders[1:]
-		} else {
-			sell.Status = OrderStatusPartFilled
+func validateTimeInForce(order *Order) error {
+	if order.TimeInForce == "" {
+		switch order.Type {
+		case OrderTypeLimit, OrderTypeStopLimit, OrderTypeTakeProfitLimit:
+			order.TimeInForce = TimeInForceGTC
+		default:
+			order.TimeInForce = TimeInForceIOC
 		}
+	}
 
-		if len(level.Orders) == 0 {
-			book.removeEmptyLevel(SideSell, bestAsk)
+	switch order.TimeInForce {
+	case TimeInForceGTC, TimeInForceGTD:
+		if order.Type == OrderTypeMarket {
+			return ErrInvalidTimeInForce
 		}
-		book.mu.Unlock()
-
-		trade := &Trade{
-			ID:        uuid.NewString(),
-			Symbol:    buy.Symbol,
-			BuyOrder:  buy.ID,
-			SellOrder: sell.ID,
-			Price:     price,
-			Quantity:  qty,
-			CreatedAt: time.Now(),
+	case TimeInForceIOC, TimeInForceFOK:
+		if order.PostOnly != PostOnlyNone {
+			return ErrInvalidTimeInForce
 		}
+	default:
+		return ErrInvalidTimeInForce
+	}
 
-		_ = me.repo.SaveTrade(trade)
-		_ = me.repo.UpdateOrder(buy)
-		_ = me.repo.UpdateOrder(sell)
-		_ = me.events.PublishTrade(trade)
-
-		// Notificar MarketDataEngine
-		if me.marketData != nil {
-			_ = me.marketData.OnTradeEvent(TradeEvent{
-				ID:        trade.ID,
-				Symbol:    trade.Symbol,
-				Price:     trade.Price,
-				Quantity:  trade.Quantity,
-				Side:      SideBuy, // buy é o agressor neste caso
-				Source:    TradeSourceLit,
-				Timestamp: trade.CreatedAt,
-			})
+	if order.TimeInForce == TimeInForceGTD {
+		if order.ExpireAt == nil || !order.ExpireAt.After(time.Now()) {
+			return ErrInvalidExpireAt
 		}
+	} else {
+		order.ExpireAt = nil
+	}
 
-		if buy.RemainingQty() == 0 {
-			buy.Status = OrderStatusFilled
-			break
+	if order.PostOnly != PostOnlyNone && order.Type != OrderTypeLimit {
+		return ErrInvalidTimeInForce
+	}
+	return nil
+}
+
+func validateIceberg(order *Order) error {
+	if order.DisplayQty.IsZero() {
+		return nil
+	}
+	if order.DisplayQty.IsNegative() || order.DisplayQty.GreaterThanOrEqual(order.Quantity) || !order.restsInBook() {
+		return ErrInvalidDisplayQty
+	}
+	return nil
+}
+
+// ---- execução dentro do sequenciador do símbolo ----
+
+func (m *market) place(order *Order) error {
+	queue, err := m.admission(order)
+	if err != nil {
+		return err
+	}
+	if err := m.precheck(order); err != nil {
+		return err
+	}
+	if err := m.preCheckAndLock(order); err != nil {
+		return err
+	}
+	if err := m.admit(order); err != nil {
+		// a ordem não foi aceita: o saldo travado volta ao usuário
+		_ = m.releaseRemaining(order)
+		return err
+	}
+	if queue {
+		m.queued = append(m.queued, order)
+		return nil
+	}
+	m.route(order)
+	return nil
+}
+
+// precheck valida a ordem contra o estado atual do book, sem travar saldo.
+func (m *market) precheck(order *Order) error {
+	if err := m.checkPostOnly(order); err != nil {
+		return err
+	}
+	if order.TimeInForce == TimeInForceFOK && !order.isConditional() && order.QuoteQty.IsZero() {
+		if m.fillableQty(order).LessThan(order.Quantity) {
+			return ErrFOKNotFillable
 		}
-		buy.Status = OrderStatusPartFilled
 	}
+	return m.initTrailing(order)
+}
 
-	if buy.RemainingQty() > 0 && buy.Type == OrderTypeLimit {
-		book.addOrder(buy)
-		_ = me.repo.UpdateOrder(buy)
+// admit persiste a ordem aceita e passa a rastreá-la no símbolo.
+func (m *market) admit(order *Order) error {
+	order.Seq = m.nextSeq()
+	if err := m.repo.SaveOrder(order); err != nil {
+		return err
 	}
+	m.orders[order.ID] = order
+	_ = m.events.PublishOrderUpdate(order.clone())
+	return nil
+}
 
+// route leva a ordem admitida ao índice de condicionais ou ao matching.
+func (m *market) route(order *Order) {
+	if order.isConditional() {
+		m.addStop(order)
+		m.triggerOnPrint()
+		return
+	}
+
+	m.matchOrder(order)
+	m.publishBook()
+	m.triggerOnPrint()
+}
+
+func (m *market) cancel(orderID, userID string) (*Order, error) {
+	order, err := m.lookupActiveOrder(orderID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.pullOrder(order, OrderStatusCanceled); err != nil {
+		return nil, err
+	}
+	return order.clone(), nil
+}
+
+// pullOrder retira uma ordem ativa do book/lista de STOP, libera o saldo e a
+// encerra com o status terminal informado.
+func (m *market) pullOrder(order *Order, status OrderStatus) error {
+	if !m.removeStopOrder(order) && !m.book.removeOrder(order) && !m.removeQueued(order) {
+		return ErrOrderNotActive
+	}
+
+	if err := m.releaseRemaining(order); err != nil {
+		return err
+	}
+
+	order.Status = status
+	m.forgetOrder(order)
+	if err := m.updateOrder(order); err != nil {
+		return err
+	}
+
+	m.publishBook()
 	return nil
 }
 
-func (me *MatchingEngine) matchSell(book *OrderBook, sell *Order) error {
-	for sell.RemainingQty() > 0 {
-		book.mu.RLock()
-		var bidPrices []float64
-		for price := range book.bids {
-			bidPrices = append(bidPrices, price)
+func (m *market) expire(now time.Time) int {
+	var due []*Order
+	for _, order := range m.orders {
+		if order.TimeInForce == TimeInForceGTD && order.ExpireAt != nil && !order.ExpireAt.After(now) {
+			due = append(due, order)
 		}
-		book.mu.RUnlock()
+	}
 
-		if len(bidPrices) == 0 {
-			break
+	expired := 0
+	for _, order := range due {
+		if err := m.pullOrder(order, OrderStatusExpired); err == nil {
+			expired++
 		}
-		sort.Sort(sort.Reverse(sort.Float64Slice(bidPrices)))
-		bestBid := bidPrices[0]
+	}
+	return expired
+}
 
-		if sell.Type == OrderTypeLimit && bestBid < sell.Price {
-			break
+func (m *market) amendOrder(req AmendOrderRequest) (*Order, error) {
+	order, err := m.lookupActiveOrder(req.OrderID, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if order.execType() != OrderTypeLimit || m.groupHoldsLock(order) {
+		return nil, ErrInvalidAmend
+	}
+	if err := marketStatusError(m.status); err != nil && m.status != MarketStatusAuction {
+		return nil, err
+	}
+
+	newPrice := req.NewPrice
+	if newPrice.IsZero() {
+		newPrice = order.Price
+	}
+	newQty := req.NewQuantity
+	if newQty.IsZero() {
+		newQty = order.Quantity
+	}
+	if !newPrice.IsPositive() || newQty.LessThanOrEqual(order.FilledQty) {
+		return nil, ErrInvalidAmend
+	}
+	if newPrice == order.Price && newQty == order.Quantity {
+		return order.clone(), nil
+	}
+	if err := m.checkAmend(newPrice, newQty); err != nil {
+		return nil, err
+	}
+
+	if order.PostOnly != PostOnlyNone && newPrice != order.Price {
+		probe := order.clone()
+		probe.Price = newPrice
+		if err := m.checkPostOnly(probe); err != nil {
+			return nil, err
 		}
+		newPrice = probe.Price
+	}
 
-		book.mu.Lock()
-		level := book.bids[bestBid]
-		if level == nil || len(level.Orders) == 0 {
-			book.mu.Unlock()
-			continue
+	if newPrice == order.Price && newQty.LessThan(order.Quantity) {
+		if err := m.releaseQty(order, order.Quantity.Sub(newQty)); err != nil {
+			return nil, err
 		}
+		m.book.mu.Lock()
+		order.Quantity = newQty
+		order.replenish()
+		m.book.mu.Unlock()
 
-		buy := level.Orders[0]
-		qty := min(sell.RemainingQty(), buy.RemainingQty())
-		price := bestBid
+		if err := m.updateOrder(order); err != nil {
+			return nil, err
+		}
+		m.publishBook()
+		return order.clone(), nil
+	}
 
-		sell.FilledQty += qty
-		buy.FilledQty += qty
+	// a trava é ajustada antes de a ordem sair do book: um amend recusado
+	// por saldo mantém a posição na fila
+	if !m.book.contains(order) {
+		return nil, ErrOrderNotActive
+	}
+	if err := m.relockForAmend(order, newPrice, newQty); err != nil {
+		return nil, err
+	}
+	m.book.removeOrder(order)
 
-		if buy.RemainingQty() == 0 {
-			buy.Status = OrderStatusFilled
-			level.Orders = level.Orders[1:]
-		} else {
-			buy.Status = OrderStatusPartFilled
-		}
+	order.Price = newPrice
+	order.Quantity = newQty
+	if err := m.updateOrder(order); err != nil {
+		return nil, err
+	}
+
+	m.matchOrder(order)
+	m.publishBook()
+	m.triggerOnPrint()
+	return order.clone(), nil
+}
+
+// relockForAmend ajusta a trava de saldo da diferença entre o lock atual e o
+// lock exigido pela nova combinação preço/quantidade.
+func (m *market) relockForAmend(order *Order, newPrice, newQty decimal.Decimal) error {
+	remainingAfter := newQty.Sub(order.FilledQty)
 
-		if len(level.Orders) == 0 {
-			book.removeEmptyLevel(SideBuy, bestBid)
+	if order.Side == SideSell {
+		delta := remainingAfter.Sub(order.RemainingQty())
+		if delta.IsPositive() {
+			if !m.balances.CanLockBase(order.UserID, order.Symbol, delta) {
+				return ErrInsufficientBase
+			}
+			return m.balances.LockBase(order.UserID, order.Symbol, delta)
 		}
-		book.mu.Unlock()
-
-		trade := &Trade{
-			ID:        uuid.NewString(),
-			Symbol:    sell.Symbol,
-			BuyOrder:  buy.ID,
-			SellOrder: sell.ID,
-			Price:     price,
-			Quantity:  qty,
-			CreatedAt: time.Now(),
+		if delta.IsNegative() {
+			return m.balances.ReleaseBase(order.UserID, order.Symbol, delta.Neg())
 		}
+		return nil
+	}
 
-		_ = me.repo.SaveTrade(trade)
-		_ = me.repo.UpdateOrder(sell)
-		_ = me.repo.UpdateOrder(buy)
-		_ = me.events.PublishTrade(trade)
-
-		// Notificar MarketDataEngine
-		if me.marketData != nil {
-			_ = me.marketData.OnTradeEvent(TradeEvent{
-				ID:        trade.ID,
-				Symbol:    trade.Symbol,
-				Price:     trade.Price,
-				Quantity:  trade.Quantity,
-				Side:      SideSell, // sell é o agressor neste caso
-				Source:    TradeSourceLit,
-				Timestamp: trade.CreatedAt,
-			})
+	quoteSymbol := order.Symbol + "_QUOTE"
+	target, err := orderNotional(newPrice, remainingAfter)
+	if err != nil {
+		return err
+	}
+	delta := target.Sub(order.LockedQuote)
+	if delta.IsPositive() {
+		if !m.balances.CanLockQuote(order.UserID, quoteSymbol, delta) {
+			return ErrInsufficientQuote
 		}
+		err = m.balances.LockQuote(order.UserID, quoteSymbol, delta)
+	} else if delta.IsNegative() {
+		err = m.balances.ReleaseQuote(order.UserID, quoteSymbol, delta.Neg())
+	}
+	if err != nil {
+		return err
+	}
+	order.LockedQuote = target
+	return nil
+}
 
-		if sell.RemainingQty() == 0 {
-			sell.Status = OrderStatusFilled
-			break
+// releaseRemaining devolve o saldo ainda travado pela parte não executada.
+func (m *market) releaseRemaining(order *Order) error {
+	if order.Side == SideBuy {
+		return m.releaseQuote(order, order.LockedQuote)
+	}
+	return m.releaseQty(order, order.RemainingQty())
+}
+
+// releaseQty devolve o saldo travado para qty unidades ainda não executadas;
+// em compras, a fração correspondente da trava em quote. Deve ser chamada
+// antes de reduzir a quantidade da ordem.
+func (m *market) releaseQty(order *Order, qty decimal.Decimal) error {
+	if !qty.IsPositive() || m.groupHoldsLock(order) {
+		return nil
+	}
+
+	if order.Side == SideSell {
+		return m.balances.ReleaseBase(order.UserID, order.Symbol, qty)
+	}
+
+	remaining := order.RemainingQty()
+	if !remaining.IsPositive() {
+		return nil
+	}
+	if qty.GreaterThanOrEqual(remaining) {
+		return m.releaseQuote(order, order.LockedQuote)
+	}
+	return m.releaseQuote(order, order.LockedQuote.Mul(qty).Div(remaining))
+}
+
+func (m *market) lookupActiveOrder(orderID, userID string) (*Order, error) {
+	order, ok := m.orders[orderID]
+	if !ok {
+		return nil, ErrOrderNotActive
+	}
+	if order.UserID != userID {
+		return nil, ErrOrderNotOwned
+	}
+	return order, nil
+}
+
+func (m *market) removeStopOrder(order *Order) bool {
+	return order.isConditional() && m.stops.remove(order)
+}
+
+// forgetOrder descarta uma ordem que atingiu estado terminal.
+func (m *market) forgetOrder(order *Order) {
+	delete(m.orders, order.ID)
+	m.engine.unindexOrder(order.ID)
+}
+
+// updateOrder carimba sequência/horário e persiste a ordem.
+func (m *market) updateOrder(order *Order) error {
+	m.stampOrder(order)
+	err := m.repo.UpdateOrder(order)
+	_ = m.events.PublishOrderUpdate(order.clone())
+	if order.GroupID != "" {
+		m.onGroupLeg(order)
+	}
+	return err
+}
+
+// updateOrHalt persiste uma ordem alterada pelo matching; se a gravação
+// falhar, o símbolo para (halt) em vez de seguir com o Repository divergente.
+func (m *market) updateOrHalt(order *Order) {
+	if err := m.updateOrder(order); err != nil {
+		m.halt(fmt.Errorf("update order %s: %w", order.ID, err))
+	}
+}
+
+// stampOrder carimba sequência e horário de uma ordem alterada.
+func (m *market) stampOrder(order *Order) {
+	order.Seq = m.nextSeq()
+	order.UpdatedAt = time.Now()
+}
+
+func (m *market) publishBook() {
+	snapshot := m.book.Snapshot(50)
+	snapshot.Seq = m.nextSeq()
+	_ = m.events.PublishOrderBookUpdate(m.symbol, snapshot)
+
+	// Notificar MarketDataEngine do snapshot atualizado
+	if m.marketData != nil {
+		m.marketData.OnOrderBookSnapshot(snapshot)
+	}
+	if m.status == MarketStatusAuction {
+		m.publishIndicative()
+	}
+}
+
+// checkPostOnly rejeita ou reprecifica uma ordem maker-only que executaria
+// imediatamente contra o melhor preço do lado oposto.
+func (m *market) checkPostOnly(order *Order) error {
+	if order.PostOnly == PostOnlyNone {
+		return nil
+	}
+
+	if order.Side == SideBuy {
+		ask, ok := m.book.bestAsk()
+		if !ok || order.Price.LessThan(ask) {
+			return nil
+		}
+		step := m.priceStep()
+		if order.PostOnly == PostOnlyReject || !ask.Sub(step).IsPositive() {
+			return ErrPostOnlyWouldCross
 		}
-		sell.Status = OrderStatusPartFilled
+		order.Price = ask.Sub(step)
+		return nil
 	}
 
-	if sell.RemainingQty() > 0 && sell.Type == OrderTypeLimit {
-		book.addOrder(sell)
-		_ = me.repo.UpdateOrder(sell)
+	bid, ok := m.book.bestBid()
+	if !ok || order.Price.GreaterThan(bid) {
+		return nil
 	}
+	if order.PostOnly == PostOnlyReject {
+		return ErrPostOnlyWouldCross
+	}
+	order.Price = bid.Add(m.priceStep())
+	return nil
+}
+
+// preCheckAndLock trava o saldo da ordem. MARKET percorre o book dentro do
+// preço de proteção: define a quantidade de ordens por valor e, na compra,
+// trava o custo estimado. Condicionais de compra que viram MARKET travam
+// pelo gatilho acrescido da proteção.
+func (m *market) preCheckAndLock(order *Order) error {
+	baseSymbol := order.Symbol
+	quoteSymbol := order.Symbol + "_QUOTE"
 
+	var notional decimal.Decimal
+	var err error
+	switch {
+	case order.Type == OrderTypeMarket:
+		notional, err = m.sizeMarketOrder(order)
+	case order.isConditional() && order.Price.IsZero():
+		notional, err = orderNotional(m.stopProtectionPrice(order), order.Quantity)
+	default:
+		notional, err = orderNotional(order.Price, order.Quantity)
+	}
+	if err != nil {
+		return err
+	}
+
+	if order.Side == SideSell {
+		if !m.balances.CanLockBase(order.UserID, baseSymbol, order.Quantity) {
+			return ErrInsufficientBase
+		}
+		return m.balances.LockBase(order.UserID, baseSymbol, order.Quantity)
+	}
+
+	if !m.balances.CanLockQuote(order.UserID, quoteSymbol, notional) {
+		return ErrInsufficientQuote
+	}
+	if err := m.balances.LockQuote(order.UserID, quoteSymbol, notional); err != nil {
+		return err
+	}
+	order.LockedQuote = notional
 	return nil
 }
 
-func (me *MatchingEngine) TriggerStops(symbol string, lastPrice float64) {
-	var pending []*Order
+// matchOrder executa a ordem agressora contra o melhor nível do lado oposto
+// até esgotar a quantidade, o limite de preço (o de proteção, para MARKET)
+// ou a trava de uma compra MARKET. Em leilão a ordem só repousa no book.
+func (m *market) matchOrder(taker *Order) {
+	if m.status == MarketStatusAuction {
+		m.finishTaker(taker)
+		return
+	}
+
+	opposite := SideSell
+	if taker.Side == SideSell {
+		opposite = SideBuy
+	}
+	limit, _ := m.limitTicks(taker)
 
-	for _, order := range me.stopOrders {
-		if order.Symbol != symbol {
-			pending = append(pending, order)
+	for taker.RemainingQty().IsPositive() && m.fault == nil {
+		maker, price, qty, step := m.takeTop(taker, opposite, limit)
+		if step == matchSelfTrade {
+			if !m.preventSelfTrade(taker, maker) {
+				break
+			}
 			continue
 		}
+		if step == matchStop {
+			break
+		}
+
+		if maker.Status == OrderStatusFilled {
+			m.forgetOrder(maker)
+		}
+		m.recordTrade(taker, maker, price, qty)
+	}
+
+	m.finishTaker(taker)
+}
+
+type matchStep int
+
+const (
+	matchStop matchStep = iota
+	matchFill
+	matchSelfTrade
+)
+
+// takeTop executa, sob o lock do book, a próxima execução da agressora contra
+// a ordem do topo do lado oposto e atualiza quantidades, status e a fila do
+// nível. matchSelfTrade devolve o maker do mesmo usuário sem executar.
+func (m *market) takeTop(taker *Order, opposite Side, limit int64) (maker *Order, price, qty decimal.Decimal, step matchStep) {
+	book := m.book
+	book.mu.Lock()
+	defer book.mu.Unlock()
+
+	level := book.bestLocked(opposite)
+	if level == nil || !crosses(taker.Side, limit, level.ticks) {
+		return nil, price, qty, matchStop
+	}
+	maker = level.head
+	if taker.STP != STPNone && maker.UserID == taker.UserID {
+		return maker, price, qty, matchSelfTrade
+	}
+
+	price = level.Price
+	qty = m.fillQty(taker, decimal.Min(taker.RemainingQty(), maker.displayedQty()), price)
+	if !qty.IsPositive() || !fillFits(taker, maker, price, qty) {
+		return nil, price, qty, matchStop
+	}
+
+	taker.FilledQty = taker.FilledQty.Add(qty)
+	maker.FilledQty = maker.FilledQty.Add(qty)
+
+	if maker.RemainingQty().IsZero() {
+		maker.Status = OrderStatusFilled
+		book.unlinkLocked(maker)
+	} else {
+		maker.Status = OrderStatusPartFilled
+		book.consumeVisibleLocked(maker, qty)
+	}
+	if taker.RemainingQty().IsZero() {
+		taker.Status = OrderStatusFilled
+	} else {
+		taker.Status = OrderStatusPartFilled
+	}
+	return maker, price, qty, matchFill
+}
 
-		trigger := false
-		if order.Side == SideBuy && lastPrice >= order.StopPrice {
-			trigger = true
+// fillFits confere que o notional da execução cabe nos acumulados em quote
+// das duas ordens; uma execução que sairia da faixa encerra o matching da
+// agressora em vez de derrubar o sequenciador.
+func fillFits(taker, maker *Order, price, qty decimal.Decimal) bool {
+	notional, err := price.CheckedMul(qty)
+	if err != nil {
+		return false
+	}
+	for _, o := range []*Order{taker, maker} {
+		if _, err := o.FilledQuote.CheckedAdd(notional); err != nil {
+			return false
 		}
-		if order.Side == SideSell && lastPrice <= order.StopPrice {
-			trigger = true
+	}
+	return true
+}
+
+// recordTrade contabiliza a execução de qty a price entre taker e maker (com
+// quantidades e status já atualizados) e emite o trade. O lado do taker é o
+// lado agressor publicado.
+func (m *market) recordTrade(taker, maker *Order, price, qty decimal.Decimal) {
+	buy, sell := taker, maker
+	if taker.Side == SideSell {
+		buy, sell = maker, taker
+	}
+	notional := price.Mul(qty)
+	taker.FilledQuote = taker.FilledQuote.Add(notional)
+	maker.FilledQuote = maker.FilledQuote.Add(notional)
+	m.consumeQuote(buy, notional)
+
+	trade := &Trade{
+		ID:        uuid.NewString(),
+		Seq:       m.nextSeq(),
+		Symbol:    taker.Symbol,
+		BuyOrder:  buy.ID,
+		SellOrder: sell.ID,
+		BuyerID:   buy.UserID,
+		SellerID:  sell.UserID,
+		TakerSide: taker.Side,
+		Price:     price,
+		Quantity:  qty,
+		CreatedAt: time.Now(),
+	}
+
+	m.notePrint(price)
+	if m.replaying {
+		m.adoptJournaledTrade(trade)
+	} else {
+		m.engine.feedBreaker(m.symbol, trade)
+		m.engine.assessFees(trade)
+		if err := m.journalTrade(trade); err != nil {
+			m.halt(fmt.Errorf("journal trade %s: %w", trade.ID, err))
+			return
 		}
+	}
 
-		if !trigger {
-			pending = append(pending, order)
-			continue
+	for _, o := range []*Order{taker, maker} {
+		if o.GroupID != "" {
+			m.reserveEntryFill(o, price, qty)
 		}
+	}
+	m.stampOrder(taker)
+	m.stampOrder(maker)
+	if err := m.repo.SaveTrade(trade, taker, maker); err != nil {
+		m.halt(fmt.Errorf("save trade %s: %w", trade.ID, err))
+		return
+	}
+	if !m.replaying {
+		m.engine.submitPostTrade(trade)
+	}
+	for _, o := range []*Order{taker, maker} {
+		_ = m.events.PublishOrderUpdate(o.clone())
+		if o.GroupID != "" {
+			m.onGroupLeg(o)
+		}
+	}
+	_ = m.events.PublishTrade(trade)
 
-		order.Type = OrderTypeMarket
-		_ = me.match(order)
+	// Notificar MarketDataEngine
+	if m.marketData != nil {
+		_ = m.marketData.OnTradeEvent(TradeEvent{
+			ID:        trade.ID,
+			Symbol:    trade.Symbol,
+			Price:     trade.Price,
+			Quantity:  trade.Quantity,
+			Side:      taker.Side, // lado do agressor
+			Source:    TradeSourceLit,
+			Timestamp: trade.CreatedAt,
+		})
 	}
+}
 
-	me.stopOrders = pending
+// finishTaker decide o destino do saldo não executado de uma ordem agressora:
+// repousa no book (GTC/GTD) ou expira liberando o saldo travado (IOC/FOK/MARKET).
+func (m *market) finishTaker(order *Order) {
+	if order.Status == OrderStatusCanceled || m.fault != nil {
+		// encerrada por self-trade prevention dentro do loop, ou símbolo
+		// parado por falha de gravação
+		return
+	}
+	if !order.RemainingQty().IsPositive() {
+		m.forgetOrder(order)
+		return
+	}
+
+	if order.restsInBook() {
+		m.book.addOrder(order)
+		m.updateOrHalt(order)
+		return
+	}
+
+	m.expireRemainder(order)
 }
 
-func (me *MatchingEngine) GetOrderBookSnapshot(symbol string, depth int) OrderBookSnapshot {
-	return me.getBook(symbol).Snapshot(depth)
+// preventSelfTrade aplica o modo STP da agressora quando o topo do book é uma
+// ordem do mesmo usuário. Devolve false se a agressora foi encerrada.
+func (m *market) preventSelfTrade(taker, maker *Order) bool {
+	mode := taker.STP
+	switch mode {
+	case STPCancelOldest:
+		m.stpCancel(maker, taker, mode)
+		return true
+	case STPCancelBoth:
+		m.stpCancel(maker, taker, mode)
+		m.stpCancel(taker, maker, mode)
+		return false
+	case STPDecrementAndCancel:
+		qty := decimal.Min(taker.RemainingQty(), maker.RemainingQty())
+		m.stpDecrement(maker, taker, mode, qty)
+		m.stpDecrement(taker, maker, mode, qty)
+		return taker.Status != OrderStatusCanceled
+	default:
+		m.stpCancel(taker, maker, mode)
+		return false
+	}
 }
 
-func min(a, b float64) float64 {
-	if a < b {
-		return a
+// stpCancel cancela o restante da ordem, retirando-a do book se estiver em
+// repouso, e libera o saldo correspondente.
+func (m *market) stpCancel(order, counter *Order, mode STPMode) {
+	qty := order.RemainingQty()
+	m.book.removeOrder(order)
+	_ = m.releaseRemaining(order)
+
+	order.Status = OrderStatusCanceled
+	m.forgetOrder(order)
+	m.updateOrHalt(order)
+	m.publishOrderEvent(OrderEventSTPCanceled, order, counter, mode, qty)
+}
+
+// stpDecrement reduz a quantidade da ordem em qty sem gerar trade; se nada
+// restar, a ordem é cancelada.
+func (m *market) stpDecrement(order, counter *Order, mode STPMode, qty decimal.Decimal) {
+	_ = m.releaseQty(order, qty)
+	m.book.mu.Lock()
+	order.Quantity = order.Quantity.Sub(qty)
+	done := !order.RemainingQty().IsPositive()
+	if done {
+		m.book.unlinkLocked(order)
+	} else {
+		order.replenish()
+	}
+	m.book.mu.Unlock()
+
+	if done {
+		order.Status = OrderStatusCanceled
+		m.forgetOrder(order)
 	}
-	return b
+	m.updateOrHalt(order)
+	m.publishOrderEvent(OrderEventSTPDecremented, order, counter, mode, qty)
+}
+
+func (m *market) publishOrderEvent(kind OrderEventKind, order, counter *Order, mode STPMode, qty decimal.Decimal) {
+	_ = m.events.PublishOrderEvent(&OrderEvent{
+		Seq:            m.nextSeq(),
+		Kind:           kind,
+		Symbol:         order.Symbol,
+		OrderID:        order.ID,
+		UserID:         order.UserID,
+		CounterOrderID: counter.ID,
+		STP:            mode,
+		Quantity:       qty,
+		Status:         order.Status,
+		CreatedAt:      time.Now(),
+	})
+}
+
+func (m *market) expireRemainder(order *Order) {
+	_ = m.releaseRemaining(order)
+	order.Status = OrderStatusExpired
+	m.forgetOrder(order)
+	m.updateOrHalt(order)
 }
@@ -0,0 +1,275 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSelfTradePrevention(t *testing.T) {
+	tests := []struct {
+		mode        STPMode
+		makerStatus OrderStatus
+		takerStatus OrderStatus
+		takerQty    string
+		lockedBase  string
+		lockedQuote string
+	}{
+		{STPCancelNewest, OrderStatusNew, OrderStatusCanceled, "3", "2", "0"},
+		{STPCancelOldest, OrderStatusCanceled, OrderStatusNew, "3", "0", "30"},
+		{STPCancelBoth, OrderStatusCanceled, OrderStatusCanceled, "3", "0", "0"},
+		{STPDecrementAndCancel, OrderStatusCanceled, OrderStatusNew, "1", "0", "10"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			me, repo, balances := newTestEngine(t)
+			fund(balances, "alice", "AAA")
+
+			maker := mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "2"))
+			req := limit("alice", "AAA", SideBuy, "10", "3")
+			req.STP = tt.mode
+			taker := mustPlace(t, me, req)
+
+			if n := repo.tradeCount(); n != 0 {
+				t.Fatalf("trades = %d, want 0", n)
+			}
+			if s := repo.order(maker.ID).Status; s != tt.makerStatus {
+				t.Errorf("maker status = %s, want %s", s, tt.makerStatus)
+			}
+			got := repo.order(taker.ID)
+			if got.Status != tt.takerStatus {
+				t.Errorf("taker status = %s, want %s", got.Status, tt.takerStatus)
+			}
+			if !got.Quantity.Equal(d(tt.takerQty)) {
+				t.Errorf("taker quantity = %s, want %s", got.Quantity, tt.takerQty)
+			}
+			if _, locked := balances.get("alice", "AAA"); !locked.Equal(d(tt.lockedBase)) {
+				t.Errorf("locked base = %s, want %s", locked, tt.lockedBase)
+			}
+			if _, locked := balances.get("alice", "AAA_QUOTE"); !locked.Equal(d(tt.lockedQuote)) {
+				t.Errorf("locked quote = %s, want %s", locked, tt.lockedQuote)
+			}
+		})
+	}
+}
+
+func TestSelfTradeAllowedWithoutSTP(t *testing.T) {
+	me, repo, balances := newTestEngine(t)
+	fund(balances, "alice", "AAA")
+	mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "1"))
+	mustPlace(t, me, limit("alice", "AAA", SideBuy, "10", "1"))
+	if n := repo.tradeCount(); n != 1 {
+		t.Fatalf("trades = %d, want 1", n)
+	}
+}
+
+func TestIcebergReplenishLosesPriority(t *testing.T) {
+	me, repo, balances := newTestEngine(t)
+	for _, u := range []string{"ice", "plain", "taker"} {
+		fund(balances, u, "AAA")
+	}
+	req := limit("ice", "AAA", SideSell, "10", "10")
+	req.DisplayQty = d("2")
+	ice := mustPlace(t, me, req)
+	plain := mustPlace(t, me, limit("plain", "AAA", SideSell, "10", "1"))
+
+	snap := me.GetOrderBookSnapshot("AAA", 5)
+	if len(snap.Asks) != 1 || !snap.Asks[0].Quantity.Equal(d("3")) {
+		t.Fatalf("asks = %+v, want only the visible 2+1 at 10", snap.Asks)
+	}
+
+	// 2 da fatia visível, depois a ordem comum (o iceberg volta ao fim da
+	// fila ao repor), depois mais 1 da nova fatia
+	mustPlace(t, me, limit("taker", "AAA", SideBuy, "10", "4"))
+
+	if got := repo.order(ice.ID); !got.FilledQty.Equal(d("3")) || !got.VisibleQty.Equal(d("1")) {
+		t.Fatalf("iceberg filled %s visible %s, want 3 and 1", got.FilledQty, got.VisibleQty)
+	}
+	if s := repo.order(plain.ID).Status; s != OrderStatusFilled {
+		t.Fatalf("plain order status = %s, want FILLED", s)
+	}
+	snap = me.GetOrderBookSnapshot("AAA", 5)
+	if len(snap.Asks) != 1 || !snap.Asks[0].Quantity.Equal(d("1")) {
+		t.Fatalf("asks = %+v, want visible 1 at 10", snap.Asks)
+	}
+}
+
+func TestIcebergValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		display string
+		tif     TimeInForce
+	}{
+		{"display equal to quantity", "5", ""},
+		{"display above quantity", "6", ""},
+		{"immediate order", "1", TimeInForceIOC},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			me, _, balances := newTestEngine(t)
+			fund(balances, "alice", "AAA")
+			req := limit("alice", "AAA", SideSell, "10", "5")
+			req.DisplayQty = d(tt.display)
+			req.TimeInForce = tt.tif
+			if _, err := me.PlaceOrder(req); err == nil {
+				t.Fatal("PlaceOrder accepted an invalid iceberg")
+			}
+		})
+	}
+}
+
+func TestAmendRejectedKeepsQueuePriority(t *testing.T) {
+	me, repo, balances := newTestEngine(t)
+	balances.deposit("alice", "AAA_QUOTE", d("100"))
+	fund(balances, "bob", "AAA")
+	fund(balances, "seller", "AAA")
+
+	first := mustPlace(t, me, limit("alice", "AAA", SideBuy, "10", "5"))
+	second := mustPlace(t, me, limit("bob", "AAA", SideBuy, "10", "5"))
+
+	_, err := me.AmendOrder(AmendOrderRequest{OrderID: first.ID, UserID: "alice", NewQuantity: d("20")})
+	if !errors.Is(err, ErrInsufficientQuote) {
+		t.Fatalf("AmendOrder error = %v, want ErrInsufficientQuote", err)
+	}
+	if avail, locked := balances.get("alice", "AAA_QUOTE"); !avail.Equal(d("50")) || !locked.Equal(d("50")) {
+		t.Fatalf("alice quote = %s/%s after the rejected amend, want 50/50", avail, locked)
+	}
+
+	mustPlace(t, me, limit("seller", "AAA", SideSell, "10", "5"))
+	if s := repo.order(first.ID).Status; s != OrderStatusFilled {
+		t.Errorf("first bid status = %s, want FILLED (priority kept)", s)
+	}
+	if s := repo.order(second.ID).Status; s != OrderStatusNew {
+		t.Errorf("second bid status = %s, want NEW", s)
+	}
+}
+
+func TestSaveTradeFailureHaltsSymbol(t *testing.T) {
+	me, repo, balances := newTestEngine(t)
+	for _, u := range []string{"alice", "bob"} {
+		fund(balances, u, "AAA")
+		fund(balances, u, "BBB")
+	}
+	mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "5"))
+
+	repo.saveTradeErr = errors.New("disk full")
+	if _, err := me.PlaceOrder(limit("bob", "AAA", SideBuy, "10", "2")); !errors.Is(err, ErrMarketFaulted) {
+		t.Fatalf("crossing order error = %v, want ErrMarketFaulted", err)
+	}
+	repo.saveTradeErr = nil
+
+	if _, err := me.PlaceOrder(limit("bob", "AAA", SideBuy, "9", "1")); !errors.Is(err, ErrMarketFaulted) {
+		t.Errorf("order after the failure error = %v, want ErrMarketFaulted", err)
+	}
+	if n := repo.tradeCount(); n != 0 {
+		t.Errorf("trades = %d, want none", n)
+	}
+	// os outros símbolos seguem operando
+	mustPlace(t, me, limit("alice", "BBB", SideSell, "10", "1"))
+}
+
+func TestTimeInForce(t *testing.T) {
+	tests := []struct {
+		name       string
+		tif        TimeInForce
+		qty        string
+		wantErr    error
+		wantStatus OrderStatus
+		wantFilled string
+	}{
+		{"IOC expires the remainder", TimeInForceIOC, "5", nil, OrderStatusExpired, "3"},
+		{"FOK rejects when not fillable", TimeInForceFOK, "5", ErrFOKNotFillable, "", "0"},
+		{"FOK fills completely", TimeInForceFOK, "3", nil, OrderStatusFilled, "3"},
+		{"GTC rests the remainder", TimeInForceGTC, "5", nil, OrderStatusPartFilled, "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			me, repo, balances := newTestEngine(t)
+			fund(balances, "alice", "AAA")
+			fund(balances, "bob", "AAA")
+			mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "3"))
+
+			req := limit("bob", "AAA", SideBuy, "10", tt.qty)
+			req.TimeInForce = tt.tif
+			order, err := me.PlaceOrder(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PlaceOrder error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if n := repo.tradeCount(); n != 0 {
+					t.Fatalf("trades = %d, want none", n)
+				}
+				return
+			}
+			got := repo.order(order.ID)
+			if got.Status != tt.wantStatus || !got.FilledQty.Equal(d(tt.wantFilled)) {
+				t.Fatalf("order = %s filled %s, want %s filled %s", got.Status, got.FilledQty, tt.wantStatus, tt.wantFilled)
+			}
+			if tt.tif == TimeInForceIOC {
+				// só o notional executado segue travado, até a liquidação
+				if _, locked := balances.get("bob", "AAA_QUOTE"); !locked.Equal(d("30")) {
+					t.Errorf("bob quote locked %s after IOC, want 30", locked)
+				}
+			}
+		})
+	}
+}
+
+func TestGTDOrdersExpire(t *testing.T) {
+	me, repo, balances := newTestEngine(t)
+	fund(balances, "alice", "AAA")
+
+	req := limit("alice", "AAA", SideSell, "10", "2")
+	req.TimeInForce = TimeInForceGTD
+	if _, err := me.PlaceOrder(req); !errors.Is(err, ErrInvalidExpireAt) {
+		t.Fatalf("GTD without expire time error = %v, want ErrInvalidExpireAt", err)
+	}
+
+	expireAt := time.Now().Add(time.Minute)
+	req.ExpireAt = &expireAt
+	order := mustPlace(t, me, req)
+	if n := me.ExpireOrders(expireAt.Add(-time.Second)); n != 0 {
+		t.Fatalf("expired %d orders before the deadline", n)
+	}
+	if n := me.ExpireOrders(expireAt); n != 1 {
+		t.Fatalf("expired %d orders at the deadline, want 1", n)
+	}
+	if s := repo.order(order.ID).Status; s != OrderStatusExpired {
+		t.Errorf("status = %s, want EXPIRED", s)
+	}
+	if _, locked := balances.get("alice", "AAA"); !locked.IsZero() {
+		t.Errorf("alice base still locked %s after expiry", locked)
+	}
+}
+
+func TestPostOnly(t *testing.T) {
+	tests := []struct {
+		mode      PostOnlyMode
+		wantErr   error
+		wantPrice string
+	}{
+		{PostOnlyReject, ErrPostOnlyWouldCross, ""},
+		{PostOnlyReprice, nil, "9.9999"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			me, repo, balances := newTestEngine(t)
+			fund(balances, "alice", "AAA")
+			fund(balances, "bob", "AAA")
+			mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "1"))
+
+			req := limit("bob", "AAA", SideBuy, "10.5", "1")
+			req.PostOnly = tt.mode
+			order, err := me.PlaceOrder(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("PlaceOrder error = %v, want %v", err, tt.wantErr)
+			}
+			if n := repo.tradeCount(); n != 0 {
+				t.Fatalf("post-only order traded %d times", n)
+			}
+			if tt.wantErr == nil && !order.Price.Equal(d(tt.wantPrice)) {
+				t.Errorf("repriced to %s, want %s", order.Price, tt.wantPrice)
+			}
+		})
+	}
+}
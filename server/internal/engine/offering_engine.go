@@ -0,0 +1,482 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"hearcap/server/internal/decimal"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrOfferingNotFound   = errors.New("offering not found")
+	ErrBidNotFound        = errors.New("offering bid not found")
+	ErrInvalidOffering    = errors.New("invalid offering")
+	ErrOfferingNotOpen    = errors.New("offering is not open for subscriptions")
+	ErrOfferingNotEnded   = errors.New("offering subscription window has not ended")
+	ErrInvalidOfferingBid = errors.New("invalid offering bid")
+	ErrBidNotOwned        = errors.New("bid does not belong to user")
+)
+
+// OfferingEngine conduz a oferta primária de uma listagem aprovada: janela de
+// subscrição, lances com quote travado na wallet, alocação no fechamento,
+// devolução do não alocado, emissão do ativo base aos subscritores e, com a
+// captação mínima atingida, a ativação do mercado (ActivateListing).
+type OfferingEngine struct {
+	repo     OfferingRepository
+	listings *ListingEngine
+	wallet   *WalletEngine
+
+	// mu serializa lances e fechamentos para que nenhum lance entre durante
+	// a alocação.
+	mu sync.Mutex
+}
+
+func NewOfferingEngine(repo OfferingRepository, listings *ListingEngine, wallet *WalletEngine) *OfferingEngine {
+	return &OfferingEngine{
+		repo:     repo,
+		listings: listings,
+		wallet:   wallet,
+	}
+}
+
+type OpenOfferingRequest struct {
+	ListingID  string
+	QuoteAsset string
+	Method     AllocationMethod
+	// MinPrice/MaxPrice delimitam os lances do book-building (PRICE_PRIORITY);
+	// PRO_RATA usa o InitialPrice da listagem.
+	MinPrice       decimal.Decimal
+	MaxPrice       decimal.Decimal
+	AllocationStep decimal.Decimal
+	StartsAt       time.Time
+	EndsAt         time.Time
+}
+
+// OpenOffering abre a subscrição de uma listagem APPROVED, que passa a
+// OFFERING até o fechamento.
+func (oe *OfferingEngine) OpenOffering(req OpenOfferingRequest) (*Offering, error) {
+	app, err := oe.listings.listings.FindListingByID(req.ListingID)
+	if err != nil {
+		return nil, err
+	}
+	if app.Status != ListingStatusApproved {
+		return nil, errors.New("listing not approved")
+	}
+	if req.QuoteAsset == "" || !req.EndsAt.After(req.StartsAt) || req.AllocationStep.IsNegative() ||
+		!app.TotalSupply.IsPositive() || app.FreeFloatPercent <= 0 || app.FreeFloatPercent > 100 {
+		return nil, ErrInvalidOffering
+	}
+
+	now := time.Now()
+	o := &Offering{
+		ID:             uuid.NewString(),
+		ListingID:      app.ID,
+		Symbol:         app.Symbol,
+		IssuerID:       app.ArtistID,
+		QuoteAsset:     req.QuoteAsset,
+		Method:         req.Method,
+		Status:         OfferingStatusOpen,
+		OfferedQty:     app.TotalSupply.MulFloat(app.FreeFloatPercent / 100).Floor(req.AllocationStep),
+		AllocationStep: req.AllocationStep,
+		MinRaise:       app.MinRaiseUSD,
+		MaxRaise:       app.MaxRaiseUSD,
+		StartsAt:       req.StartsAt,
+		EndsAt:         req.EndsAt,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	switch req.Method {
+	case AllocationProRata:
+		if !app.InitialPrice.IsPositive() {
+			return nil, ErrInvalidOffering
+		}
+		o.Price = app.InitialPrice
+		o.MinPrice, o.MaxPrice = app.InitialPrice, app.InitialPrice
+	case AllocationPricePriority:
+		if !req.MinPrice.IsPositive() || req.MaxPrice.LessThan(req.MinPrice) {
+			return nil, ErrInvalidOffering
+		}
+		o.MinPrice, o.MaxPrice = req.MinPrice, req.MaxPrice
+	default:
+		return nil, ErrInvalidOffering
+	}
+	if !o.OfferedQty.IsPositive() {
+		return nil, ErrInvalidOffering
+	}
+
+	if err := oe.repo.SaveOffering(o); err != nil {
+		return nil, err
+	}
+	app.Status = ListingStatusOffering
+	app.UpdatedAt = now
+	if err := oe.listings.listings.UpdateListing(app); err != nil {
+		return nil, err
+	}
+	_ = oe.listings.notify.NotifyListingStatusChanged(app)
+	return o, nil
+}
+
+type SubmitOfferingBidRequest struct {
+	OfferingID string
+	UserID     string
+	// Price é ignorado em PRO_RATA (preço fixo da oferta).
+	Price    decimal.Decimal
+	Quantity decimal.Decimal
+}
+
+// SubmitBid registra um lance dentro da janela e trava Price*Quantity do
+// ativo de quote na wallet do investidor.
+func (oe *OfferingEngine) SubmitBid(req SubmitOfferingBidRequest) (*OfferingBid, error) {
+	oe.mu.Lock()
+	defer oe.mu.Unlock()
+
+	o, err := oe.repo.FindOfferingByID(req.OfferingID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if o.Status != OfferingStatusOpen || now.Before(o.StartsAt) || !now.Before(o.EndsAt) {
+		return nil, ErrOfferingNotOpen
+	}
+
+	price := req.Price
+	if o.Method == AllocationProRata {
+		price = o.Price
+	}
+	if !req.Quantity.IsPositive() || !req.Quantity.IsMultipleOf(o.AllocationStep) || req.Quantity.GreaterThan(o.OfferedQty) ||
+		price.LessThan(o.MinPrice) || price.GreaterThan(o.MaxPrice) {
+		return nil, ErrInvalidOfferingBid
+	}
+
+	amount := price.Mul(req.Quantity)
+	if err := oe.wallet.lock(req.UserID, o.QuoteAsset, amount); err != nil {
+		return nil, err
+	}
+	bid := &OfferingBid{
+		ID:           uuid.NewString(),
+		OfferingID:   o.ID,
+		UserID:       req.UserID,
+		Status:       OfferingBidPending,
+		Price:        price,
+		Quantity:     req.Quantity,
+		LockedAmount: amount,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := oe.repo.SaveBid(bid); err != nil {
+		_ = oe.wallet.unlock(req.UserID, o.QuoteAsset, amount)
+		return nil, err
+	}
+	return bid, nil
+}
+
+// CancelBid retira um lance enquanto a subscrição está aberta, destravando o
+// valor.
+func (oe *OfferingEngine) CancelBid(bidID, userID string) (*OfferingBid, error) {
+	oe.mu.Lock()
+	defer oe.mu.Unlock()
+
+	bid, err := oe.repo.FindBidByID(bidID)
+	if err != nil {
+		return nil, err
+	}
+	if bid.UserID != userID {
+		return nil, ErrBidNotOwned
+	}
+	o, err := oe.repo.FindOfferingByID(bid.OfferingID)
+	if err != nil {
+		return nil, err
+	}
+	if o.Status != OfferingStatusOpen || bid.Status != OfferingBidPending {
+		return nil, ErrOfferingNotOpen
+	}
+
+	if err := oe.wallet.unlock(bid.UserID, o.QuoteAsset, bid.LockedAmount); err != nil {
+		return nil, err
+	}
+	bid.Status = OfferingBidCanceled
+	bid.UpdatedAt = time.Now()
+	if err := oe.repo.UpdateBid(bid); err != nil {
+		return nil, err
+	}
+	return bid, nil
+}
+
+// CloseOffering encerra a subscrição cuja janela terminou até now.
+func (oe *OfferingEngine) CloseOffering(offeringID string, now time.Time) (*Offering, error) {
+	oe.mu.Lock()
+	defer oe.mu.Unlock()
+
+	o, err := oe.repo.FindOfferingByID(offeringID)
+	if err != nil {
+		return nil, err
+	}
+	if o.Status == OfferingStatusOpen && now.Before(o.EndsAt) {
+		return nil, ErrOfferingNotEnded
+	}
+	if err := oe.close(o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// ProcessClosings fecha as ofertas vencidas e retoma fechamentos
+// interrompidos (para o cron).
+func (oe *OfferingEngine) ProcessClosings(now time.Time) error {
+	oe.mu.Lock()
+	defer oe.mu.Unlock()
+
+	offerings, err := oe.repo.ListOfferingsToClose(now)
+	if err != nil {
+		return err
+	}
+	for _, o := range offerings {
+		if err := oe.close(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartClosingSweeper roda ProcessClosings a cada interval: fecha as ofertas
+// vencidas e retoma as que pararam em ALLOCATING.
+func (oe *OfferingEngine) StartClosingSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				if err := oe.ProcessClosings(now); err != nil {
+					log.Printf("[Offering] closing sweep failed: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// close aloca (uma única vez), liquida cada lance ainda não liquidado e
+// encerra a oferta. Cada etapa é persistida antes da seguinte e cada perna na
+// wallet tem chave própria (offeringKey), então um fechamento interrompido é
+// retomado de onde parou sem mover o mesmo valor duas vezes.
+func (oe *OfferingEngine) close(o *Offering) error {
+	bids, err := oe.repo.ListBids(o.ID)
+	if err != nil {
+		return err
+	}
+
+	if o.Status == OfferingStatusOpen {
+		var active []*OfferingBid
+		for _, b := range bids {
+			if b.Status == OfferingBidPending || b.Status == OfferingBidAllocated {
+				active = append(active, b)
+			}
+		}
+		allocateOffering(o, active)
+		for _, b := range active {
+			b.Status = OfferingBidAllocated
+			b.UpdatedAt = time.Now()
+			if err := oe.repo.UpdateBid(b); err != nil {
+				return err
+			}
+		}
+		o.Status = OfferingStatusAllocating
+		o.UpdatedAt = time.Now()
+		if err := oe.repo.UpdateOffering(o); err != nil {
+			return err
+		}
+	}
+
+	if o.Status == OfferingStatusAllocating {
+		for _, b := range bids {
+			if b.Status != OfferingBidAllocated {
+				continue
+			}
+			if err := oe.settleBid(o, b); err != nil {
+				return err
+			}
+		}
+
+		o.Status = OfferingStatusFailed
+		if o.AllocatedQty.IsPositive() {
+			if err := oe.post(o, o.IssuerID, o.QuoteAsset, offeringKey(o, "issuer"), o.RaisedAmount, decimal.Zero); err != nil {
+				return err
+			}
+			o.Status = OfferingStatusCompleted
+		}
+		o.UpdatedAt = time.Now()
+		if err := oe.repo.UpdateOffering(o); err != nil {
+			return err
+		}
+	}
+
+	return oe.handOff(o)
+}
+
+// settleBid debita o custo da alocação, emite o ativo base ao subscritor e
+// devolve o restante da trava.
+func (oe *OfferingEngine) settleBid(o *Offering, b *OfferingBid) error {
+	if b.AllocatedQty.IsPositive() {
+		if err := oe.post(o, b.UserID, o.QuoteAsset, bidKey(o, b, "debit"), decimal.Zero, b.Cost.Neg()); err != nil {
+			return err
+		}
+		if err := oe.post(o, b.UserID, o.Symbol, bidKey(o, b, "mint"), b.AllocatedQty, decimal.Zero); err != nil {
+			return err
+		}
+	}
+	if refund := b.LockedAmount.Sub(b.Cost); refund.IsPositive() {
+		if err := oe.post(o, b.UserID, o.QuoteAsset, bidKey(o, b, "refund"), refund, refund.Neg()); err != nil {
+			return err
+		}
+	}
+
+	b.Status = OfferingBidRefunded
+	if b.AllocatedQty.IsPositive() {
+		b.Status = OfferingBidSettled
+	}
+	b.UpdatedAt = time.Now()
+	return oe.repo.UpdateBid(b)
+}
+
+// post lança uma perna do fechamento com a chave key: deltas de disponível e
+// travado de userID em asset. Repetida após uma queda, a perna já lançada não
+// muda nada.
+func (oe *OfferingEngine) post(o *Offering, userID, asset, key string, avail, locked decimal.Decimal) error {
+	_, err := oe.wallet.postKeyed(userID, asset, key, LedgerEntryOffering, o.ID,
+		func(*Balance) (decimal.Decimal, decimal.Decimal) { return avail, locked })
+	return err
+}
+
+func offeringKey(o *Offering, leg string) string {
+	return "offering:" + o.ID + ":" + leg
+}
+
+func bidKey(o *Offering, b *OfferingBid, leg string) string {
+	return offeringKey(o, "bid:"+b.ID+":"+leg)
+}
+
+// handOff ativa o mercado de uma oferta concluída; uma oferta que falhou
+// devolve a listagem a APPROVED para uma nova tentativa.
+func (oe *OfferingEngine) handOff(o *Offering) error {
+	app, err := oe.listings.listings.FindListingByID(o.ListingID)
+	if err != nil {
+		return err
+	}
+	if app.Status != ListingStatusOffering {
+		return nil
+	}
+
+	if o.Status == OfferingStatusCompleted {
+		_, err := oe.listings.ActivateListing(o.ListingID)
+		return err
+	}
+	app.Status = ListingStatusApproved
+	app.UpdatedAt = time.Now()
+	if err := oe.listings.listings.UpdateListing(app); err != nil {
+		return err
+	}
+	_ = oe.listings.notify.NotifyListingStatusChanged(app)
+	return nil
+}
+
+// supplyAt é a quantidade vendável a price: o free float, limitado pela
+// captação máxima.
+func (o *Offering) supplyAt(price decimal.Decimal) decimal.Decimal {
+	supply := o.OfferedQty
+	if o.MaxRaise.IsPositive() {
+		supply = decimal.Min(supply, o.MaxRaise.DivTrunc(price))
+	}
+	return supply.Floor(o.AllocationStep)
+}
+
+// allocateOffering define o preço de corte, a alocação e o custo de cada
+// lance e os totais da oferta. Abaixo da captação mínima nada é alocado.
+func allocateOffering(o *Offering, bids []*OfferingBid) {
+	sorted := append([]*OfferingBid(nil), bids...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Price != sorted[j].Price {
+			return sorted[i].Price.GreaterThan(sorted[j].Price)
+		}
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+	for _, b := range sorted {
+		b.AllocatedQty, b.Cost = decimal.Zero, decimal.Zero
+	}
+	o.AllocatedQty, o.RaisedAmount = decimal.Zero, decimal.Zero
+	if len(sorted) == 0 {
+		return
+	}
+
+	// preço de corte: o maior preço em que a demanda acumulada cobre a oferta
+	// (ou o menor lance, se a oferta não for toda subscrita)
+	price := sorted[len(sorted)-1].Price
+	var above decimal.Decimal
+	for i := 0; i < len(sorted); {
+		level := sorted[i].Price
+		j, qty := i, decimal.Zero
+		for ; j < len(sorted) && sorted[j].Price == level; j++ {
+			qty = qty.Add(sorted[j].Quantity)
+		}
+		if supply := o.supplyAt(level); above.Add(qty).GreaterThanOrEqual(supply) {
+			price = level
+			prorate(sorted[i:j], supply.Sub(above), o.AllocationStep)
+			break
+		}
+		for _, b := range sorted[i:j] {
+			b.AllocatedQty = b.Quantity
+		}
+		above = above.Add(qty)
+		i = j
+	}
+
+	o.Price = price
+	for _, b := range sorted {
+		b.Cost = b.AllocatedQty.Mul(price)
+		o.AllocatedQty = o.AllocatedQty.Add(b.AllocatedQty)
+		o.RaisedAmount = o.RaisedAmount.Add(b.Cost)
+	}
+
+	if o.RaisedAmount.LessThan(o.MinRaise) {
+		for _, b := range sorted {
+			b.AllocatedQty, b.Cost = decimal.Zero, decimal.Zero
+		}
+		o.AllocatedQty, o.RaisedAmount = decimal.Zero, decimal.Zero
+	}
+}
+
+// prorate divide supply entre os lances de um mesmo preço na proporção das
+// quantidades pedidas; a sobra do arredondamento vai aos lances mais antigos.
+func prorate(bids []*OfferingBid, supply, step decimal.Decimal) {
+	var demand decimal.Decimal
+	for _, b := range bids {
+		demand = demand.Add(b.Quantity)
+	}
+	if demand.LessThanOrEqual(supply) {
+		for _, b := range bids {
+			b.AllocatedQty = b.Quantity
+		}
+		return
+	}
+
+	left := supply
+	for _, b := range bids {
+		b.AllocatedQty = b.Quantity.MulDivTrunc(supply, demand).Floor(step)
+		left = left.Sub(b.AllocatedQty)
+	}
+	for _, b := range bids {
+		if !left.IsPositive() {
+			break
+		}
+		extra := decimal.Min(left, b.Quantity.Sub(b.AllocatedQty)).Floor(step)
+		b.AllocatedQty = b.AllocatedQty.Add(extra)
+		left = left.Sub(extra)
+	}
+}
@@ -0,0 +1,285 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memOfferings implementa OfferingRepository e ListingRepository guardando
+// cópias, como um banco.
+type memOfferings struct {
+	mu        sync.Mutex
+	offerings map[string]Offering
+	bids      []*OfferingBid
+	listings  map[string]ListingApplication
+}
+
+func newMemOfferings() *memOfferings {
+	return &memOfferings{
+		offerings: make(map[string]Offering),
+		listings:  make(map[string]ListingApplication),
+	}
+}
+
+func (r *memOfferings) SaveOffering(o *Offering) error { return r.UpdateOffering(o) }
+
+func (r *memOfferings) UpdateOffering(o *Offering) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.offerings[o.ID] = *o
+	return nil
+}
+
+func (r *memOfferings) FindOfferingByID(id string) (*Offering, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.offerings[id]
+	if !ok {
+		return nil, ErrOfferingNotFound
+	}
+	return &o, nil
+}
+
+func (r *memOfferings) ListOfferingsToClose(before time.Time) ([]*Offering, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*Offering
+	for _, o := range r.offerings {
+		if (o.Status == OfferingStatusOpen && !o.EndsAt.After(before)) || o.Status == OfferingStatusAllocating {
+			o := o
+			out = append(out, &o)
+		}
+	}
+	return out, nil
+}
+
+func (r *memOfferings) SaveBid(b *OfferingBid) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := *b
+	r.bids = append(r.bids, &c)
+	return nil
+}
+
+func (r *memOfferings) UpdateBid(b *OfferingBid) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, cur := range r.bids {
+		if cur.ID == b.ID {
+			c := *b
+			r.bids[i] = &c
+		}
+	}
+	return nil
+}
+
+func (r *memOfferings) FindBidByID(id string) (*OfferingBid, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, b := range r.bids {
+		if b.ID == id {
+			c := *b
+			return &c, nil
+		}
+	}
+	return nil, ErrBidNotFound
+}
+
+func (r *memOfferings) ListBids(offeringID string) ([]*OfferingBid, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*OfferingBid
+	for _, b := range r.bids {
+		if b.OfferingID == offeringID {
+			c := *b
+			out = append(out, &c)
+		}
+	}
+	return out, nil
+}
+
+func (r *memOfferings) SaveListing(app *ListingApplication) error { return r.UpdateListing(app) }
+
+func (r *memOfferings) UpdateListing(app *ListingApplication) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listings[app.ID] = *app
+	return nil
+}
+
+func (r *memOfferings) FindListingByID(id string) (*ListingApplication, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	app, ok := r.listings[id]
+	if !ok {
+		return nil, ErrListingNotFound
+	}
+	return &app, nil
+}
+
+func (r *memOfferings) FindListingBySymbol(string) (*ListingApplication, error) {
+	return nil, ErrListingNotFound
+}
+
+func (r *memOfferings) ListActiveListings() ([]*ListingApplication, error) { return nil, nil }
+
+func TestAllocateOffering(t *testing.T) {
+	type bid struct{ price, qty, want string }
+	tests := []struct {
+		name     string
+		offering Offering
+		bids     []bid
+		price    string
+		raised   string
+	}{
+		{
+			name:     "pro-rata oversubscribed",
+			offering: Offering{OfferedQty: d("100"), AllocationStep: d("1")},
+			bids:     []bid{{"10", "60", "40"}, {"10", "90", "60"}},
+			price:    "10", raised: "1000",
+		},
+		{
+			// 10/3 por lance e a sobra de 1 vai ao mais antigo
+			name:     "rounding leftover to the oldest",
+			offering: Offering{OfferedQty: d("10"), AllocationStep: d("1")},
+			bids:     []bid{{"10", "10", "4"}, {"10", "10", "3"}, {"10", "10", "3"}},
+			price:    "10", raised: "100",
+		},
+		{
+			// 60 a 12 cabem inteiros; o corte é 11, rateado com o que sobra
+			name:     "price priority",
+			offering: Offering{OfferedQty: d("100"), AllocationStep: d("1")},
+			bids:     []bid{{"12", "60", "60"}, {"11", "60", "40"}, {"10", "50", "0"}},
+			price:    "11", raised: "1100",
+		},
+		{
+			name:     "undersubscribed",
+			offering: Offering{OfferedQty: d("100"), AllocationStep: d("1")},
+			bids:     []bid{{"10", "30", "30"}},
+			price:    "10", raised: "300",
+		},
+		{
+			name:     "capped by max raise",
+			offering: Offering{OfferedQty: d("100"), AllocationStep: d("1"), MaxRaise: d("500")},
+			bids:     []bid{{"10", "80", "50"}},
+			price:    "10", raised: "500",
+		},
+		{
+			name:     "below min raise",
+			offering: Offering{OfferedQty: d("100"), AllocationStep: d("1"), MinRaise: d("500")},
+			bids:     []bid{{"10", "30", "0"}},
+			price:    "10", raised: "0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := tt.offering
+			start := time.Now()
+			var bids []*OfferingBid
+			for i, b := range tt.bids {
+				bids = append(bids, &OfferingBid{
+					Price:     d(b.price),
+					Quantity:  d(b.qty),
+					CreatedAt: start.Add(time.Duration(i) * time.Second),
+				})
+			}
+			allocateOffering(&o, bids)
+
+			for i, b := range tt.bids {
+				if !bids[i].AllocatedQty.Equal(d(b.want)) {
+					t.Errorf("bid %d allocated %s, want %s", i, bids[i].AllocatedQty, b.want)
+				}
+				if want := d(b.want).Mul(d(tt.price)); tt.raised != "0" && !bids[i].Cost.Equal(want) {
+					t.Errorf("bid %d cost %s, want %s", i, bids[i].Cost, want)
+				}
+			}
+			if !o.Price.Equal(d(tt.price)) || !o.RaisedAmount.Equal(d(tt.raised)) {
+				t.Errorf("offering price %s raised %s, want %s and %s", o.Price, o.RaisedAmount, tt.price, tt.raised)
+			}
+		})
+	}
+}
+
+func TestCloseOfferingResumesAfterCrash(t *testing.T) {
+	wallet, mw := newTestWallet()
+	repo := newMemOfferings()
+	reg := NewInstrumentRegistry(Instrument{QuoteAsset: "BRL"}, nil)
+	listings := NewListingEngine(repo, nil, NoOpGovernanceNotifier{}, nil, nil, reg, ListingEngineConfig{})
+	oe := NewOfferingEngine(repo, listings, wallet)
+
+	_ = repo.SaveListing(&ListingApplication{
+		ID:               "listing",
+		ArtistID:         "issuer",
+		Symbol:           "ART",
+		Status:           ListingStatusApproved,
+		InitialPrice:     d("10"),
+		TotalSupply:      d("1000"),
+		FreeFloatPercent: 10,
+	})
+	now := time.Now()
+	o, err := oe.OpenOffering(OpenOfferingRequest{
+		ListingID:      "listing",
+		QuoteAsset:     "BRL",
+		Method:         AllocationProRata,
+		AllocationStep: d("1"),
+		StartsAt:       now.Add(-time.Minute),
+		EndsAt:         now.Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mw.set("alice", "BRL", d("1000"), d("0"))
+	mw.set("bob", "BRL", d("1000"), d("0"))
+	for _, b := range []struct{ user, qty string }{{"alice", "60"}, {"bob", "90"}} {
+		if _, err := oe.SubmitBid(SubmitOfferingBidRequest{OfferingID: o.ID, UserID: b.user, Quantity: d(b.qty)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a queda acontece entre o débito e a emissão do lance de bob
+	errCrash := errors.New("crash")
+	mw.failPost = func(entry *LedgerEntry) error {
+		if strings.HasSuffix(entry.Key, ":mint") && strings.HasPrefix(entry.AccountID, "bob|") {
+			return errCrash
+		}
+		return nil
+	}
+	end := now.Add(2 * time.Minute)
+	if _, err := oe.CloseOffering(o.ID, end); !errors.Is(err, errCrash) {
+		t.Fatalf("CloseOffering err = %v, want the crash", err)
+	}
+	if cur, _ := repo.FindOfferingByID(o.ID); cur.Status != OfferingStatusAllocating {
+		t.Fatalf("offering after the crash = %s, want ALLOCATING", cur.Status)
+	}
+
+	mw.failPost = nil
+	if err := oe.ProcessClosings(end); err != nil {
+		t.Fatal(err)
+	}
+
+	// 100 ofertados a 10: alice 40 e bob 60, cada um pagando só uma vez
+	for _, tc := range []struct{ user, quote, base string }{{"alice", "600", "40"}, {"bob", "400", "60"}} {
+		if avail, locked := mw.get(tc.user, "BRL"); !avail.Equal(d(tc.quote)) || !locked.IsZero() {
+			t.Errorf("%s quote = %s/%s, want %s/0", tc.user, avail, locked, tc.quote)
+		}
+		if avail, _ := mw.get(tc.user, "ART"); !avail.Equal(d(tc.base)) {
+			t.Errorf("%s base = %s, want %s", tc.user, avail, tc.base)
+		}
+	}
+	if avail, _ := mw.get("issuer", "BRL"); !avail.Equal(d("1000")) {
+		t.Errorf("issuer raised %s, want 1000", avail)
+	}
+	if cur, _ := repo.FindOfferingByID(o.ID); cur.Status != OfferingStatusCompleted {
+		t.Errorf("offering = %s, want COMPLETED", cur.Status)
+	}
+	if app, _ := repo.FindListingByID("listing"); app.Status != ListingStatusActive {
+		t.Errorf("listing = %s, want ACTIVE", app.Status)
+	}
+	if _, ok := reg.Get("ART"); !ok {
+		t.Error("market ART not created")
+	}
+}
@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
+
+type OfferingStatus string
+
+const (
+	OfferingStatusOpen OfferingStatus = "OPEN"
+	// OfferingStatusAllocating: alocação calculada, liquidação dos lances em
+	// andamento (retomada por ProcessClosings após uma falha).
+	OfferingStatusAllocating OfferingStatus = "ALLOCATING"
+	OfferingStatusCompleted  OfferingStatus = "COMPLETED"
+	// OfferingStatusFailed: captação abaixo de MinRaise, lances devolvidos.
+	OfferingStatusFailed OfferingStatus = "FAILED"
+)
+
+type AllocationMethod string
+
+const (
+	// AllocationProRata vende a preço fixo (InitialPrice) e rateia a
+	// demanda excedente proporcionalmente.
+	AllocationProRata AllocationMethod = "PRO_RATA"
+	// AllocationPricePriority é o book-building: os lances dentro da faixa
+	// são atendidos do maior preço para o menor e todos pagam o preço de
+	// corte; o nível marginal é rateado.
+	AllocationPricePriority AllocationMethod = "PRICE_PRIORITY"
+)
+
+// Offering é a oferta primária de uma listagem aprovada.
+type Offering struct {
+	ID         string
+	ListingID  string
+	Symbol     string
+	IssuerID   string
+	QuoteAsset string
+	Method     AllocationMethod
+	Status     OfferingStatus
+
+	// OfferedQty é o free float (TotalSupply * FreeFloatPercent).
+	OfferedQty decimal.Decimal
+	// AllocationStep é o incremento das quantidades alocadas (zero = escala
+	// interna completa).
+	AllocationStep decimal.Decimal
+	// Price é o preço fixo (PRO_RATA) ou, após o fechamento, o preço de corte.
+	Price    decimal.Decimal
+	MinPrice decimal.Decimal
+	MaxPrice decimal.Decimal
+	MinRaise decimal.Decimal
+	MaxRaise decimal.Decimal
+
+	StartsAt time.Time
+	EndsAt   time.Time
+
+	AllocatedQty decimal.Decimal
+	RaisedAmount decimal.Decimal
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type OfferingBidStatus string
+
+const (
+	OfferingBidPending   OfferingBidStatus = "PENDING"
+	OfferingBidCanceled  OfferingBidStatus = "CANCELED"
+	OfferingBidAllocated OfferingBidStatus = "ALLOCATED"
+	OfferingBidSettled   OfferingBidStatus = "SETTLED"
+	OfferingBidRefunded  OfferingBidStatus = "REFUNDED"
+)
+
+// OfferingBid é um lance de subscrição com o valor em quote travado na wallet.
+type OfferingBid struct {
+	ID         string
+	OfferingID string
+	UserID     string
+	Status     OfferingBidStatus
+
+	Price        decimal.Decimal
+	Quantity     decimal.Decimal
+	LockedAmount decimal.Decimal
+
+	AllocatedQty decimal.Decimal
+	// Cost é o valor debitado (AllocatedQty * preço de corte); o restante da
+	// trava é devolvido.
+	Cost decimal.Decimal
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -1,13 +1,70 @@
 package engine
 
 import (
-	"sort"
 	"sync"
+
+	"hearcap/server/internal/decimal"
 )
 
+// priceToTicks devolve a chave inteira do nível de preço (as unidades do
+// ponto fixo).
+func priceToTicks(price decimal.Decimal) int64 {
+	return price.Units()
+}
+
+// priceLevel é uma fila FIFO intrusiva: as ordens se encadeiam pelos campos
+// prev/next da própria Order, o que permite remoção O(1).
 type priceLevel struct {
-	Price  float64
-	Orders []*Order
+	Price decimal.Decimal
+	ticks int64
+	head  *Order
+	tail  *Order
+	count int
+}
+
+func (l *priceLevel) push(order *Order) {
+	order.level = l
+	order.prev = l.tail
+	order.next = nil
+	if l.tail != nil {
+		l.tail.next = order
+	} else {
+		l.head = order
+	}
+	l.tail = order
+	l.count++
+}
+
+func (l *priceLevel) unlink(order *Order) {
+	if order.prev != nil {
+		order.prev.next = order.next
+	} else {
+		l.head = order.next
+	}
+	if order.next != nil {
+		order.next.prev = order.prev
+	} else {
+		l.tail = order.prev
+	}
+	order.prev, order.next, order.level = nil, nil, nil
+	l.count--
+}
+
+func (l *priceLevel) remainingQty() decimal.Decimal {
+	var qty decimal.Decimal
+	for o := l.head; o != nil; o = o.next {
+		qty = qty.Add(o.RemainingQty())
+	}
+	return qty
+}
+
+// displayedQty soma apenas o que é visível no nível (fatias de icebergs).
+func (l *priceLevel) displayedQty() decimal.Decimal {
+	var qty decimal.Decimal
+	for o := l.head; o != nil; o = o.next {
+		qty = qty.Add(o.displayedQty())
+	}
+	return qty
 }
 
 // OrderBook mantém profundidade baseado em FIFO preço-tempo.
@@ -15,18 +72,19 @@ type OrderBook struct {
 	Symbol string
 
 	mu   sync.RWMutex
-	bids map[float64]*priceLevel
-	asks map[float64]*priceLevel
+	bids *priceLadder
+	asks *priceLadder
 }
 
 type OrderBookLevel struct {
-	Price    float64 `json:"price"`
-	Quantity float64 `json:"quantity"`
-	Count    int     `json:"count"`
+	Price    decimal.Decimal `json:"price"`
+	Quantity decimal.Decimal `json:"quantity"`
+	Count    int             `json:"count"`
 }
 
 type OrderBookSnapshot struct {
 	Symbol string           `json:"symbol"`
+	Seq    uint64           `json:"seq"`
 	Bids   []OrderBookLevel `json:"bids"`
 	Asks   []OrderBookLevel `json:"asks"`
 }
@@ -34,94 +92,287 @@ type OrderBookSnapshot struct {
 func NewOrderBook(symbol string) *OrderBook {
 	return &OrderBook{
 		Symbol: symbol,
-		bids:   make(map[float64]*priceLevel),
-		asks:   make(map[float64]*priceLevel),
+		bids:   newPriceLadder(true),
+		asks:   newPriceLadder(false),
+	}
+}
+
+func (ob *OrderBook) side(side Side) *priceLadder {
+	if side == SideSell {
+		return ob.asks
 	}
+	return ob.bids
 }
 
 func (ob *OrderBook) addOrder(order *Order) {
 	ob.mu.Lock()
 	defer ob.mu.Unlock()
+	ob.insertLocked(order)
+}
 
-	book := ob.bids
-	if order.Side == SideSell {
-		book = ob.asks
+func (ob *OrderBook) insertLocked(order *Order) {
+	ladder := ob.side(order.Side)
+	ticks := priceToTicks(order.Price)
+
+	level := ladder.get(ticks)
+	if level == nil {
+		level = &priceLevel{Price: order.Price, ticks: ticks}
+		ladder.insert(level)
 	}
+	order.replenish()
+	level.push(order)
+}
 
-	level, ok := book[order.Price]
-	if !ok {
-		level = &priceLevel{Price: order.Price}
-		book[order.Price] = level
+// consumeVisibleLocked desconta qty da fatia visível de um iceberg em repouso;
+// fatia consumida dá lugar à próxima, no fim da fila do nível. O chamador
+// precisa segurar ob.mu.
+func (ob *OrderBook) consumeVisibleLocked(order *Order, qty decimal.Decimal) {
+	if !order.DisplayQty.IsPositive() {
+		return
+	}
+	order.VisibleQty = order.VisibleQty.Sub(qty)
+	if !order.VisibleQty.IsPositive() {
+		level := order.level
+		level.unlink(order)
+		order.replenish()
+		level.push(order)
 	}
+}
 
-	level.Orders = append(level.Orders, order)
+// contains indica se a ordem está em repouso no book.
+func (ob *OrderBook) contains(order *Order) bool {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	level := order.level
+	return level != nil && ob.side(order.Side).get(level.ticks) == level
 }
 
-func (ob *OrderBook) removeEmptyLevel(side Side, price float64) {
-	book := ob.bids
-	if side == SideSell {
-		book = ob.asks
+// removeOrder retira uma ordem em repouso do seu nível de preço.
+func (ob *OrderBook) removeOrder(order *Order) bool {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.unlinkLocked(order)
+}
+
+// unlinkLocked remove a ordem do seu nível e descarta o nível se esvaziar.
+// O chamador precisa segurar ob.mu.
+func (ob *OrderBook) unlinkLocked(order *Order) bool {
+	level := order.level
+	if level == nil {
+		return false
+	}
+	ladder := ob.side(order.Side)
+	if ladder.get(level.ticks) != level {
+		return false
 	}
 
-	level := book[price]
-	if level != nil && len(level.Orders) == 0 {
-		delete(book, price)
+	level.unlink(order)
+	if level.count == 0 {
+		ladder.remove(level.ticks)
 	}
+	return true
 }
 
-func (ob *OrderBook) Snapshot(depth int) OrderBookSnapshot {
+// bestLocked devolve o melhor nível do lado informado. O chamador precisa
+// segurar ob.mu.
+func (ob *OrderBook) bestLocked(side Side) *priceLevel {
+	return ob.side(side).first()
+}
+
+func (ob *OrderBook) bestBid() (decimal.Decimal, bool) {
 	ob.mu.RLock()
 	defer ob.mu.RUnlock()
 
-	var bidPrices []float64
-	for p := range ob.bids {
-		bidPrices = append(bidPrices, p)
+	if level := ob.bids.first(); level != nil {
+		return level.Price, true
 	}
-	sort.Sort(sort.Reverse(sort.Float64Slice(bidPrices)))
+	return decimal.Zero, false
+}
 
-	var askPrices []float64
-	for p := range ob.asks {
-		askPrices = append(askPrices, p)
+func (ob *OrderBook) bestAsk() (decimal.Decimal, bool) {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+
+	if level := ob.asks.first(); level != nil {
+		return level.Price, true
 	}
-	sort.Float64s(askPrices)
+	return decimal.Zero, false
+}
+
+// crossingQty soma a quantidade do lado oposto executável contra a ordem
+// até o limite de preço limit (em ticks).
+func (ob *OrderBook) crossingQty(order *Order, limit int64) decimal.Decimal {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
 
-	snap := OrderBookSnapshot{Symbol: ob.Symbol}
+	ladder := ob.asks
+	if order.Side == SideSell {
+		ladder = ob.bids
+	}
 
-	for i, price := range bidPrices {
-		if depth > 0 && i >= depth {
+	var total decimal.Decimal
+	for node := ladder.head.next[0]; node != nil; node = node.next[0] {
+		if !crosses(order.Side, limit, node.level.ticks) {
 			break
 		}
-		level := ob.bids[price]
-		var qty float64
-		for _, order := range level.Orders {
-			qty += order.RemainingQty()
+		if order.STP == STPNone {
+			total = total.Add(node.level.remainingQty())
+			continue
 		}
-		if qty > 0 {
-			snap.Bids = append(snap.Bids, OrderBookLevel{
-				Price:    price,
-				Quantity: qty,
-				Count:    len(level.Orders),
-			})
+		// com STP, ordens do próprio usuário não contam como liquidez
+		for o := node.level.head; o != nil; o = o.next {
+			if o.UserID != order.UserID {
+				total = total.Add(o.RemainingQty())
+			}
+		}
+	}
+	return total
+}
+
+// crosses indica se uma ordem do lado informado com limite limitTicks executa
+// contra um nível de preço levelTicks do lado oposto.
+func crosses(side Side, limitTicks, levelTicks int64) bool {
+	if side == SideBuy {
+		return levelTicks <= limitTicks
+	}
+	return levelTicks >= limitTicks
+}
+
+func (ob *OrderBook) Snapshot(depth int) OrderBookSnapshot {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+
+	return OrderBookSnapshot{
+		Symbol: ob.Symbol,
+		Bids:   ob.bids.levels(depth),
+		Asks:   ob.asks.levels(depth),
+	}
+}
+
+// ---- skip list de níveis de preço ----
+
+const ladderMaxHeight = 24
+
+type ladderNode struct {
+	level *priceLevel
+	next  []*ladderNode
+}
+
+// priceLadder mantém os níveis ordenados por ticks (decrescente para bids,
+// crescente para asks): o melhor preço é sempre o primeiro nó, O(1).
+type priceLadder struct {
+	head   ladderNode
+	height int
+	desc   bool
+	index  map[int64]*ladderNode
+	seed   uint64
+}
+
+func newPriceLadder(desc bool) *priceLadder {
+	return &priceLadder{
+		head:   ladderNode{next: make([]*ladderNode, ladderMaxHeight)},
+		height: 1,
+		desc:   desc,
+		index:  make(map[int64]*ladderNode),
+		seed:   0x9E3779B97F4A7C15,
+	}
+}
+
+func (l *priceLadder) before(a, b int64) bool {
+	if l.desc {
+		return a > b
+	}
+	return a < b
+}
+
+// randomHeight usa xorshift com semente fixa para que a forma da lista seja
+// reprodutível entre execuções.
+func (l *priceLadder) randomHeight() int {
+	l.seed ^= l.seed << 13
+	l.seed ^= l.seed >> 7
+	l.seed ^= l.seed << 17
+	h := 1
+	for x := l.seed; h < ladderMaxHeight && x&3 == 0; x >>= 2 {
+		h++
+	}
+	return h
+}
+
+func (l *priceLadder) first() *priceLevel {
+	if node := l.head.next[0]; node != nil {
+		return node.level
+	}
+	return nil
+}
+
+func (l *priceLadder) get(ticks int64) *priceLevel {
+	if node, ok := l.index[ticks]; ok {
+		return node.level
+	}
+	return nil
+}
+
+func (l *priceLadder) insert(level *priceLevel) {
+	var update [ladderMaxHeight]*ladderNode
+	x := &l.head
+	for i := l.height - 1; i >= 0; i-- {
+		for x.next[i] != nil && l.before(x.next[i].level.ticks, level.ticks) {
+			x = x.next[i]
 		}
+		update[i] = x
 	}
 
-	for i, price := range askPrices {
-		if depth > 0 && i >= depth {
-			break
+	h := l.randomHeight()
+	if h > l.height {
+		for i := l.height; i < h; i++ {
+			update[i] = &l.head
 		}
-		level := ob.asks[price]
-		var qty float64
-		for _, order := range level.Orders {
-			qty += order.RemainingQty()
+		l.height = h
+	}
+
+	node := &ladderNode{level: level, next: make([]*ladderNode, h)}
+	for i := 0; i < h; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	l.index[level.ticks] = node
+}
+
+func (l *priceLadder) remove(ticks int64) {
+	node, ok := l.index[ticks]
+	if !ok {
+		return
+	}
+
+	x := &l.head
+	for i := l.height - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i] != node && l.before(x.next[i].level.ticks, ticks) {
+			x = x.next[i]
+		}
+		if x.next[i] == node {
+			x.next[i] = node.next[i]
+		}
+	}
+	for l.height > 1 && l.head.next[l.height-1] == nil {
+		l.height--
+	}
+	delete(l.index, ticks)
+}
+
+func (l *priceLadder) levels(depth int) []OrderBookLevel {
+	var out []OrderBookLevel
+	for node := l.head.next[0]; node != nil; node = node.next[0] {
+		if depth > 0 && len(out) >= depth {
+			break
 		}
-		if qty > 0 {
-			snap.Asks = append(snap.Asks, OrderBookLevel{
-				Price:    price,
+		qty := node.level.displayedQty()
+		if qty.IsPositive() {
+			out = append(out, OrderBookLevel{
+				Price:    node.level.Price,
 				Quantity: qty,
-				Count:    len(level.Orders),
+				Count:    node.level.count,
 			})
 		}
 	}
-
-	return snap
+	return out
 }
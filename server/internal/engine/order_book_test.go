@@ -0,0 +1,261 @@
+package engine
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"hearcap/server/internal/decimal"
+)
+
+func ladderTicks(l *priceLadder) []int64 {
+	var out []int64
+	for node := l.head.next[0]; node != nil; node = node.next[0] {
+		out = append(out, node.level.ticks)
+	}
+	return out
+}
+
+func TestPriceLadderOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		desc   bool
+		insert []int64
+		remove []int64
+		want   []int64
+	}{
+		{"asks ascending", false, []int64{30, 10, 20}, nil, []int64{10, 20, 30}},
+		{"bids descending", true, []int64{30, 10, 20}, nil, []int64{30, 20, 10}},
+		{"remove best", false, []int64{5, 1, 3}, []int64{1}, []int64{3, 5}},
+		{"remove middle and worst", true, []int64{5, 1, 3, 4}, []int64{3, 1}, []int64{5, 4}},
+		{"remove missing is a no-op", false, []int64{2, 1}, []int64{7}, []int64{1, 2}},
+		{"remove all", false, []int64{2, 1}, []int64{1, 2}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newPriceLadder(tt.desc)
+			for _, ticks := range tt.insert {
+				l.insert(&priceLevel{Price: decimal.FromUnits(ticks), ticks: ticks})
+			}
+			for _, ticks := range tt.remove {
+				l.remove(ticks)
+			}
+			got := ladderTicks(l)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("ladder = %v, want %v", got, tt.want)
+			}
+			if len(l.index) != len(tt.want) {
+				t.Fatalf("index has %d levels, want %d", len(l.index), len(tt.want))
+			}
+			if len(tt.want) > 0 && l.first().ticks != tt.want[0] {
+				t.Fatalf("first = %d, want %d", l.first().ticks, tt.want[0])
+			}
+		})
+	}
+}
+
+func TestPriceLadderRandomized(t *testing.T) {
+	l := newPriceLadder(false)
+	rng := rand.New(rand.NewSource(1))
+	live := make(map[int64]bool)
+	for i := 0; i < 5000; i++ {
+		ticks := rng.Int63n(1000)
+		if live[ticks] {
+			l.remove(ticks)
+			delete(live, ticks)
+			continue
+		}
+		l.insert(&priceLevel{ticks: ticks})
+		live[ticks] = true
+	}
+	got := ladderTicks(l)
+	if len(got) != len(live) {
+		t.Fatalf("ladder has %d levels, want %d", len(got), len(live))
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i-1] >= got[i] {
+			t.Fatalf("ladder out of order at %d: %d >= %d", i, got[i-1], got[i])
+		}
+	}
+}
+
+func TestOrderBookFIFOUnlink(t *testing.T) {
+	tests := []struct {
+		name   string
+		remove []int
+		want   []int
+	}{
+		{"head", []int{0}, []int{1, 2}},
+		{"middle", []int{1}, []int{0, 2}},
+		{"tail", []int{2}, []int{0, 1}},
+		{"head then tail", []int{0, 2}, []int{1}},
+		{"all", []int{1, 0, 2}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ob := NewOrderBook("AAA")
+			orders := make([]*Order, 3)
+			for i := range orders {
+				orders[i] = &Order{ID: fmt.Sprint(i), Side: SideBuy, Price: d("10"), Quantity: d("1")}
+				ob.addOrder(orders[i])
+			}
+			for _, i := range tt.remove {
+				if !ob.removeOrder(orders[i]) {
+					t.Fatalf("removeOrder(%d) = false", i)
+				}
+				if ob.removeOrder(orders[i]) {
+					t.Fatalf("second removeOrder(%d) = true", i)
+				}
+			}
+
+			level := ob.bids.first()
+			if len(tt.want) == 0 {
+				if level != nil {
+					t.Fatalf("empty level was not removed from the ladder")
+				}
+				return
+			}
+			var got []int
+			for o := level.head; o != nil; o = o.next {
+				var id int
+				fmt.Sscan(o.ID, &id)
+				got = append(got, id)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) || level.count != len(tt.want) {
+				t.Fatalf("queue = %v (count %d), want %v", got, level.count, tt.want)
+			}
+			if level.tail.ID != fmt.Sprint(tt.want[len(tt.want)-1]) {
+				t.Fatalf("tail = %s, want %d", level.tail.ID, tt.want[len(tt.want)-1])
+			}
+		})
+	}
+}
+
+func TestMatchingPriceTimePriority(t *testing.T) {
+	me, repo, balances := newTestEngine(t)
+	for _, u := range []string{"m1", "m2", "m3", "taker"} {
+		fund(balances, u, "AAA")
+	}
+	first := mustPlace(t, me, limit("m1", "AAA", SideSell, "10", "1"))
+	second := mustPlace(t, me, limit("m2", "AAA", SideSell, "10", "1"))
+	better := mustPlace(t, me, limit("m3", "AAA", SideSell, "9", "1"))
+
+	mustPlace(t, me, limit("taker", "AAA", SideBuy, "10", "2"))
+
+	if s := repo.order(better.ID).Status; s != OrderStatusFilled {
+		t.Fatalf("best price status = %s, want FILLED", s)
+	}
+	if s := repo.order(first.ID).Status; s != OrderStatusFilled {
+		t.Fatalf("first at level status = %s, want FILLED", s)
+	}
+	if s := repo.order(second.ID).Status; s != OrderStatusNew {
+		t.Fatalf("second at level status = %s, want NEW", s)
+	}
+}
+
+// ---- benchmarks de book profundo ----
+
+const (
+	benchLevels         = 10_000
+	benchOrdersPerLevel = 100 // 1M ordens em repouso
+)
+
+var (
+	deepBookOnce sync.Once
+	deepBook     *OrderBook
+)
+
+// benchDeepBook monta (uma vez) um book com benchLevels níveis de venda e
+// benchLevels*benchOrdersPerLevel ordens em repouso.
+func benchDeepBook() *OrderBook {
+	deepBookOnce.Do(func() {
+		deepBook = NewOrderBook("DEEP")
+		for lvl := 0; lvl < benchLevels; lvl++ {
+			price := decimal.FromInt(int64(1000 + lvl))
+			for i := 0; i < benchOrdersPerLevel; i++ {
+				deepBook.addOrder(&Order{
+					ID:       fmt.Sprintf("%d-%d", lvl, i),
+					Side:     SideSell,
+					Price:    price,
+					Quantity: decimal.One,
+				})
+			}
+		}
+	})
+	return deepBook
+}
+
+func BenchmarkOrderBookAddCancelDeep(b *testing.B) {
+	ob := benchDeepBook()
+	rng := rand.New(rand.NewSource(1))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		o := &Order{
+			ID:       "bench",
+			Side:     SideSell,
+			Price:    decimal.FromInt(int64(1000 + rng.Intn(benchLevels))),
+			Quantity: decimal.One,
+		}
+		ob.addOrder(o)
+		ob.removeOrder(o)
+	}
+}
+
+func BenchmarkOrderBookNewLevelDeep(b *testing.B) {
+	ob := benchDeepBook()
+	rng := rand.New(rand.NewSource(1))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// preço entre níveis existentes: cria e descarta um nível
+		price := decimal.FromInt(int64(1000 + rng.Intn(benchLevels))).Add(decimal.RequireFromString("0.5"))
+		o := &Order{ID: "bench", Side: SideSell, Price: price, Quantity: decimal.One}
+		ob.addOrder(o)
+		ob.removeOrder(o)
+	}
+}
+
+func BenchmarkOrderBookBestDeep(b *testing.B) {
+	ob := benchDeepBook()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := ob.bestAsk(); !ok {
+			b.Fatal("empty book")
+		}
+	}
+}
+
+func BenchmarkOrderBookSnapshotDeep(b *testing.B) {
+	ob := benchDeepBook()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ob.Snapshot(50)
+	}
+}
+
+// BenchmarkMatchingSweepDeep mede o matching completo (sequenciador, travas,
+// trades) de agressoras que varrem 10 níveis de um book com benchLevels
+// níveis, repondo a liquidez consumida a cada rodada.
+func BenchmarkMatchingSweepDeep(b *testing.B) {
+	me, _, balances := newTestEngine(b)
+	balances.deposit("maker", "DEEP", decimal.FromInt(100_000_000))
+	balances.deposit("taker", "DEEP_QUOTE", decimal.FromInt(100_000_000))
+	for lvl := 0; lvl < benchLevels; lvl++ {
+		mustPlace(b, me, limit("maker", "DEEP", SideSell, fmt.Sprint(1000+lvl), "1"))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mustPlace(b, me, limit("taker", "DEEP", SideBuy, "1009", "10"))
+		b.StopTimer()
+		for lvl := 0; lvl < 10; lvl++ {
+			mustPlace(b, me, limit("maker", "DEEP", SideSell, fmt.Sprint(1000+lvl), "1"))
+		}
+		b.StartTimer()
+	}
+}
@@ -0,0 +1,882 @@
+package engine
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"hearcap/server/internal/decimal"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidOrderGroup  = errors.New("invalid order group")
+	ErrOrderGroupNotFound = errors.New("order group not found")
+)
+
+type OrderGroupType string
+
+const (
+	// OrderGroupOCO: a execução (ou o cancelamento) de uma perna encerra as demais.
+	OrderGroupOCO OrderGroupType = "OCO"
+	// OrderGroupBracket: uma ordem de entrada que, ao terminar executada, abre
+	// um par OCO de saída (take-profit + stop-loss) na quantidade executada.
+	OrderGroupBracket OrderGroupType = "BRACKET"
+)
+
+// OrderGroupPolicy define o que acontece com as pernas irmãs quando uma perna
+// do OCO executa.
+type OrderGroupPolicy string
+
+const (
+	// GroupCancelOnPartial cancela as irmãs na primeira execução, mesmo parcial.
+	GroupCancelOnPartial OrderGroupPolicy = "CANCEL_ON_PARTIAL"
+	// GroupCancelOnFill reduz as irmãs pelo que foi executado e só as cancela
+	// quando uma perna é totalmente preenchida.
+	GroupCancelOnFill OrderGroupPolicy = "CANCEL_ON_FILL"
+)
+
+type OrderGroupStatus string
+
+const (
+	// OrderGroupPending: bracket aguardando a ordem de entrada.
+	OrderGroupPending   OrderGroupStatus = "PENDING"
+	OrderGroupActive    OrderGroupStatus = "ACTIVE"
+	OrderGroupCompleted OrderGroupStatus = "COMPLETED"
+	OrderGroupCanceled  OrderGroupStatus = "CANCELED"
+	// OrderGroupRejected: as saídas do bracket não puderam ser abertas
+	// (ex.: mercado fechado ou saldo insuficiente para a parte da trava que
+	// a execução da entrada não cobre).
+	OrderGroupRejected OrderGroupStatus = "REJECTED"
+)
+
+// OrderGroup liga ordens do mesmo usuário e símbolo. As pernas de saída
+// (todas do mesmo lado e quantidade) compartilham uma única trava de saldo,
+// mantida pelo grupo e liberada quando a última perna termina. Num bracket a
+// trava das saídas é reservada contra o que a entrada recebe a cada execução
+// (ReceivableBalanceService), sem esperar a liquidação.
+type OrderGroup struct {
+	ID     string
+	UserID string
+	Symbol string
+	Type   OrderGroupType
+	Policy OrderGroupPolicy
+	Status OrderGroupStatus
+
+	EntryOrderID string
+	LegIDs       []string
+
+	Side      Side
+	Quantity  decimal.Decimal
+	FilledQty decimal.Decimal
+	// LockPrice é o preço por unidade travado em quote para pernas de compra;
+	// LockedQuote é o que resta dessa trava após as execuções.
+	LockPrice   decimal.Decimal
+	LockedQuote decimal.Decimal
+	// Receivable é a parte da trava reservada contra o que a entrada do
+	// bracket recebe na liquidação: base numa entrada de compra, quote numa
+	// de venda.
+	Receivable decimal.Decimal
+	LegFilled  map[string]decimal.Decimal
+	// STP aplicado às pernas de saída.
+	STP STPMode
+
+	// parâmetros das saídas do bracket
+	TakeProfitPrice    decimal.Decimal
+	StopLossPrice      decimal.Decimal
+	StopLossLimitPrice decimal.Decimal
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Seq       uint64
+
+	// busy evita que os cancelamentos feitos pelo próprio grupo reentrem
+	// em onGroupLeg
+	busy bool
+	// reserveFailed marca um bracket cuja entrada não conseguiu reservar o
+	// que recebe; as saídas não são abertas
+	reserveFailed bool
+}
+
+func (g *OrderGroup) clone() *OrderGroup {
+	c := *g
+	c.LegIDs = append([]string(nil), g.LegIDs...)
+	c.LegFilled = make(map[string]decimal.Decimal, len(g.LegFilled))
+	for id, qty := range g.LegFilled {
+		c.LegFilled[id] = qty
+	}
+	c.busy = false
+	return &c
+}
+
+func (g *OrderGroup) IsTerminal() bool {
+	switch g.Status {
+	case OrderGroupCompleted, OrderGroupCanceled, OrderGroupRejected:
+		return true
+	}
+	return false
+}
+
+// OCOLeg descreve uma perna de um OCO; lado, quantidade, usuário e símbolo
+// vêm do grupo.
+type OCOLeg struct {
+	Type            OrderType
+	Price           decimal.Decimal
+	StopPrice       decimal.Decimal
+	TrailingAmount  decimal.Decimal
+	TrailingPercent decimal.Decimal
+	TimeInForce     TimeInForce
+	ExpireAt        *time.Time
+}
+
+type NewOCORequest struct {
+	UserID   string
+	Symbol   string
+	Side     Side
+	Quantity decimal.Decimal
+	Policy   OrderGroupPolicy
+	STP      STPMode
+	Legs     []OCOLeg
+}
+
+type NewBracketRequest struct {
+	Entry  NewOrderRequest
+	Policy OrderGroupPolicy
+
+	TakeProfitPrice decimal.Decimal
+	StopLossPrice   decimal.Decimal
+	// StopLossLimitPrice > 0 faz o stop-loss ser STOP_LIMIT em vez de STOP.
+	StopLossLimitPrice decimal.Decimal
+}
+
+// PlaceOCO abre um grupo one-cancels-other, tipicamente um LIMIT de
+// take-profit e um STOP de stop-loss no mesmo lado.
+func (me *MatchingEngine) PlaceOCO(req NewOCORequest) (*OrderGroup, error) {
+	if !req.Quantity.IsPositive() || len(req.Legs) < 2 {
+		return nil, ErrInvalidOrderGroup
+	}
+	if err := validateBounds(req.Quantity); err != nil {
+		return nil, err
+	}
+	policy, err := groupPolicy(req.Policy)
+	if err != nil {
+		return nil, err
+	}
+	stp := req.STP
+	if stp == STPNone {
+		stp = me.accountSTPMode(req.UserID)
+	}
+	if !validSTPMode(stp) {
+		return nil, ErrInvalidSTPMode
+	}
+
+	now := time.Now()
+	group := &OrderGroup{
+		ID:        uuid.NewString(),
+		UserID:    req.UserID,
+		Symbol:    req.Symbol,
+		Type:      OrderGroupOCO,
+		Policy:    policy,
+		Status:    OrderGroupActive,
+		Side:      req.Side,
+		Quantity:  req.Quantity,
+		LegFilled: make(map[string]decimal.Decimal),
+		STP:       stp,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	legs := make([]*Order, 0, len(req.Legs))
+	for _, l := range req.Legs {
+		leg := &Order{
+			ID:              uuid.NewString(),
+			UserID:          req.UserID,
+			Symbol:          req.Symbol,
+			Side:            req.Side,
+			Type:            l.Type,
+			Price:           l.Price,
+			StopPrice:       l.StopPrice,
+			Quantity:        req.Quantity,
+			TrailingAmount:  l.TrailingAmount,
+			TrailingPercent: l.TrailingPercent,
+			TimeInForce:     l.TimeInForce,
+			ExpireAt:        l.ExpireAt,
+			STP:             stp,
+			GroupID:         group.ID,
+			Status:          OrderStatusNew,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}
+		if err := validateGroupLeg(leg); err != nil {
+			return nil, err
+		}
+		if err := validateBounds(leg.Price, leg.StopPrice, leg.TrailingAmount); err != nil {
+			return nil, err
+		}
+		if err := validateNotional(leg); err != nil {
+			return nil, err
+		}
+		if err := me.checkInstrument(leg); err != nil {
+			return nil, err
+		}
+		legs = append(legs, leg)
+		group.LegIDs = append(group.LegIDs, leg.ID)
+	}
+
+	return me.submitGroup(group, legs)
+}
+
+// PlaceBracket envia a ordem de entrada; quando ela termina com execução, o
+// engine abre o OCO de saída (LIMIT em TakeProfitPrice + STOP/STOP_LIMIT em
+// StopLossPrice) no lado oposto, na quantidade executada.
+func (me *MatchingEngine) PlaceBracket(req NewBracketRequest) (*OrderGroup, error) {
+	entryReq := req.Entry
+	if !entryReq.Quantity.IsPositive() || !req.TakeProfitPrice.IsPositive() || !req.StopLossPrice.IsPositive() {
+		return nil, ErrInvalidOrderGroup
+	}
+	if entryReq.Type != OrderTypeLimit && entryReq.Type != OrderTypeMarket {
+		return nil, ErrInvalidOrderGroup
+	}
+	if err := validatePrice(entryReq.Type, entryReq.Price); err != nil {
+		return nil, err
+	}
+	if err := validateBounds(entryReq.Price, entryReq.Quantity, entryReq.QuoteQty, entryReq.DisplayQty, req.TakeProfitPrice, req.StopLossPrice, req.StopLossLimitPrice); err != nil {
+		return nil, err
+	}
+	policy, err := groupPolicy(req.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entry := &Order{
+		ID:          uuid.NewString(),
+		UserID:      entryReq.UserID,
+		Symbol:      entryReq.Symbol,
+		Side:        entryReq.Side,
+		Type:        entryReq.Type,
+		Price:       entryReq.Price,
+		Quantity:    entryReq.Quantity,
+		QuoteQty:    entryReq.QuoteQty,
+		DisplayQty:  entryReq.DisplayQty,
+		TimeInForce: entryReq.TimeInForce,
+		ExpireAt:    entryReq.ExpireAt,
+		PostOnly:    entryReq.PostOnly,
+		STP:         entryReq.STP,
+		Status:      OrderStatusNew,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := validateTimeInForce(entry); err != nil {
+		return nil, err
+	}
+	if err := validateIceberg(entry); err != nil {
+		return nil, err
+	}
+	if err := validateQuoteQty(entry); err != nil {
+		return nil, err
+	}
+	if err := validateNotional(entry); err != nil {
+		return nil, err
+	}
+	if err := me.checkBracketInstrument(entry, req); err != nil {
+		return nil, err
+	}
+	if entry.STP == STPNone {
+		entry.STP = me.accountSTPMode(entry.UserID)
+	}
+	if !validSTPMode(entry.STP) {
+		return nil, ErrInvalidSTPMode
+	}
+
+	exitSide := SideSell
+	if entry.Side == SideSell {
+		exitSide = SideBuy
+	}
+	group := &OrderGroup{
+		ID:                 uuid.NewString(),
+		UserID:             entry.UserID,
+		Symbol:             entry.Symbol,
+		Type:               OrderGroupBracket,
+		Policy:             policy,
+		Status:             OrderGroupPending,
+		EntryOrderID:       entry.ID,
+		Side:               exitSide,
+		LegFilled:          make(map[string]decimal.Decimal),
+		STP:                entry.STP,
+		TakeProfitPrice:    req.TakeProfitPrice,
+		StopLossPrice:      req.StopLossPrice,
+		StopLossLimitPrice: req.StopLossLimitPrice,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	entry.GroupID = group.ID
+
+	return me.submitGroup(group, []*Order{entry})
+}
+
+// checkBracketInstrument valida a entrada e os preços de saída do bracket
+// contra o mercado.
+func (me *MatchingEngine) checkBracketInstrument(entry *Order, req NewBracketRequest) error {
+	inst, ok, err := me.instrument(entry.Symbol)
+	if !ok {
+		return err
+	}
+	if err := inst.validateOrder(entry); err != nil {
+		return err
+	}
+	for _, p := range []decimal.Decimal{req.TakeProfitPrice, req.StopLossPrice, req.StopLossLimitPrice} {
+		if err := inst.checkPrice(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CancelOrderGroup cancela todas as ordens ativas do grupo (entrada e pernas).
+func (me *MatchingEngine) CancelOrderGroup(groupID, userID string) (*OrderGroup, error) {
+	me.mu.RLock()
+	symbol, ok := me.groupSymbols[groupID]
+	me.mu.RUnlock()
+	if !ok {
+		return nil, ErrOrderGroupNotFound
+	}
+	res := me.submit(symbol, command{kind: cmdCancelGroup, orderID: groupID, userID: userID})
+	return res.group, res.err
+}
+
+func (me *MatchingEngine) submitGroup(group *OrderGroup, orders []*Order) (*OrderGroup, error) {
+	me.mu.Lock()
+	me.groupSymbols[group.ID] = group.Symbol
+	for _, o := range orders {
+		me.orderSymbols[o.ID] = o.Symbol
+	}
+	me.mu.Unlock()
+
+	res := me.submit(group.Symbol, command{kind: cmdPlaceGroup, group: group, legs: orders})
+	if res.err != nil {
+		me.unindexGroup(group.ID)
+		for _, o := range orders {
+			me.unindexOrder(o.ID)
+		}
+		return nil, res.err
+	}
+	return res.group, nil
+}
+
+func (me *MatchingEngine) unindexGroup(groupID string) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	delete(me.groupSymbols, groupID)
+}
+
+func groupPolicy(policy OrderGroupPolicy) (OrderGroupPolicy, error) {
+	switch policy {
+	case "":
+		return GroupCancelOnPartial, nil
+	case GroupCancelOnPartial, GroupCancelOnFill:
+		return policy, nil
+	}
+	return "", ErrInvalidOrderGroup
+}
+
+// validateGroupLeg aceita apenas pernas que podem aguardar no book ou no
+// índice de condicionais: LIMIT GTC/GTD e ordens condicionais.
+func validateGroupLeg(leg *Order) error {
+	if leg.Type != OrderTypeLimit && !leg.isConditional() {
+		return ErrInvalidOrderGroup
+	}
+	if leg.Type == OrderTypeLimit && !leg.Price.IsPositive() {
+		return ErrInvalidOrderGroup
+	}
+	if err := validateTimeInForce(leg); err != nil {
+		return err
+	}
+	if leg.TimeInForce == TimeInForceFOK || (leg.Type == OrderTypeLimit && !leg.restsInBook()) {
+		return ErrInvalidOrderGroup
+	}
+	return validateConditional(leg)
+}
+
+// ---- execução dentro do sequenciador do símbolo ----
+
+func (m *market) placeGroup(group *OrderGroup, orders []*Order) error {
+	if err := marketStatusError(m.status); err != nil {
+		return err
+	}
+	if group.Type == OrderGroupBracket {
+		entry := orders[0]
+		m.groups[group.ID] = group
+		group.Seq = m.nextSeq()
+		if err := m.repo.SaveOrderGroup(group); err != nil {
+			delete(m.groups, group.ID)
+			return err
+		}
+		if err := m.place(entry); err != nil {
+			m.finishGroup(group, OrderGroupRejected)
+			return err
+		}
+		return nil
+	}
+	return m.openGroup(group, orders, true)
+}
+
+// openGroup trava o saldo compartilhado das pernas, persiste o grupo e envia
+// as pernas ao book/índice de condicionais. Todas as pernas são admitidas
+// antes de qualquer execução, para que uma perna que execute na entrada já
+// encontre as irmãs registradas.
+func (m *market) openGroup(group *OrderGroup, legs []*Order, save bool) error {
+	for _, leg := range legs {
+		if err := m.precheck(leg); err != nil {
+			return err
+		}
+	}
+	if err := m.lockGroup(group, legs); err != nil {
+		return err
+	}
+
+	group.Status = OrderGroupActive
+	m.groups[group.ID] = group
+	if save {
+		group.Seq = m.nextSeq()
+		if err := m.repo.SaveOrderGroup(group); err != nil {
+			m.abortGroup(group, nil)
+			return err
+		}
+	} else {
+		m.updateGroup(group)
+	}
+
+	for i, leg := range legs {
+		if err := m.admit(leg); err != nil {
+			m.abortGroup(group, legs[:i])
+			if save {
+				m.updateGroup(group)
+			}
+			return err
+		}
+	}
+	for _, leg := range legs {
+		if _, live := m.orders[leg.ID]; live && !leg.IsTerminal() {
+			m.route(leg)
+		}
+	}
+	return nil
+}
+
+// abortGroup desfaz uma abertura que falhou depois de lockGroup: tira o grupo
+// do mercado, cancela as pernas já admitidas e devolve a trava compartilhada.
+func (m *market) abortGroup(group *OrderGroup, admitted []*Order) {
+	group.Status = OrderGroupRejected
+	delete(m.groups, group.ID)
+	for _, leg := range admitted {
+		m.cancelLeg(leg)
+	}
+	if group.Side == SideSell {
+		m.releaseGroup(group, group.Quantity)
+	} else if group.LockedQuote.IsPositive() {
+		m.releaseGroup(group, group.LockedQuote)
+	}
+	group.LockedQuote = decimal.Zero
+}
+
+func (m *market) lockGroup(group *OrderGroup, legs []*Order) error {
+	if group.Type == OrderGroupBracket {
+		return m.lockBracketExits(group, legs)
+	}
+	if group.Side == SideSell {
+		if !m.balances.CanLockBase(group.UserID, group.Symbol, group.Quantity) {
+			return ErrInsufficientBase
+		}
+		return m.balances.LockBase(group.UserID, group.Symbol, group.Quantity)
+	}
+
+	notional, err := m.groupNotional(group, legs)
+	if err != nil {
+		return err
+	}
+	quoteSymbol := group.Symbol + "_QUOTE"
+	if !m.balances.CanLockQuote(group.UserID, quoteSymbol, notional) {
+		return ErrInsufficientQuote
+	}
+	if err := m.balances.LockQuote(group.UserID, quoteSymbol, notional); err != nil {
+		return err
+	}
+	group.LockedQuote = notional
+	return nil
+}
+
+// groupNotional calcula a trava em quote de pernas de compra pelo pior preço
+// entre elas e o grava em group.LockPrice.
+func (m *market) groupNotional(group *OrderGroup, legs []*Order) (decimal.Decimal, error) {
+	for _, leg := range legs {
+		price := leg.Price
+		if !price.IsPositive() {
+			// perna que vira MARKET: gatilho acrescido da proteção
+			price = m.stopProtectionPrice(leg)
+		}
+		if price.GreaterThan(group.LockPrice) {
+			group.LockPrice = price
+		}
+	}
+	return orderNotional(group.LockPrice, group.Quantity)
+}
+
+// receivables devolve o BalanceService como ReceivableBalanceService quando o
+// do engine o implementa (durante o replay, o substituto sem efeito).
+func (m *market) receivables() (ReceivableBalanceService, bool) {
+	if _, ok := m.engine.balances.(ReceivableBalanceService); !ok {
+		return nil, false
+	}
+	rb, ok := m.balances.(ReceivableBalanceService)
+	return rb, ok
+}
+
+// reserveEntryFill reserva para as saídas do bracket o que a entrada recebe
+// nesta execução. Roda antes de o trade seguir para a liquidação, para que o
+// crédito encontre a reserva e entre travado.
+func (m *market) reserveEntryFill(order *Order, price, qty decimal.Decimal) {
+	group, ok := m.groups[order.GroupID]
+	if !ok || group.EntryOrderID != order.ID || group.reserveFailed {
+		return
+	}
+	rb, ok := m.receivables()
+	if !ok {
+		return
+	}
+
+	amount := qty
+	var err error
+	if order.Side == SideBuy {
+		err = rb.LockReceivableBase(group.UserID, group.Symbol, amount)
+	} else {
+		amount = price.Mul(qty)
+		err = rb.LockReceivableQuote(group.UserID, group.Symbol+"_QUOTE", amount)
+	}
+	if err != nil {
+		// sem a reserva, o crédito da entrada não fica garantido para as
+		// saídas: o bracket é rejeitado quando a entrada terminar
+		log.Printf("[Matching] %s: reserve for bracket %s failed: %v", m.symbol, group.ID, err)
+		group.reserveFailed = true
+		return
+	}
+	group.Receivable = group.Receivable.Add(amount)
+}
+
+// lockBracketExits trava as saídas do bracket: a parte coberta pelo que a
+// entrada recebeu fica na reserva (group.Receivable) e só o que faltar é
+// travado do disponível; reserva além do necessário é devolvida.
+func (m *market) lockBracketExits(group *OrderGroup, legs []*Order) error {
+	need := group.Quantity
+	if group.Side == SideBuy {
+		notional, err := m.groupNotional(group, legs)
+		if err != nil {
+			return err
+		}
+		need = notional
+	}
+
+	covered := decimal.Min(need, group.Receivable)
+	if surplus := group.Receivable.Sub(covered); surplus.IsPositive() {
+		m.releaseReceivable(group, surplus)
+	}
+	if extra := need.Sub(covered); extra.IsPositive() {
+		if group.Side == SideSell {
+			if !m.balances.CanLockBase(group.UserID, group.Symbol, extra) {
+				return ErrInsufficientBase
+			}
+			if err := m.balances.LockBase(group.UserID, group.Symbol, extra); err != nil {
+				return err
+			}
+		} else {
+			quoteSymbol := group.Symbol + "_QUOTE"
+			if !m.balances.CanLockQuote(group.UserID, quoteSymbol, extra) {
+				return ErrInsufficientQuote
+			}
+			if err := m.balances.LockQuote(group.UserID, quoteSymbol, extra); err != nil {
+				return err
+			}
+		}
+	}
+	if group.Side == SideBuy {
+		group.LockedQuote = need
+	}
+	return nil
+}
+
+// releaseReceivable desfaz amount da reserva do bracket.
+func (m *market) releaseReceivable(group *OrderGroup, amount decimal.Decimal) {
+	amount = decimal.Min(amount, group.Receivable)
+	if !amount.IsPositive() {
+		return
+	}
+	rb, ok := m.receivables()
+	if !ok {
+		return
+	}
+	group.Receivable = group.Receivable.Sub(amount)
+	if group.Side == SideSell {
+		_ = rb.ReleaseReceivableBase(group.UserID, group.Symbol, amount)
+		return
+	}
+	_ = rb.ReleaseReceivableQuote(group.UserID, group.Symbol+"_QUOTE", amount)
+}
+
+// releaseGroup devolve amount da trava do grupo, primeiro da reserva.
+func (m *market) releaseGroup(group *OrderGroup, amount decimal.Decimal) {
+	reserved := decimal.Min(amount, group.Receivable)
+	m.releaseReceivable(group, reserved)
+	rest := amount.Sub(reserved)
+	if !rest.IsPositive() {
+		return
+	}
+	if group.Side == SideSell {
+		_ = m.balances.ReleaseBase(group.UserID, group.Symbol, rest)
+		return
+	}
+	_ = m.balances.ReleaseQuote(group.UserID, group.Symbol+"_QUOTE", rest)
+}
+
+// groupHoldsLock indica se o saldo da ordem está travado no grupo (pernas de
+// OCO e saídas de bracket) e não na própria ordem.
+func (m *market) groupHoldsLock(order *Order) bool {
+	if order.GroupID == "" {
+		return false
+	}
+	group, ok := m.groups[order.GroupID]
+	return !ok || group.EntryOrderID != order.ID
+}
+
+// onGroupLeg reage a toda atualização de uma ordem que pertence a um grupo.
+func (m *market) onGroupLeg(order *Order) {
+	group, ok := m.groups[order.GroupID]
+	if !ok || group.busy || group.IsTerminal() {
+		return
+	}
+
+	if order.ID == group.EntryOrderID {
+		if order.IsTerminal() && group.Status == OrderGroupPending {
+			switch {
+			case group.reserveFailed:
+				m.finishGroup(group, OrderGroupRejected)
+			case order.FilledQty.IsPositive():
+				group.Status = OrderGroupActive
+				group.Quantity = order.FilledQty
+				m.pendingBrackets = append(m.pendingBrackets, group)
+			default:
+				m.finishGroup(group, OrderGroupCanceled)
+			}
+		}
+		return
+	}
+
+	group.busy = true
+	delta := order.FilledQty.Sub(group.LegFilled[order.ID])
+	switch {
+	case delta.IsPositive():
+		group.LegFilled[order.ID] = order.FilledQty
+		group.FilledQty = group.FilledQty.Add(delta)
+		for _, sibling := range m.groupSiblings(group, order) {
+			if group.Policy == GroupCancelOnPartial || !order.RemainingQty().IsPositive() {
+				m.cancelLeg(sibling)
+			} else {
+				m.reduceLeg(sibling, delta)
+			}
+		}
+		m.updateGroup(group)
+	case order.IsTerminal():
+		// perna cancelada ou expirada: o par perde o sentido
+		for _, sibling := range m.groupSiblings(group, order) {
+			m.cancelLeg(sibling)
+		}
+	}
+	group.busy = false
+
+	m.finishIfDone(group)
+}
+
+// groupSiblings devolve as pernas ainda ativas do grupo, exceto order, na
+// ordem em que foram criadas.
+func (m *market) groupSiblings(group *OrderGroup, order *Order) []*Order {
+	var out []*Order
+	for _, id := range group.LegIDs {
+		if id == order.ID {
+			continue
+		}
+		if leg, ok := m.orders[id]; ok && !leg.IsTerminal() {
+			out = append(out, leg)
+		}
+	}
+	return out
+}
+
+// cancelLeg retira a perna de onde estiver; o saldo fica com o grupo.
+func (m *market) cancelLeg(order *Order) {
+	inBook := false
+	if !m.removeStopOrder(order) {
+		inBook = m.book.removeOrder(order)
+	}
+	order.Status = OrderStatusCanceled
+	m.forgetOrder(order)
+	_ = m.updateOrder(order)
+	if inBook {
+		m.publishBook()
+	}
+}
+
+// reduceLeg diminui a quantidade de uma perna irmã pelo que outra executou.
+func (m *market) reduceLeg(order *Order, qty decimal.Decimal) {
+	m.book.mu.Lock()
+	order.Quantity = order.Quantity.Sub(qty)
+	m.book.mu.Unlock()
+	if !order.RemainingQty().IsPositive() {
+		m.cancelLeg(order)
+		return
+	}
+	_ = m.updateOrder(order)
+}
+
+// finishIfDone encerra o grupo quando nenhuma perna segue ativa.
+func (m *market) finishIfDone(group *OrderGroup) {
+	if group.Status != OrderGroupActive {
+		return
+	}
+	for _, id := range group.LegIDs {
+		if leg, ok := m.orders[id]; ok && !leg.IsTerminal() {
+			return
+		}
+	}
+	if len(group.LegIDs) == 0 {
+		return
+	}
+	status := OrderGroupCanceled
+	if group.FilledQty.IsPositive() {
+		status = OrderGroupCompleted
+	}
+	m.finishGroup(group, status)
+}
+
+// finishGroup libera a trava compartilhada que sobrou e encerra o grupo. Um
+// bracket sem saídas abertas devolve toda a reserva feita pela entrada; com
+// saídas, o que sobra da reserva foi consumido pelas execuções.
+func (m *market) finishGroup(group *OrderGroup, status OrderGroupStatus) {
+	if len(group.LegIDs) > 0 {
+		remaining := group.Quantity.Sub(group.FilledQty)
+		if group.Side == SideSell && remaining.IsPositive() {
+			m.releaseGroup(group, remaining)
+		}
+		if group.Side == SideBuy && group.LockedQuote.IsPositive() {
+			m.releaseGroup(group, group.LockedQuote)
+			group.LockedQuote = decimal.Zero
+		}
+		group.Receivable = decimal.Zero
+	} else {
+		m.releaseReceivable(group, group.Receivable)
+	}
+
+	group.Status = status
+	delete(m.groups, group.ID)
+	m.engine.unindexGroup(group.ID)
+	m.updateGroup(group)
+}
+
+func (m *market) updateGroup(group *OrderGroup) {
+	group.Seq = m.nextSeq()
+	group.UpdatedAt = time.Now()
+	_ = m.repo.UpdateOrderGroup(group)
+}
+
+func (m *market) cancelGroup(groupID, userID string) (*OrderGroup, error) {
+	group, ok := m.groups[groupID]
+	if !ok {
+		return nil, ErrOrderGroupNotFound
+	}
+	if group.UserID != userID {
+		return nil, ErrOrderNotOwned
+	}
+
+	group.busy = true
+	if entry, ok := m.orders[group.EntryOrderID]; ok && group.Status == OrderGroupPending {
+		_ = m.pullOrder(entry, OrderStatusCanceled)
+	}
+	for _, id := range group.LegIDs {
+		if leg, ok := m.orders[id]; ok && !leg.IsTerminal() {
+			m.cancelLeg(leg)
+		}
+	}
+	group.busy = false
+
+	m.finishGroup(group, OrderGroupCanceled)
+	return group.clone(), nil
+}
+
+// openBracketExits abre o OCO de saída dos brackets cuja entrada terminou no
+// comando atual. Roda depois do comando para não reentrar no matching.
+func (m *market) openBracketExits() {
+	for len(m.pendingBrackets) > 0 {
+		group := m.pendingBrackets[0]
+		m.pendingBrackets = m.pendingBrackets[1:]
+
+		legs := m.bracketLegs(group)
+		for _, leg := range legs {
+			group.LegIDs = append(group.LegIDs, leg.ID)
+		}
+		if err := m.openGroup(group, legs, false); err != nil {
+			group.LegIDs = nil
+			m.finishGroup(group, OrderGroupRejected)
+			continue
+		}
+		for _, leg := range legs {
+			m.engine.indexOrder(leg)
+		}
+	}
+}
+
+// bracketLegs monta as saídas do bracket. Os IDs derivam do grupo para que o
+// replay do journal recrie as mesmas ordens.
+func (m *market) bracketLegs(group *OrderGroup) []*Order {
+	now := time.Now()
+	newLeg := func(suffix string, typ OrderType) *Order {
+		return &Order{
+			ID:        uuid.NewSHA1(uuid.NameSpaceOID, []byte(group.ID+":"+suffix)).String(),
+			UserID:    group.UserID,
+			Symbol:    group.Symbol,
+			Side:      group.Side,
+			Type:      typ,
+			Quantity:  group.Quantity,
+			STP:       group.STP,
+			GroupID:   group.ID,
+			Status:    OrderStatusNew,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+	}
+
+	takeProfit := newLeg("take-profit", OrderTypeLimit)
+	takeProfit.Price = group.TakeProfitPrice
+
+	stopLoss := newLeg("stop-loss", OrderTypeStop)
+	stopLoss.StopPrice = group.StopLossPrice
+	if group.StopLossLimitPrice.IsPositive() {
+		stopLoss.Type = OrderTypeStopLimit
+		stopLoss.Price = group.StopLossLimitPrice
+	}
+
+	legs := []*Order{takeProfit, stopLoss}
+	for _, leg := range legs {
+		_ = validateTimeInForce(leg)
+	}
+	return legs
+}
+
+// groupIDs lista os grupos ativos em ordem estável.
+func (m *market) groupIDs() []string {
+	ids := make([]string, 0, len(m.groups))
+	for id := range m.groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
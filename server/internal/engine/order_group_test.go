@@ -0,0 +1,227 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBracketExitsReserveAgainstUnsettledEntry(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry Side
+		// asset e quantidade reservados para as saídas
+		asset    string
+		reserved string
+	}{
+		// compra 2 @ 10: saídas de venda travam a base ainda não liquidada
+		{"buy entry", SideBuy, "AAA", "2"},
+		// venda 2 @ 10: saídas de compra travam 12 * 2 = 24, 20 reservados do
+		// recebível e 4 do disponível
+		{"sell entry", SideSell, "AAA_QUOTE", "20"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			me, repo, balances := newTestEngine(t)
+			fund(balances, "maker", "AAA")
+			// só o necessário para a entrada: nada do ativo que ela recebe
+			if tt.entry == SideBuy {
+				balances.deposit("trader", "AAA_QUOTE", d("20"))
+			} else {
+				balances.deposit("trader", "AAA", d("2"))
+				balances.deposit("trader", "AAA_QUOTE", d("4"))
+			}
+
+			makerSide, tp, sl := SideSell, "12", "8"
+			if tt.entry == SideSell {
+				makerSide, tp, sl = SideBuy, "8", "12"
+			}
+			mustPlace(t, me, limit("maker", "AAA", makerSide, "10", "2"))
+
+			group, err := me.PlaceBracket(NewBracketRequest{
+				Entry:              limit("trader", "AAA", tt.entry, "10", "2"),
+				TakeProfitPrice:    d(tp),
+				StopLossPrice:      d(sl),
+				StopLossLimitPrice: d(sl),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := repo.group(group.ID)
+			if g.Status != OrderGroupActive || len(g.LegIDs) != 2 {
+				t.Fatalf("group %s with %d legs, want ACTIVE with 2", g.Status, len(g.LegIDs))
+			}
+			if got := balances.getReserved("trader", tt.asset); !got.Equal(d(tt.reserved)) {
+				t.Fatalf("reserved %s = %s, want %s", tt.asset, got, tt.reserved)
+			}
+
+			if _, err := me.CancelOrderGroup(group.ID, "trader"); err != nil {
+				t.Fatal(err)
+			}
+			if got := balances.getReserved("trader", tt.asset); !got.IsZero() {
+				t.Fatalf("reserved after cancel = %s, want 0", got)
+			}
+			if _, locked := balances.get("trader", tt.asset); !locked.IsZero() {
+				t.Fatalf("locked after cancel = %s, want 0", locked)
+			}
+		})
+	}
+}
+
+func TestBracketRejectedWhenExitsCannotBeCovered(t *testing.T) {
+	me, repo, balances := newTestEngine(t)
+	fund(balances, "maker", "AAA")
+	balances.deposit("trader", "AAA", d("2"))
+
+	mustPlace(t, me, limit("maker", "AAA", SideBuy, "10", "2"))
+	// saídas de compra a 12 exigem 24 em quote; a venda só rende 20
+	group, err := me.PlaceBracket(NewBracketRequest{
+		Entry:              limit("trader", "AAA", SideSell, "10", "2"),
+		TakeProfitPrice:    d("8"),
+		StopLossPrice:      d("12"),
+		StopLossLimitPrice: d("12"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := repo.group(group.ID).Status; s != OrderGroupRejected {
+		t.Fatalf("group status = %s, want REJECTED", s)
+	}
+	if got := balances.getReserved("trader", "AAA_QUOTE"); !got.IsZero() {
+		t.Fatalf("reservation kept after rejection: %s", got)
+	}
+}
+
+func TestWalletSettlementLocksReservedCredit(t *testing.T) {
+	wallet, mw := newTestWallet()
+	svc := NewWalletBalanceService(wallet, nil, nil)
+	custody := NewWalletCustodyService(wallet, "clearing")
+
+	// a saída do bracket reserva a base antes da liquidação da entrada
+	if err := svc.LockReceivableBase("buyer", "AAA", d("2")); err != nil {
+		t.Fatal(err)
+	}
+	ob := &SettlementObligation{ID: "ob1", UserID: "buyer", Asset: "AAA", Received: d("2"), Net: d("2")}
+	if err := custody.SettleObligation(ob); err != nil {
+		t.Fatal(err)
+	}
+	avail, locked := mw.get("buyer", "AAA")
+	if !avail.IsZero() || !locked.Equal(d("2")) {
+		t.Fatalf("buyer base = %s/%s, want 0 available and 2 locked", avail, locked)
+	}
+
+	if err := svc.ReleaseReceivableBase("buyer", "AAA", d("2")); err != nil {
+		t.Fatal(err)
+	}
+	if avail, locked := mw.get("buyer", "AAA"); !avail.Equal(d("2")) || !locked.IsZero() {
+		t.Fatalf("buyer base after release = %s/%s, want 2/0", avail, locked)
+	}
+}
+
+func TestOCOOpenFailureUnwinds(t *testing.T) {
+	errSave := errors.New("disk full")
+	tests := []struct {
+		name  string
+		setup func(repo *memRepo)
+	}{
+		{"group save fails", func(repo *memRepo) { repo.saveGroupErr = errSave }},
+		{"second leg admit fails", func(repo *memRepo) {
+			n := 0
+			repo.saveOrderErr = func(*Order) error {
+				if n++; n == 2 {
+					return errSave
+				}
+				return nil
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			me, repo, balances := newTestEngine(t)
+			balances.deposit("trader", "AAA", d("2"))
+			tt.setup(repo)
+
+			_, err := me.PlaceOCO(NewOCORequest{
+				UserID:   "trader",
+				Symbol:   "AAA",
+				Side:     SideSell,
+				Quantity: d("2"),
+				Legs: []OCOLeg{
+					{Type: OrderTypeLimit, Price: d("12")},
+					{Type: OrderTypeStop, StopPrice: d("8")},
+				},
+			})
+			if !errors.Is(err, errSave) {
+				t.Fatalf("PlaceOCO err = %v, want %v", err, errSave)
+			}
+			if avail, locked := balances.get("trader", "AAA"); !avail.Equal(d("2")) || !locked.IsZero() {
+				t.Fatalf("trader base = %s/%s, want 2/0", avail, locked)
+			}
+			for _, o := range repo.orders {
+				if o.Status != OrderStatusCanceled {
+					t.Fatalf("leg %s left %s, want CANCELED", o.ID, o.Status)
+				}
+			}
+			for _, g := range repo.groups {
+				if g.Status != OrderGroupRejected {
+					t.Fatalf("persisted group status = %s, want REJECTED", g.Status)
+				}
+			}
+			// o saldo devolvido volta a servir ordens novas
+			mustPlace(t, me, limit("trader", "AAA", SideSell, "12", "2"))
+		})
+	}
+}
+
+func TestBracketRejectedWhenReserveFails(t *testing.T) {
+	me, repo, balances := newTestEngine(t)
+	fund(balances, "maker", "AAA")
+	balances.deposit("trader", "AAA_QUOTE", d("20"))
+	// base livre que cobriria as saídas: mesmo assim o bracket não abre
+	balances.deposit("trader", "AAA", d("2"))
+	balances.reserveErr = errors.New("wallet unavailable")
+
+	mustPlace(t, me, limit("maker", "AAA", SideSell, "10", "2"))
+	group, err := me.PlaceBracket(NewBracketRequest{
+		Entry:           limit("trader", "AAA", SideBuy, "10", "2"),
+		TakeProfitPrice: d("12"),
+		StopLossPrice:   d("8"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := repo.group(group.ID)
+	if g.Status != OrderGroupRejected || len(g.LegIDs) != 0 {
+		t.Fatalf("group %s with %d legs, want REJECTED without exits", g.Status, len(g.LegIDs))
+	}
+	if _, locked := balances.get("trader", "AAA"); !locked.IsZero() {
+		t.Fatalf("locked base = %s, want 0", locked)
+	}
+}
+
+func TestBracketEntryValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry NewOrderRequest
+		want  error
+	}{
+		{"limit without price", NewOrderRequest{Type: OrderTypeLimit, Quantity: d("2")}, ErrInvalidPrice},
+		{"display above quantity", NewOrderRequest{Type: OrderTypeLimit, Price: d("10"), Quantity: d("2"), DisplayQty: d("3")}, ErrInvalidDisplayQty},
+		{"quote qty with quantity", NewOrderRequest{Type: OrderTypeMarket, Quantity: d("2"), QuoteQty: d("20")}, ErrInvalidQuoteQty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			me, _, balances := newTestEngine(t)
+			fund(balances, "trader", "AAA")
+			entry := tt.entry
+			entry.UserID, entry.Symbol, entry.Side = "trader", "AAA", SideBuy
+			_, err := me.PlaceBracket(NewBracketRequest{
+				Entry:           entry,
+				TakeProfitPrice: d("12"),
+				StopLossPrice:   d("8"),
+			})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
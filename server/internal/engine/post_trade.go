@@ -0,0 +1,338 @@
+package engine
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrUnknownCounterparty indica trade cujas ordens não foram encontradas.
+var ErrUnknownCounterparty = errors.New("trade counterparty not found")
+
+// PostTradeStage é uma etapa do pós-trade, executada na ordem de
+// postTradeStages.
+type PostTradeStage string
+
+const (
+	PostTradeStageCounterparty PostTradeStage = "COUNTERPARTY"
+	PostTradeStageClearing     PostTradeStage = "CLEARING"
+	PostTradeStageRisk         PostTradeStage = "RISK"
+)
+
+var postTradeStages = []PostTradeStage{
+	PostTradeStageCounterparty,
+	PostTradeStageClearing,
+	PostTradeStageRisk,
+}
+
+type PostTradeConfig struct {
+	// MaxAttempts é o número de tentativas antes do dead-letter (padrão 5).
+	MaxAttempts int
+	// RetryBackoff é a espera antes da segunda tentativa; dobra a cada falha
+	// (padrão 1s).
+	RetryBackoff time.Duration
+	// QueueSize é a capacidade da fila (padrão 1024). Com a fila cheia,
+	// Submit segura o sequenciador em vez de perder o trade.
+	QueueSize int
+}
+
+// PostTradeFailure é um trade que esgotou as tentativas. Stage é a etapa que
+// falhou (as anteriores já foram aplicadas).
+type PostTradeFailure struct {
+	Trade    *Trade
+	Stage    PostTradeStage
+	Attempts int
+	Error    string
+	FailedAt time.Time
+}
+
+// postTradeJob é um trade em processamento e o quanto dele já foi aplicado.
+type postTradeJob struct {
+	trade    *Trade
+	stage    int // índice em postTradeStages
+	attempts int
+}
+
+// PostTradePipeline leva cada trade lit do MatchingEngine ao clearing e ao
+// risco, nessa ordem. A liquidação na wallet não acontece aqui: é feita uma
+// única vez, no T+N do ClearingEngine (pelo CustodyService), sobre as
+// posições que o clearing acumulou. Uma etapa que falha é retentada com
+// backoff a partir de onde parou; esgotadas as tentativas o trade vai para o
+// dead-letter. Quando orders implementa PostTradeOutbox, o avanço de cada
+// trade é gravado e os pendentes são retomados no Start. clearing, risk e
+// orders são opcionais.
+type PostTradePipeline struct {
+	clearing    *ClearingEngine
+	risk        *RiskEngine
+	orders      OrderLookup
+	outbox      PostTradeOutbox
+	deadLetters PostTradeDeadLetterRepository
+	cfg         PostTradeConfig
+
+	queue    chan *postTradeJob
+	quit     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewPostTradePipeline(clearing *ClearingEngine, risk *RiskEngine, orders OrderLookup, deadLetters PostTradeDeadLetterRepository, cfg PostTradeConfig) *PostTradePipeline {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = time.Second
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	outbox, _ := orders.(PostTradeOutbox)
+	return &PostTradePipeline{
+		clearing:    clearing,
+		risk:        risk,
+		orders:      orders,
+		outbox:      outbox,
+		deadLetters: deadLetters,
+		cfg:         cfg,
+		queue:       make(chan *postTradeJob, cfg.QueueSize),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Start inicia o worker e devolve à fila os trades pendentes do outbox, a
+// partir da etapa gravada. Chame antes de ligar o pipeline ao MatchingEngine.
+func (p *PostTradePipeline) Start() error {
+	go p.run()
+	if p.outbox == nil {
+		return nil
+	}
+	pending, err := p.outbox.ListPendingPostTrades()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		log.Printf("[PostTrade] resuming %d pending trades", len(pending))
+	}
+	for _, pt := range pending {
+		p.enqueue(&postTradeJob{trade: pt.Trade, stage: stageIndex(pt.Stage)})
+	}
+	return nil
+}
+
+// Stop processa o que já está na fila e encerra o worker. Trades que falham a
+// partir daqui (inclusive retentativas agendadas) vão direto para o
+// dead-letter.
+func (p *PostTradePipeline) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.quit)
+		<-p.done
+	})
+}
+
+// Submit enfileira uma cópia do trade.
+func (p *PostTradePipeline) Submit(trade *Trade) {
+	t := *trade
+	p.enqueue(&postTradeJob{trade: &t})
+}
+
+// Redrive devolve à fila um trade do dead-letter, retomando da etapa que
+// falhou, e o remove do repositório.
+func (p *PostTradePipeline) Redrive(f *PostTradeFailure) error {
+	job := &postTradeJob{trade: f.Trade, stage: stageIndex(f.Stage)}
+	if p.outbox != nil {
+		if err := p.outbox.SetPostTradeStage(f.Trade.ID, f.Stage); err != nil {
+			return err
+		}
+	}
+	if p.deadLetters != nil {
+		if err := p.deadLetters.DeleteDeadLetter(f.Trade.ID); err != nil {
+			return err
+		}
+	}
+	p.enqueue(job)
+	return nil
+}
+
+func (p *PostTradePipeline) enqueue(job *postTradeJob) {
+	select {
+	case <-p.quit:
+		p.deadLetter(job, errors.New("post-trade pipeline stopped"))
+		return
+	default:
+	}
+	select {
+	case p.queue <- job:
+	case <-p.quit:
+		p.deadLetter(job, errors.New("post-trade pipeline stopped"))
+	}
+}
+
+func (p *PostTradePipeline) run() {
+	defer close(p.done)
+	for {
+		select {
+		case job := <-p.queue:
+			p.process(job)
+		case <-p.quit:
+			for {
+				select {
+				case job := <-p.queue:
+					p.process(job)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// process avança o job; numa falha agenda a retentativa ou, sem tentativas
+// restantes, grava o dead-letter.
+func (p *PostTradePipeline) process(job *postTradeJob) {
+	err := p.advance(job)
+	if err == nil {
+		return
+	}
+	job.attempts++
+	stage := postTradeStages[job.stage]
+	log.Printf("[PostTrade] trade %s failed at %s (attempt %d/%d): %v", job.trade.ID, stage, job.attempts, p.cfg.MaxAttempts, err)
+
+	if job.attempts >= p.cfg.MaxAttempts {
+		p.deadLetter(job, err)
+		return
+	}
+	select {
+	case <-p.quit:
+		p.deadLetter(job, err)
+		return
+	default:
+	}
+	delay := p.cfg.RetryBackoff << (job.attempts - 1)
+	time.AfterFunc(delay, func() { p.enqueue(job) })
+}
+
+// advance executa as etapas pendentes do job, guardando o progresso de cada
+// uma (no job e no outbox) para que a retentativa, ou o restart, não repita o
+// que já foi aplicado.
+func (p *PostTradePipeline) advance(job *postTradeJob) error {
+	t := job.trade
+	for job.stage < len(postTradeStages) {
+		var err error
+		switch postTradeStages[job.stage] {
+		case PostTradeStageCounterparty:
+			err = p.resolveCounterparties(t)
+		case PostTradeStageClearing:
+			if p.clearing != nil {
+				err = p.clearing.OnTrade(t, t.BuyerID, t.SellerID)
+			}
+		case PostTradeStageRisk:
+			if p.risk != nil {
+				err = p.risk.OnTrade(t, t.BuyerID, t.SellerID)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		job.stage++
+		p.saveStage(job)
+	}
+	return nil
+}
+
+// saveStage grava no outbox a próxima etapa do job ("" quando não há). Uma
+// falha só é registrada: no pior caso o restart repete uma etapa, e o
+// clearing ignora trades já aplicados.
+func (p *PostTradePipeline) saveStage(job *postTradeJob) {
+	if p.outbox == nil {
+		return
+	}
+	var next PostTradeStage
+	if job.stage < len(postTradeStages) {
+		next = postTradeStages[job.stage]
+	}
+	if err := p.outbox.SetPostTradeStage(job.trade.ID, next); err != nil {
+		log.Printf("[PostTrade] failed to save stage of trade %s: %v", job.trade.ID, err)
+	}
+}
+
+// resolveCounterparties preenche comprador e vendedor a partir das ordens
+// quando o trade não os traz.
+func (p *PostTradePipeline) resolveCounterparties(t *Trade) error {
+	if t.BuyerID != "" && t.SellerID != "" {
+		return nil
+	}
+	if p.orders == nil {
+		return ErrUnknownCounterparty
+	}
+	for _, side := range []struct {
+		orderID string
+		userID  *string
+	}{{t.BuyOrder, &t.BuyerID}, {t.SellOrder, &t.SellerID}} {
+		if *side.userID != "" {
+			continue
+		}
+		order, err := p.orders.FindOrder(side.orderID)
+		if err != nil {
+			return err
+		}
+		if order == nil {
+			return ErrUnknownCounterparty
+		}
+		*side.userID = order.UserID
+	}
+	return nil
+}
+
+func (p *PostTradePipeline) deadLetter(job *postTradeJob, cause error) {
+	stage := postTradeStages[min(job.stage, len(postTradeStages)-1)]
+	log.Printf("[PostTrade] trade %s dead-lettered at %s: %v", job.trade.ID, stage, cause)
+	if p.deadLetters == nil {
+		return
+	}
+	f := &PostTradeFailure{
+		Trade:    job.trade,
+		Stage:    stage,
+		Attempts: job.attempts,
+		Error:    cause.Error(),
+		FailedAt: time.Now(),
+	}
+	if err := p.deadLetters.SaveDeadLetter(f); err != nil {
+		log.Printf("[PostTrade] failed to save dead letter for trade %s: %v", job.trade.ID, err)
+		return
+	}
+	// O trade passa a ser do dead-letter; sai do outbox para não ser retomado
+	// no restart.
+	if p.outbox != nil {
+		if err := p.outbox.SetPostTradeStage(job.trade.ID, ""); err != nil {
+			log.Printf("[PostTrade] failed to clear stage of trade %s: %v", job.trade.ID, err)
+		}
+	}
+}
+
+func stageIndex(stage PostTradeStage) int {
+	for i, s := range postTradeStages {
+		if s == stage {
+			return i
+		}
+	}
+	return 0
+}
+
+// SetPostTrade encaminha cada trade executado ao pipeline de pós-trade, depois
+// de cobradas as taxas e gravado o trade. O replay do journal só envia os
+// trades que não estavam no Repository (ver Recover).
+func (me *MatchingEngine) SetPostTrade(p *PostTradePipeline) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.postTrade = p
+}
+
+func (me *MatchingEngine) submitPostTrade(trade *Trade) {
+	me.mu.RLock()
+	p := me.postTrade
+	me.mu.RUnlock()
+	if p != nil {
+		p.Submit(trade)
+	}
+}
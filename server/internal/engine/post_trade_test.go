@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memOutbox é o outbox do pós-trade (e o OrderLookup do pipeline); guarda a
+// etapa pendente de cada trade e o histórico de gravações.
+type memOutbox struct {
+	mu      sync.Mutex
+	orders  map[string]*Order
+	trades  []*Trade
+	stages  map[string]PostTradeStage
+	history map[string][]PostTradeStage
+}
+
+func newMemOutbox() *memOutbox {
+	return &memOutbox{
+		orders:  make(map[string]*Order),
+		stages:  make(map[string]PostTradeStage),
+		history: make(map[string][]PostTradeStage),
+	}
+}
+
+func (o *memOutbox) add(trade *Trade, stage PostTradeStage) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.trades = append(o.trades, trade)
+	o.stages[trade.ID] = stage
+}
+
+func (o *memOutbox) FindOrder(id string) (*Order, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.orders[id], nil
+}
+
+func (o *memOutbox) ListPendingPostTrades() ([]*PendingPostTrade, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var pending []*PendingPostTrade
+	for _, trade := range o.trades {
+		if stage := o.stages[trade.ID]; stage != "" {
+			t := *trade
+			pending = append(pending, &PendingPostTrade{Trade: &t, Stage: stage})
+		}
+	}
+	return pending, nil
+}
+
+func (o *memOutbox) SetPostTradeStage(tradeID string, stage PostTradeStage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stages[tradeID] = stage
+	o.history[tradeID] = append(o.history[tradeID], stage)
+	return nil
+}
+
+func (o *memOutbox) stage(tradeID string) PostTradeStage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.stages[tradeID]
+}
+
+type memDeadLetters struct {
+	mu       sync.Mutex
+	failures map[string]*PostTradeFailure
+}
+
+func newMemDeadLetters() *memDeadLetters {
+	return &memDeadLetters{failures: make(map[string]*PostTradeFailure)}
+}
+
+func (r *memDeadLetters) SaveDeadLetter(f *PostTradeFailure) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures[f.Trade.ID] = f
+	return nil
+}
+
+func (r *memDeadLetters) ListDeadLetters(limit int) ([]*PostTradeFailure, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []*PostTradeFailure
+	for _, f := range r.failures {
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+func (r *memDeadLetters) DeleteDeadLetter(tradeID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.failures, tradeID)
+	return nil
+}
+
+func (r *memDeadLetters) find(tradeID string) *PostTradeFailure {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failures[tradeID]
+}
+
+// waitUntil espera cond valer, já que o pipeline roda no seu próprio worker.
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPostTradeRetryDoesNotReapplyClearing(t *testing.T) {
+	clearingRepo := newMemClearingRepo()
+	// a gravação do clearing acontece, mas a resposta se perde
+	clearingRepo.failAfterApply = errors.New("connection reset")
+	outbox := newMemOutbox()
+	p := NewPostTradePipeline(NewClearingEngine(clearingRepo, nil, nil, nil, ClearingConfig{DefaultQuote: "USD"}), nil, outbox, nil, PostTradeConfig{RetryBackoff: time.Millisecond})
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	trade := &Trade{ID: "t1", Symbol: "AAA", BuyerID: "bob", SellerID: "alice", Price: d("10"), Quantity: d("2"), CreatedAt: time.Now()}
+	outbox.add(trade, PostTradeStageCounterparty)
+	p.Submit(trade)
+	waitUntil(t, "trade t1 to conclude", func() bool { return outbox.stage("t1") == "" })
+
+	positions := clearingRepo.listPositions(func(p ClearingPosition) bool { return p.UserID == "bob" })
+	if len(positions) != 1 || !positions[0].BaseDelta.Equal(d("2")) {
+		t.Fatalf("bob positions = %+v, want a single delta of 2", positions)
+	}
+	outbox.mu.Lock()
+	history := outbox.history["t1"]
+	outbox.mu.Unlock()
+	if want := []PostTradeStage{PostTradeStageClearing, PostTradeStageRisk, ""}; !equalStages(history, want) {
+		t.Fatalf("stage history = %v, want %v", history, want)
+	}
+}
+
+func TestPostTradeResumesPendingOnStart(t *testing.T) {
+	clearingRepo := newMemClearingRepo()
+	outbox := newMemOutbox()
+	outbox.orders["b1"] = &Order{ID: "b1", UserID: "bob"}
+	outbox.orders["s1"] = &Order{ID: "s1", UserID: "alice"}
+	now := time.Now()
+	// t1 caiu antes do pós-trade; t2 já tinha passado do clearing; t3 concluiu
+	outbox.add(&Trade{ID: "t1", Symbol: "AAA", BuyOrder: "b1", SellOrder: "s1", Price: d("10"), Quantity: d("1"), CreatedAt: now}, PostTradeStageCounterparty)
+	outbox.add(&Trade{ID: "t2", Symbol: "AAA", BuyerID: "bob", SellerID: "alice", Price: d("10"), Quantity: d("5"), CreatedAt: now}, PostTradeStageRisk)
+	outbox.add(&Trade{ID: "t3", Symbol: "AAA", BuyerID: "bob", SellerID: "alice", Price: d("10"), Quantity: d("7"), CreatedAt: now}, "")
+
+	p := NewPostTradePipeline(NewClearingEngine(clearingRepo, nil, nil, nil, ClearingConfig{DefaultQuote: "USD"}), nil, outbox, nil, PostTradeConfig{})
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+
+	for _, id := range []string{"t1", "t2", "t3"} {
+		if stage := outbox.stage(id); stage != "" {
+			t.Errorf("trade %s stage = %q after resuming, want concluded", id, stage)
+		}
+	}
+	positions := clearingRepo.listPositions(func(p ClearingPosition) bool { return p.UserID == "bob" })
+	if len(positions) != 1 || !positions[0].BaseDelta.Equal(d("1")) {
+		t.Fatalf("bob positions = %+v, want only t1 (1 AAA)", positions)
+	}
+}
+
+func TestPostTradeDeadLetterAndRedriveUpdateOutbox(t *testing.T) {
+	clearingRepo := newMemClearingRepo()
+	outbox := newMemOutbox()
+	deadLetters := newMemDeadLetters()
+	ce := NewClearingEngine(clearingRepo, nil, nil, nil, ClearingConfig{DefaultQuote: "USD", FeeAccount: "fees"})
+	p := NewPostTradePipeline(ce, nil, outbox, deadLetters, PostTradeConfig{MaxAttempts: 1})
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	// taxa num ativo que não é o quote: o clearing recusa
+	trade := &Trade{ID: "t1", Symbol: "AAA", BuyerID: "bob", SellerID: "alice", Price: d("10"), Quantity: d("1"), BuyerFee: d("0.01"), FeeAsset: "EUR", CreatedAt: time.Now()}
+	outbox.add(trade, PostTradeStageCounterparty)
+	p.Submit(trade)
+	waitUntil(t, "trade t1 to be dead-lettered", func() bool { return deadLetters.find("t1") != nil })
+
+	f := deadLetters.find("t1")
+	if f.Stage != PostTradeStageClearing {
+		t.Fatalf("dead letter stage = %s, want %s", f.Stage, PostTradeStageClearing)
+	}
+	if stage := outbox.stage("t1"); stage != "" {
+		t.Fatalf("outbox stage = %q after dead-lettering, want cleared", stage)
+	}
+
+	f.Trade.FeeAsset = "USD"
+	if err := p.Redrive(f); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, "redriven trade t1 to conclude", func() bool {
+		return len(clearingRepo.listPositions(func(p ClearingPosition) bool { return p.UserID == "fees" })) == 1
+	})
+	waitUntil(t, "trade t1 to leave the outbox", func() bool { return outbox.stage("t1") == "" })
+	if deadLetters.find("t1") != nil {
+		t.Fatal("redriven trade still in the dead letter")
+	}
+	outbox.mu.Lock()
+	history := outbox.history["t1"]
+	outbox.mu.Unlock()
+	want := []PostTradeStage{PostTradeStageClearing, "", PostTradeStageClearing, PostTradeStageRisk, ""}
+	if !equalStages(history, want) {
+		t.Fatalf("stage history = %v, want %v", history, want)
+	}
+}
+
+func equalStages(a, b []PostTradeStage) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,490 @@
+package engine
+
+import (
+	"log"
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
+
+// AttachJournal liga o journal ao engine. Deve ser chamado antes de Recover e
+// antes de qualquer ordem: comandos aceitos sem journal não são recuperáveis.
+func (me *MatchingEngine) AttachJournal(j *FileJournal) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.journal = j
+	me.snapshotEvery = j.cfg.SnapshotEvery
+	for _, m := range me.markets {
+		m.journal = j
+		m.snapshotEvery = j.cfg.SnapshotEvery
+	}
+}
+
+// Checkpoint grava snapshot de todos os símbolos e descarta os segmentos do
+// journal já cobertos por eles.
+func (me *MatchingEngine) Checkpoint() error {
+	if me.journal == nil {
+		return nil
+	}
+
+	var upto uint64
+	first := true
+	for _, symbol := range me.marketSymbols() {
+		if res := me.submit(symbol, command{kind: cmdSnapshot}); res.err != nil {
+			return res.err
+		}
+		lsn := me.getMarket(symbol).snapshotLSN.Load()
+		if lsn == 0 {
+			continue
+		}
+		if first || lsn < upto {
+			upto = lsn
+			first = false
+		}
+	}
+	if first {
+		return nil
+	}
+	return me.journal.Prune(upto)
+}
+
+// Recover reconstrói o estado de todos os símbolos a partir dos snapshots e
+// do journal. Deve rodar antes de o engine receber tráfego. Durante o replay
+// nenhum evento é publicado e só os comandos sem ACK (interrompidos pela
+// queda) movem saldo: os demais já o fizeram antes do crash. O desfecho de
+// cada comando sem ACK é gravado no journal, para que um novo replay não o
+// repita. Os trades recebem o ID, o horário e as taxas gravados no journal;
+// ao final, as ordens tocadas são regravadas no Repository e os trades que
+// não estão nele são gravados e enviados ao pós-trade. Por fim, o status de
+// cada mercado do InstrumentRegistry é aplicado (ver SetInstruments).
+func (me *MatchingEngine) Recover() error {
+	if me.journal == nil {
+		return nil
+	}
+
+	snapshots, err := me.journal.loadSnapshots()
+	if err != nil {
+		return err
+	}
+
+	recovered := make(map[string]*market)
+	marketFor := func(symbol string) *market {
+		if m, ok := recovered[symbol]; ok {
+			return m
+		}
+		m := newMarket(me, symbol)
+		m.beginReplay()
+		recovered[symbol] = m
+		return m
+	}
+
+	for _, snap := range snapshots {
+		marketFor(snap.Symbol).restore(snap)
+	}
+
+	rejected := make(map[uint64]bool)
+	acked := make(map[uint64]bool)
+	trades := make(map[uint64][]*Trade)
+	err = me.journal.Replay(0, func(rec JournalRecord) error {
+		switch rec.Kind {
+		case JournalReject:
+			rejected[rec.RefLSN] = true
+		case JournalAck:
+			acked[rec.RefLSN] = true
+		case JournalTrade:
+			if rec.Trade != nil {
+				trades[rec.RefLSN] = append(trades[rec.RefLSN], rec.Trade)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var outcomes []JournalRecord
+	err = me.journal.Replay(0, func(rec JournalRecord) error {
+		if rec.Kind == JournalReject || rec.Kind == JournalTrade || rec.Kind == JournalAck {
+			return nil
+		}
+		m := marketFor(rec.Symbol)
+		if rec.LSN <= m.snapshotLSN.Load() {
+			return nil
+		}
+		if !rejected[rec.LSN] {
+			if cmd, ok := commandFromRecord(rec); ok {
+				m.journaledTrades = trades[rec.LSN]
+				if acked[rec.LSN] {
+					m.apply(cmd)
+				} else {
+					outcomes = append(outcomes, m.applyUnacked(cmd, rec.LSN))
+				}
+				m.journaledTrades = nil
+			}
+		}
+		m.lastLSN = rec.LSN
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, rec := range outcomes {
+		lsn, err := me.journal.Append(rec)
+		if err != nil {
+			return err
+		}
+		recovered[rec.Symbol].lastLSN = lsn
+	}
+
+	for _, m := range recovered {
+		if err := m.endReplay(); err != nil {
+			return err
+		}
+	}
+
+	me.mu.Lock()
+	for symbol, m := range recovered {
+		me.markets[symbol] = m
+		me.statuses[symbol] = m.status
+		if m.status == MarketStatusAuction {
+			me.auctionEnds[symbol] = m.auctionEnds
+		}
+		for id := range m.orders {
+			me.orderSymbols[id] = symbol
+		}
+		for id := range m.groups {
+			me.groupSymbols[id] = symbol
+		}
+		go m.run(me.quit)
+	}
+	me.recovered = true
+	me.mu.Unlock()
+
+	me.syncInstruments()
+	return nil
+}
+
+// journalRecord traduz o comando para o registro gravado no journal. Comandos
+// que não alteram estado (snapshot) não são gravados.
+func (m *market) journalRecord(cmd command) (JournalRecord, bool) {
+	rec := JournalRecord{Symbol: m.symbol, Time: time.Now()}
+	switch cmd.kind {
+	case cmdPlace:
+		rec.Kind = JournalPlace
+		rec.Order = cmd.order
+	case cmdCancel:
+		rec.Kind = JournalCancel
+		rec.OrderID = cmd.orderID
+		rec.UserID = cmd.userID
+	case cmdAmend:
+		amend := cmd.amend
+		rec.Kind = JournalAmend
+		rec.Amend = &amend
+	case cmdTrigger:
+		rec.Kind = JournalTrigger
+		rec.Price = cmd.price
+	case cmdExpire:
+		rec.Kind = JournalExpire
+		rec.Time = cmd.now
+	case cmdPlaceGroup:
+		rec.Kind = JournalPlaceGroup
+		rec.Group = cmd.group
+		rec.Orders = cmd.legs
+	case cmdCancelGroup:
+		rec.Kind = JournalCancelGroup
+		rec.OrderID = cmd.orderID
+		rec.UserID = cmd.userID
+	case cmdSetStatus:
+		rec.Kind = JournalStatus
+		rec.Status = cmd.status
+		rec.Time = cmd.now
+	case cmdUncross:
+		rec.Kind = JournalUncross
+		rec.Time = cmd.now
+	default:
+		return rec, false
+	}
+	return rec, true
+}
+
+func commandFromRecord(rec JournalRecord) (command, bool) {
+	switch rec.Kind {
+	case JournalPlace:
+		if rec.Order == nil {
+			return command{}, false
+		}
+		return command{kind: cmdPlace, order: rec.Order}, true
+	case JournalCancel:
+		return command{kind: cmdCancel, orderID: rec.OrderID, userID: rec.UserID}, true
+	case JournalAmend:
+		if rec.Amend == nil {
+			return command{}, false
+		}
+		return command{kind: cmdAmend, amend: *rec.Amend}, true
+	case JournalTrigger:
+		return command{kind: cmdTrigger, price: rec.Price}, true
+	case JournalExpire:
+		return command{kind: cmdExpire, now: rec.Time}, true
+	case JournalPlaceGroup:
+		if rec.Group == nil {
+			return command{}, false
+		}
+		return command{kind: cmdPlaceGroup, group: rec.Group, legs: rec.Orders}, true
+	case JournalCancelGroup:
+		return command{kind: cmdCancelGroup, orderID: rec.OrderID, userID: rec.UserID}, true
+	case JournalStatus:
+		return command{kind: cmdSetStatus, status: rec.Status, now: rec.Time}, true
+	case JournalUncross:
+		return command{kind: cmdUncross, now: rec.Time}, true
+	}
+	return command{}, false
+}
+
+// snapshot grava o estado atual do símbolo cobrindo até lastLSN.
+func (m *market) snapshot() error {
+	m.sinceSnapshot = 0
+	if m.journal == nil || m.lastLSN == 0 {
+		return nil
+	}
+
+	snap := &marketSnapshot{Symbol: m.symbol, LSN: m.lastLSN, Seq: m.seq, LastPrice: m.lastPrice, Status: m.status, AuctionEnds: m.auctionEnds}
+	m.book.mu.RLock()
+	for _, ladder := range []*priceLadder{m.book.bids, m.book.asks} {
+		for node := ladder.head.next[0]; node != nil; node = node.next[0] {
+			for o := node.level.head; o != nil; o = o.next {
+				snap.Resting = append(snap.Resting, o.clone())
+			}
+		}
+	}
+	m.book.mu.RUnlock()
+	for _, o := range m.stops.orders() {
+		snap.Stops = append(snap.Stops, o.clone())
+	}
+	for _, id := range m.groupIDs() {
+		snap.Groups = append(snap.Groups, m.groups[id].clone())
+	}
+	for _, o := range m.queued {
+		snap.Queued = append(snap.Queued, o.clone())
+	}
+
+	if err := m.journal.writeSnapshot(snap); err != nil {
+		return err
+	}
+	m.snapshotLSN.Store(snap.LSN)
+	return nil
+}
+
+// restore carrega o snapshot num market recém-criado, antes do replay.
+func (m *market) restore(snap *marketSnapshot) {
+	m.seq = snap.Seq
+	m.lastPrice = snap.LastPrice
+	m.lastLSN = snap.LSN
+	m.snapshotLSN.Store(snap.LSN)
+	for _, o := range snap.Resting {
+		m.book.addOrder(o)
+		m.orders[o.ID] = o
+	}
+	for _, o := range snap.Stops {
+		m.stops.add(o)
+		m.orders[o.ID] = o
+	}
+	for _, g := range snap.Groups {
+		m.groups[g.ID] = g
+	}
+	if snap.Status != "" {
+		m.status = snap.Status
+	}
+	m.auctionEnds = snap.AuctionEnds
+	for _, o := range snap.Queued {
+		m.queued = append(m.queued, o)
+		m.orders[o.ID] = o
+	}
+}
+
+// journalTrade grava o trade logo depois de executado (e cobradas as taxas),
+// antes de ir ao Repository e ao pós-trade. Se a gravação falhar o símbolo
+// para antes de o trade sair do sequenciador: o replay o recria com outro ID
+// e ele é gravado e liquidado uma única vez.
+func (m *market) journalTrade(trade *Trade) error {
+	if m.journal == nil {
+		return nil
+	}
+	t := *trade
+	_, err := m.journal.Append(JournalRecord{
+		Symbol: m.symbol,
+		Kind:   JournalTrade,
+		RefLSN: m.lastLSN,
+		Trade:  &t,
+		Time:   trade.CreatedAt,
+	})
+	return err
+}
+
+// adoptJournaledTrade dá ao trade recriado no replay a identidade do trade
+// original, na ordem em que o comando os executou. Sem registro (crash antes
+// da gravação) o trade nunca chegou ao Repository nem teve taxas cobradas.
+func (m *market) adoptJournaledTrade(trade *Trade) {
+	if len(m.journaledTrades) == 0 {
+		m.repo.(*replayRepository).unjournaled[trade.ID] = true
+		return
+	}
+	orig := m.journaledTrades[0]
+	m.journaledTrades = m.journaledTrades[1:]
+	trade.ID = orig.ID
+	trade.CreatedAt = orig.CreatedAt
+	trade.BuyerFee, trade.SellerFee, trade.FeeAsset = orig.BuyerFee, orig.SellerFee, orig.FeeAsset
+}
+
+// applyUnacked refaz um comando gravado sem ACK nem REJECT: a queda pode ter
+// acontecido antes de ele travar ou liberar saldo, então as travas vão ao
+// BalanceService real. Devolve o registro com o desfecho, a gravar depois do
+// replay.
+func (m *market) applyUnacked(cmd command, lsn uint64) JournalRecord {
+	log.Printf("[Matching] %s: command %d was not acknowledged; reapplying its balance changes", m.symbol, lsn)
+	m.balances = m.engine.balances
+	res := m.apply(cmd)
+	m.balances = replayBalances{}
+
+	kind := JournalAck
+	if res.err != nil {
+		kind = JournalReject
+	}
+	return JournalRecord{Symbol: m.symbol, Kind: kind, RefLSN: lsn, Time: time.Now()}
+}
+
+// beginReplay troca as dependências externas por versões inertes.
+func (m *market) beginReplay() {
+	m.replaying = true
+	m.repo = newReplayRepository()
+	m.balances = replayBalances{}
+	m.events = replayEvents{}
+	m.marketData = nil
+}
+
+// endReplay restaura as dependências reais e regrava no Repository o estado
+// final das ordens tocadas pelo replay.
+func (m *market) endReplay() error {
+	touched := m.repo.(*replayRepository)
+	m.replaying = false
+	m.repo = m.engine.repo
+	m.balances = m.engine.balances
+	m.events = m.engine.events
+	m.marketData = m.engine.marketData
+	m.sinceSnapshot = 0
+
+	for _, id := range touched.order {
+		if err := m.repo.UpdateOrder(touched.orders[id]); err != nil {
+			return err
+		}
+	}
+	for _, id := range touched.group {
+		if err := m.repo.UpdateOrderGroup(touched.groups[id]); err != nil {
+			return err
+		}
+	}
+	for _, trade := range touched.trades {
+		if err := m.reconcileTrade(trade, touched.unjournaled[trade.ID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileTrade grava e envia ao pós-trade um trade do replay que não está
+// no Repository (crash entre a execução e a gravação). Sem TradeLookup não há
+// como saber, e o trade é deixado como está.
+func (m *market) reconcileTrade(trade *Trade, unjournaled bool) error {
+	lookup, ok := m.repo.(TradeLookup)
+	if !ok {
+		return nil
+	}
+	saved, err := lookup.FindTrade(trade.ID)
+	if err != nil {
+		return err
+	}
+	if saved != nil {
+		return nil
+	}
+	if unjournaled {
+		m.engine.assessFees(trade)
+	}
+	if err := m.repo.SaveTrade(trade); err != nil {
+		return err
+	}
+	log.Printf("[Matching] %s: recovered trade %s (seq %d) missing from the repository", m.symbol, trade.ID, trade.Seq)
+	m.engine.submitPostTrade(trade)
+	return nil
+}
+
+// replayRepository registra as ordens e grupos tocados, na ordem do primeiro
+// toque, e os trades recriados.
+type replayRepository struct {
+	orders map[string]*Order
+	order  []string
+	groups map[string]*OrderGroup
+	group  []string
+	trades []*Trade
+	// unjournaled são os trades sem registro TRADE no journal.
+	unjournaled map[string]bool
+}
+
+func newReplayRepository() *replayRepository {
+	return &replayRepository{
+		orders:      make(map[string]*Order),
+		groups:      make(map[string]*OrderGroup),
+		unjournaled: make(map[string]bool),
+	}
+}
+
+func (r *replayRepository) touch(order *Order) error {
+	if _, ok := r.orders[order.ID]; !ok {
+		r.order = append(r.order, order.ID)
+	}
+	r.orders[order.ID] = order
+	return nil
+}
+
+func (r *replayRepository) SaveOrder(order *Order) error   { return r.touch(order) }
+func (r *replayRepository) UpdateOrder(order *Order) error { return r.touch(order) }
+func (r *replayRepository) SaveTrade(trade *Trade, orders ...*Order) error {
+	t := *trade
+	r.trades = append(r.trades, &t)
+	for _, o := range orders {
+		_ = r.touch(o)
+	}
+	return nil
+}
+
+func (r *replayRepository) touchGroup(group *OrderGroup) error {
+	if _, ok := r.groups[group.ID]; !ok {
+		r.group = append(r.group, group.ID)
+	}
+	r.groups[group.ID] = group
+	return nil
+}
+
+func (r *replayRepository) SaveOrderGroup(group *OrderGroup) error   { return r.touchGroup(group) }
+func (r *replayRepository) UpdateOrderGroup(group *OrderGroup) error { return r.touchGroup(group) }
+
+// replayBalances aceita tudo: travas e liberações dos comandos com ACK já
+// foram aplicadas no saldo antes do crash.
+type replayBalances struct{}
+
+func (replayBalances) CanLockBase(string, string, decimal.Decimal) bool   { return true }
+func (replayBalances) CanLockQuote(string, string, decimal.Decimal) bool  { return true }
+func (replayBalances) LockBase(string, string, decimal.Decimal) error     { return nil }
+func (replayBalances) LockQuote(string, string, decimal.Decimal) error    { return nil }
+func (replayBalances) ReleaseBase(string, string, decimal.Decimal) error  { return nil }
+func (replayBalances) ReleaseQuote(string, string, decimal.Decimal) error { return nil }
+
+func (replayBalances) LockReceivableBase(string, string, decimal.Decimal) error     { return nil }
+func (replayBalances) LockReceivableQuote(string, string, decimal.Decimal) error    { return nil }
+func (replayBalances) ReleaseReceivableBase(string, string, decimal.Decimal) error  { return nil }
+func (replayBalances) ReleaseReceivableQuote(string, string, decimal.Decimal) error { return nil }
+
+type replayEvents struct{}
+
+func (replayEvents) PublishOrderBookUpdate(string, OrderBookSnapshot) error { return nil }
+func (replayEvents) PublishTrade(*Trade) error                              { return nil }
+func (replayEvents) PublishOrderEvent(*OrderEvent) error                    { return nil }
+func (replayEvents) PublishOrderUpdate(*Order) error                        { return nil }
@@ -0,0 +1,241 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// recoverInto abre o journal de dir em um engine novo e executa Recover.
+func recoverInto(t *testing.T, dir string) (*MatchingEngine, *memRepo) {
+	t.Helper()
+	j, err := NewFileJournal(JournalConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	me, repo, _ := newTestEngine(t)
+	me.AttachJournal(j)
+	if err := me.Recover(); err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	return me, repo
+}
+
+func TestRecoverReplaysJournal(t *testing.T) {
+	tests := []struct {
+		name       string
+		checkpoint bool
+	}{
+		{"journal only", false},
+		{"snapshot plus tail", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			j, err := NewFileJournal(JournalConfig{Dir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			me, _, balances := newTestEngine(t)
+			me.AttachJournal(j)
+			for _, u := range []string{"alice", "bob"} {
+				fund(balances, u, "AAA")
+				fund(balances, u, "BBB")
+			}
+
+			mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "5"))
+			mustPlace(t, me, limit("alice", "AAA", SideSell, "11", "5"))
+			if tt.checkpoint {
+				if err := me.Checkpoint(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			mustPlace(t, me, limit("bob", "AAA", SideBuy, "10", "2"))
+			canceled := mustPlace(t, me, limit("bob", "AAA", SideBuy, "9", "1"))
+			if _, err := me.CancelOrder(canceled.ID, "bob"); err != nil {
+				t.Fatal(err)
+			}
+			resting := mustPlace(t, me, limit("bob", "BBB", SideBuy, "3", "4"))
+
+			want := map[string]OrderBookSnapshot{
+				"AAA": me.GetOrderBookSnapshot("AAA", 10),
+				"BBB": me.GetOrderBookSnapshot("BBB", 10),
+			}
+			me.Stop()
+			j.Close()
+
+			recovered, repo := recoverInto(t, dir)
+			for symbol, snap := range want {
+				if got := recovered.GetOrderBookSnapshot(symbol, 10); !reflect.DeepEqual(got, snap) {
+					t.Errorf("%s book after recovery = %+v, want %+v", symbol, got, snap)
+				}
+			}
+			if got := repo.order(resting.ID); got == nil || got.Status != OrderStatusNew {
+				t.Errorf("resting order was not rewritten to the repository: %+v", got)
+			}
+			if _, err := recovered.CancelOrder(resting.ID, "bob"); err != nil {
+				t.Errorf("recovered order cannot be canceled: %v", err)
+			}
+		})
+	}
+}
+
+func TestRecoverKeepsTradeIDsAndReconcilesRepository(t *testing.T) {
+	dir := t.TempDir()
+	j, err := NewFileJournal(JournalConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	me, live, balances := newTestEngine(t)
+	me.AttachJournal(j)
+	fund(balances, "alice", "AAA")
+	fund(balances, "bob", "AAA")
+
+	mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "5"))
+	mustPlace(t, me, limit("bob", "AAA", SideBuy, "10", "2"))
+	mustPlace(t, me, limit("bob", "AAA", SideBuy, "10", "1"))
+	trades := live.tradeList()
+	if len(trades) != 2 {
+		t.Fatalf("trades = %d, want 2", len(trades))
+	}
+	me.Stop()
+	j.Close()
+
+	// crash depois de gravar o primeiro trade e antes do segundo
+	j, err = NewFileJournal(JournalConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	recovered, repo, _ := newTestEngine(t)
+	_ = repo.SaveTrade(trades[0])
+	clearingRepo := newMemClearingRepo()
+	pipeline := NewPostTradePipeline(NewClearingEngine(clearingRepo, nil, nil, nil, ClearingConfig{DefaultQuote: "USD"}), nil, nil, nil, PostTradeConfig{})
+	if err := pipeline.Start(); err != nil {
+		t.Fatal(err)
+	}
+	recovered.SetPostTrade(pipeline)
+	recovered.AttachJournal(j)
+	if err := recovered.Recover(); err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	pipeline.Stop()
+
+	got := repo.tradeList()
+	if len(got) != 2 {
+		t.Fatalf("repository has %d trades after recovery, want 2", len(got))
+	}
+	for i, trade := range trades {
+		if got[i].ID != trade.ID || !got[i].CreatedAt.Equal(trade.CreatedAt) {
+			t.Errorf("trade %d = %s at %s, want %s at %s", i, got[i].ID, got[i].CreatedAt, trade.ID, trade.CreatedAt)
+		}
+	}
+
+	// só o trade que faltava chega ao pós-trade
+	positions := clearingRepo.listPositions(func(p ClearingPosition) bool { return p.UserID == "bob" })
+	if len(positions) != 1 || !positions[0].BaseDelta.Equal(trades[1].Quantity) {
+		t.Fatalf("bob clearing positions = %+v, want a single delta of %s", positions, trades[1].Quantity)
+	}
+}
+
+func TestJournalTradeFailureHaltsSymbol(t *testing.T) {
+	dir := t.TempDir()
+	j, err := NewFileJournal(JournalConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	me, repo, balances := newTestEngine(t)
+	me.AttachJournal(j)
+	fund(balances, "alice", "AAA")
+	fund(balances, "bob", "AAA")
+	mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "5"))
+
+	// o PLACE da compra já está no journal; o TRADE não consegue ser gravado
+	repo.onSave = func(order *Order) {
+		if order.UserID == "bob" {
+			j.file.Close()
+		}
+	}
+	if _, err := me.PlaceOrder(limit("bob", "AAA", SideBuy, "10", "2")); !errors.Is(err, ErrMarketFaulted) {
+		t.Fatalf("PlaceOrder error = %v, want ErrMarketFaulted", err)
+	}
+	repo.onSave = nil
+	if n := repo.tradeCount(); n != 0 {
+		t.Fatalf("trade reached the repository without a journal record: %d trades", n)
+	}
+	if _, err := me.PlaceOrder(limit("alice", "AAA", SideSell, "11", "1")); !errors.Is(err, ErrMarketFaulted) {
+		t.Fatalf("command after the failure error = %v, want ErrMarketFaulted", err)
+	}
+	me.Stop()
+
+	// no replay o trade é recriado uma única vez e a compra, sem ACK, trava
+	// o saldo de novo
+	j2, err := NewFileJournal(JournalConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j2.Close()
+	recovered, repo2, balances2 := newTestEngine(t)
+	fund(balances2, "bob", "AAA")
+	recovered.AttachJournal(j2)
+	if err := recovered.Recover(); err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	if n := repo2.tradeCount(); n != 1 {
+		t.Fatalf("trades after recovery = %d, want 1", n)
+	}
+	if _, locked := balances2.get("alice", "AAA"); !locked.IsZero() {
+		t.Errorf("acknowledged sell locked %s again", locked)
+	}
+	if _, locked := balances2.get("bob", "AAA_QUOTE"); !locked.Equal(d("20")) {
+		t.Errorf("bob quote locked %s, want 20 for the unacknowledged buy", locked)
+	}
+}
+
+func TestRecoverRelocksOnlyUnacknowledgedCommands(t *testing.T) {
+	dir := t.TempDir()
+	j, err := NewFileJournal(JournalConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	me, _, balances := newTestEngine(t)
+	me.AttachJournal(j)
+	fund(balances, "alice", "AAA")
+	mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "5"))
+	me.Stop()
+
+	// queda logo depois de gravar o PLACE, antes de travar o saldo
+	bid := &Order{
+		ID: "bob-bid", UserID: "bob", Symbol: "AAA", Side: SideBuy, Type: OrderTypeLimit,
+		Price: d("9"), Quantity: d("1"), TimeInForce: TimeInForceGTC, Status: OrderStatusNew,
+	}
+	if _, err := j.Append(JournalRecord{Symbol: "AAA", Kind: JournalPlace, Order: bid}); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	for round, wantLocked := range []string{"9", "0"} {
+		j, err := NewFileJournal(JournalConfig{Dir: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		recovered, _, balances := newTestEngine(t)
+		fund(balances, "bob", "AAA")
+		recovered.AttachJournal(j)
+		if err := recovered.Recover(); err != nil {
+			t.Fatalf("round %d: Recover: %v", round, err)
+		}
+		if _, locked := balances.get("alice", "AAA"); !locked.IsZero() {
+			t.Errorf("round %d: acknowledged sell locked %s again", round, locked)
+		}
+		if _, locked := balances.get("bob", "AAA_QUOTE"); !locked.Equal(d(wantLocked)) {
+			t.Errorf("round %d: bob quote locked %s, want %s", round, locked, wantLocked)
+		}
+		if snap := recovered.GetOrderBookSnapshot("AAA", 5); len(snap.Bids) != 1 {
+			t.Errorf("round %d: bids = %+v, want the recovered bid", round, snap.Bids)
+		}
+		recovered.Stop()
+		j.Close()
+	}
+}
@@ -2,9 +2,10 @@ package engine
 
 import (
 	"errors"
-	"math"
 	"time"
 
+	"hearcap/server/internal/decimal"
+
 	"github.com/google/uuid"
 )
 
@@ -49,12 +50,12 @@ func (re *RiskEngine) ValidateNewOrder(userID string, order *Order) error {
 	return nil
 }
 
-func (re *RiskEngine) checkPriceBand(symbol string, price float64) error {
+func (re *RiskEngine) checkPriceBand(symbol string, price decimal.Decimal) error {
 	ref, err := re.priceFeed.GetLastPrice(symbol)
-	if err != nil || ref <= 0 {
+	if err != nil || !ref.IsPositive() {
 		return nil
 	}
-	diff := math.Abs(price-ref) / ref * 100
+	diff := price.Sub(ref).Abs().QuoFloat(ref) * 100
 	if diff > re.cfg.MaxPriceDeviationPercent {
 		return errors.New("order price outside allowed band")
 	}
@@ -64,12 +65,12 @@ func (re *RiskEngine) checkPriceBand(symbol string, price float64) error {
 func (re *RiskEngine) checkMaxNotionalPerOrder(order *Order) error {
 	refPrice := order.Price
 	if order.Type == OrderTypeMarket {
-		if last, err := re.priceFeed.GetLastPrice(order.Symbol); err == nil && last > 0 {
+		if last, err := re.priceFeed.GetLastPrice(order.Symbol); err == nil && last.IsPositive() {
 			refPrice = last
 		}
 	}
-	notional := refPrice * order.Quantity
-	if notional > re.cfg.MaxNotionalPerOrder {
+	notional := refPrice.Mul(order.Quantity)
+	if notional.GreaterThan(re.cfg.MaxNotionalPerOrder) {
 		return errors.New("order notional exceeds limit")
 	}
 	return nil
@@ -82,15 +83,15 @@ func (re *RiskEngine) checkMarginPreTrade(userID string, order *Order) error {
 	}
 	refPrice := order.Price
 	if order.Type == OrderTypeMarket {
-		if last, err := re.priceFeed.GetLastPrice(order.Symbol); err == nil && last > 0 {
+		if last, err := re.priceFeed.GetLastPrice(order.Symbol); err == nil && last.IsPositive() {
 			refPrice = last
 		}
 	}
-	orderNotional := refPrice * order.Quantity
-	additionalMargin := orderNotional / re.cfg.MaxLeverage
-	postUsed := acc.UsedMargin + additionalMargin
-	requiredEquity := postUsed * re.cfg.MaintenanceMarginReq
-	if acc.Equity < requiredEquity {
+	orderNotional := refPrice.Mul(order.Quantity)
+	additionalMargin := orderNotional.MulFloat(1 / re.cfg.MaxLeverage)
+	postUsed := acc.UsedMargin.Add(additionalMargin)
+	requiredEquity := postUsed.MulFloat(re.cfg.MaintenanceMarginReq)
+	if acc.Equity.LessThan(requiredEquity) {
 		return errors.New("insufficient margin for this order")
 	}
 	return nil
@@ -101,7 +102,7 @@ func (re *RiskEngine) ensureMarginAccount(userID string) (*MarginAccount, error)
 	if acc == nil || err != nil {
 		acc = &MarginAccount{
 			UserID:    userID,
-			Equity:    0,
+			Equity:    decimal.Zero,
 			UpdatedAt: time.Now(),
 		}
 		if err := re.marginRepo.SaveMarginAccount(acc); err != nil {
@@ -127,15 +128,15 @@ func (re *RiskEngine) OnTrade(trade *Trade, buyUserID, sellUserID string) error
 	return nil
 }
 
-func (re *RiskEngine) applyTradeToPosition(userID, symbol string, qty, price float64, side Side) error {
+func (re *RiskEngine) applyTradeToPosition(userID, symbol string, qty, price decimal.Decimal, side Side) error {
 	pos, err := re.posRepo.GetPosition(userID, symbol)
 	if err != nil || pos == nil {
 		pos = &Position{
 			ID:        uuid.NewString(),
 			UserID:    userID,
 			Symbol:    symbol,
-			Quantity:  0,
-			AvgPrice:  0,
+			Quantity:  decimal.Zero,
+			AvgPrice:  decimal.Zero,
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
 		}
@@ -145,18 +146,18 @@ func (re *RiskEngine) applyTradeToPosition(userID, symbol string, qty, price flo
 	}
 
 	if side == SideBuy {
-		totalCost := pos.AvgPrice*pos.Quantity + price*qty
-		newQty := pos.Quantity + qty
-		if newQty != 0 {
-			pos.AvgPrice = totalCost / newQty
+		totalCost := pos.AvgPrice.Mul(pos.Quantity).Add(price.Mul(qty))
+		newQty := pos.Quantity.Add(qty)
+		if !newQty.IsZero() {
+			pos.AvgPrice = totalCost.Div(newQty)
 		} else {
-			pos.AvgPrice = 0
+			pos.AvgPrice = decimal.Zero
 		}
 		pos.Quantity = newQty
 	} else {
-		pos.Quantity -= qty
-		if pos.Quantity == 0 {
-			pos.AvgPrice = 0
+		pos.Quantity = pos.Quantity.Sub(qty)
+		if pos.Quantity.IsZero() {
+			pos.AvgPrice = decimal.Zero
 		}
 	}
 	pos.UpdatedAt = time.Now()
@@ -173,25 +174,25 @@ func (re *RiskEngine) recalcMarginForUser(userID string) error {
 		return err
 	}
 
-	var equity float64
+	var equity decimal.Decimal
 	for _, pos := range posList {
-		if pos.Quantity == 0 {
+		if pos.Quantity.IsZero() {
 			continue
 		}
 		mark, err := re.priceFeed.GetLastPrice(pos.Symbol)
-		if err != nil || mark <= 0 {
+		if err != nil || !mark.IsPositive() {
 			continue
 		}
-		pnl := (mark - pos.AvgPrice) * pos.Quantity
-		equity += pnl
+		pnl := mark.Sub(pos.AvgPrice).Mul(pos.Quantity)
+		equity = equity.Add(pnl)
 	}
 
 	acc.Equity = equity
 	acc.UpdatedAt = time.Now()
-	if acc.UsedMargin > 0 {
-		required := acc.UsedMargin * re.cfg.MaintenanceMarginReq
+	if acc.UsedMargin.IsPositive() {
+		required := acc.UsedMargin.MulFloat(re.cfg.MaintenanceMarginReq)
 		acc.MaintenanceReq = required
-		if acc.Equity < required {
+		if acc.Equity.LessThan(required) {
 			re.logAndNotify(userID, "", "MARGIN_CALL", "equity below maintenance requirement")
 		}
 	}
@@ -205,6 +206,6 @@ func (re *RiskEngine) logAndNotify(userID, symbol, eventType, msg string) {
 		_ = re.riskRepo.LogRiskEvent(userID, symbol, eventType, msg, now)
 	}
 	if re.notifier != nil {
-		_ = re.notifier.NotifyRiskEvent(userID, symbol, msg)
+		_ = re.notifier.NotifyRiskEvent(userID, symbol, eventType, msg)
 	}
 }
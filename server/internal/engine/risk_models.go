@@ -1,37 +1,46 @@
 package engine
 
-import "time"
+import (
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
 
 type MarketStatus string
 
 const (
-	MarketStatusOpen   MarketStatus = "OPEN"
-	MarketStatusHalted MarketStatus = "HALTED"
+	MarketStatusOpen      MarketStatus = "OPEN"
+	MarketStatusHalted    MarketStatus = "HALTED"
+	MarketStatusSuspended MarketStatus = "SUSPENDED"
+	MarketStatusDelisted  MarketStatus = "DELISTED"
+	// MarketStatusAuction: leilão de abertura/reabertura, ordens acumulam sem
+	// executar até o uncross.
+	MarketStatusAuction MarketStatus = "AUCTION"
 )
 
 type Position struct {
 	ID        string
 	UserID    string
 	Symbol    string
-	Quantity  float64
-	AvgPrice  float64
+	Quantity  decimal.Decimal
+	AvgPrice  decimal.Decimal
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
 type MarginAccount struct {
 	UserID          string
-	Equity          float64
-	UsedMargin      float64
-	MaintenanceReq  float64
+	Equity          decimal.Decimal
+	UsedMargin      decimal.Decimal
+	MaintenanceReq  decimal.Decimal
 	MarginCallLevel float64
 	UpdatedAt       time.Time
 }
 
 type RiskConfig struct {
 	MaxPriceDeviationPercent float64
-	MaxNotionalPerOrder      float64
-	MaxDailyNotional         float64
+	MaxNotionalPerOrder      decimal.Decimal
+	MaxDailyNotional         decimal.Decimal
 	MaxLeverage              float64
 	MaintenanceMarginReq     float64
 
@@ -42,6 +51,6 @@ type RiskConfig struct {
 
 type PriceTick struct {
 	Symbol    string
-	Price     float64
+	Price     decimal.Decimal
 	Timestamp time.Time
 }
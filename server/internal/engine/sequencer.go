@@ -0,0 +1,284 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
+
+var (
+	ErrEngineStopped = errors.New("matching engine stopped")
+	// ErrCommandAborted indica comando interrompido por um pânico no
+	// sequenciador; o símbolo segue atendendo os próximos comandos.
+	ErrCommandAborted = errors.New("matching command aborted by internal error")
+	// ErrMarketFaulted indica símbolo parado por falha de gravação no meio de
+	// um comando; só um reinício (com replay do journal) o reabre.
+	ErrMarketFaulted = errors.New("market stopped after a persistence failure")
+)
+
+type commandKind int
+
+const (
+	cmdPlace commandKind = iota
+	cmdCancel
+	cmdAmend
+	cmdTrigger
+	cmdExpire
+	cmdSnapshot
+	cmdPlaceGroup
+	cmdCancelGroup
+	cmdSetStatus
+	cmdUncross
+)
+
+// command é a unidade de trabalho consumida pelo sequenciador de um símbolo.
+type command struct {
+	kind    commandKind
+	order   *Order
+	orderID string
+	userID  string
+	amend   AmendOrderRequest
+	price   decimal.Decimal
+	now     time.Time
+	group   *OrderGroup
+	legs    []*Order
+	status  MarketStatus
+
+	reply chan commandResult
+}
+
+type commandResult struct {
+	order *Order
+	group *OrderGroup
+	count int
+	err   error
+}
+
+// market concentra o estado mutável de um símbolo (book, ordens ativas, STOPs
+// pendentes e contador de sequência). Só a goroutine do sequenciador toca
+// nesse estado; o resto do sistema conversa com ela pelo canal cmds.
+type market struct {
+	engine *MatchingEngine
+	symbol string
+	book   *OrderBook
+
+	repo       Repository
+	balances   BalanceService
+	events     EventBus
+	marketData *MarketDataEngine
+
+	orders map[string]*Order
+	stops  *stopBook
+	seq    uint64
+
+	// status controla a entrada de ordens; queued guarda, em ordem de
+	// chegada, as ordens aceitas durante um halt (HaltQueue); auctionEnds é o
+	// fim do leilão em curso.
+	status      MarketStatus
+	queued      []*Order
+	auctionEnds time.Time
+
+	// lastPrice é o último preço negociado; printed marca que o comando em
+	// execução gerou trades (entre printLow e printHigh) e as ordens
+	// condicionais precisam ser reavaliadas.
+	lastPrice decimal.Decimal
+	printed   bool
+	printHigh decimal.Decimal
+	printLow  decimal.Decimal
+
+	// grupos OCO/bracket ativos; brackets com entrada encerrada aguardam a
+	// abertura das saídas no fim do comando
+	groups          map[string]*OrderGroup
+	pendingBrackets []*OrderGroup
+
+	journal       *FileJournal
+	snapshotEvery int
+	sinceSnapshot int
+	lastLSN       uint64
+	snapshotLSN   atomic.Uint64
+	replaying     bool
+	// journaledTrades são os trades gravados pelo comando em replay, ainda
+	// não recriados.
+	journaledTrades []*Trade
+
+	// fault é a falha de gravação que parou o símbolo; com ela definida todo
+	// comando é recusado.
+	fault error
+
+	cmds chan command
+}
+
+const commandBuffer = 1024
+
+func newMarket(me *MatchingEngine, symbol string) *market {
+	return &market{
+		engine:        me,
+		symbol:        symbol,
+		book:          NewOrderBook(symbol),
+		repo:          me.repo,
+		balances:      me.balances,
+		events:        me.events,
+		marketData:    me.marketData,
+		orders:        make(map[string]*Order),
+		stops:         newStopBook(),
+		status:        MarketStatusOpen,
+		groups:        make(map[string]*OrderGroup),
+		journal:       me.journal,
+		snapshotEvery: me.snapshotEvery,
+		cmds:          make(chan command, commandBuffer),
+	}
+}
+
+func (m *market) run(quit <-chan struct{}) {
+	for {
+		select {
+		case cmd := <-m.cmds:
+			cmd.reply <- m.apply(cmd)
+		case <-quit:
+			return
+		}
+	}
+}
+
+// apply grava o comando no journal (quando houver) antes de executá-lo; se a
+// execução falhar, um registro REJECT impede que o replay o reaplique, e se
+// terminar, um ACK indica ao replay que o saldo já foi movido. Sem ACK nem
+// REJECT (queda no meio do comando) o replay refaz as travas (ver Recover).
+func (m *market) apply(cmd command) commandResult {
+	if m.fault != nil {
+		return commandResult{err: m.faultError()}
+	}
+	rec, durable := m.journalRecord(cmd)
+	live := durable && m.journal != nil && !m.replaying
+	if live {
+		lsn, err := m.journal.Append(rec)
+		if err != nil {
+			return commandResult{err: err}
+		}
+		m.lastLSN = lsn
+	}
+
+	res := m.execute(cmd)
+	if m.fault != nil {
+		// o comando fez efeito em parte: sem REJECT, o replay o refaz inteiro
+		return commandResult{err: m.faultError()}
+	}
+
+	if live {
+		kind := JournalAck
+		if res.err != nil {
+			kind = JournalReject
+		}
+		lsn, err := m.journal.Append(JournalRecord{
+			Symbol: m.symbol,
+			Kind:   kind,
+			RefLSN: m.lastLSN,
+			Time:   time.Now(),
+		})
+		if err != nil {
+			// o comando vale, mas o replay não saberia que o saldo já foi movido
+			m.halt(fmt.Errorf("journal %s of command %d: %w", kind, m.lastLSN, err))
+			return res
+		}
+		m.lastLSN = lsn
+		m.sinceSnapshot++
+		if m.snapshotEvery > 0 && m.sinceSnapshot >= m.snapshotEvery {
+			_ = m.snapshot()
+		}
+	}
+	return res
+}
+
+// halt para o símbolo depois de uma falha de gravação no meio de um comando.
+// O estado em memória pode estar à frente do Repository; o matching em curso
+// é interrompido e os próximos comandos são recusados.
+func (m *market) halt(err error) {
+	if m.fault != nil {
+		return
+	}
+	m.fault = err
+	log.Printf("[Matching] %s: halted: %v", m.symbol, err)
+}
+
+func (m *market) faultError() error {
+	return fmt.Errorf("%w: %v", ErrMarketFaulted, m.fault)
+}
+
+// execute isola o comando: um pânico vira ErrCommandAborted (e, via apply,
+// um REJECT no journal) em vez de derrubar o processo com todos os símbolos.
+// O que o comando alterou antes do pânico não é desfeito.
+func (m *market) execute(cmd command) (res commandResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[Matching] %s: command %d aborted: %v\n%s", m.symbol, cmd.kind, r, debug.Stack())
+			m.pendingBrackets = nil
+			m.printed = false
+			res = commandResult{err: fmt.Errorf("%w: %v", ErrCommandAborted, r)}
+		}
+	}()
+	res = m.dispatch(cmd)
+	m.openBracketExits()
+	return res
+}
+
+func (m *market) dispatch(cmd command) commandResult {
+	switch cmd.kind {
+	case cmdPlace:
+		err := m.place(cmd.order)
+		return commandResult{order: cmd.order.clone(), err: err}
+	case cmdCancel:
+		order, err := m.cancel(cmd.orderID, cmd.userID)
+		return commandResult{order: order, err: err}
+	case cmdAmend:
+		order, err := m.amendOrder(cmd.amend)
+		return commandResult{order: order, err: err}
+	case cmdTrigger:
+		return commandResult{count: m.triggerStops(cmd.price)}
+	case cmdExpire:
+		return commandResult{count: m.expire(cmd.now)}
+	case cmdSnapshot:
+		return commandResult{err: m.snapshot()}
+	case cmdPlaceGroup:
+		err := m.placeGroup(cmd.group, cmd.legs)
+		return commandResult{group: cmd.group.clone(), err: err}
+	case cmdCancelGroup:
+		group, err := m.cancelGroup(cmd.orderID, cmd.userID)
+		return commandResult{group: group, err: err}
+	case cmdSetStatus:
+		return commandResult{err: m.setStatus(cmd.status, cmd.now)}
+	case cmdUncross:
+		return commandResult{count: m.uncrossDue(cmd.now)}
+	}
+	return commandResult{err: errors.New("unknown command")}
+}
+
+// nextSeq devolve o próximo número de sequência do símbolo; todo evento
+// produzido pelo sequenciador (ordem, trade, snapshot) recebe um.
+func (m *market) nextSeq() uint64 {
+	m.seq++
+	return m.seq
+}
+
+// submit enfileira o comando no sequenciador do símbolo e aguarda o resultado.
+func (me *MatchingEngine) submit(symbol string, cmd command) commandResult {
+	m := me.getMarket(symbol)
+	cmd.reply = make(chan commandResult, 1)
+
+	select {
+	case m.cmds <- cmd:
+	case <-me.quit:
+		return commandResult{err: ErrEngineStopped}
+	}
+
+	select {
+	case res := <-cmd.reply:
+		return res
+	case <-me.quit:
+		return commandResult{err: ErrEngineStopped}
+	}
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSequencerIsolatesPanickingCommand(t *testing.T) {
+	me, repo, balances := newTestEngine(t)
+	j, err := NewFileJournal(JournalConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	me.AttachJournal(j)
+
+	for _, u := range []string{"boom", "alice", "bob"} {
+		fund(balances, u, "AAA")
+		fund(balances, u, "BBB")
+	}
+	repo.onSave = func(order *Order) {
+		if order.UserID == "boom" {
+			panic("repository exploded")
+		}
+	}
+
+	_, err = me.PlaceOrder(limit("boom", "AAA", SideBuy, "10", "1"))
+	if !errors.Is(err, ErrCommandAborted) {
+		t.Fatalf("PlaceOrder err = %v, want ErrCommandAborted", err)
+	}
+
+	// o mesmo símbolo e os demais seguem atendendo
+	mustPlace(t, me, limit("alice", "AAA", SideSell, "10", "1"))
+	mustPlace(t, me, limit("bob", "AAA", SideBuy, "10", "1"))
+	mustPlace(t, me, limit("alice", "BBB", SideBuy, "5", "1"))
+	if n := repo.tradeCount(); n != 1 {
+		t.Fatalf("trades = %d, want 1", n)
+	}
+
+	var placeLSN uint64
+	rejected := false
+	err = j.Replay(0, func(rec JournalRecord) error {
+		switch {
+		case rec.Kind == JournalPlace && rec.Order.UserID == "boom":
+			placeLSN = rec.LSN
+		case rec.Kind == JournalReject && rec.RefLSN == placeLSN:
+			rejected = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if placeLSN == 0 || !rejected {
+		t.Fatalf("aborted PLACE (lsn %d) was not followed by a REJECT", placeLSN)
+	}
+}
+
+func TestSequencerRejectsOversizedOrderBeforeJournal(t *testing.T) {
+	me, _, balances := newTestEngine(t)
+	j, err := NewFileJournal(JournalConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	me.AttachJournal(j)
+	fund(balances, "alice", "AAA")
+
+	_, err = me.PlaceOrder(limit("alice", "AAA", SideBuy, "1000000", "1000000"))
+	if !errors.Is(err, ErrOrderTooLarge) {
+		t.Fatalf("PlaceOrder err = %v, want ErrOrderTooLarge", err)
+	}
+	records := 0
+	_ = j.Replay(0, func(JournalRecord) error { records++; return nil })
+	if records != 0 {
+		t.Fatalf("journal has %d records, want 0", records)
+	}
+	mustPlace(t, me, limit("alice", "AAA", SideBuy, "10", "1"))
+}
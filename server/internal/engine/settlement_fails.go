@@ -0,0 +1,228 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
+
+// ErrNoReferencePrice indica ativo sem preço para valorar multa ou buy-in.
+var ErrNoReferencePrice = errors.New("no reference price for asset")
+
+// FailsConfig é a política para obrigações que não liquidam no ciclo.
+type FailsConfig struct {
+	// RetryBackoff é a espera antes da primeira retentativa; dobra a cada
+	// falha (padrão 1h).
+	RetryBackoff time.Duration
+	// MaxRetries limita as retentativas automáticas (padrão 10); depois o
+	// fail só envelhece até o buy-in.
+	MaxRetries int
+	// BuyInAfter é a idade do fail de entrega a partir da qual a clearing
+	// executa o buy-in (padrão 4 dias; negativo desliga).
+	BuyInAfter time.Duration
+	// BuyInPremium é o acréscimo sobre o último preço cobrado no buy-in
+	// (0.05 = 5%).
+	BuyInPremium decimal.Decimal
+	// PenaltyRate é a multa por dia de fail sobre o valor em aberto
+	// (0.001 = 0,1% ao dia); zero desliga.
+	PenaltyRate decimal.Decimal
+}
+
+func (c FailsConfig) withDefaults() FailsConfig {
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = time.Hour
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = 10
+	}
+	if c.BuyInAfter == 0 {
+		c.BuyInAfter = 4 * 24 * time.Hour
+	}
+	return c
+}
+
+// SetPriceFeed define a fonte do preço usado para valorar multas e buy-ins
+// (ex.: MarketDataEngine).
+func (ce *ClearingEngine) SetPriceFeed(prices PriceFeed) {
+	ce.prices = prices
+}
+
+// attemptObligation tenta liquidar ob; numa falha registra o fail e agenda a
+// retentativa. Devolve se a obrigação ficou quitada.
+func (ce *ClearingEngine) attemptObligation(ob *SettlementObligation, now time.Time) bool {
+	if err := ce.settleObligation(ob); err != nil {
+		ce.recordFail(ob, err, now)
+		return false
+	}
+	ob.Status = SettlementStatusSettled
+	ob.NextAttemptAt = nil
+	return true
+}
+
+func (ce *ClearingEngine) recordFail(ob *SettlementObligation, cause error, now time.Time) {
+	msg := cause.Error()
+	ob.ErrorMessage = &msg
+	ob.Attempts++
+	ob.Status = SettlementStatusFailed
+	if ob.Settled.IsPositive() {
+		ob.Status = SettlementStatusPartial
+	}
+	if ob.FailedSince == nil {
+		since := now
+		ob.FailedSince = &since
+		ob.PenaltyUntil = &since
+	}
+	next := now.Add(ce.config.Fails.RetryBackoff << min(ob.Attempts-1, 16))
+	ob.NextAttemptAt = &next
+}
+
+// RunFails trata as obrigações em fail: cobra as multas dos dias vencidos,
+// retenta as que passaram do backoff e, com o fail mais velho que BuyInAfter,
+// executa o buy-in. Os lotes afetados têm o status recalculado.
+func (ce *ClearingEngine) RunFails(ctx context.Context, now time.Time) error {
+	obligations, err := ce.repo.ListOpenObligations()
+	if err != nil {
+		return err
+	}
+
+	batches := make(map[string]bool)
+	for _, ob := range obligations {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		ce.chargePenalty(ob, now)
+		if ob.Attempts < ce.config.Fails.MaxRetries && ob.NextAttemptAt != nil && !now.Before(*ob.NextAttemptAt) {
+			ce.attemptObligation(ob, now)
+		}
+		if ob.open() && ce.buyInDue(ob, now) {
+			ce.buyIn(ob)
+		}
+
+		ob.UpdatedAt = now
+		if err := ce.repo.UpdateSettlementObligation(ob); err != nil {
+			return err
+		}
+		batches[ob.BatchID] = true
+	}
+
+	for batchID := range batches {
+		if err := ce.refreshBatch(batchID, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListFails lista as obrigações em fail.
+func (ce *ClearingEngine) ListFails() ([]*SettlementObligation, error) {
+	return ce.repo.ListOpenObligations()
+}
+
+// refreshBatch recalcula o status de um lote fechado; lotes ainda em
+// andamento fecham pela retomada (RecoverBatches).
+func (ce *ClearingEngine) refreshBatch(batchID string, now time.Time) error {
+	batch, err := ce.findBatch(batchID)
+	if err != nil {
+		return err
+	}
+	if batch.Phase != BatchPhaseClosed {
+		return nil
+	}
+	positions, err := ce.repo.ListPositionsByBatch(batchID)
+	if err != nil {
+		return err
+	}
+	obligations, err := ce.repo.ListSettlementObligations(batchID)
+	if err != nil {
+		return err
+	}
+	return ce.finishBatch(batch, positions, obligations, now)
+}
+
+// chargePenalty cobra de quem falhou a entrega a multa de cada dia inteiro em
+// fail desde PenaltyUntil, sobre o valor em aberto, no ativo quote. Fails de
+// recebimento são da clearing e não geram multa.
+func (ce *ClearingEngine) chargePenalty(ob *SettlementObligation, now time.Time) {
+	rate := ce.config.Fails.PenaltyRate
+	if !rate.IsPositive() || ce.custody == nil || ob.PenaltyUntil == nil || !ob.Net.IsNegative() {
+		return
+	}
+	days := int64(now.Sub(*ob.PenaltyUntil) / (24 * time.Hour))
+	if days <= 0 {
+		return
+	}
+
+	value, quote, err := ce.valueOf(ob.Asset, ob.Outstanding())
+	if err != nil {
+		log.Printf("[Clearing] penalty for obligation %s not charged: %v", ob.ID, err)
+		return
+	}
+	penalty := value.Mul(rate).MulInt(days)
+	if penalty.IsPositive() {
+		// a chave é o início do período cobrado: repetir a cobrança após uma
+		// queda, antes de gravar PenaltyUntil, não cobra de novo
+		key := "penalty:" + ob.ID + ":" + strconv.FormatInt(ob.PenaltyUntil.Unix(), 10)
+		charged, err := ce.custody.ChargeFail(ob.UserID, quote, penalty, LedgerEntryFailPenalty, ob.ID, key)
+		if err != nil {
+			log.Printf("[Clearing] penalty for obligation %s not charged: %v", ob.ID, err)
+			return
+		}
+		ob.Penalties = ob.Penalties.Add(charged)
+	}
+	until := ob.PenaltyUntil.Add(time.Duration(days) * 24 * time.Hour)
+	ob.PenaltyUntil = &until
+}
+
+func (ce *ClearingEngine) buyInDue(ob *SettlementObligation, now time.Time) bool {
+	after := ce.config.Fails.BuyInAfter
+	return after > 0 && ob.Net.IsNegative() && ob.FailedSince != nil && now.Sub(*ob.FailedSince) >= after
+}
+
+// buyIn encerra um fail de entrega: a clearing cobra do faltoso, em dinheiro,
+// o que falta entregar ao último preço mais BuyInPremium e assume a compra do
+// ativo para quem tem a receber.
+func (ce *ClearingEngine) buyIn(ob *SettlementObligation) {
+	if ce.custody == nil {
+		return
+	}
+	value, quote, err := ce.valueOf(ob.Asset, ob.Outstanding())
+	if err != nil {
+		log.Printf("[Clearing] buy-in of obligation %s failed: %v", ob.ID, err)
+		return
+	}
+	cost := value.Mul(decimal.One.Add(ce.config.Fails.BuyInPremium))
+	charged, err := ce.custody.ChargeFail(ob.UserID, quote, cost, LedgerEntryBuyIn, ob.ID, "buyin:"+ob.ID)
+	if err != nil {
+		log.Printf("[Clearing] buy-in of obligation %s failed: %v", ob.ID, err)
+		return
+	}
+	ob.BuyInCost = charged
+	ob.Status = SettlementStatusBoughtIn
+	ob.NextAttemptAt = nil
+}
+
+// valueOf valora qty do ativo no seu quote; o próprio quote vale 1.
+func (ce *ClearingEngine) valueOf(asset string, qty decimal.Decimal) (decimal.Decimal, string, error) {
+	_, quote := ce.assetsOf(asset)
+	if quote == asset {
+		return qty, quote, nil
+	}
+	if ce.prices == nil {
+		return decimal.Zero, quote, ErrNoReferencePrice
+	}
+	price, err := ce.prices.GetLastPrice(asset)
+	if err != nil {
+		return decimal.Zero, quote, err
+	}
+	if !price.IsPositive() {
+		return decimal.Zero, quote, ErrNoReferencePrice
+	}
+	return qty.Mul(price), quote, nil
+}
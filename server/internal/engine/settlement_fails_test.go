@@ -0,0 +1,186 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
+
+// fixedPrices é um PriceFeed com preços fixos por ativo.
+type fixedPrices map[string]decimal.Decimal
+
+func (p fixedPrices) GetLastPrice(symbol string) (decimal.Decimal, error) {
+	return p[symbol], nil
+}
+
+// failingSettle liquida um trade em que alice vende 2 AAA a bob por 10 mas só
+// tem 1 AAA travado: a entrega dela entra em fail com 1 AAA em aberto.
+func failingSettle(t *testing.T, fails FailsConfig) (*ClearingEngine, *memClearingRepo, *memWallet, time.Time) {
+	t.Helper()
+	wallet, mw := newTestWallet()
+	mw.set("alice", "AAA", decimal.Zero, d("1"))
+	mw.set("bob", "USD", decimal.Zero, d("20"))
+
+	repo := newMemClearingRepo()
+	ce := NewClearingEngine(repo, NewWalletCustodyService(wallet, "clearing"), nil, nil, ClearingConfig{DefaultQuote: "USD", Fails: fails})
+	ce.SetPriceFeed(fixedPrices{"AAA": d("10")})
+
+	start := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	trade := &Trade{ID: "t1", Symbol: "AAA", Price: d("10"), Quantity: d("2"), CreatedAt: start.Add(-24 * time.Hour)}
+	if err := ce.OnTrade(trade, "bob", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ce.RunTPlusOneSettle(context.Background(), start); err != nil {
+		t.Fatal(err)
+	}
+	return ce, repo, mw, start
+}
+
+func aliceDelivery(t *testing.T, repo *memClearingRepo) *SettlementObligation {
+	t.Helper()
+	obs := repo.listObligations(func(ob SettlementObligation) bool { return ob.UserID == "alice" && ob.Asset == "AAA" })
+	if len(obs) != 1 {
+		t.Fatalf("alice AAA obligations = %d, want 1", len(obs))
+	}
+	return obs[0]
+}
+
+func TestSettlementFailDeliversWhatThereIs(t *testing.T) {
+	_, repo, mw, start := failingSettle(t, FailsConfig{})
+
+	ob := aliceDelivery(t, repo)
+	if ob.Status != SettlementStatusPartial || !ob.Settled.Equal(d("1")) || !ob.Outstanding().Equal(d("1")) {
+		t.Fatalf("obligation = %s settled %s outstanding %s, want PARTIAL 1/1", ob.Status, ob.Settled, ob.Outstanding())
+	}
+	if ob.Attempts != 1 || ob.FailedSince == nil || !ob.FailedSince.Equal(start) {
+		t.Fatalf("obligation attempts %d failed since %v, want 1 since %s", ob.Attempts, ob.FailedSince, start)
+	}
+	if ob.NextAttemptAt == nil || !ob.NextAttemptAt.Equal(start.Add(time.Hour)) {
+		t.Fatalf("next attempt = %v, want %s", ob.NextAttemptAt, start.Add(time.Hour))
+	}
+
+	batches := repo.listBatches(func(SettlementBatch) bool { return true })
+	if len(batches) != 1 || batches[0].Status != SettlementStatusPartial || batches[0].FailedCount != 1 {
+		t.Fatalf("batches = %+v, want one PARTIAL with 1 fail", batches)
+	}
+	for _, pos := range repo.listPositions(func(ClearingPosition) bool { return true }) {
+		want := SettlementStatusSettled
+		if pos.UserID == "alice" {
+			want = SettlementStatusFailed
+		}
+		if pos.Status != want {
+			t.Errorf("%s position = %s, want %s", pos.UserID, pos.Status, want)
+		}
+	}
+	// quem tem a receber é creditado integralmente
+	if avail, _ := mw.get("bob", "AAA"); !avail.Equal(d("2")) {
+		t.Fatalf("bob AAA = %s, want 2", avail)
+	}
+}
+
+func TestSettlementFailRetryCuresFail(t *testing.T) {
+	ce, repo, mw, start := failingSettle(t, FailsConfig{})
+	mw.set("alice", "AAA", d("1"), decimal.Zero)
+
+	// antes do backoff nada é retentado
+	if err := ce.RunFails(context.Background(), start.Add(30*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if ob := aliceDelivery(t, repo); ob.Attempts != 1 || ob.Status != SettlementStatusPartial {
+		t.Fatalf("obligation = %s after %d attempts, want untouched before the backoff", ob.Status, ob.Attempts)
+	}
+
+	if err := ce.RunFails(context.Background(), start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	ob := aliceDelivery(t, repo)
+	if ob.Status != SettlementStatusSettled || !ob.Outstanding().IsZero() || ob.NextAttemptAt != nil {
+		t.Fatalf("obligation = %s outstanding %s, want SETTLED", ob.Status, ob.Outstanding())
+	}
+	batches := repo.listBatches(func(SettlementBatch) bool { return true })
+	if len(batches) != 1 || batches[0].Status != SettlementStatusSettled || batches[0].FailedCount != 0 {
+		t.Fatalf("batches = %+v, want one SETTLED", batches)
+	}
+	if pos := repo.listPositions(func(p ClearingPosition) bool { return p.UserID == "alice" }); pos[0].Status != SettlementStatusSettled {
+		t.Fatalf("alice position = %s, want SETTLED", pos[0].Status)
+	}
+	if avail, _ := mw.get("alice", "AAA"); !avail.IsZero() {
+		t.Fatalf("alice AAA = %s, want 0", avail)
+	}
+}
+
+func TestSettlementFailPenaltiesAndBuyIn(t *testing.T) {
+	ce, repo, mw, start := failingSettle(t, FailsConfig{
+		MaxRetries:   2,
+		BuyInAfter:   48 * time.Hour,
+		BuyInPremium: d("0.1"),
+		PenaltyRate:  d("0.01"),
+	})
+
+	steps := []struct {
+		after     time.Duration
+		status    SettlementStatus
+		attempts  int
+		penalties string
+	}{
+		// um dia em fail: multa de 1% sobre 1 AAA a 10 USD e retentativa
+		{25 * time.Hour, SettlementStatusPartial, 2, "0.1"},
+		// mesmo dia: nem multa nova nem retentativa (MaxRetries)
+		{26 * time.Hour, SettlementStatusPartial, 2, "0.1"},
+		// 48h: segundo dia de multa e buy-in a 10 × 1,1
+		{48 * time.Hour, SettlementStatusBoughtIn, 2, "0.2"},
+	}
+	for _, step := range steps {
+		if err := ce.RunFails(context.Background(), start.Add(step.after)); err != nil {
+			t.Fatal(err)
+		}
+		ob := aliceDelivery(t, repo)
+		if ob.Status != step.status || ob.Attempts != step.attempts || !ob.Penalties.Equal(d(step.penalties)) {
+			t.Fatalf("after %s: obligation = %s, %d attempts, penalties %s; want %s, %d, %s",
+				step.after, ob.Status, ob.Attempts, ob.Penalties, step.status, step.attempts, step.penalties)
+		}
+	}
+
+	ob := aliceDelivery(t, repo)
+	if !ob.BuyInCost.Equal(d("11")) || ob.NextAttemptAt != nil {
+		t.Fatalf("buy-in cost = %s (next attempt %v), want 11 and no retry", ob.BuyInCost, ob.NextAttemptAt)
+	}
+	batches := repo.listBatches(func(SettlementBatch) bool { return true })
+	if len(batches) != 1 || batches[0].Status != SettlementStatusSettled {
+		t.Fatalf("batches = %+v, want one SETTLED after the buy-in", batches)
+	}
+	if open, _ := ce.ListFails(); len(open) != 0 {
+		t.Fatalf("open fails = %d after the buy-in, want 0", len(open))
+	}
+
+	tests := []struct {
+		user, asset, avail string
+	}{
+		{"alice", "USD", "8.8"},
+		{"clearing", "USD", "11.2"},
+		{"bob", "AAA", "2"},
+	}
+	for _, tt := range tests {
+		if avail, _ := mw.get(tt.user, tt.asset); !avail.Equal(d(tt.avail)) {
+			t.Errorf("%s %s = %s, want %s", tt.user, tt.asset, avail, tt.avail)
+		}
+	}
+}
+
+func TestSettlementFailWithoutPriceSkipsPenalty(t *testing.T) {
+	ce, repo, _, start := failingSettle(t, FailsConfig{PenaltyRate: d("0.01"), BuyInAfter: -1})
+	ce.SetPriceFeed(nil)
+
+	if err := ce.RunFails(context.Background(), start.Add(72*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	ob := aliceDelivery(t, repo)
+	if !ob.Penalties.IsZero() || !ob.PenaltyUntil.Equal(start) {
+		t.Fatalf("penalties = %s until %s, want none charged without a price", ob.Penalties, ob.PenaltyUntil)
+	}
+	if ob.Status != SettlementStatusPartial {
+		t.Fatalf("obligation = %s, want PARTIAL with buy-in disabled", ob.Status)
+	}
+}
@@ -0,0 +1,357 @@
+package engine
+
+import (
+	"errors"
+
+	"hearcap/server/internal/decimal"
+)
+
+var ErrInvalidStopOrder = errors.New("invalid conditional order parameters")
+
+// validateConditional confere os parâmetros de STOP/STOP_LIMIT/TRAILING_STOP/
+// TAKE_PROFIT/TAKE_PROFIT_LIMIT antes de a ordem entrar no sequenciador.
+func validateConditional(order *Order) error {
+	if !order.isConditional() {
+		return nil
+	}
+
+	switch order.Type {
+	case OrderTypeStopLimit, OrderTypeTakeProfitLimit:
+		if !order.Price.IsPositive() || !order.StopPrice.IsPositive() {
+			return ErrInvalidStopOrder
+		}
+	case OrderTypeTrailingStop:
+		amount, pct := order.TrailingAmount, order.TrailingPercent
+		if amount.IsPositive() == pct.IsPositive() || amount.IsNegative() || pct.IsNegative() || pct.GreaterThanOrEqual(hundred) {
+			return ErrInvalidStopOrder
+		}
+	default:
+		if !order.StopPrice.IsPositive() {
+			return ErrInvalidStopOrder
+		}
+	}
+	return nil
+}
+
+// triggeredBy indica se o preço negociado last dispara a ordem condicional.
+// STOP e variantes disparam contra a posição (compra acima, venda abaixo);
+// TAKE_PROFIT dispara a favor (compra abaixo, venda acima).
+func (o *Order) triggeredBy(last decimal.Decimal) bool {
+	switch o.Type {
+	case OrderTypeTakeProfit, OrderTypeTakeProfitLimit:
+		if o.Side == SideBuy {
+			return last.LessThanOrEqual(o.StopPrice)
+		}
+		return last.GreaterThanOrEqual(o.StopPrice)
+	default:
+		if o.Side == SideBuy {
+			return last.GreaterThanOrEqual(o.StopPrice)
+		}
+		return last.LessThanOrEqual(o.StopPrice)
+	}
+}
+
+// trail move o StopPrice de um trailing stop quando last é mais favorável que
+// a referência atual; o stop nunca recua. Devolve true se mudou.
+func (o *Order) trail(last, tick decimal.Decimal) bool {
+	if o.Type != OrderTypeTrailingStop {
+		return false
+	}
+	if o.Side == SideSell && last.LessThanOrEqual(o.TrailingRef) {
+		return false
+	}
+	if o.Side == SideBuy && last.GreaterThanOrEqual(o.TrailingRef) {
+		return false
+	}
+	o.TrailingRef = last
+	o.StopPrice = o.trailingStop(last, tick)
+	return true
+}
+
+var hundred = decimal.FromInt(100)
+
+// trailingStop é o gatilho à distância do trailing a partir de ref, no tick
+// do mercado (tick zero = sem arredondamento) e arredondado para longe de
+// ref: a distância nunca fica menor que a pedida.
+func (o *Order) trailingStop(ref, tick decimal.Decimal) decimal.Decimal {
+	offset := o.TrailingAmount
+	if o.TrailingPercent.IsPositive() {
+		offset = ref.MulDivTrunc(o.TrailingPercent, hundred)
+	}
+	if o.Side == SideSell {
+		return ref.Sub(offset).Floor(tick)
+	}
+	return ref.Add(offset).Ceil(tick)
+}
+
+// initTrailing fixa a referência inicial do trailing stop: último preço
+// negociado, senão o melhor preço do lado que a ordem acompanha.
+func (m *market) initTrailing(order *Order) error {
+	if order.Type != OrderTypeTrailingStop {
+		return nil
+	}
+
+	ref := m.lastPrice
+	if !ref.IsPositive() {
+		var ok bool
+		if order.Side == SideSell {
+			ref, ok = m.book.bestBid()
+		} else {
+			ref, ok = m.book.bestAsk()
+		}
+		if !ok {
+			return ErrInvalidStopOrder
+		}
+	}
+	order.TrailingRef = ref
+	order.StopPrice = order.trailingStop(ref, m.tickSize())
+	return nil
+}
+
+// maxStopCascade limita quantas rodadas de disparo em cadeia um único comando
+// pode produzir (STOP dispara, executa, imprime preço que dispara outro STOP...).
+// Ordens que ainda estiverem em condição de disparo ao atingir o limite são
+// avaliadas no próximo trade do símbolo.
+const maxStopCascade = 32
+
+// addStop indexa a ordem condicional; se o último preço negociado já a
+// dispara, registra um print para que triggerOnPrint a ative.
+func (m *market) addStop(order *Order) {
+	m.stops.add(order)
+	if m.lastPrice.IsPositive() && order.triggeredBy(m.lastPrice) {
+		m.notePrint(m.lastPrice)
+	}
+}
+
+// notePrint registra um preço negociado pelo comando em execução.
+func (m *market) notePrint(price decimal.Decimal) {
+	m.lastPrice = price
+	if !m.printed || price.GreaterThan(m.printHigh) {
+		m.printHigh = price
+	}
+	if !m.printed || price.LessThan(m.printLow) {
+		m.printLow = price
+	}
+	m.printed = true
+}
+
+// triggerOnPrint dispara as ordens condicionais atingidas pelos preços
+// negociados no comando e repete enquanto os disparos gerarem novos trades,
+// até maxStopCascade rodadas. Devolve quantas ordens foram ativadas.
+func (m *market) triggerOnPrint() int {
+	fired := 0
+	for round := 0; m.printed && round < maxStopCascade; round++ {
+		high, low := m.printHigh, m.printLow
+		m.printed = false
+		fired += m.fireStops(high, low)
+	}
+	m.printed = false
+	if fired > 0 {
+		m.publishBook()
+	}
+	return fired
+}
+
+// triggerStops aplica um preço externo às ordens condicionais, seguido da
+// cascata normal dos trades que elas gerarem.
+func (m *market) triggerStops(lastPrice decimal.Decimal) int {
+	if m.status != MarketStatusOpen {
+		return 0
+	}
+	fired := m.fireStops(lastPrice, lastPrice)
+	cascaded := m.triggerOnPrint()
+	if fired > 0 && cascaded == 0 {
+		m.publishBook()
+	}
+	return fired + cascaded
+}
+
+// fireStops atualiza os trailing stops e ativa, em ordem determinística, as
+// ordens cujo gatilho está dentro da faixa [low, high] negociada: primeiro as
+// que disparam na alta (gatilho crescente), depois as que disparam na baixa
+// (gatilho decrescente); no mesmo gatilho, por ordem de chegada.
+func (m *market) fireStops(high, low decimal.Decimal) int {
+	for _, order := range m.stops.retrail(high, low, m.tickSize()) {
+		_ = m.updateOrder(order)
+	}
+
+	triggered := m.stops.popTriggered(high, low)
+	for _, order := range triggered {
+		if _, live := m.orders[order.ID]; !live {
+			// cancelada por uma ordem irmã (OCO) disparada na mesma rodada
+			continue
+		}
+		m.activateStop(order)
+	}
+	return len(triggered)
+}
+
+// activateStop marca a ordem como disparada e a executa como MARKET ou LIMIT
+// (execType), mantendo o tipo original no registro.
+func (m *market) activateStop(order *Order) {
+	order.Triggered = true
+
+	if order.TimeInForce == TimeInForceFOK && m.fillableQty(order).LessThan(order.RemainingQty()) {
+		m.expireRemainder(order)
+		return
+	}
+	m.matchOrder(order)
+}
+
+// ---- índice de ordens condicionais ----
+
+// stopBook indexa as ordens condicionais por preço de gatilho, reaproveitando
+// a skip list e as filas FIFO intrusivas do book (uma ordem pendente nunca
+// está no book ao mesmo tempo).
+type stopBook struct {
+	// rise dispara com preço >= gatilho (STOP de compra, TAKE_PROFIT de
+	// venda), em ordem crescente; fall dispara com preço <= gatilho, em
+	// ordem decrescente.
+	rise *priceLadder
+	fall *priceLadder
+	// trailing guarda os trailing stops na ordem de chegada para reajuste.
+	trailing []*Order
+}
+
+func newStopBook() *stopBook {
+	return &stopBook{
+		rise: newPriceLadder(false),
+		fall: newPriceLadder(true),
+	}
+}
+
+// triggersOnRise indica se a ordem dispara com o preço subindo até o gatilho.
+func (o *Order) triggersOnRise() bool {
+	switch o.Type {
+	case OrderTypeTakeProfit, OrderTypeTakeProfitLimit:
+		return o.Side == SideSell
+	default:
+		return o.Side == SideBuy
+	}
+}
+
+func (sb *stopBook) ladder(order *Order) *priceLadder {
+	if order.triggersOnRise() {
+		return sb.rise
+	}
+	return sb.fall
+}
+
+func (sb *stopBook) add(order *Order) {
+	sb.insert(order)
+	if order.Type == OrderTypeTrailingStop {
+		sb.trailing = append(sb.trailing, order)
+	}
+}
+
+func (sb *stopBook) insert(order *Order) {
+	ladder := sb.ladder(order)
+	ticks := priceToTicks(order.StopPrice)
+	level := ladder.get(ticks)
+	if level == nil {
+		level = &priceLevel{Price: order.StopPrice, ticks: ticks}
+		ladder.insert(level)
+	}
+	level.push(order)
+}
+
+func (sb *stopBook) unlink(order *Order) bool {
+	level := order.level
+	if level == nil {
+		return false
+	}
+	ladder := sb.ladder(order)
+	if ladder.get(level.ticks) != level {
+		return false
+	}
+	level.unlink(order)
+	if level.count == 0 {
+		ladder.remove(level.ticks)
+	}
+	return true
+}
+
+func (sb *stopBook) remove(order *Order) bool {
+	if !sb.unlink(order) {
+		return false
+	}
+	if order.Type == OrderTypeTrailingStop {
+		sb.dropTrailing(order)
+	}
+	return true
+}
+
+// retrail move os trailing stops conforme a faixa negociada (máxima para
+// venda, mínima para compra) e devolve os que mudaram, já reindexados.
+func (sb *stopBook) retrail(high, low, tick decimal.Decimal) []*Order {
+	var moved []*Order
+	for _, order := range sb.trailing {
+		last := low
+		if order.Side == SideSell {
+			last = high
+		}
+		if order.level == nil || !order.trail(last, tick) {
+			continue
+		}
+		// o gatilho mudou: reposiciona no índice (fim da fila do novo nível);
+		// level.ticks ainda reflete o gatilho antigo
+		sb.unlink(order)
+		sb.insert(order)
+		moved = append(moved, order)
+	}
+	return moved
+}
+
+// popTriggered retira do índice as ordens disparadas pela faixa [low, high].
+func (sb *stopBook) popTriggered(high, low decimal.Decimal) []*Order {
+	var out []*Order
+	highTicks, lowTicks := priceToTicks(high), priceToTicks(low)
+
+	for level := sb.rise.first(); level != nil && level.ticks <= highTicks; level = sb.rise.first() {
+		out = append(out, sb.drain(sb.rise, level)...)
+	}
+	for level := sb.fall.first(); level != nil && level.ticks >= lowTicks; level = sb.fall.first() {
+		out = append(out, sb.drain(sb.fall, level)...)
+	}
+
+	for _, order := range out {
+		if order.Type == OrderTypeTrailingStop {
+			sb.dropTrailing(order)
+		}
+	}
+	return out
+}
+
+func (sb *stopBook) drain(ladder *priceLadder, level *priceLevel) []*Order {
+	var out []*Order
+	for o := level.head; o != nil; {
+		next := o.next
+		level.unlink(o)
+		out = append(out, o)
+		o = next
+	}
+	ladder.remove(level.ticks)
+	return out
+}
+
+func (sb *stopBook) dropTrailing(order *Order) {
+	for i, o := range sb.trailing {
+		if o == order {
+			sb.trailing = append(sb.trailing[:i], sb.trailing[i+1:]...)
+			return
+		}
+	}
+}
+
+// orders lista as ordens pendentes na ordem de disparo (rise, depois fall).
+func (sb *stopBook) orders() []*Order {
+	var out []*Order
+	for _, ladder := range []*priceLadder{sb.rise, sb.fall} {
+		for node := ladder.head.next[0]; node != nil; node = node.next[0] {
+			for o := node.level.head; o != nil; o = o.next {
+				out = append(out, o)
+			}
+		}
+	}
+	return out
+}
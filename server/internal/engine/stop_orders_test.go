@@ -0,0 +1,123 @@
+package engine
+
+import "testing"
+
+func TestStopCascade(t *testing.T) {
+	me, repo, balances := newTestEngine(t)
+	for _, u := range []string{"bid", "s1", "s2", "s3", "seller"} {
+		fund(balances, u, "AAA")
+	}
+	for _, price := range []string{"10", "9", "8"} {
+		mustPlace(t, me, limit("bid", "AAA", SideBuy, price, "1"))
+	}
+
+	stop := func(user, trigger string) *Order {
+		return mustPlace(t, me, NewOrderRequest{
+			UserID: user, Symbol: "AAA", Side: SideSell, Type: OrderTypeStop,
+			StopPrice: d(trigger), Quantity: d("1"),
+		})
+	}
+	first := stop("s1", "10")
+	second := stop("s2", "9")
+	untouched := stop("s3", "7")
+
+	// a venda a 10 dispara s1, que executa a 9 e dispara s2, que executa a 8
+	mustPlace(t, me, limit("seller", "AAA", SideSell, "10", "1"))
+
+	if n := repo.tradeCount(); n != 3 {
+		t.Fatalf("trades = %d, want 3", n)
+	}
+	for _, o := range []*Order{first, second} {
+		if s := repo.order(o.ID).Status; s != OrderStatusFilled {
+			t.Errorf("stop %s status = %s, want FILLED", o.UserID, s)
+		}
+	}
+	if s := repo.order(untouched.ID).Status; s != OrderStatusNew {
+		t.Errorf("stop below the last print status = %s, want NEW", s)
+	}
+	if snap := me.GetOrderBookSnapshot("AAA", 5); len(snap.Bids) != 0 {
+		t.Fatalf("bids = %+v, want empty book", snap.Bids)
+	}
+}
+
+func TestTriggeredBy(t *testing.T) {
+	tests := []struct {
+		typ  OrderType
+		side Side
+		last string
+		want bool
+	}{
+		{OrderTypeStop, SideBuy, "10", true},
+		{OrderTypeStop, SideBuy, "9.99", false},
+		{OrderTypeStop, SideSell, "10", true},
+		{OrderTypeStop, SideSell, "10.01", false},
+		{OrderTypeTakeProfit, SideBuy, "9", true},
+		{OrderTypeTakeProfit, SideBuy, "11", false},
+		{OrderTypeTakeProfit, SideSell, "11", true},
+		{OrderTypeTakeProfit, SideSell, "9", false},
+	}
+	for _, tt := range tests {
+		o := &Order{Type: tt.typ, Side: tt.side, StopPrice: d("10")}
+		if got := o.triggeredBy(d(tt.last)); got != tt.want {
+			t.Errorf("%s %s triggeredBy(%s) = %v, want %v", tt.side, tt.typ, tt.last, got, tt.want)
+		}
+	}
+}
+
+func TestTrailingStopRoundsToTick(t *testing.T) {
+	tests := []struct {
+		side   Side
+		pct    string
+		amount string
+		ref    string
+		tick   string
+		want   string
+	}{
+		{SideSell, "3", "", "10.37", "0.01", "10.05"},
+		{SideBuy, "3", "", "10.37", "0.01", "10.69"},
+		{SideSell, "2.5", "", "9.99", "0.05", "9.70"},
+		{SideBuy, "", "0.333", "10", "0.01", "10.34"},
+		{SideSell, "3", "", "10.37", "0", "10.0589"},
+	}
+	for _, tt := range tests {
+		o := &Order{Side: tt.side}
+		if tt.pct != "" {
+			o.TrailingPercent = d(tt.pct)
+		} else {
+			o.TrailingAmount = d(tt.amount)
+		}
+		if got := o.trailingStop(d(tt.ref), d(tt.tick)); !got.Equal(d(tt.want)) {
+			t.Errorf("%s trailing %s%s from %s at tick %s = %s, want %s", tt.side, tt.pct, tt.amount, tt.ref, tt.tick, got, tt.want)
+		}
+	}
+}
+
+func TestTriggeredStopKeepsType(t *testing.T) {
+	me, repo, balances := newTestEngine(t)
+	for _, u := range []string{"bid", "seller", "stop"} {
+		fund(balances, u, "AAA")
+	}
+	stop := mustPlace(t, me, NewOrderRequest{
+		UserID: "stop", Symbol: "AAA", Side: SideSell, Type: OrderTypeStopLimit,
+		StopPrice: d("10"), Price: d("9.5"), Quantity: d("2"),
+	})
+	mustPlace(t, me, limit("bid", "AAA", SideBuy, "10", "1"))
+	mustPlace(t, me, limit("seller", "AAA", SideSell, "10", "1"))
+
+	got := repo.order(stop.ID)
+	if got.Type != OrderTypeStopLimit || !got.Triggered || got.Status != OrderStatusNew {
+		t.Fatalf("fired stop = %s triggered=%v %s, want STOP_LIMIT triggered NEW", got.Type, got.Triggered, got.Status)
+	}
+	snap := me.GetOrderBookSnapshot("AAA", 5)
+	if len(snap.Asks) != 1 || !snap.Asks[0].Price.Equal(d("9.5")) {
+		t.Fatalf("asks = %+v, want the fired stop resting at 9.5", snap.Asks)
+	}
+	// disparada, a ordem se comporta como LIMIT: pode ser alterada
+	amended, err := me.AmendOrder(AmendOrderRequest{OrderID: stop.ID, UserID: "stop", NewPrice: d("9.8")})
+	if err != nil {
+		t.Fatalf("AmendOrder on a fired stop-limit: %v", err)
+	}
+	if amended.Type != OrderTypeStopLimit {
+		t.Errorf("amended type = %s, want STOP_LIMIT", amended.Type)
+	}
+}
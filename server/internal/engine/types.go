@@ -2,6 +2,8 @@ package engine
 
 import (
 	"time"
+
+	"hearcap/server/internal/decimal"
 )
 
 type Side string
@@ -17,6 +19,51 @@ const (
 	OrderTypeMarket OrderType = "MARKET"
 	OrderTypeLimit  OrderType = "LIMIT"
 	OrderTypeStop   OrderType = "STOP"
+	// OrderTypeStopLimit vira LIMIT em Price quando StopPrice é atingido.
+	OrderTypeStopLimit OrderType = "STOP_LIMIT"
+	// OrderTypeTrailingStop é um STOP cujo StopPrice acompanha o melhor preço
+	// negociado a uma distância fixa (TrailingAmount) ou percentual (TrailingPercent).
+	OrderTypeTrailingStop OrderType = "TRAILING_STOP"
+	// OrderTypeTakeProfit vira MARKET quando o preço atinge StopPrice a favor
+	// da posição (compra abaixo, venda acima).
+	OrderTypeTakeProfit OrderType = "TAKE_PROFIT"
+	// OrderTypeTakeProfitLimit vira LIMIT em Price nas mesmas condições.
+	OrderTypeTakeProfitLimit OrderType = "TAKE_PROFIT_LIMIT"
+)
+
+type TimeInForce string
+
+const (
+	TimeInForceGTC TimeInForce = "GTC"
+	TimeInForceIOC TimeInForce = "IOC"
+	TimeInForceFOK TimeInForce = "FOK"
+	TimeInForceGTD TimeInForce = "GTD"
+)
+
+// PostOnlyMode define o que fazer com uma ordem maker-only que cruzaria o book.
+type PostOnlyMode string
+
+const (
+	PostOnlyNone    PostOnlyMode = ""
+	PostOnlyReject  PostOnlyMode = "REJECT"
+	PostOnlyReprice PostOnlyMode = "REPRICE"
+)
+
+// STPMode define como evitar que uma ordem execute contra outra do mesmo
+// usuário. O modo da ordem agressora é o que vale.
+type STPMode string
+
+const (
+	STPNone STPMode = ""
+	// STPCancelNewest cancela o restante da agressora e mantém a ordem em repouso.
+	STPCancelNewest STPMode = "CANCEL_NEWEST"
+	// STPCancelOldest cancela a ordem em repouso e segue o matching.
+	STPCancelOldest STPMode = "CANCEL_OLDEST"
+	// STPCancelBoth cancela as duas.
+	STPCancelBoth STPMode = "CANCEL_BOTH"
+	// STPDecrementAndCancel reduz ambas pela menor quantidade restante e
+	// cancela a que zerar.
+	STPDecrementAndCancel STPMode = "DECREMENT_AND_CANCEL"
 )
 
 type OrderStatus string
@@ -26,6 +73,7 @@ const (
 	OrderStatusPartFilled OrderStatus = "PARTIALLY_FILLED"
 	OrderStatusFilled     OrderStatus = "FILLED"
 	OrderStatusCanceled   OrderStatus = "CANCELED"
+	OrderStatusExpired    OrderStatus = "EXPIRED"
 )
 
 type Order struct {
@@ -34,27 +82,139 @@ type Order struct {
 	Symbol    string
 	Side      Side
 	Type      OrderType
-	Price     float64
-	StopPrice float64
-	Quantity  float64
-	FilledQty float64
+	Price     decimal.Decimal
+	StopPrice decimal.Decimal
+	Quantity  decimal.Decimal
+	FilledQty decimal.Decimal
+
+	// QuoteQty > 0 define uma MARKET pelo valor a gastar/receber em quote;
+	// Quantity é derivada do book ao entrar no sequenciador.
+	QuoteQty    decimal.Decimal
+	FilledQuote decimal.Decimal
+	// LockedQuote é a trava em quote ainda mantida por uma ordem de compra:
+	// diminui a cada execução e a sobra é devolvida quando a ordem termina.
+	LockedQuote decimal.Decimal
+
+	// DisplayQty > 0 torna a ordem um iceberg: só VisibleQty (a fatia atual)
+	// aparece no book; ao se esgotar, a próxima fatia volta ao fim da fila.
+	DisplayQty decimal.Decimal
+	VisibleQty decimal.Decimal
+
+	TrailingAmount  decimal.Decimal
+	TrailingPercent decimal.Decimal
+	// TrailingRef é o preço mais favorável visto desde a entrada do trailing stop.
+	TrailingRef decimal.Decimal
+	// Triggered marca a ordem condicional já disparada: Type continua o
+	// original e a execução segue como execType.
+	Triggered bool
+
+	TimeInForce TimeInForce
+	ExpireAt    *time.Time
+	PostOnly    PostOnlyMode
+	STP         STPMode
+
+	// GroupID liga a ordem a um OrderGroup (OCO ou bracket).
+	GroupID string
 
 	Status    OrderStatus
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	// Seq é a sequência do último evento do símbolo que alterou a ordem.
+	Seq uint64
+
+	// encadeamento intrusivo na fila FIFO do nível de preço (order_book.go)
+	level      *priceLevel
+	prev, next *Order
+}
+
+func (o *Order) RemainingQty() decimal.Decimal {
+	return o.Quantity.Sub(o.FilledQty)
 }
 
-func (o *Order) RemainingQty() float64 {
-	return o.Quantity - o.FilledQty
+// displayedQty é a quantidade exibida no book (a fatia visível de icebergs).
+func (o *Order) displayedQty() decimal.Decimal {
+	if o.DisplayQty.IsPositive() {
+		return o.VisibleQty
+	}
+	return o.RemainingQty()
+}
+
+// replenish abre a próxima fatia de um iceberg (ou a ajusta ao restante).
+func (o *Order) replenish() {
+	if !o.DisplayQty.IsPositive() {
+		return
+	}
+	remaining := o.RemainingQty()
+	if !o.VisibleQty.IsPositive() || o.VisibleQty.GreaterThan(remaining) {
+		o.VisibleQty = decimal.Min(o.DisplayQty, remaining)
+	}
+}
+
+// clone devolve uma cópia desvinculada do book, segura para entregar a quem
+// está fora do sequenciador do símbolo.
+func (o *Order) clone() *Order {
+	c := *o
+	c.level, c.prev, c.next = nil, nil, nil
+	return &c
+}
+
+// IsTerminal indica se a ordem não pode mais ser executada nem alterada.
+func (o *Order) IsTerminal() bool {
+	return o.Status == OrderStatusFilled || o.Status == OrderStatusCanceled || o.Status == OrderStatusExpired
+}
+
+// isConditional indica se a ordem aguarda um gatilho de preço antes de ir
+// ao book.
+func (o *Order) isConditional() bool {
+	if o.Triggered {
+		return false
+	}
+	switch o.Type {
+	case OrderTypeStop, OrderTypeStopLimit, OrderTypeTrailingStop, OrderTypeTakeProfit, OrderTypeTakeProfitLimit:
+		return true
+	}
+	return false
+}
+
+// execType é o tipo com que a ordem executa: o próprio Type ou, para uma
+// condicional disparada, MARKET (LIMIT nas variantes _LIMIT).
+func (o *Order) execType() OrderType {
+	if !o.Triggered {
+		return o.Type
+	}
+	switch o.Type {
+	case OrderTypeStopLimit, OrderTypeTakeProfitLimit:
+		return OrderTypeLimit
+	}
+	return OrderTypeMarket
+}
+
+// restsInBook indica se o saldo não executado deve repousar no book.
+func (o *Order) restsInBook() bool {
+	if o.execType() != OrderTypeLimit {
+		return false
+	}
+	return o.TimeInForce == TimeInForceGTC || o.TimeInForce == TimeInForceGTD
 }
 
 type Trade struct {
 	ID        string
+	Seq       uint64
 	Symbol    string
 	BuyOrder  string
 	SellOrder string
-	Price     float64
-	Quantity  float64
+	BuyerID   string
+	SellerID  string
+	// TakerSide é o lado agressor; o outro lado é o maker.
+	TakerSide Side
+	Price     decimal.Decimal
+	Quantity  decimal.Decimal
+	// BuyerFee/SellerFee são as taxas cobradas em FeeAsset (negativas =
+	// rebate).
+	BuyerFee  decimal.Decimal
+	SellerFee decimal.Decimal
+	FeeAsset  string
 	CreatedAt time.Time
 }
 
@@ -63,7 +223,46 @@ type NewOrderRequest struct {
 	Symbol    string
 	Side      Side
 	Type      OrderType
-	Price     float64
-	StopPrice float64
-	Quantity  float64
+	Price     decimal.Decimal
+	StopPrice decimal.Decimal
+	Quantity  decimal.Decimal
+	// QuoteQty substitui Quantity em ordens MARKET definidas por valor
+	// ("gastar 100 em quote").
+	QuoteQty decimal.Decimal
+	// DisplayQty > 0 cria um iceberg (só LIMIT GTC/GTD, menor que Quantity).
+	DisplayQty decimal.Decimal
+
+	// TRAILING_STOP: informe um dos dois (distância absoluta ou percentual).
+	TrailingAmount  decimal.Decimal
+	TrailingPercent decimal.Decimal
+
+	TimeInForce TimeInForce
+	ExpireAt    *time.Time
+	PostOnly    PostOnlyMode
+	// STP vazio usa o padrão da conta (MatchingEngine.SetAccountSTP).
+	STP STPMode
+}
+
+type OrderEventKind string
+
+const (
+	// OrderEventSTPCanceled: ordem cancelada por self-trade prevention.
+	OrderEventSTPCanceled OrderEventKind = "STP_CANCELED"
+	// OrderEventSTPDecremented: quantidade reduzida por DECREMENT_AND_CANCEL.
+	OrderEventSTPDecremented OrderEventKind = "STP_DECREMENTED"
+)
+
+// OrderEvent descreve uma mudança de ordem que não gera trade.
+type OrderEvent struct {
+	Seq            uint64
+	Kind           OrderEventKind
+	Symbol         string
+	OrderID        string
+	UserID         string
+	CounterOrderID string
+	STP            STPMode
+	// Quantity é a quantidade cancelada ou decrementada.
+	Quantity  decimal.Decimal
+	Status    OrderStatus
+	CreatedAt time.Time
 }
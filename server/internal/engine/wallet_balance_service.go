@@ -1,9 +1,13 @@
 package engine
 
+import "hearcap/server/internal/decimal"
+
 type WalletBalanceService struct {
 	wallet      *WalletEngine
 	marketBase  map[string]string
 	marketQuote map[string]string
+	// defaultQuote é o ativo quote dos mercados sem entrada em marketQuote.
+	defaultQuote string
 }
 
 func NewWalletBalanceService(wallet *WalletEngine, marketBase, marketQuote map[string]string) *WalletBalanceService {
@@ -21,47 +25,74 @@ func (w *WalletBalanceService) baseAsset(symbol string) string {
 	return symbol
 }
 
+// SetDefaultQuote faz os mercados sem mapeamento travarem asset como quote
+// (ex.: "USDT" para todos os tokens).
+func (w *WalletBalanceService) SetDefaultQuote(asset string) {
+	w.defaultQuote = asset
+}
+
 func (w *WalletBalanceService) quoteAsset(symbol string) string {
 	if a, ok := w.marketQuote[symbol]; ok {
 		return a
 	}
+	if w.defaultQuote != "" {
+		return w.defaultQuote
+	}
 	return symbol + "_QUOTE"
 }
 
-func (w *WalletBalanceService) CanLockBase(userID, symbol string, qty float64) bool {
+func (w *WalletBalanceService) CanLockBase(userID, symbol string, qty decimal.Decimal) bool {
 	asset := w.baseAsset(symbol)
 	_, bal, err := w.wallet.getOrCreateBalance(userID, asset)
 	if err != nil {
 		return false
 	}
-	return bal.Available >= qty
+	return bal.Available.GreaterThanOrEqual(qty)
 }
 
-func (w *WalletBalanceService) CanLockQuote(userID, symbol string, notional float64) bool {
+func (w *WalletBalanceService) CanLockQuote(userID, symbol string, notional decimal.Decimal) bool {
 	asset := w.quoteAsset(symbol)
 	_, bal, err := w.wallet.getOrCreateBalance(userID, asset)
 	if err != nil {
 		return false
 	}
-	return bal.Available >= notional
+	return bal.Available.GreaterThanOrEqual(notional)
 }
 
-func (w *WalletBalanceService) LockBase(userID, symbol string, qty float64) error {
+func (w *WalletBalanceService) LockBase(userID, symbol string, qty decimal.Decimal) error {
 	asset := w.baseAsset(symbol)
 	return w.wallet.lock(userID, asset, qty)
 }
 
-func (w *WalletBalanceService) LockQuote(userID, symbol string, notional float64) error {
+func (w *WalletBalanceService) LockQuote(userID, symbol string, notional decimal.Decimal) error {
 	asset := w.quoteAsset(symbol)
 	return w.wallet.lock(userID, asset, notional)
 }
 
-func (w *WalletBalanceService) ReleaseBase(userID, symbol string, qty float64) error {
+func (w *WalletBalanceService) ReleaseBase(userID, symbol string, qty decimal.Decimal) error {
 	asset := w.baseAsset(symbol)
 	return w.wallet.unlock(userID, asset, qty)
 }
 
-func (w *WalletBalanceService) ReleaseQuote(userID, symbol string, notional float64) error {
+func (w *WalletBalanceService) ReleaseQuote(userID, symbol string, notional decimal.Decimal) error {
 	asset := w.quoteAsset(symbol)
 	return w.wallet.unlock(userID, asset, notional)
 }
+
+// LockReceivableBase reserva qty da base que userID recebe de trades ainda
+// não liquidados. Implementa ReceivableBalanceService.
+func (w *WalletBalanceService) LockReceivableBase(userID, symbol string, qty decimal.Decimal) error {
+	return w.wallet.reserve(userID, w.baseAsset(symbol), qty)
+}
+
+func (w *WalletBalanceService) LockReceivableQuote(userID, symbol string, notional decimal.Decimal) error {
+	return w.wallet.reserve(userID, w.quoteAsset(symbol), notional)
+}
+
+func (w *WalletBalanceService) ReleaseReceivableBase(userID, symbol string, qty decimal.Decimal) error {
+	return w.wallet.releaseReserved(userID, w.baseAsset(symbol), qty)
+}
+
+func (w *WalletBalanceService) ReleaseReceivableQuote(userID, symbol string, notional decimal.Decimal) error {
+	return w.wallet.releaseReserved(userID, w.quoteAsset(symbol), notional)
+}
@@ -1,58 +1,119 @@
 package engine
 
+import (
+	"errors"
+	"strconv"
+
+	"hearcap/server/internal/decimal"
+)
+
+// ErrFailToDeliver indica participante sem saldo para entregar toda a
+// obrigação; o que havia foi entregue (entrega parcial).
+var ErrFailToDeliver = errors.New("participant cannot deliver the full obligation")
+
 type WalletCustodyService struct {
-	wallet      *WalletEngine
-	marketBase  map[string]string
-	marketQuote map[string]string
+	wallet *WalletEngine
+	// account é a conta da clearing, que recebe multas e buy-ins.
+	account string
 }
 
-func NewWalletCustodyService(wallet *WalletEngine, marketBase, marketQuote map[string]string) *WalletCustodyService {
-	return &WalletCustodyService{
-		wallet:      wallet,
-		marketBase:  marketBase,
-		marketQuote: marketQuote,
-	}
+func NewWalletCustodyService(wallet *WalletEngine, clearingAccount string) *WalletCustodyService {
+	return &WalletCustodyService{wallet: wallet, account: clearingAccount}
 }
 
-func (wcs *WalletCustodyService) baseAsset(symbol string) string {
-	if a, ok := wcs.marketBase[symbol]; ok {
-		return a
+// SettleObligation move o ativo uma única vez por participante: do que ele
+// entrega sai primeiro a trava e depois o disponível, e um líquido positivo é
+// creditado (travado até o valor reservado, ver Balance.Reserved). Quitada a
+// obrigação, o que sobrou da trava volta ao disponível, descontando antes as
+// reservas consumidas no próprio ciclo.
+//
+// Cada perna é lançada com a chave settlementKey: uma tentativa repetida
+// depois de uma queda reencontra as pernas já lançadas e só as contabiliza.
+// Uma falha ao devolver a trava também é devolvida: a obrigação entra em
+// fail e a retentativa, já sem nada a mover, refaz só a devolução.
+func (wcs *WalletCustodyService) SettleObligation(ob *SettlementObligation) error {
+	if due := ob.Outstanding(); due.IsPositive() {
+		if ob.Net.IsPositive() {
+			entry, err := wcs.wallet.postKeyed(ob.UserID, ob.Asset, settlementKey(ob, "credit"), LedgerEntryTrade, ob.ID,
+				func(bal *Balance) (decimal.Decimal, decimal.Decimal) { return receive(bal, due) })
+			if err != nil {
+				return err
+			}
+			ob.Settled = ob.Settled.Add(entry.Amount)
+		} else {
+			paid, err := wcs.deliver(ob, due)
+			ob.Settled = ob.Settled.Add(paid)
+			if err != nil {
+				return err
+			}
+			if paid.LessThan(due) {
+				return ErrFailToDeliver
+			}
+		}
 	}
-	return symbol
-}
 
-func (wcs *WalletCustodyService) quoteAsset(symbol string) string {
-	if a, ok := wcs.marketQuote[symbol]; ok {
-		return a
+	pay := decimal.Max(ob.Net.Neg(), decimal.Zero)
+	if release := ob.Delivered.Sub(pay); release.IsPositive() {
+		// entregas sem trava (block trades) não têm o que devolver
+		_, err := wcs.wallet.postKeyed(ob.UserID, ob.Asset, "settle:"+ob.ID+":release", LedgerEntryTrade, ob.ID,
+			func(bal *Balance) (decimal.Decimal, decimal.Decimal) {
+				// entregas cobertas por reserva não chegaram a ser travadas
+				pending := decimal.Min(release, bal.Reserved)
+				bal.Reserved = bal.Reserved.Sub(pending)
+				r := decimal.Min(release.Sub(pending), bal.Locked)
+				return r, r.Neg()
+			})
+		if err != nil {
+			return err
+		}
 	}
-	return symbol + "_QUOTE"
+	return nil
 }
 
-func (wcs *WalletCustodyService) ApplySettlement(userID, symbol string, baseDelta, quoteDelta float64) error {
-	base := wcs.baseAsset(symbol)
-	quote := wcs.quoteAsset(symbol)
+// deliver debita até due do participante, da trava e depois do disponível, e
+// devolve quanto foi debitado nesta tentativa.
+func (wcs *WalletCustodyService) deliver(ob *SettlementObligation, due decimal.Decimal) (decimal.Decimal, error) {
+	paid := decimal.Zero
+	entry, err := wcs.wallet.postKeyed(ob.UserID, ob.Asset, settlementKey(ob, "locked"), LedgerEntryTrade, ob.ID,
+		func(bal *Balance) (decimal.Decimal, decimal.Decimal) {
+			return decimal.Zero, decimal.Min(due, bal.Locked).Neg()
+		})
+	if err != nil {
+		return paid, err
+	}
+	if entry != nil {
+		paid = entry.Amount.Neg()
+	}
 
-	if baseDelta > 0 {
-		if err := wcs.wallet.unlock(userID, base, baseDelta); err != nil {
-			_ = wcs.wallet.creditAvailable(userID, base, baseDelta, LedgerEntryTrade, "SETTLEMENT_BASE")
-		}
-	} else if baseDelta < 0 {
-		amount := -baseDelta
-		if err := wcs.wallet.unlock(userID, base, amount); err != nil {
-			_ = wcs.wallet.debitAvailable(userID, base, amount, LedgerEntryTrade, "SETTLEMENT_BASE")
-		}
+	entry, err = wcs.wallet.postKeyed(ob.UserID, ob.Asset, settlementKey(ob, "available"), LedgerEntryTrade, ob.ID,
+		func(bal *Balance) (decimal.Decimal, decimal.Decimal) {
+			return decimal.Min(due.Sub(paid), bal.Available).Neg(), decimal.Zero
+		})
+	if err != nil {
+		return paid, err
 	}
+	if entry != nil {
+		paid = paid.Add(entry.Amount.Neg())
+	}
+	return paid, nil
+}
 
-	if quoteDelta > 0 {
-		if err := wcs.wallet.unlock(userID, quote, quoteDelta); err != nil {
-			_ = wcs.wallet.creditAvailable(userID, quote, quoteDelta, LedgerEntryTrade, "SETTLEMENT_QUOTE")
-		}
-	} else if quoteDelta < 0 {
-		amount := -quoteDelta
-		if err := wcs.wallet.unlock(userID, quote, amount); err != nil {
-			_ = wcs.wallet.debitAvailable(userID, quote, amount, LedgerEntryTrade, "SETTLEMENT_QUOTE")
-		}
+// ChargeFail transfere amount do participante para a conta da clearing, cada
+// perna com a sua chave; numa repetição o crédito usa o valor já debitado.
+func (wcs *WalletCustodyService) ChargeFail(userID, asset string, amount decimal.Decimal, typ LedgerEntryType, ref, key string) (decimal.Decimal, error) {
+	debit, err := wcs.wallet.postKeyed(userID, asset, key+":debit", typ, ref,
+		func(*Balance) (decimal.Decimal, decimal.Decimal) { return amount.Neg(), decimal.Zero })
+	if err != nil || debit == nil {
+		return decimal.Zero, err
 	}
+	charged := debit.Amount.Neg()
+	_, err = wcs.wallet.postKeyed(wcs.account, asset, key+":credit", typ, ref,
+		func(*Balance) (decimal.Decimal, decimal.Decimal) { return charged, decimal.Zero })
+	return charged, err
+}
 
-	return nil
+// settlementKey é a chave de uma perna de ob na tentativa atual: a mesma até
+// que a tentativa seja gravada (Attempts só muda num fail).
+func settlementKey(ob *SettlementObligation, leg string) string {
+	return "settle:" + ob.ID + ":" + strconv.Itoa(ob.Attempts) + ":" + leg
 }
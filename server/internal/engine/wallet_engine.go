@@ -2,17 +2,28 @@ package engine
 
 import (
 	"errors"
+	"sync"
 	"time"
 
+	"hearcap/server/internal/decimal"
+
 	"github.com/google/uuid"
 )
 
+// ErrAmountPrecision indica valor com mais casas do que Asset.Decimals permite.
+var ErrAmountPrecision = errors.New("amount exceeds asset precision")
+
 type WalletEngine struct {
 	assets    AssetRepository
 	wallets   WalletRepository
 	ledger    LedgerRepository
 	deposits  DepositRepository
 	withdraws WithdrawalRepository
+	notifier  BalanceNotifier
+
+	// mu serializa o ciclo leitura-alteração-gravação dos saldos: sequenciadores
+	// e o pós-trade movimentam as mesmas contas em paralelo.
+	mu sync.Mutex
 }
 
 func NewWalletEngine(assets AssetRepository, wallets WalletRepository, ledger LedgerRepository, deposits DepositRepository, withdraws WithdrawalRepository) *WalletEngine {
@@ -34,8 +45,8 @@ func (we *WalletEngine) getOrCreateBalance(userID, asset string) (*WalletAccount
 	if err != nil || bal == nil {
 		bal = &Balance{
 			AccountID: acc.ID,
-			Available: 0,
-			Locked:    0,
+			Available: decimal.Zero,
+			Locked:    decimal.Zero,
 			UpdatedAt: time.Now(),
 		}
 		if err := we.wallets.SaveBalance(bal); err != nil {
@@ -45,17 +56,53 @@ func (we *WalletEngine) getOrCreateBalance(userID, asset string) (*WalletAccount
 	return acc, bal, nil
 }
 
-func (we *WalletEngine) creditAvailable(userID, asset string, amount float64, typ LedgerEntryType, ref string) error {
-	if amount <= 0 {
+// SetBalanceNotifier passa a avisar notifier a cada saldo alterado. Chame no
+// bootstrap, antes de movimentar saldos.
+func (we *WalletEngine) SetBalanceNotifier(notifier BalanceNotifier) {
+	we.notifier = notifier
+}
+
+// updateBalance grava o saldo da conta e avisa o BalanceNotifier.
+func (we *WalletEngine) updateBalance(userID, asset string, bal *Balance) error {
+	if err := we.wallets.UpdateBalance(bal); err != nil {
+		return err
+	}
+	if we.notifier != nil {
+		_ = we.notifier.NotifyBalance(userID, asset, *bal)
+	}
+	return nil
+}
+
+// checkPrecision rejeita valores que o ativo não representa (Asset.Decimals).
+// Ativos sem cadastro aceitam a escala interna completa.
+func (we *WalletEngine) checkPrecision(asset string, amount decimal.Decimal) error {
+	a, err := we.assets.GetAsset(asset)
+	if err != nil || a == nil {
+		return nil
+	}
+	if !amount.Truncate(int32(a.Decimals)).Equal(amount) {
+		return ErrAmountPrecision
+	}
+	return nil
+}
+
+func (we *WalletEngine) creditAvailable(userID, asset string, amount decimal.Decimal, typ LedgerEntryType, ref string) error {
+	if !amount.IsPositive() {
 		return errors.New("amount must be > 0")
 	}
+	we.mu.Lock()
+	defer we.mu.Unlock()
 	acc, bal, err := we.getOrCreateBalance(userID, asset)
 	if err != nil {
 		return err
 	}
-	bal.Available += amount
+	avail, err := bal.Available.CheckedAdd(amount)
+	if err != nil {
+		return err
+	}
+	bal.Available = avail
 	bal.UpdatedAt = time.Now()
-	if err := we.wallets.UpdateBalance(bal); err != nil {
+	if err := we.updateBalance(userID, asset, bal); err != nil {
 		return err
 	}
 	entry := &LedgerEntry{
@@ -70,20 +117,23 @@ func (we *WalletEngine) creditAvailable(userID, asset string, amount float64, ty
 	return we.ledger.SaveEntry(entry)
 }
 
-func (we *WalletEngine) debitAvailable(userID, asset string, amount float64, typ LedgerEntryType, ref string) error {
-	if amount <= 0 {
+// debitLocked consome amount do saldo travado (liquidação de uma trava).
+func (we *WalletEngine) debitLocked(userID, asset string, amount decimal.Decimal, typ LedgerEntryType, ref string) error {
+	if !amount.IsPositive() {
 		return errors.New("amount must be > 0")
 	}
+	we.mu.Lock()
+	defer we.mu.Unlock()
 	acc, bal, err := we.getOrCreateBalance(userID, asset)
 	if err != nil {
 		return err
 	}
-	if bal.Available < amount {
-		return errors.New("insufficient available balance")
+	if bal.Locked.LessThan(amount) {
+		return errors.New("insufficient locked balance")
 	}
-	bal.Available -= amount
+	bal.Locked = bal.Locked.Sub(amount)
 	bal.UpdatedAt = time.Now()
-	if err := we.wallets.UpdateBalance(bal); err != nil {
+	if err := we.updateBalance(userID, asset, bal); err != nil {
 		return err
 	}
 	entry := &LedgerEntry{
@@ -91,51 +141,169 @@ func (we *WalletEngine) debitAvailable(userID, asset string, amount float64, typ
 		AccountID: acc.ID,
 		Asset:     asset,
 		Type:      typ,
-		Amount:    -amount,
+		Amount:    amount.Neg(),
 		Reference: ref,
 		CreatedAt: time.Now(),
 	}
 	return we.ledger.SaveEntry(entry)
 }
 
-func (we *WalletEngine) lock(userID, asset string, amount float64) error {
-	if amount <= 0 {
+func (we *WalletEngine) lock(userID, asset string, amount decimal.Decimal) error {
+	if !amount.IsPositive() {
 		return errors.New("amount must be > 0")
 	}
+	we.mu.Lock()
+	defer we.mu.Unlock()
 	_, bal, err := we.getOrCreateBalance(userID, asset)
 	if err != nil {
 		return err
 	}
-	if bal.Available < amount {
+	if bal.Available.LessThan(amount) {
 		return errors.New("insufficient available to lock")
 	}
-	bal.Available -= amount
-	bal.Locked += amount
+	bal.Available = bal.Available.Sub(amount)
+	bal.Locked = bal.Locked.Add(amount)
+	bal.UpdatedAt = time.Now()
+	return we.updateBalance(userID, asset, bal)
+}
+
+func (we *WalletEngine) unlock(userID, asset string, amount decimal.Decimal) error {
+	if !amount.IsPositive() {
+		return errors.New("amount must be > 0")
+	}
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	_, bal, err := we.getOrCreateBalance(userID, asset)
+	if err != nil {
+		return err
+	}
+	if bal.Locked.LessThan(amount) {
+		return errors.New("insufficient locked balance")
+	}
+	bal.Locked = bal.Locked.Sub(amount)
+	bal.Available = bal.Available.Add(amount)
 	bal.UpdatedAt = time.Now()
-	return we.wallets.UpdateBalance(bal)
+	return we.updateBalance(userID, asset, bal)
 }
 
-func (we *WalletEngine) unlock(userID, asset string, amount float64) error {
-	if amount <= 0 {
+// reserve trava amount de userID em asset contra saldo que ele ainda vai
+// receber na liquidação de trades já executados.
+func (we *WalletEngine) reserve(userID, asset string, amount decimal.Decimal) error {
+	if !amount.IsPositive() {
 		return errors.New("amount must be > 0")
 	}
+	we.mu.Lock()
+	defer we.mu.Unlock()
 	_, bal, err := we.getOrCreateBalance(userID, asset)
 	if err != nil {
 		return err
 	}
-	if bal.Locked < amount {
+	reserved, err := bal.Reserved.CheckedAdd(amount)
+	if err != nil {
+		return err
+	}
+	bal.Reserved = reserved
+	bal.UpdatedAt = time.Now()
+	return we.updateBalance(userID, asset, bal)
+}
+
+// releaseReserved desfaz amount de uma reserva: primeiro a parte que ainda
+// não chegou (Reserved) e depois a que já foi liquidada e está travada.
+func (we *WalletEngine) releaseReserved(userID, asset string, amount decimal.Decimal) error {
+	if !amount.IsPositive() {
+		return errors.New("amount must be > 0")
+	}
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	_, bal, err := we.getOrCreateBalance(userID, asset)
+	if err != nil {
+		return err
+	}
+	pending := decimal.Min(amount, bal.Reserved)
+	unlock := amount.Sub(pending)
+	if bal.Locked.LessThan(unlock) {
 		return errors.New("insufficient locked balance")
 	}
-	bal.Locked -= amount
-	bal.Available += amount
+	bal.Reserved = bal.Reserved.Sub(pending)
+	bal.Locked = bal.Locked.Sub(unlock)
+	bal.Available = bal.Available.Add(unlock)
+	bal.UpdatedAt = time.Now()
+	return we.updateBalance(userID, asset, bal)
+}
+
+// receive divide um crédito de liquidação entre disponível e travado: a parte
+// coberta por reservas (Reserved) entra travada e sai de Reserved. Altera só
+// o Reserved de bal; os deltas devolvidos são aplicados por quem chama.
+func receive(bal *Balance, amount decimal.Decimal) (avail, locked decimal.Decimal) {
+	locked = decimal.Min(amount, bal.Reserved)
+	bal.Reserved = bal.Reserved.Sub(locked)
+	return amount.Sub(locked), locked
+}
+
+// postKeyed aplica à conta os deltas de disponível e travado que delta calcula
+// sobre o saldo atual e grava, na mesma transação, um lançamento de valor
+// disponível+travado com a chave key. Se key já está no ledger nada muda e o
+// lançamento existente é devolvido; deltas zerados que também não mexem em
+// Reserved não geram lançamento (entry nil).
+func (we *WalletEngine) postKeyed(userID, asset, key string, typ LedgerEntryType, ref string, delta func(bal *Balance) (avail, locked decimal.Decimal)) (*LedgerEntry, error) {
+	we.mu.Lock()
+	defer we.mu.Unlock()
+	if entry, err := we.ledger.FindEntryByKey(key); err != nil || entry != nil {
+		return entry, err
+	}
+	acc, bal, err := we.getOrCreateBalance(userID, asset)
+	if err != nil {
+		return nil, err
+	}
+	reserved := bal.Reserved
+	avail, locked := delta(bal)
+	if avail.IsZero() && locked.IsZero() && bal.Reserved.Equal(reserved) {
+		return nil, nil
+	}
+	newAvail, err := bal.Available.CheckedAdd(avail)
+	if err != nil {
+		return nil, err
+	}
+	newLocked, err := bal.Locked.CheckedAdd(locked)
+	if err != nil {
+		return nil, err
+	}
+	if newAvail.IsNegative() {
+		return nil, errors.New("insufficient available balance")
+	}
+	if newLocked.IsNegative() {
+		return nil, errors.New("insufficient locked balance")
+	}
+
+	bal.Available = newAvail
+	bal.Locked = newLocked
 	bal.UpdatedAt = time.Now()
-	return we.wallets.UpdateBalance(bal)
+	entry := &LedgerEntry{
+		ID:        uuid.NewString(),
+		AccountID: acc.ID,
+		Asset:     asset,
+		Type:      typ,
+		Amount:    avail.Add(locked),
+		Reference: ref,
+		Key:       key,
+		CreatedAt: time.Now(),
+	}
+	if err := we.ledger.PostEntry(entry, bal); err != nil {
+		return nil, err
+	}
+	if we.notifier != nil {
+		_ = we.notifier.NotifyBalance(userID, asset, *bal)
+	}
+	return entry, nil
 }
 
-func (we *WalletEngine) CreateDeposit(userID, asset string, amount float64) (*DepositRequest, error) {
-	if amount <= 0 {
+func (we *WalletEngine) CreateDeposit(userID, asset string, amount decimal.Decimal) (*DepositRequest, error) {
+	if !amount.IsPositive() {
 		return nil, errors.New("amount must be > 0")
 	}
+	if err := we.checkPrecision(asset, amount); err != nil {
+		return nil, err
+	}
 	now := time.Now()
 	dep := &DepositRequest{
 		ID:        uuid.NewString(),
@@ -169,10 +337,13 @@ func (we *WalletEngine) ConfirmDeposit(depositID string, txHash *string) error {
 	return we.deposits.UpdateDeposit(dep)
 }
 
-func (we *WalletEngine) RequestWithdrawal(userID, asset string, amount float64, address string) (*WithdrawalRequest, error) {
-	if amount <= 0 {
+func (we *WalletEngine) RequestWithdrawal(userID, asset string, amount decimal.Decimal, address string) (*WithdrawalRequest, error) {
+	if !amount.IsPositive() {
 		return nil, errors.New("amount must be > 0")
 	}
+	if err := we.checkPrecision(asset, amount); err != nil {
+		return nil, err
+	}
 	if err := we.lock(userID, asset, amount); err != nil {
 		return nil, err
 	}
@@ -202,29 +373,7 @@ func (we *WalletEngine) CompleteWithdrawal(withdrawalID string, txHash *string)
 		return errors.New("withdrawal not in correct status")
 	}
 
-	_, bal, err := we.getOrCreateBalance(w.UserID, w.Asset)
-	if err != nil {
-		return err
-	}
-	if bal.Locked < w.Amount {
-		return errors.New("locked balance insufficient")
-	}
-	bal.Locked -= w.Amount
-	bal.UpdatedAt = time.Now()
-	if err := we.wallets.UpdateBalance(bal); err != nil {
-		return err
-	}
-
-	entry := &LedgerEntry{
-		ID:        uuid.NewString(),
-		AccountID: bal.AccountID,
-		Asset:     w.Asset,
-		Type:      LedgerEntryWithdrawal,
-		Amount:    -w.Amount,
-		Reference: w.ID,
-		CreatedAt: time.Now(),
-	}
-	if err := we.ledger.SaveEntry(entry); err != nil {
+	if err := we.debitLocked(w.UserID, w.Asset, w.Amount, LedgerEntryWithdrawal, w.ID); err != nil {
 		return err
 	}
 
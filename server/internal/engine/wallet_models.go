@@ -1,6 +1,10 @@
 package engine
 
-import "time"
+import (
+	"time"
+
+	"hearcap/server/internal/decimal"
+)
 
 type AssetType string
 
@@ -29,8 +33,11 @@ type WalletAccount struct {
 
 type Balance struct {
 	AccountID string
-	Available float64
-	Locked    float64
+	Available decimal.Decimal
+	Locked    decimal.Decimal
+	// Reserved é trava sobre saldo ainda a receber de trades não liquidados
+	// (saídas de bracket); vira Locked quando a liquidação credita o ativo.
+	Reserved  decimal.Decimal
 	UpdatedAt time.Time
 }
 
@@ -45,6 +52,9 @@ const (
 	LedgerEntryCorporateAct  LedgerEntryType = "CORPORATE_ACTION"
 	LedgerEntryAdjustment    LedgerEntryType = "ADJUSTMENT"
 	LedgerEntryInternalTrans LedgerEntryType = "INTERNAL_TRANSFER"
+	LedgerEntryOffering      LedgerEntryType = "PRIMARY_OFFERING"
+	LedgerEntryFailPenalty   LedgerEntryType = "SETTLEMENT_PENALTY"
+	LedgerEntryBuyIn         LedgerEntryType = "BUY_IN"
 )
 
 type LedgerEntry struct {
@@ -52,8 +62,11 @@ type LedgerEntry struct {
 	AccountID string
 	Asset     string
 	Type      LedgerEntryType
-	Amount    float64
+	Amount    decimal.Decimal
 	Reference string
+	// Key é a chave de idempotência do lançamento (vazia nos lançamentos
+	// comuns): a mesma chave nunca é aplicada duas vezes.
+	Key       string
 	CreatedAt time.Time
 }
 
@@ -69,7 +82,7 @@ type DepositRequest struct {
 	ID        string
 	UserID    string
 	Asset     string
-	Amount    float64
+	Amount    decimal.Decimal
 	Status    DepositStatus
 	TxHash    *string
 	CreatedAt time.Time
@@ -89,11 +102,10 @@ type WithdrawalRequest struct {
 	ID        string
 	UserID    string
 	Asset     string
-	Amount    float64
+	Amount    decimal.Decimal
 	Address   string
 	Status    WithdrawalStatus
 	TxHash    *string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
-
@@ -18,6 +18,7 @@ import (
 // ws://host/ws/market/book?symbol=GNX
 // ws://host/ws/market/ticker?symbol=GNX
 // ws://host/ws/market/candles?symbol=GNX&interval=1m
+// ws://host/ws/market/auction?symbol=GNX
 
 type MarketDataWSHandler struct {
 	marketData *engine.MarketDataEngine
@@ -41,6 +42,13 @@ func (h *MarketDataWSHandler) SetMarketDataEngine(engine *engine.MarketDataEngin
 	h.marketData = engine
 }
 
+// SetMatchingEngine liga o engine usado como fallback do book (thread-safe)
+func (h *MarketDataWSHandler) SetMatchingEngine(matching *engine.MatchingEngine) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.matching = matching
+}
+
 func (h *MarketDataWSHandler) HandleTrades(c *websocket.Conn) {
 	symbol := strings.ToUpper(c.Query("symbol", ""))
 	if symbol == "" {
@@ -232,6 +240,38 @@ func (h *MarketDataWSHandler) HandleCandles(c *websocket.Conn) {
 	}
 }
 
+// HandleAuction transmite o preço indicativo e o desequilíbrio dos leilões
+// de abertura/reabertura do símbolo.
+func (h *MarketDataWSHandler) HandleAuction(c *websocket.Conn) {
+	symbol := strings.ToUpper(c.Query("symbol", ""))
+	if symbol == "" {
+		c.WriteJSON(fiber.Map{"error": "symbol is required"})
+		c.Close()
+		return
+	}
+
+	streamID := "auction:" + symbol
+	h.registerClient(streamID, c)
+	defer h.unregisterClient(streamID, c)
+
+	// Envia o indicativo atual se houver leilão em curso
+	if ind, ok := h.marketData.GetAuctionIndicative(symbol); ok {
+		c.WriteJSON(fiber.Map{
+			"stream": "auction",
+			"data":   ind,
+		})
+	}
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := c.WriteJSON(fiber.Map{"type": "ping"}); err != nil {
+			return
+		}
+	}
+}
+
 func (h *MarketDataWSHandler) registerClient(streamID string, conn *websocket.Conn) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -389,3 +429,34 @@ func (h *MarketDataWSHandler) BroadcastOrderBook(symbol string, snapshot engine.
 		}
 	}
 }
+
+// BroadcastAuction envia o indicativo de leilão do símbolo
+func (h *MarketDataWSHandler) BroadcastAuction(ind *engine.AuctionIndicative) {
+	streamID := "auction:" + ind.Symbol
+	h.mu.RLock()
+	clients, ok := h.clients[streamID]
+	if !ok {
+		h.mu.RUnlock()
+		return
+	}
+	clientsCopy := make(map[*websocket.Conn]bool, len(clients))
+	for conn := range clients {
+		clientsCopy[conn] = true
+	}
+	h.mu.RUnlock()
+
+	msg := fiber.Map{
+		"stream": "auction",
+		"data":   ind,
+	}
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	for conn := range clientsCopy {
+		if err := conn.WriteMessage(websocket.TextMessage, msgBytes); err != nil {
+			h.unregisterClient(streamID, conn)
+		}
+	}
+}
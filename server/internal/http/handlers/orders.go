@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"hearcap/server/internal/decimal"
+	"hearcap/server/internal/engine"
+	"hearcap/server/internal/services"
+)
+
+// OrderHandler expõe a entrada de ordens do MatchingEngine e as consultas de
+// ordens e fills persistidos.
+type OrderHandler struct {
+	matching *engine.MatchingEngine
+	orders   *services.GORMOrderRepository
+}
+
+func NewOrderHandler(matching *engine.MatchingEngine, orders *services.GORMOrderRepository) *OrderHandler {
+	return &OrderHandler{
+		matching: matching,
+		orders:   orders,
+	}
+}
+
+type placeOrderRequest struct {
+	UserID          string          `json:"user_id"`
+	Symbol          string          `json:"symbol"`
+	Side            string          `json:"side"`
+	Type            string          `json:"type"`
+	Price           decimal.Decimal `json:"price"`
+	StopPrice       decimal.Decimal `json:"stop_price"`
+	Quantity        decimal.Decimal `json:"quantity"`
+	QuoteQty        decimal.Decimal `json:"quote_qty"`
+	DisplayQty      decimal.Decimal `json:"display_qty"`
+	TrailingAmount  decimal.Decimal `json:"trailing_amount"`
+	TrailingPercent decimal.Decimal `json:"trailing_percent"`
+	TimeInForce     string          `json:"time_in_force"`
+	ExpireAt        *time.Time      `json:"expire_at"`
+	PostOnly        string          `json:"post_only"`
+	STP             string          `json:"stp"`
+}
+
+type amendOrderRequest struct {
+	UserID   string          `json:"user_id"`
+	Price    decimal.Decimal `json:"price"`
+	Quantity decimal.Decimal `json:"quantity"`
+}
+
+// orderResponse é a visão JSON de uma ordem.
+type orderResponse struct {
+	ID          string              `json:"id"`
+	UserID      string              `json:"user_id"`
+	Symbol      string              `json:"symbol"`
+	Side        engine.Side         `json:"side"`
+	Type        engine.OrderType    `json:"type"`
+	Triggered   bool                `json:"triggered,omitempty"`
+	Status      engine.OrderStatus  `json:"status"`
+	Price       decimal.Decimal     `json:"price"`
+	StopPrice   decimal.Decimal     `json:"stop_price"`
+	Quantity    decimal.Decimal     `json:"quantity"`
+	FilledQty   decimal.Decimal     `json:"filled_qty"`
+	FilledQuote decimal.Decimal     `json:"filled_quote"`
+	QuoteQty    decimal.Decimal     `json:"quote_qty"`
+	DisplayQty  decimal.Decimal     `json:"display_qty"`
+	TimeInForce engine.TimeInForce  `json:"time_in_force"`
+	ExpireAt    *time.Time          `json:"expire_at,omitempty"`
+	PostOnly    engine.PostOnlyMode `json:"post_only,omitempty"`
+	STP         engine.STPMode      `json:"stp,omitempty"`
+	GroupID     string              `json:"group_id,omitempty"`
+	Seq         uint64              `json:"seq"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+// fillResponse é uma execução vista por um dos lados.
+type fillResponse struct {
+	ID        string          `json:"id"`
+	Symbol    string          `json:"symbol"`
+	OrderID   string          `json:"order_id"`
+	Side      engine.Side     `json:"side"`
+	Liquidity string          `json:"liquidity"` // MAKER ou TAKER
+	Price     decimal.Decimal `json:"price"`
+	Quantity  decimal.Decimal `json:"quantity"`
+	Fee       decimal.Decimal `json:"fee"`
+	FeeAsset  string          `json:"fee_asset,omitempty"`
+	Seq       uint64          `json:"seq"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// POST /api/orders
+func (h *OrderHandler) PlaceOrder(c *fiber.Ctx) error {
+	var req placeOrderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return orderErrorJSON(c, http.StatusBadRequest, "INVALID_BODY", "corpo inválido")
+	}
+	if _, err := uuid.Parse(req.UserID); err != nil {
+		return orderErrorJSON(c, http.StatusBadRequest, "INVALID_USER", "user_id inválido")
+	}
+
+	order, err := h.matching.PlaceOrder(engine.NewOrderRequest{
+		UserID:          req.UserID,
+		Symbol:          strings.ToUpper(req.Symbol),
+		Side:            engine.Side(strings.ToUpper(req.Side)),
+		Type:            engine.OrderType(strings.ToUpper(req.Type)),
+		Price:           req.Price,
+		StopPrice:       req.StopPrice,
+		Quantity:        req.Quantity,
+		QuoteQty:        req.QuoteQty,
+		DisplayQty:      req.DisplayQty,
+		TrailingAmount:  req.TrailingAmount,
+		TrailingPercent: req.TrailingPercent,
+		TimeInForce:     engine.TimeInForce(strings.ToUpper(req.TimeInForce)),
+		ExpireAt:        req.ExpireAt,
+		PostOnly:        engine.PostOnlyMode(strings.ToUpper(req.PostOnly)),
+		STP:             engine.STPMode(strings.ToUpper(req.STP)),
+	})
+	if err != nil {
+		return translateOrderError(c, err)
+	}
+	return c.Status(http.StatusCreated).JSON(newOrderResponse(order))
+}
+
+// DELETE /api/orders/:id?user_id=...
+func (h *OrderHandler) CancelOrder(c *fiber.Ctx) error {
+	userID := c.Query("user_id")
+	if _, err := uuid.Parse(userID); err != nil {
+		return orderErrorJSON(c, http.StatusBadRequest, "INVALID_USER", "user_id inválido")
+	}
+
+	order, err := h.matching.CancelOrder(c.Params("id"), userID)
+	if err != nil {
+		return translateOrderError(c, err)
+	}
+	return c.JSON(newOrderResponse(order))
+}
+
+// PATCH /api/orders/:id (price e/ou quantity; zero mantém o valor atual)
+func (h *OrderHandler) AmendOrder(c *fiber.Ctx) error {
+	var req amendOrderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return orderErrorJSON(c, http.StatusBadRequest, "INVALID_BODY", "corpo inválido")
+	}
+	if _, err := uuid.Parse(req.UserID); err != nil {
+		return orderErrorJSON(c, http.StatusBadRequest, "INVALID_USER", "user_id inválido")
+	}
+
+	order, err := h.matching.AmendOrder(engine.AmendOrderRequest{
+		OrderID:     c.Params("id"),
+		UserID:      req.UserID,
+		NewPrice:    req.Price,
+		NewQuantity: req.Quantity,
+	})
+	if err != nil {
+		return translateOrderError(c, err)
+	}
+	return c.JSON(newOrderResponse(order))
+}
+
+// GET /api/orders/:id?user_id=...
+func (h *OrderHandler) GetOrder(c *fiber.Ctx) error {
+	userID := c.Query("user_id")
+	if _, err := uuid.Parse(userID); err != nil {
+		return orderErrorJSON(c, http.StatusBadRequest, "INVALID_USER", "user_id inválido")
+	}
+
+	order, err := h.orders.FindOrder(c.Params("id"))
+	if err != nil {
+		return translateOrderError(c, err)
+	}
+	if order == nil || order.UserID != userID {
+		return translateOrderError(c, engine.ErrOrderNotFound)
+	}
+	return c.JSON(newOrderResponse(order))
+}
+
+// GET /api/orders/open?user_id=...&symbol=GNX
+func (h *OrderHandler) GetOpenOrders(c *fiber.Ctx) error {
+	return h.listOrders(c, true)
+}
+
+// GET /api/orders/history?user_id=...&symbol=GNX&limit=100
+func (h *OrderHandler) GetOrderHistory(c *fiber.Ctx) error {
+	return h.listOrders(c, false)
+}
+
+func (h *OrderHandler) listOrders(c *fiber.Ctx, openOnly bool) error {
+	userID := c.Query("user_id")
+	if _, err := uuid.Parse(userID); err != nil {
+		return orderErrorJSON(c, http.StatusBadRequest, "INVALID_USER", "user_id inválido")
+	}
+
+	orders, err := h.orders.ListOrdersByUser(userID, strings.ToUpper(c.Query("symbol")), openOnly, queryLimit(c))
+	if err != nil {
+		return translateOrderError(c, err)
+	}
+	result := make([]orderResponse, len(orders))
+	for i, o := range orders {
+		result[i] = newOrderResponse(o)
+	}
+	return c.JSON(fiber.Map{
+		"user_id": userID,
+		"orders":  result,
+	})
+}
+
+// GET /api/fills?user_id=...&symbol=GNX&limit=100
+func (h *OrderHandler) GetFills(c *fiber.Ctx) error {
+	userID := c.Query("user_id")
+	if _, err := uuid.Parse(userID); err != nil {
+		return orderErrorJSON(c, http.StatusBadRequest, "INVALID_USER", "user_id inválido")
+	}
+
+	trades, err := h.orders.ListFillsByUser(userID, strings.ToUpper(c.Query("symbol")), queryLimit(c))
+	if err != nil {
+		return translateOrderError(c, err)
+	}
+	result := make([]fillResponse, len(trades))
+	for i, t := range trades {
+		// Num self-trade, vale o lado comprador.
+		side := engine.SideBuy
+		if t.BuyerID != userID {
+			side = engine.SideSell
+		}
+		result[i] = newFillResponse(t, side)
+	}
+	return c.JSON(fiber.Map{
+		"user_id": userID,
+		"fills":   result,
+	})
+}
+
+// queryLimit lê ?limit= (padrão 100, máximo 1000).
+func queryLimit(c *fiber.Ctx) int {
+	limit := 100
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+	return limit
+}
+
+func newOrderResponse(o *engine.Order) orderResponse {
+	return orderResponse{
+		ID:          o.ID,
+		UserID:      o.UserID,
+		Symbol:      o.Symbol,
+		Side:        o.Side,
+		Type:        o.Type,
+		Triggered:   o.Triggered,
+		Status:      o.Status,
+		Price:       o.Price,
+		StopPrice:   o.StopPrice,
+		Quantity:    o.Quantity,
+		FilledQty:   o.FilledQty,
+		FilledQuote: o.FilledQuote,
+		QuoteQty:    o.QuoteQty,
+		DisplayQty:  o.DisplayQty,
+		TimeInForce: o.TimeInForce,
+		ExpireAt:    o.ExpireAt,
+		PostOnly:    o.PostOnly,
+		STP:         o.STP,
+		GroupID:     o.GroupID,
+		Seq:         o.Seq,
+		CreatedAt:   o.CreatedAt,
+		UpdatedAt:   o.UpdatedAt,
+	}
+}
+
+// newFillResponse monta a execução do ponto de vista do lado side.
+func newFillResponse(t *engine.Trade, side engine.Side) fillResponse {
+	f := fillResponse{
+		ID:        t.ID,
+		Symbol:    t.Symbol,
+		OrderID:   t.BuyOrder,
+		Side:      engine.SideBuy,
+		Price:     t.Price,
+		Quantity:  t.Quantity,
+		Fee:       t.BuyerFee,
+		FeeAsset:  t.FeeAsset,
+		Seq:       t.Seq,
+		CreatedAt: t.CreatedAt,
+	}
+	if side == engine.SideSell {
+		f.OrderID, f.Side, f.Fee = t.SellOrder, engine.SideSell, t.SellerFee
+	}
+	f.Liquidity = "MAKER"
+	if f.Side == t.TakerSide {
+		f.Liquidity = "TAKER"
+	}
+	return f
+}
+
+func orderErrorJSON(c *fiber.Ctx, status int, code, message string) error {
+	return c.Status(status).JSON(fiber.Map{
+		"error": message,
+		"code":  code,
+	})
+}
+
+// orderErrors mapeia os erros do engine para status HTTP e código estável.
+var orderErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{engine.ErrInvalidOrder, http.StatusBadRequest, "INVALID_ORDER"},
+	{engine.ErrInvalidQuantity, http.StatusBadRequest, "INVALID_QUANTITY"},
+	{engine.ErrInvalidPrice, http.StatusBadRequest, "INVALID_PRICE"},
+	{engine.ErrInvalidTimeInForce, http.StatusBadRequest, "INVALID_TIME_IN_FORCE"},
+	{engine.ErrInvalidExpireAt, http.StatusBadRequest, "INVALID_EXPIRE_AT"},
+	{engine.ErrInvalidSTPMode, http.StatusBadRequest, "INVALID_STP_MODE"},
+	{engine.ErrInvalidDisplayQty, http.StatusBadRequest, "INVALID_DISPLAY_QTY"},
+	{engine.ErrInvalidStopOrder, http.StatusBadRequest, "INVALID_STOP_ORDER"},
+	{engine.ErrInvalidQuoteQty, http.StatusBadRequest, "INVALID_QUOTE_QTY"},
+	{engine.ErrInvalidAmend, http.StatusBadRequest, "INVALID_AMEND"},
+	{engine.ErrPriceNotOnTick, http.StatusBadRequest, "PRICE_NOT_ON_TICK"},
+	{engine.ErrQtyNotOnLot, http.StatusBadRequest, "QTY_NOT_ON_LOT"},
+	{engine.ErrQtyBelowMinimum, http.StatusBadRequest, "QTY_BELOW_MINIMUM"},
+	{engine.ErrQtyAboveMaximum, http.StatusBadRequest, "QTY_ABOVE_MAXIMUM"},
+	{engine.ErrNotionalBelowMinimum, http.StatusBadRequest, "NOTIONAL_BELOW_MINIMUM"},
+	{engine.ErrOrderTooLarge, http.StatusBadRequest, "ORDER_TOO_LARGE"},
+	{engine.ErrInsufficientBase, http.StatusUnprocessableEntity, "INSUFFICIENT_BALANCE"},
+	{engine.ErrInsufficientQuote, http.StatusUnprocessableEntity, "INSUFFICIENT_BALANCE"},
+	{engine.ErrPostOnlyWouldCross, http.StatusUnprocessableEntity, "POST_ONLY_WOULD_CROSS"},
+	{engine.ErrFOKNotFillable, http.StatusUnprocessableEntity, "FOK_NOT_FILLABLE"},
+	{engine.ErrNoLiquidity, http.StatusUnprocessableEntity, "NO_LIQUIDITY"},
+	{engine.ErrUnknownMarket, http.StatusNotFound, "UNKNOWN_MARKET"},
+	{engine.ErrMarketNotOpen, http.StatusConflict, "MARKET_NOT_OPEN"},
+	{engine.ErrMarketHalted, http.StatusConflict, "MARKET_HALTED"},
+	{engine.ErrMarketClosed, http.StatusConflict, "MARKET_CLOSED"},
+	{engine.ErrMarketInAuction, http.StatusConflict, "MARKET_IN_AUCTION"},
+	{engine.ErrMarketDelisted, http.StatusConflict, "MARKET_DELISTED"},
+	{engine.ErrOrderNotFound, http.StatusNotFound, "ORDER_NOT_FOUND"},
+	{engine.ErrOrderNotOwned, http.StatusForbidden, "ORDER_NOT_OWNED"},
+	{engine.ErrOrderNotActive, http.StatusConflict, "ORDER_NOT_ACTIVE"},
+}
+
+func translateOrderError(c *fiber.Ctx, err error) error {
+	for _, e := range orderErrors {
+		if errors.Is(err, e.err) {
+			return orderErrorJSON(c, e.status, e.code, err.Error())
+		}
+	}
+	return orderErrorJSON(c, http.StatusInternalServerError, "INTERNAL", "não foi possível processar a ordem")
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"hearcap/server/internal/decimal"
+	"hearcap/server/internal/engine"
+)
+
+// nopRepo, openBalances e nopEvents bastam para o MatchingEngine atender os
+// handlers sem banco: todo saldo pode ser travado.
+type nopRepo struct{}
+
+func (nopRepo) SaveOrder(*engine.Order) error                   { return nil }
+func (nopRepo) UpdateOrder(*engine.Order) error                 { return nil }
+func (nopRepo) SaveTrade(*engine.Trade, ...*engine.Order) error { return nil }
+func (nopRepo) SaveOrderGroup(*engine.OrderGroup) error         { return nil }
+func (nopRepo) UpdateOrderGroup(*engine.OrderGroup) error       { return nil }
+
+type openBalances struct{}
+
+func (openBalances) CanLockBase(string, string, decimal.Decimal) bool   { return true }
+func (openBalances) CanLockQuote(string, string, decimal.Decimal) bool  { return true }
+func (openBalances) LockBase(string, string, decimal.Decimal) error     { return nil }
+func (openBalances) LockQuote(string, string, decimal.Decimal) error    { return nil }
+func (openBalances) ReleaseBase(string, string, decimal.Decimal) error  { return nil }
+func (openBalances) ReleaseQuote(string, string, decimal.Decimal) error { return nil }
+
+type nopEvents struct{}
+
+func (nopEvents) PublishOrderBookUpdate(string, engine.OrderBookSnapshot) error { return nil }
+func (nopEvents) PublishTrade(*engine.Trade) error                              { return nil }
+func (nopEvents) PublishOrderEvent(*engine.OrderEvent) error                    { return nil }
+func (nopEvents) PublishOrderUpdate(*engine.Order) error                        { return nil }
+
+func newOrderTestApp(t *testing.T) (*fiber.App, *engine.MatchingEngine) {
+	t.Helper()
+	me := engine.NewMatchingEngine(nopRepo{}, openBalances{}, nopEvents{}, nil)
+	t.Cleanup(me.Stop)
+	h := NewOrderHandler(me, nil)
+	app := fiber.New()
+	app.Post("/api/orders", h.PlaceOrder)
+	app.Delete("/api/orders/:id", h.CancelOrder)
+	app.Patch("/api/orders/:id", h.AmendOrder)
+	return app, me
+}
+
+// do envia a requisição e devolve o status e o corpo decodificado.
+func do(t *testing.T, app *fiber.App, method, path, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	var out map[string]interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Fatalf("%s %s: invalid JSON %q", method, path, raw)
+	}
+	return resp.StatusCode, out
+}
+
+func TestPlaceOrderEndpoint(t *testing.T) {
+	alice := uuid.NewString()
+	tests := []struct {
+		name   string
+		body   string
+		halt   bool
+		status int
+		code   string
+	}{
+		{"invalid body", `{`, false, http.StatusBadRequest, "INVALID_BODY"},
+		{"invalid user", `{"user_id":"alice","symbol":"gnx","side":"buy","type":"limit","price":"10","quantity":"1"}`, false, http.StatusBadRequest, "INVALID_USER"},
+		{"invalid price", `{"user_id":"` + alice + `","symbol":"gnx","side":"buy","type":"limit","price":"0","quantity":"1"}`, false, http.StatusBadRequest, "INVALID_PRICE"},
+		{"halted market", `{"user_id":"` + alice + `","symbol":"gnx","side":"buy","type":"limit","price":"10","quantity":"1"}`, true, http.StatusConflict, "MARKET_HALTED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, me := newOrderTestApp(t)
+			if tt.halt {
+				if err := me.SetMarketStatus("GNX", engine.MarketStatusHalted); err != nil {
+					t.Fatal(err)
+				}
+			}
+			status, body := do(t, app, http.MethodPost, "/api/orders", tt.body)
+			if status != tt.status || body["code"] != tt.code {
+				t.Fatalf("got %d %v, want %d %s", status, body, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestOrderLifecycleEndpoints(t *testing.T) {
+	app, _ := newOrderTestApp(t)
+	alice, bob := uuid.NewString(), uuid.NewString()
+
+	status, order := do(t, app, http.MethodPost, "/api/orders",
+		`{"user_id":"`+alice+`","symbol":"gnx","side":"buy","type":"limit","price":"10","quantity":"2"}`)
+	if status != http.StatusCreated || order["symbol"] != "GNX" || order["status"] != string(engine.OrderStatusNew) {
+		t.Fatalf("place = %d %v", status, order)
+	}
+	id := order["id"].(string)
+
+	status, amended := do(t, app, http.MethodPatch, "/api/orders/"+id, `{"user_id":"`+alice+`","quantity":"1"}`)
+	if status != http.StatusOK || amended["quantity"] != 1.0 {
+		t.Fatalf("amend = %d %v", status, amended)
+	}
+	if status, body := do(t, app, http.MethodDelete, "/api/orders/"+id+"?user_id="+bob, ""); status != http.StatusForbidden || body["code"] != "ORDER_NOT_OWNED" {
+		t.Fatalf("cancel by another user = %d %v", status, body)
+	}
+	if status, body := do(t, app, http.MethodDelete, "/api/orders/"+id+"?user_id="+alice, ""); status != http.StatusOK || body["status"] != string(engine.OrderStatusCanceled) {
+		t.Fatalf("cancel = %d %v", status, body)
+	}
+	if status, body := do(t, app, http.MethodDelete, "/api/orders/"+uuid.NewString()+"?user_id="+alice, ""); status != http.StatusNotFound || body["code"] != "ORDER_NOT_FOUND" {
+		t.Fatalf("cancel unknown order = %d %v", status, body)
+	}
+}
+
+func TestNewFillResponse(t *testing.T) {
+	trade := &engine.Trade{
+		ID: "t1", BuyOrder: "b1", SellOrder: "s1", TakerSide: engine.SideSell,
+		BuyerFee: decimal.RequireFromString("0.1"), SellerFee: decimal.RequireFromString("0.2"),
+	}
+	buy, sell := newFillResponse(trade, engine.SideBuy), newFillResponse(trade, engine.SideSell)
+	if buy.OrderID != "b1" || buy.Liquidity != "MAKER" || !buy.Fee.Equal(trade.BuyerFee) {
+		t.Fatalf("buyer fill = %+v", buy)
+	}
+	if sell.OrderID != "s1" || sell.Liquidity != "TAKER" || !sell.Fee.Equal(trade.SellerFee) {
+		t.Fatalf("seller fill = %+v", sell)
+	}
+}
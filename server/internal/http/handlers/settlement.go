@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"hearcap/server/internal/decimal"
+	"hearcap/server/internal/engine"
+)
+
+// SettlementHandler expõe os lotes de liquidação do ClearingEngine: relatório
+// por lote (JSON ou CSV) e extrato por participante.
+type SettlementHandler struct {
+	clearing *engine.ClearingEngine
+}
+
+func NewSettlementHandler(clearing *engine.ClearingEngine) *SettlementHandler {
+	return &SettlementHandler{clearing: clearing}
+}
+
+// settlementBatchResponse é a visão JSON de um lote.
+type settlementBatchResponse struct {
+	ID               string                  `json:"id"`
+	Symbol           string                  `json:"symbol,omitempty"`
+	Symbols          []string                `json:"symbols"`
+	SettlementDate   time.Time               `json:"settlement_date"`
+	Status           engine.SettlementStatus `json:"status"`
+	PositionCount    int                     `json:"position_count"`
+	ParticipantCount int                     `json:"participant_count"`
+	ObligationCount  int                     `json:"obligation_count"`
+	FailedCount      int                     `json:"failed_count"`
+	CreatedAt        time.Time               `json:"created_at"`
+	CompletedAt      *time.Time              `json:"completed_at,omitempty"`
+	Error            *string                 `json:"error,omitempty"`
+}
+
+type settlementAssetResponse struct {
+	Asset        string          `json:"asset"`
+	Gross        decimal.Decimal `json:"gross"`
+	Net          decimal.Decimal `json:"net"`
+	Participants int             `json:"participants"`
+}
+
+type settlementObligationResponse struct {
+	ID            string                  `json:"id"`
+	BatchID       string                  `json:"batch_id"`
+	UserID        string                  `json:"user_id"`
+	Asset         string                  `json:"asset"`
+	Delivered     decimal.Decimal         `json:"delivered"`
+	Received      decimal.Decimal         `json:"received"`
+	Net           decimal.Decimal         `json:"net"`
+	Settled       decimal.Decimal         `json:"settled"`
+	Status        engine.SettlementStatus `json:"status"`
+	Attempts      int                     `json:"attempts,omitempty"`
+	FailedSince   *time.Time              `json:"failed_since,omitempty"`
+	NextAttemptAt *time.Time              `json:"next_attempt_at,omitempty"`
+	Penalties     decimal.Decimal         `json:"penalties"`
+	BuyInCost     decimal.Decimal         `json:"buy_in_cost"`
+	Error         *string                 `json:"error,omitempty"`
+}
+
+type settlementPositionResponse struct {
+	Symbol     string                  `json:"symbol"`
+	BaseDelta  decimal.Decimal         `json:"base_delta"`
+	QuoteDelta decimal.Decimal         `json:"quote_delta"`
+	Status     engine.SettlementStatus `json:"status"`
+}
+
+// GET /api/settlement/batches?limit=100
+func (h *SettlementHandler) ListBatches(c *fiber.Ctx) error {
+	batches, err := h.clearing.ListBatches(queryLimit(c))
+	if err != nil {
+		return translateSettlementError(c, err)
+	}
+	result := make([]settlementBatchResponse, len(batches))
+	for i, b := range batches {
+		result[i] = newSettlementBatchResponse(b)
+	}
+	return c.JSON(fiber.Map{"batches": result})
+}
+
+// GET /api/settlement/batches/:id/report?format=json|csv
+func (h *SettlementHandler) GetReport(c *fiber.Ctx) error {
+	report, err := h.clearing.BatchReport(c.Params("id"))
+	if err != nil {
+		return translateSettlementError(c, err)
+	}
+
+	if c.Query("format") == "csv" {
+		body, err := settlementReportCSV(report)
+		if err != nil {
+			return translateSettlementError(c, err)
+		}
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="settlement-`+report.Batch.ID+`.csv"`)
+		return c.Send(body)
+	}
+
+	assets := make([]settlementAssetResponse, len(report.Assets))
+	for i, a := range report.Assets {
+		assets[i] = settlementAssetResponse{Asset: a.Asset, Gross: a.Gross, Net: a.Net, Participants: a.Participants}
+	}
+	return c.JSON(fiber.Map{
+		"batch":       newSettlementBatchResponse(report.Batch),
+		"assets":      assets,
+		"obligations": newSettlementObligationResponses(report.Obligations),
+	})
+}
+
+// GET /api/settlement/batches/:id/statements/:user_id
+func (h *SettlementHandler) GetStatement(c *fiber.Ctx) error {
+	st, err := h.clearing.ParticipantStatement(c.Params("id"), c.Params("user_id"))
+	if err != nil {
+		return translateSettlementError(c, err)
+	}
+
+	positions := make([]settlementPositionResponse, len(st.Positions))
+	for i, p := range st.Positions {
+		positions[i] = settlementPositionResponse{Symbol: p.Symbol, BaseDelta: p.BaseDelta, QuoteDelta: p.QuoteDelta, Status: p.Status}
+	}
+	return c.JSON(fiber.Map{
+		"batch_id":        st.BatchID,
+		"user_id":         st.UserID,
+		"settlement_date": st.SettlementDate,
+		"positions":       positions,
+		"obligations":     newSettlementObligationResponses(st.Obligations),
+	})
+}
+
+// GET /api/settlement/fails
+func (h *SettlementHandler) ListFails(c *fiber.Ctx) error {
+	fails, err := h.clearing.ListFails()
+	if err != nil {
+		return translateSettlementError(c, err)
+	}
+	return c.JSON(fiber.Map{"fails": newSettlementObligationResponses(fails)})
+}
+
+// settlementReportCSV gera uma linha por obrigação do lote.
+func settlementReportCSV(report *engine.SettlementReport) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"batch_id", "settlement_date", "user_id", "asset", "delivered", "received", "net", "settled", "status", "penalties", "buy_in_cost", "error"})
+	date := report.Batch.SettlementDate.Format(time.RFC3339)
+	for _, ob := range report.Obligations {
+		errMsg := ""
+		if ob.ErrorMessage != nil {
+			errMsg = *ob.ErrorMessage
+		}
+		_ = w.Write([]string{
+			report.Batch.ID, date, ob.UserID, ob.Asset,
+			ob.Delivered.String(), ob.Received.String(), ob.Net.String(), ob.Settled.String(),
+			string(ob.Status), ob.Penalties.String(), ob.BuyInCost.String(), errMsg,
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func newSettlementBatchResponse(b *engine.SettlementBatch) settlementBatchResponse {
+	return settlementBatchResponse{
+		ID:               b.ID,
+		Symbol:           b.Symbol,
+		Symbols:          b.Symbols,
+		SettlementDate:   b.SettlementDate,
+		Status:           b.Status,
+		PositionCount:    b.PositionCount,
+		ParticipantCount: b.ParticipantCount,
+		ObligationCount:  b.ObligationCount,
+		FailedCount:      b.FailedCount,
+		CreatedAt:        b.CreatedAt,
+		CompletedAt:      b.CompletedAt,
+		Error:            b.ErrorMessage,
+	}
+}
+
+func newSettlementObligationResponses(obs []*engine.SettlementObligation) []settlementObligationResponse {
+	result := make([]settlementObligationResponse, len(obs))
+	for i, ob := range obs {
+		result[i] = settlementObligationResponse{
+			ID:            ob.ID,
+			BatchID:       ob.BatchID,
+			UserID:        ob.UserID,
+			Asset:         ob.Asset,
+			Delivered:     ob.Delivered,
+			Received:      ob.Received,
+			Net:           ob.Net,
+			Settled:       ob.Settled,
+			Status:        ob.Status,
+			Attempts:      ob.Attempts,
+			FailedSince:   ob.FailedSince,
+			NextAttemptAt: ob.NextAttemptAt,
+			Penalties:     ob.Penalties,
+			BuyInCost:     ob.BuyInCost,
+			Error:         ob.ErrorMessage,
+		}
+	}
+	return result
+}
+
+func translateSettlementError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, engine.ErrBatchNotFound) {
+		return orderErrorJSON(c, http.StatusNotFound, "BATCH_NOT_FOUND", err.Error())
+	}
+	return orderErrorJSON(c, http.StatusInternalServerError, "INTERNAL", "não foi possível consultar a liquidação")
+}
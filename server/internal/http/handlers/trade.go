@@ -7,6 +7,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
+	"hearcap/server/internal/decimal"
 	"hearcap/server/internal/services"
 )
 
@@ -23,9 +24,9 @@ func NewTradeHandler(service *services.TradeService, wallets *services.WalletSer
 }
 
 type tradeRequest struct {
-	UserID   string  `json:"user_id"`
-	Symbol   string  `json:"symbol"`
-	Quantity float64 `json:"quantity"`
+	UserID   string          `json:"user_id"`
+	Symbol   string          `json:"symbol"`
+	Quantity decimal.Decimal `json:"quantity"`
 }
 
 func (h *TradeHandler) Buy(c *fiber.Ctx) error {
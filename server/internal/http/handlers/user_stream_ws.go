@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+
+	"hearcap/server/internal/decimal"
+	"hearcap/server/internal/engine"
+)
+
+// Stream privado do usuário:
+// POST /api/user-stream {"user_id": "..."} -> {"token": "..."}
+// ws://host/ws/user?user_id=...&token=...
+//
+// A API ainda não autentica usuários, então o token não é emitido a quem o
+// pede: POST /api/user-stream exige "Authorization: Bearer <chave do
+// emissor>" (USER_STREAM_ISSUER_KEY), usada pelo serviço que já autenticou o
+// usuário para obter o token em nome dele. Sem chave configurada a emissão
+// fica desligada.
+//
+// Cada mensagem leva "seq", contínuo por conexão a partir de 1: um salto
+// indica mensagem perdida e o cliente deve reconectar e reconsultar o REST.
+
+// userStreamTokenTTL é a validade de um token do stream privado.
+const userStreamTokenTTL = 24 * time.Hour
+
+// userStreamBuffer é quantas mensagens uma conexão pode acumular antes de ser
+// encerrada por lentidão.
+const userStreamBuffer = 256
+
+// UserStreamHandler entrega ordens, fills, saldos e eventos de risco a cada
+// usuário conectado. Implementa engine.EventBus, engine.BalanceNotifier e
+// engine.RiskNotificationService.
+type UserStreamHandler struct {
+	secret    []byte
+	issuerKey []byte
+	conns     map[string]map[*userConn]bool // usuário -> conexões
+	mu        sync.RWMutex                  // protege o map de conexões
+}
+
+// NewUserStreamHandler cria o handler. Sem segredo configurado, gera um
+// aleatório: os tokens emitidos deixam de valer quando o processo reinicia.
+// issuerKey é a chave exigida de quem pede tokens (vazia = emissão desligada).
+func NewUserStreamHandler(secret, issuerKey string) *UserStreamHandler {
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			log.Fatalf("user stream: erro ao gerar segredo: %v", err)
+		}
+		secret = hex.EncodeToString(buf)
+		log.Println("user stream: USER_STREAM_SECRET vazio, usando segredo aleatório")
+	}
+	if issuerKey == "" {
+		log.Println("user stream: USER_STREAM_ISSUER_KEY vazio, emissão de tokens desligada")
+	}
+	return &UserStreamHandler{
+		secret:    []byte(secret),
+		issuerKey: []byte(issuerKey),
+		conns:     make(map[string]map[*userConn]bool),
+	}
+}
+
+// userConn é uma conexão do stream com a sua própria sequência.
+type userConn struct {
+	userID string
+	out    chan []byte
+	done   chan struct{}
+	once   sync.Once
+
+	mu  sync.Mutex // serializa seq e enfileiramento
+	seq uint64
+}
+
+func newUserConn(userID string) *userConn {
+	return &userConn{
+		userID: userID,
+		out:    make(chan []byte, userStreamBuffer),
+		done:   make(chan struct{}),
+	}
+}
+
+// push numera e enfileira a mensagem. Com a fila cheia a conexão é encerrada:
+// o cliente reconecta em vez de seguir com um buraco na sequência.
+func (uc *userConn) push(typ string, data interface{}) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	msg, err := json.Marshal(fiber.Map{
+		"stream": "user",
+		"type":   typ,
+		"seq":    uc.seq + 1,
+		"data":   data,
+	})
+	if err != nil {
+		return
+	}
+	select {
+	case <-uc.done:
+		return
+	default:
+	}
+	select {
+	case uc.out <- msg:
+		uc.seq++
+	default:
+		uc.close()
+	}
+}
+
+func (uc *userConn) close() {
+	uc.once.Do(func() { close(uc.done) })
+}
+
+// SignUserStreamToken gera o token do stream de userID válido até expires.
+func SignUserStreamToken(secret []byte, userID string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(userID + ":" + exp))
+	return exp + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (h *UserStreamHandler) verifyToken(userID, token string) bool {
+	exp, _, ok := strings.Cut(token, ".")
+	if !ok || len(h.secret) == 0 {
+		return false
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+	expected := SignUserStreamToken(h.secret, userID, time.Unix(unix, 0))
+	return hmac.Equal([]byte(expected), []byte(token))
+}
+
+// authorizedIssuer confere a chave do emissor no header Authorization.
+func (h *UserStreamHandler) authorizedIssuer(c *fiber.Ctx) bool {
+	key, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	return ok && len(h.issuerKey) > 0 && hmac.Equal([]byte(key), h.issuerKey)
+}
+
+// POST /api/user-stream
+func (h *UserStreamHandler) CreateToken(c *fiber.Ctx) error {
+	if len(h.issuerKey) == 0 {
+		return orderErrorJSON(c, http.StatusForbidden, "TOKEN_ISSUING_DISABLED", "emissão de tokens do stream desligada")
+	}
+	if !h.authorizedIssuer(c) {
+		return orderErrorJSON(c, http.StatusUnauthorized, "UNAUTHORIZED", "chave do emissor inválida")
+	}
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return orderErrorJSON(c, http.StatusBadRequest, "INVALID_BODY", "corpo inválido")
+	}
+	if _, err := uuid.Parse(req.UserID); err != nil {
+		return orderErrorJSON(c, http.StatusBadRequest, "INVALID_USER", "user_id inválido")
+	}
+
+	expires := time.Now().Add(userStreamTokenTTL)
+	return c.JSON(fiber.Map{
+		"user_id":    req.UserID,
+		"token":      SignUserStreamToken(h.secret, req.UserID, expires),
+		"expires_at": expires,
+	})
+}
+
+// Authorize valida o token antes do upgrade para WebSocket.
+func (h *UserStreamHandler) Authorize(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+	userID := c.Query("user_id")
+	if !h.verifyToken(userID, c.Query("token")) {
+		return orderErrorJSON(c, http.StatusUnauthorized, "UNAUTHORIZED", "token do stream inválido ou expirado")
+	}
+	c.Locals("user_id", userID)
+	return c.Next()
+}
+
+func (h *UserStreamHandler) HandleUser(c *websocket.Conn) {
+	userID, _ := c.Locals("user_id").(string)
+	uc := newUserConn(userID)
+	h.register(uc)
+	defer h.unregister(uc)
+
+	uc.push("subscribed", fiber.Map{"user_id": userID})
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-uc.out:
+			if err := c.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			// Ping para manter conexão (fora da sequência)
+			if err := c.WriteJSON(fiber.Map{"type": "ping"}); err != nil {
+				return
+			}
+		case <-uc.done:
+			return
+		}
+	}
+}
+
+func (h *UserStreamHandler) register(uc *userConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.conns[uc.userID] == nil {
+		h.conns[uc.userID] = make(map[*userConn]bool)
+	}
+	h.conns[uc.userID][uc] = true
+	log.Printf("[WS] User stream connected: %s", uc.userID)
+}
+
+func (h *UserStreamHandler) unregister(uc *userConn) {
+	uc.close()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if conns, ok := h.conns[uc.userID]; ok {
+		delete(conns, uc)
+		if len(conns) == 0 {
+			delete(h.conns, uc.userID)
+		}
+	}
+	log.Printf("[WS] User stream disconnected: %s", uc.userID)
+}
+
+// send entrega a mensagem a todas as conexões de userID.
+func (h *UserStreamHandler) send(userID, typ string, data interface{}) {
+	h.mu.RLock()
+	conns := make([]*userConn, 0, len(h.conns[userID]))
+	for uc := range h.conns[userID] {
+		conns = append(conns, uc)
+	}
+	h.mu.RUnlock()
+
+	for _, uc := range conns {
+		uc.push(typ, data)
+	}
+}
+
+// broadcast entrega a mensagem a todos os usuários conectados.
+func (h *UserStreamHandler) broadcast(typ string, data interface{}) {
+	h.mu.RLock()
+	var conns []*userConn
+	for _, byUser := range h.conns {
+		for uc := range byUser {
+			conns = append(conns, uc)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, uc := range conns {
+		uc.push(typ, data)
+	}
+}
+
+// -------- engine.EventBus --------
+
+// PublishOrderBookUpdate não faz nada: o book público sai pelo MarketDataEngine.
+func (h *UserStreamHandler) PublishOrderBookUpdate(string, engine.OrderBookSnapshot) error {
+	return nil
+}
+
+// PublishTrade envia o fill (com a taxa) a comprador e vendedor.
+func (h *UserStreamHandler) PublishTrade(trade *engine.Trade) error {
+	h.send(trade.BuyerID, "fill", newFillResponse(trade, engine.SideBuy))
+	h.send(trade.SellerID, "fill", newFillResponse(trade, engine.SideSell))
+	return nil
+}
+
+func (h *UserStreamHandler) PublishOrderEvent(ev *engine.OrderEvent) error {
+	h.send(ev.UserID, "order_event", ev)
+	return nil
+}
+
+func (h *UserStreamHandler) PublishOrderUpdate(order *engine.Order) error {
+	h.send(order.UserID, "order", newOrderResponse(order))
+	return nil
+}
+
+// -------- engine.BalanceNotifier --------
+
+func (h *UserStreamHandler) NotifyBalance(userID, asset string, bal engine.Balance) error {
+	h.send(userID, "balance", struct {
+		Asset     string          `json:"asset"`
+		Available decimal.Decimal `json:"available"`
+		Locked    decimal.Decimal `json:"locked"`
+		Reserved  decimal.Decimal `json:"reserved"`
+		UpdatedAt time.Time       `json:"updated_at"`
+	}{asset, bal.Available, bal.Locked, bal.Reserved, bal.UpdatedAt})
+	return nil
+}
+
+// -------- engine.RiskNotificationService --------
+
+func (h *UserStreamHandler) NotifyRiskEvent(userID, symbol, eventType, msg string) error {
+	h.send(userID, "risk", fiber.Map{
+		"symbol":  symbol,
+		"event":   eventType,
+		"message": msg,
+	})
+	return nil
+}
+
+func (h *UserStreamHandler) NotifyMarketHalt(symbol, reason string) error {
+	h.broadcast("market_status", fiber.Map{
+		"symbol": symbol,
+		"status": engine.MarketStatusHalted,
+		"reason": reason,
+	})
+	return nil
+}
+
+func (h *UserStreamHandler) NotifyMarketResume(symbol string) error {
+	h.broadcast("market_status", fiber.Map{
+		"symbol": symbol,
+		"status": engine.MarketStatusOpen,
+	})
+	return nil
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"hearcap/server/internal/engine"
+)
+
+func TestCreateUserStreamToken(t *testing.T) {
+	alice := uuid.NewString()
+	tests := []struct {
+		name      string
+		issuerKey string
+		auth      string
+		body      string
+		status    int
+		code      string
+	}{
+		{"issuing disabled", "", "Bearer key", `{"user_id":"` + alice + `"}`, http.StatusForbidden, "TOKEN_ISSUING_DISABLED"},
+		{"missing key", "key", "", `{"user_id":"` + alice + `"}`, http.StatusUnauthorized, "UNAUTHORIZED"},
+		{"wrong key", "key", "Bearer other", `{"user_id":"` + alice + `"}`, http.StatusUnauthorized, "UNAUTHORIZED"},
+		{"invalid user", "key", "Bearer key", `{"user_id":"alice"}`, http.StatusBadRequest, "INVALID_USER"},
+		{"issued", "key", "Bearer key", `{"user_id":"` + alice + `"}`, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewUserStreamHandler("secret", tt.issuerKey)
+			app := fiber.New()
+			app.Post("/api/user-stream", h.CreateToken)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user-stream", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			var body map[string]interface{}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status || (tt.code != "" && body["code"] != tt.code) {
+				t.Fatalf("got %d %v, want %d %s", resp.StatusCode, body, tt.status, tt.code)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			token, _ := body["token"].(string)
+			if !h.verifyToken(alice, token) {
+				t.Fatal("issued token does not verify")
+			}
+			if h.verifyToken(uuid.NewString(), token) {
+				t.Fatal("issued token verifies for another user")
+			}
+		})
+	}
+}
+
+func TestVerifyUserStreamToken(t *testing.T) {
+	h := NewUserStreamHandler("secret", "key")
+	valid := SignUserStreamToken([]byte("secret"), "alice", time.Now().Add(time.Hour))
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{"valid", valid, true},
+		{"expired", SignUserStreamToken([]byte("secret"), "alice", time.Now().Add(-time.Minute)), false},
+		{"other secret", SignUserStreamToken([]byte("other"), "alice", time.Now().Add(time.Hour)), false},
+		{"tampered expiry", "9" + valid, false},
+		{"malformed", "not-a-token", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.verifyToken("alice", tt.token); got != tt.want {
+				t.Fatalf("verifyToken = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeRequiresUpgrade(t *testing.T) {
+	h := NewUserStreamHandler("secret", "key")
+	app := fiber.New()
+	app.Get("/ws/user", h.Authorize)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/ws/user?user_id=alice&token=x", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Fatalf("status = %d, want 426", resp.StatusCode)
+	}
+}
+
+// drain decodifica as mensagens enfileiradas na conexão.
+func drain(uc *userConn) []map[string]interface{} {
+	var out []map[string]interface{}
+	for {
+		select {
+		case raw := <-uc.out:
+			var msg map[string]interface{}
+			_ = json.Unmarshal(raw, &msg)
+			out = append(out, msg)
+		default:
+			return out
+		}
+	}
+}
+
+func TestUserStreamDeliversOnlyOwnEvents(t *testing.T) {
+	h := NewUserStreamHandler("secret", "key")
+	alice, bob, carol := newUserConn("alice"), newUserConn("bob"), newUserConn("carol")
+	for _, uc := range []*userConn{alice, bob, carol} {
+		h.register(uc)
+	}
+
+	_ = h.PublishOrderUpdate(&engine.Order{ID: "o1", UserID: "alice"})
+	_ = h.PublishTrade(&engine.Trade{ID: "t1", BuyerID: "alice", SellerID: "bob", BuyOrder: "o1", SellOrder: "o2", TakerSide: engine.SideBuy})
+
+	got := drain(alice)
+	if len(got) != 2 || got[0]["type"] != "order" || got[1]["type"] != "fill" {
+		t.Fatalf("alice got %v, want order then fill", got)
+	}
+	for i, msg := range got {
+		if msg["seq"] != float64(i+1) {
+			t.Fatalf("alice message %d seq = %v, want %d", i, msg["seq"], i+1)
+		}
+	}
+	if fill := got[1]["data"].(map[string]interface{}); fill["side"] != string(engine.SideBuy) {
+		t.Fatalf("alice fill side = %v, want BUY", fill["side"])
+	}
+	if got := drain(bob); len(got) != 1 || got[0]["data"].(map[string]interface{})["side"] != string(engine.SideSell) {
+		t.Fatalf("bob got %v, want his SELL fill only", got)
+	}
+	if got := drain(carol); len(got) != 0 {
+		t.Fatalf("carol got %v, want nothing", got)
+	}
+
+	_ = h.NotifyMarketHalt("GNX", "circuit breaker")
+	for _, uc := range []*userConn{alice, bob, carol} {
+		if got := drain(uc); len(got) != 1 || got[0]["type"] != "market_status" {
+			t.Fatalf("%s got %v, want the market_status broadcast", uc.userID, got)
+		}
+	}
+}
+
+func TestUserConnClosesWhenFull(t *testing.T) {
+	uc := newUserConn("alice")
+	for i := 0; i < userStreamBuffer; i++ {
+		uc.push("order", nil)
+	}
+	select {
+	case <-uc.done:
+		t.Fatal("connection closed before the buffer overflowed")
+	default:
+	}
+
+	uc.push("order", nil)
+	select {
+	case <-uc.done:
+	default:
+		t.Fatal("connection still open after the buffer overflowed")
+	}
+	if uc.seq != userStreamBuffer {
+		t.Fatalf("seq = %d, want %d (the dropped message is not numbered)", uc.seq, userStreamBuffer)
+	}
+}
@@ -33,3 +33,7 @@ func (p *WSPublisher) PublishOrderBook(snapshot engine.OrderBookSnapshot) error
 	return nil
 }
 
+func (p *WSPublisher) PublishAuction(ind *engine.AuctionIndicative) error {
+	p.wsHandler.BroadcastAuction(ind)
+	return nil
+}
@@ -11,6 +11,9 @@ type Dependencies struct {
 	TradeHandler        *handlers.TradeHandler
 	MarketDataHandler   *handlers.MarketDataHandler
 	MarketDataWSHandler *handlers.MarketDataWSHandler
+	OrderHandler        *handlers.OrderHandler
+	UserStreamHandler   *handlers.UserStreamHandler
+	SettlementHandler   *handlers.SettlementHandler
 }
 
 func Register(app *fiber.App, deps Dependencies) {
@@ -25,6 +28,28 @@ func Register(app *fiber.App, deps Dependencies) {
 		api.Get("/wallets/:userID", deps.TradeHandler.GetWallets)
 	}
 
+	// Order entry (MatchingEngine)
+	if deps.OrderHandler != nil {
+		orders := api.Group("/orders")
+		orders.Post("/", deps.OrderHandler.PlaceOrder)
+		orders.Get("/open", deps.OrderHandler.GetOpenOrders)
+		orders.Get("/history", deps.OrderHandler.GetOrderHistory)
+		orders.Get("/:id", deps.OrderHandler.GetOrder)
+		orders.Patch("/:id", deps.OrderHandler.AmendOrder)
+		orders.Delete("/:id", deps.OrderHandler.CancelOrder)
+
+		api.Get("/fills", deps.OrderHandler.GetFills)
+	}
+
+	// Liquidação (ClearingEngine)
+	if deps.SettlementHandler != nil {
+		settlement := api.Group("/settlement")
+		settlement.Get("/batches", deps.SettlementHandler.ListBatches)
+		settlement.Get("/batches/:id/report", deps.SettlementHandler.GetReport)
+		settlement.Get("/batches/:id/statements/:user_id", deps.SettlementHandler.GetStatement)
+		settlement.Get("/fails", deps.SettlementHandler.ListFails)
+	}
+
 	// Market Data REST API
 	if deps.MarketDataHandler != nil {
 		market := api.Group("/market")
@@ -41,5 +66,12 @@ func Register(app *fiber.App, deps Dependencies) {
 		ws.Get("/market/book", websocket.New(deps.MarketDataWSHandler.HandleBook))
 		ws.Get("/market/ticker", websocket.New(deps.MarketDataWSHandler.HandleTicker))
 		ws.Get("/market/candles", websocket.New(deps.MarketDataWSHandler.HandleCandles))
+		ws.Get("/market/auction", websocket.New(deps.MarketDataWSHandler.HandleAuction))
+	}
+
+	// Stream privado do usuário (ordens, fills, saldos, risco)
+	if deps.UserStreamHandler != nil {
+		api.Post("/user-stream", deps.UserStreamHandler.CreateToken)
+		app.Get("/ws/user", deps.UserStreamHandler.Authorize, websocket.New(deps.UserStreamHandler.HandleUser))
 	}
 }
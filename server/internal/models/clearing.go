@@ -0,0 +1,223 @@
+package models
+
+import (
+	"time"
+
+	"hearcap/server/internal/decimal"
+	"hearcap/server/internal/engine"
+)
+
+// ClearingPosition é a obrigação de um usuário num símbolo para uma data de
+// liquidação.
+type ClearingPosition struct {
+	ID             string          `gorm:"size:64;primaryKey"`
+	UserID         string          `gorm:"size:64;not null;index:idx_clearing_user_symbol_date"`
+	Symbol         string          `gorm:"size:16;not null;index:idx_clearing_user_symbol_date"`
+	SettlementDate time.Time       `gorm:"not null;index:idx_clearing_user_symbol_date;index:idx_clearing_status_date"`
+	BaseDelta      decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	QuoteDelta     decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	BatchID        string          `gorm:"size:64;index"`
+	Status         string          `gorm:"size:16;not null;index:idx_clearing_status_date"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// SettlementBatch é uma rodada de liquidação do ClearingEngine.
+type SettlementBatch struct {
+	ID             string   `gorm:"size:64;primaryKey"`
+	Symbol         string   `gorm:"size:16"`
+	Symbols        []string `gorm:"serializer:json"`
+	SettlementDate time.Time
+	Mode           int
+
+	PositionCount    int
+	ParticipantCount int
+	ObligationCount  int
+	FailedCount      int
+
+	Status       string    `gorm:"size:16;not null"`
+	Phase        string    `gorm:"size:16;not null;default:CLOSED;index"`
+	CreatedAt    time.Time `gorm:"index"`
+	CompletedAt  *time.Time
+	ErrorMessage *string
+}
+
+// SettlementObligation é o líquido de um participante num ativo dentro de um
+// lote de liquidação.
+type SettlementObligation struct {
+	ID        string          `gorm:"size:64;primaryKey"`
+	BatchID   string          `gorm:"size:64;not null;index:idx_obligation_batch_user"`
+	UserID    string          `gorm:"size:64;not null;index:idx_obligation_batch_user"`
+	Asset     string          `gorm:"size:16;not null"`
+	Delivered decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	Received  decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	Net       decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	Settled   decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	Status    string          `gorm:"size:16;not null;index"`
+
+	Attempts      int
+	NextAttemptAt *time.Time
+	FailedSince   *time.Time
+	Penalties     decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	PenaltyUntil  *time.Time
+	BuyInCost     decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+
+	ErrorMessage *string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// ClearingTrade marca um trade já somado às posições de clearing; a chave
+// primária torna o ApplyTrade idempotente.
+type ClearingTrade struct {
+	TradeID   string `gorm:"size:64;primaryKey"`
+	CreatedAt time.Time
+}
+
+// PostTradeDeadLetter é um trade que esgotou as tentativas do pós-trade; o
+// trade vai inteiro como JSON.
+type PostTradeDeadLetter struct {
+	TradeID  string        `gorm:"size:64;primaryKey"`
+	Symbol   string        `gorm:"size:16;not null"`
+	Trade    *engine.Trade `gorm:"serializer:json"`
+	Stage    string        `gorm:"size:16;not null"`
+	Attempts int
+	Error    string
+	FailedAt time.Time `gorm:"index"`
+}
+
+// FromEngine copia a posição do engine
+func (m *ClearingPosition) FromEngine(p *engine.ClearingPosition) {
+	m.ID = p.ID
+	m.UserID = p.UserID
+	m.Symbol = p.Symbol
+	m.SettlementDate = p.SettlementDate
+	m.BaseDelta = p.BaseDelta
+	m.QuoteDelta = p.QuoteDelta
+	m.BatchID = p.BatchID
+	m.Status = string(p.Status)
+	m.CreatedAt = p.CreatedAt
+	m.UpdatedAt = p.UpdatedAt
+}
+
+// ToEngine converte para o modelo do engine
+func (m *ClearingPosition) ToEngine() *engine.ClearingPosition {
+	return &engine.ClearingPosition{
+		ID:             m.ID,
+		UserID:         m.UserID,
+		Symbol:         m.Symbol,
+		SettlementDate: m.SettlementDate,
+		BaseDelta:      m.BaseDelta,
+		QuoteDelta:     m.QuoteDelta,
+		BatchID:        m.BatchID,
+		Status:         engine.SettlementStatus(m.Status),
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+	}
+}
+
+// FromEngine copia o lote do engine
+func (m *SettlementBatch) FromEngine(b *engine.SettlementBatch) {
+	m.ID = b.ID
+	m.Symbol = b.Symbol
+	m.Symbols = b.Symbols
+	m.SettlementDate = b.SettlementDate
+	m.Mode = int(b.Mode)
+	m.PositionCount = b.PositionCount
+	m.ParticipantCount = b.ParticipantCount
+	m.ObligationCount = b.ObligationCount
+	m.FailedCount = b.FailedCount
+	m.Status = string(b.Status)
+	m.Phase = string(b.Phase)
+	m.CreatedAt = b.CreatedAt
+	m.CompletedAt = b.CompletedAt
+	m.ErrorMessage = b.ErrorMessage
+}
+
+// ToEngine converte para o modelo do engine
+func (m *SettlementBatch) ToEngine() *engine.SettlementBatch {
+	return &engine.SettlementBatch{
+		ID:               m.ID,
+		Symbol:           m.Symbol,
+		Symbols:          m.Symbols,
+		SettlementDate:   m.SettlementDate,
+		Mode:             engine.SettlementMode(m.Mode),
+		PositionCount:    m.PositionCount,
+		ParticipantCount: m.ParticipantCount,
+		ObligationCount:  m.ObligationCount,
+		FailedCount:      m.FailedCount,
+		Status:           engine.SettlementStatus(m.Status),
+		Phase:            engine.SettlementBatchPhase(m.Phase),
+		CreatedAt:        m.CreatedAt,
+		CompletedAt:      m.CompletedAt,
+		ErrorMessage:     m.ErrorMessage,
+	}
+}
+
+// FromEngine copia a obrigação do engine
+func (m *SettlementObligation) FromEngine(ob *engine.SettlementObligation) {
+	m.ID = ob.ID
+	m.BatchID = ob.BatchID
+	m.UserID = ob.UserID
+	m.Asset = ob.Asset
+	m.Delivered = ob.Delivered
+	m.Received = ob.Received
+	m.Net = ob.Net
+	m.Settled = ob.Settled
+	m.Status = string(ob.Status)
+	m.Attempts = ob.Attempts
+	m.NextAttemptAt = ob.NextAttemptAt
+	m.FailedSince = ob.FailedSince
+	m.Penalties = ob.Penalties
+	m.PenaltyUntil = ob.PenaltyUntil
+	m.BuyInCost = ob.BuyInCost
+	m.ErrorMessage = ob.ErrorMessage
+	m.CreatedAt = ob.CreatedAt
+	m.UpdatedAt = ob.UpdatedAt
+}
+
+// ToEngine converte para o modelo do engine
+func (m *SettlementObligation) ToEngine() *engine.SettlementObligation {
+	return &engine.SettlementObligation{
+		ID:            m.ID,
+		BatchID:       m.BatchID,
+		UserID:        m.UserID,
+		Asset:         m.Asset,
+		Delivered:     m.Delivered,
+		Received:      m.Received,
+		Net:           m.Net,
+		Settled:       m.Settled,
+		Status:        engine.SettlementStatus(m.Status),
+		Attempts:      m.Attempts,
+		NextAttemptAt: m.NextAttemptAt,
+		FailedSince:   m.FailedSince,
+		Penalties:     m.Penalties,
+		PenaltyUntil:  m.PenaltyUntil,
+		BuyInCost:     m.BuyInCost,
+		ErrorMessage:  m.ErrorMessage,
+		CreatedAt:     m.CreatedAt,
+		UpdatedAt:     m.UpdatedAt,
+	}
+}
+
+// FromEngine copia a falha do pós-trade
+func (m *PostTradeDeadLetter) FromEngine(f *engine.PostTradeFailure) {
+	m.TradeID = f.Trade.ID
+	m.Symbol = f.Trade.Symbol
+	m.Trade = f.Trade
+	m.Stage = string(f.Stage)
+	m.Attempts = f.Attempts
+	m.Error = f.Error
+	m.FailedAt = f.FailedAt
+}
+
+// ToEngine converte para o modelo do engine
+func (m *PostTradeDeadLetter) ToEngine() *engine.PostTradeFailure {
+	return &engine.PostTradeFailure{
+		Trade:    m.Trade,
+		Stage:    engine.PostTradeStage(m.Stage),
+		Attempts: m.Attempts,
+		Error:    m.Error,
+		FailedAt: m.FailedAt,
+	}
+}
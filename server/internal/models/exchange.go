@@ -0,0 +1,288 @@
+package models
+
+import (
+	"time"
+
+	"hearcap/server/internal/decimal"
+	"hearcap/server/internal/engine"
+)
+
+// ExchangeOrder é uma ordem do MatchingEngine persistida (estado mais recente).
+type ExchangeOrder struct {
+	ID        string          `gorm:"size:64;primaryKey"`
+	UserID    string          `gorm:"size:64;not null;index:idx_orders_user_created;index:idx_orders_user_status"`
+	Symbol    string          `gorm:"size:16;not null;index"`
+	Side      string          `gorm:"size:8;not null"`
+	Type      string          `gorm:"size:24;not null"`
+	Price     decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	StopPrice decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	Quantity  decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	FilledQty decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+
+	QuoteQty    decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	FilledQuote decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	LockedQuote decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	DisplayQty  decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	VisibleQty  decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+
+	TrailingAmount  decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	TrailingPercent decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	TrailingRef     decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	Triggered       bool            `gorm:"not null;default:false"`
+
+	TimeInForce string `gorm:"size:8"`
+	ExpireAt    *time.Time
+	PostOnly    string `gorm:"size:16"`
+	STP         string `gorm:"size:24"`
+	GroupID     string `gorm:"size:64;index"`
+
+	Status    string    `gorm:"size:24;not null;index:idx_orders_user_status"`
+	Seq       uint64    `gorm:"not null;default:0"`
+	CreatedAt time.Time `gorm:"index:idx_orders_user_created"`
+	UpdatedAt time.Time
+}
+
+// ExchangeFill é uma execução (trade lit) entre duas ordens.
+type ExchangeFill struct {
+	ID          string          `gorm:"size:64;primaryKey"`
+	Seq         uint64          `gorm:"not null"`
+	Symbol      string          `gorm:"size:16;not null;index:idx_fills_symbol_created"`
+	BuyOrderID  string          `gorm:"size:64;not null;index"`
+	SellOrderID string          `gorm:"size:64;not null;index"`
+	BuyerID     string          `gorm:"size:64;not null;index:idx_fills_buyer_created"`
+	SellerID    string          `gorm:"size:64;not null;index:idx_fills_seller_created"`
+	MakerSide   string          `gorm:"size:8;not null"`
+	Price       decimal.Decimal `gorm:"type:numeric(19,8);not null"`
+	Quantity    decimal.Decimal `gorm:"type:numeric(19,8);not null"`
+	BuyerFee    decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	SellerFee   decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	FeeAsset    string          `gorm:"size:16"`
+	CreatedAt   time.Time       `gorm:"index:idx_fills_symbol_created;index:idx_fills_buyer_created;index:idx_fills_seller_created"`
+	// PostTradeStage é a etapa do pós-trade que falta executar; vazio quando
+	// concluído (ou em trades anteriores ao outbox).
+	PostTradeStage string `gorm:"size:16;index"`
+}
+
+// ExchangeOrderGroup é um grupo OCO/bracket persistido; pernas e execuções por
+// perna vão como JSON.
+type ExchangeOrderGroup struct {
+	ID     string `gorm:"size:64;primaryKey"`
+	UserID string `gorm:"size:64;not null;index"`
+	Symbol string `gorm:"size:16;not null"`
+	Type   string `gorm:"size:16;not null"`
+	Policy string `gorm:"size:24"`
+	Status string `gorm:"size:16;not null"`
+
+	EntryOrderID string
+	LegIDs       []string `gorm:"serializer:json"`
+
+	Side        string                     `gorm:"size:8"`
+	Quantity    decimal.Decimal            `gorm:"type:numeric(19,8);not null;default:0"`
+	FilledQty   decimal.Decimal            `gorm:"type:numeric(19,8);not null;default:0"`
+	LockPrice   decimal.Decimal            `gorm:"type:numeric(19,8);not null;default:0"`
+	LockedQuote decimal.Decimal            `gorm:"type:numeric(19,8);not null;default:0"`
+	Receivable  decimal.Decimal            `gorm:"type:numeric(19,8);not null;default:0"`
+	LegFilled   map[string]decimal.Decimal `gorm:"serializer:json"`
+	STP         string                     `gorm:"size:24"`
+
+	TakeProfitPrice    decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	StopLossPrice      decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	StopLossLimitPrice decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+
+	Seq       uint64 `gorm:"not null;default:0"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// FeeVolume é o volume negociado (em quote) por usuário e dia, base do tier
+// de taxas.
+type FeeVolume struct {
+	UserID   string          `gorm:"size:64;primaryKey"`
+	Day      time.Time       `gorm:"primaryKey"`
+	Notional decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+}
+
+// MarketInstrument é a especificação e o status de um mercado do
+// InstrumentRegistry.
+type MarketInstrument struct {
+	Symbol     string `gorm:"size:16;primaryKey"`
+	BaseAsset  string `gorm:"size:16;not null"`
+	QuoteAsset string `gorm:"size:16"`
+
+	TickSize    decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	LotSize     decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	MinQty      decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	MaxQty      decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	MinNotional decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+
+	Status    string `gorm:"size:16;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// FromEngine copia a ordem do engine
+func (m *ExchangeOrder) FromEngine(o *engine.Order) {
+	m.ID = o.ID
+	m.UserID = o.UserID
+	m.Symbol = o.Symbol
+	m.Side = string(o.Side)
+	m.Type = string(o.Type)
+	m.Price = o.Price
+	m.StopPrice = o.StopPrice
+	m.Quantity = o.Quantity
+	m.FilledQty = o.FilledQty
+	m.QuoteQty = o.QuoteQty
+	m.FilledQuote = o.FilledQuote
+	m.LockedQuote = o.LockedQuote
+	m.DisplayQty = o.DisplayQty
+	m.VisibleQty = o.VisibleQty
+	m.TrailingAmount = o.TrailingAmount
+	m.TrailingPercent = o.TrailingPercent
+	m.TrailingRef = o.TrailingRef
+	m.Triggered = o.Triggered
+	m.TimeInForce = string(o.TimeInForce)
+	m.ExpireAt = o.ExpireAt
+	m.PostOnly = string(o.PostOnly)
+	m.STP = string(o.STP)
+	m.GroupID = o.GroupID
+	m.Status = string(o.Status)
+	m.Seq = o.Seq
+	m.CreatedAt = o.CreatedAt
+	m.UpdatedAt = o.UpdatedAt
+}
+
+// ToEngine converte para o modelo do engine
+func (m *ExchangeOrder) ToEngine() *engine.Order {
+	return &engine.Order{
+		ID:              m.ID,
+		UserID:          m.UserID,
+		Symbol:          m.Symbol,
+		Side:            engine.Side(m.Side),
+		Type:            engine.OrderType(m.Type),
+		Price:           m.Price,
+		StopPrice:       m.StopPrice,
+		Quantity:        m.Quantity,
+		FilledQty:       m.FilledQty,
+		QuoteQty:        m.QuoteQty,
+		FilledQuote:     m.FilledQuote,
+		LockedQuote:     m.LockedQuote,
+		DisplayQty:      m.DisplayQty,
+		VisibleQty:      m.VisibleQty,
+		TrailingAmount:  m.TrailingAmount,
+		TrailingPercent: m.TrailingPercent,
+		TrailingRef:     m.TrailingRef,
+		Triggered:       m.Triggered,
+		TimeInForce:     engine.TimeInForce(m.TimeInForce),
+		ExpireAt:        m.ExpireAt,
+		PostOnly:        engine.PostOnlyMode(m.PostOnly),
+		STP:             engine.STPMode(m.STP),
+		GroupID:         m.GroupID,
+		Status:          engine.OrderStatus(m.Status),
+		Seq:             m.Seq,
+		CreatedAt:       m.CreatedAt,
+		UpdatedAt:       m.UpdatedAt,
+	}
+}
+
+// FromEngine copia o trade do engine; o maker é o lado oposto ao agressor.
+func (m *ExchangeFill) FromEngine(t *engine.Trade) {
+	m.ID = t.ID
+	m.Seq = t.Seq
+	m.Symbol = t.Symbol
+	m.BuyOrderID = t.BuyOrder
+	m.SellOrderID = t.SellOrder
+	m.BuyerID = t.BuyerID
+	m.SellerID = t.SellerID
+	m.MakerSide = string(engine.SideBuy)
+	if t.TakerSide == engine.SideBuy {
+		m.MakerSide = string(engine.SideSell)
+	}
+	m.Price = t.Price
+	m.Quantity = t.Quantity
+	m.BuyerFee = t.BuyerFee
+	m.SellerFee = t.SellerFee
+	m.FeeAsset = t.FeeAsset
+	m.CreatedAt = t.CreatedAt
+}
+
+// ToEngine converte para o modelo do engine
+func (m *ExchangeFill) ToEngine() *engine.Trade {
+	taker := engine.SideBuy
+	if m.MakerSide == string(engine.SideBuy) {
+		taker = engine.SideSell
+	}
+	return &engine.Trade{
+		ID:        m.ID,
+		Seq:       m.Seq,
+		Symbol:    m.Symbol,
+		BuyOrder:  m.BuyOrderID,
+		SellOrder: m.SellOrderID,
+		BuyerID:   m.BuyerID,
+		SellerID:  m.SellerID,
+		TakerSide: taker,
+		Price:     m.Price,
+		Quantity:  m.Quantity,
+		BuyerFee:  m.BuyerFee,
+		SellerFee: m.SellerFee,
+		FeeAsset:  m.FeeAsset,
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+// FromEngine copia o grupo do engine
+func (m *ExchangeOrderGroup) FromEngine(g *engine.OrderGroup) {
+	m.ID = g.ID
+	m.UserID = g.UserID
+	m.Symbol = g.Symbol
+	m.Type = string(g.Type)
+	m.Policy = string(g.Policy)
+	m.Status = string(g.Status)
+	m.EntryOrderID = g.EntryOrderID
+	m.LegIDs = g.LegIDs
+	m.Side = string(g.Side)
+	m.Quantity = g.Quantity
+	m.FilledQty = g.FilledQty
+	m.LockPrice = g.LockPrice
+	m.LockedQuote = g.LockedQuote
+	m.Receivable = g.Receivable
+	m.LegFilled = g.LegFilled
+	m.STP = string(g.STP)
+	m.TakeProfitPrice = g.TakeProfitPrice
+	m.StopLossPrice = g.StopLossPrice
+	m.StopLossLimitPrice = g.StopLossLimitPrice
+	m.Seq = g.Seq
+	m.CreatedAt = g.CreatedAt
+	m.UpdatedAt = g.UpdatedAt
+}
+
+// FromEngine copia a especificação do engine
+func (m *MarketInstrument) FromEngine(i *engine.Instrument) {
+	m.Symbol = i.Symbol
+	m.BaseAsset = i.BaseAsset
+	m.QuoteAsset = i.QuoteAsset
+	m.TickSize = i.TickSize
+	m.LotSize = i.LotSize
+	m.MinQty = i.MinQty
+	m.MaxQty = i.MaxQty
+	m.MinNotional = i.MinNotional
+	m.Status = string(i.Status)
+	m.CreatedAt = i.CreatedAt
+	m.UpdatedAt = i.UpdatedAt
+}
+
+// ToEngine converte para o modelo do engine
+func (m *MarketInstrument) ToEngine() *engine.Instrument {
+	return &engine.Instrument{
+		Symbol:      m.Symbol,
+		BaseAsset:   m.BaseAsset,
+		QuoteAsset:  m.QuoteAsset,
+		TickSize:    m.TickSize,
+		LotSize:     m.LotSize,
+		MinQty:      m.MinQty,
+		MaxQty:      m.MaxQty,
+		MinNotional: m.MinNotional,
+		Status:      engine.MarketStatus(m.Status),
+		CreatedAt:   m.CreatedAt,
+		UpdatedAt:   m.UpdatedAt,
+	}
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"hearcap/server/internal/decimal"
+	"hearcap/server/internal/engine"
+)
+
+func TestExchangeOrderRoundTrip(t *testing.T) {
+	expire := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	o := &engine.Order{
+		ID:              "o1",
+		UserID:          "alice",
+		Symbol:          "GNX",
+		Side:            engine.SideBuy,
+		Type:            engine.OrderTypeStopLimit,
+		Price:           decimal.RequireFromString("10.5"),
+		StopPrice:       decimal.RequireFromString("10"),
+		Quantity:        decimal.RequireFromString("3"),
+		FilledQty:       decimal.RequireFromString("1"),
+		FilledQuote:     decimal.RequireFromString("10.5"),
+		LockedQuote:     decimal.RequireFromString("21"),
+		DisplayQty:      decimal.RequireFromString("1"),
+		VisibleQty:      decimal.RequireFromString("1"),
+		TrailingPercent: decimal.RequireFromString("0.02"),
+		Triggered:       true,
+		TimeInForce:     engine.TimeInForceGTD,
+		ExpireAt:        &expire,
+		STP:             engine.STPCancelNewest,
+		GroupID:         "g1",
+		Status:          engine.OrderStatusPartFilled,
+		Seq:             7,
+		CreatedAt:       expire.Add(-time.Hour),
+		UpdatedAt:       expire.Add(-time.Minute),
+	}
+	var m ExchangeOrder
+	m.FromEngine(o)
+	if got := m.ToEngine(); !reflect.DeepEqual(got, o) {
+		t.Fatalf("round trip = %+v, want %+v", got, o)
+	}
+}
+
+func TestExchangeFillRoundTrip(t *testing.T) {
+	for _, taker := range []engine.Side{engine.SideBuy, engine.SideSell} {
+		trade := &engine.Trade{
+			ID:        "t1",
+			Seq:       3,
+			Symbol:    "GNX",
+			BuyOrder:  "b1",
+			SellOrder: "s1",
+			BuyerID:   "alice",
+			SellerID:  "bob",
+			TakerSide: taker,
+			Price:     decimal.RequireFromString("10"),
+			Quantity:  decimal.RequireFromString("2"),
+			BuyerFee:  decimal.RequireFromString("0.04"),
+			SellerFee: decimal.RequireFromString("-0.01"),
+			FeeAsset:  "BRL",
+			CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		}
+		var m ExchangeFill
+		m.FromEngine(trade)
+		if m.MakerSide == string(taker) {
+			t.Fatalf("taker %s stored as the maker side", taker)
+		}
+		if got := m.ToEngine(); !reflect.DeepEqual(got, trade) {
+			t.Fatalf("round trip = %+v, want %+v", got, trade)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"hearcap/server/internal/decimal"
 	"hearcap/server/internal/engine"
 
 	"github.com/google/uuid"
@@ -15,40 +16,40 @@ type MarketDataCandle struct {
 	Interval  string    `gorm:"size:8;index:idx_symbol_interval_time,unique;not null"` // 1m, 5m, 1h, 1d
 	OpenTime  time.Time `gorm:"index:idx_symbol_interval_time,unique;not null"`
 	CloseTime time.Time
-	Open      float64 `gorm:"type:numeric(18,8);not null"`
-	High      float64 `gorm:"type:numeric(18,8);not null"`
-	Low       float64 `gorm:"type:numeric(18,8);not null"`
-	Close     float64 `gorm:"type:numeric(18,8);not null"`
-	Volume    float64 `gorm:"type:numeric(18,8);not null;default:0"`
-	Trades    int64   `gorm:"not null;default:0"`
+	Open      decimal.Decimal `gorm:"type:numeric(19,8);not null"`
+	High      decimal.Decimal `gorm:"type:numeric(19,8);not null"`
+	Low       decimal.Decimal `gorm:"type:numeric(19,8);not null"`
+	Close     decimal.Decimal `gorm:"type:numeric(19,8);not null"`
+	Volume    decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	Trades    int64           `gorm:"not null;default:0"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
 // MarketDataTradeEvent representa um trade event persistido
 type MarketDataTradeEvent struct {
-	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
-	Symbol    string    `gorm:"size:16;index:idx_symbol_time;not null"`
-	Price     float64   `gorm:"type:numeric(18,8);not null"`
-	Quantity  float64   `gorm:"type:numeric(18,8);not null"`
-	Side      string    `gorm:"size:8;not null"`  // BUY ou SELL
-	Source    string    `gorm:"size:16;not null"` // LIT ou DARK_POOL
-	Timestamp time.Time `gorm:"index:idx_symbol_time;not null"`
+	ID        uuid.UUID       `gorm:"type:uuid;default:gen_random_uuid();primaryKey"`
+	Symbol    string          `gorm:"size:16;index:idx_symbol_time;not null"`
+	Price     decimal.Decimal `gorm:"type:numeric(19,8);not null"`
+	Quantity  decimal.Decimal `gorm:"type:numeric(19,8);not null"`
+	Side      string          `gorm:"size:8;not null"`  // BUY ou SELL
+	Source    string          `gorm:"size:16;not null"` // LIT ou DARK_POOL
+	Timestamp time.Time       `gorm:"index:idx_symbol_time;not null"`
 	CreatedAt time.Time
 }
 
 // MarketDataTicker24h representa o ticker 24h persistido
 type MarketDataTicker24h struct {
-	Symbol             string  `gorm:"size:16;primaryKey"`
-	LastPrice          float64 `gorm:"type:numeric(18,8);not null"`
-	OpenPrice          float64 `gorm:"type:numeric(18,8);not null"`
-	HighPrice          float64 `gorm:"type:numeric(18,8);not null"`
-	LowPrice           float64 `gorm:"type:numeric(18,8);not null"`
-	Volume             float64 `gorm:"type:numeric(18,8);not null;default:0"`
-	QuoteVolume        float64 `gorm:"type:numeric(18,8);not null;default:0"`
-	Trades             int64   `gorm:"not null;default:0"`
-	PriceChange        float64 `gorm:"type:numeric(18,8);not null;default:0"`
-	PriceChangePercent float64 `gorm:"type:numeric(8,4);not null;default:0"`
+	Symbol             string          `gorm:"size:16;primaryKey"`
+	LastPrice          decimal.Decimal `gorm:"type:numeric(19,8);not null"`
+	OpenPrice          decimal.Decimal `gorm:"type:numeric(19,8);not null"`
+	HighPrice          decimal.Decimal `gorm:"type:numeric(19,8);not null"`
+	LowPrice           decimal.Decimal `gorm:"type:numeric(19,8);not null"`
+	Volume             decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	QuoteVolume        decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	Trades             int64           `gorm:"not null;default:0"`
+	PriceChange        decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	PriceChangePercent float64         `gorm:"type:numeric(8,4);not null;default:0"`
 	OpenTime           time.Time
 	CloseTime          time.Time
 	UpdatedAt          time.Time
@@ -153,4 +154,3 @@ func (m *MarketDataTicker24h) FromEngine(t *engine.Ticker24h) {
 	m.CloseTime = t.CloseTime
 	m.UpdatedAt = t.UpdatedAt
 }
-
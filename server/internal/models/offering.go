@@ -0,0 +1,206 @@
+package models
+
+import (
+	"time"
+
+	"hearcap/server/internal/decimal"
+	"hearcap/server/internal/engine"
+)
+
+// ListingApplication é o pedido de listagem de um artista.
+type ListingApplication struct {
+	ID       string `gorm:"size:64;primaryKey"`
+	ArtistID string `gorm:"size:64;not null;index"`
+	Symbol   string `gorm:"size:16;not null;index"`
+	Name     string `gorm:"size:128"`
+	Offering string `gorm:"size:24"`
+	Status   string `gorm:"size:16;not null;index"`
+
+	InitialPrice     decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	TotalSupply      decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	FreeFloatPercent float64
+	MinRaiseUSD      decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	MaxRaiseUSD      decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+
+	ProspectusURL string
+	ExtraDocsURL  []string `gorm:"serializer:json"`
+	Notes         string
+
+	ReviewerID   *string                    `gorm:"size:64"`
+	CommitteeLog []engine.CommitteeDecision `gorm:"serializer:json"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// Offering é a oferta primária de uma listagem.
+type Offering struct {
+	ID         string `gorm:"size:64;primaryKey"`
+	ListingID  string `gorm:"size:64;not null;index"`
+	Symbol     string `gorm:"size:16;not null"`
+	IssuerID   string `gorm:"size:64;not null"`
+	QuoteAsset string `gorm:"size:16;not null"`
+	Method     string `gorm:"size:16;not null"`
+	Status     string `gorm:"size:16;not null;index:idx_offering_status_ends"`
+
+	OfferedQty     decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	AllocationStep decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	Price          decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	MinPrice       decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	MaxPrice       decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	MinRaise       decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	MaxRaise       decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+
+	StartsAt time.Time
+	EndsAt   time.Time `gorm:"index:idx_offering_status_ends"`
+
+	AllocatedQty decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	RaisedAmount decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// OfferingBid é um lance de subscrição de uma oferta.
+type OfferingBid struct {
+	ID         string `gorm:"size:64;primaryKey"`
+	OfferingID string `gorm:"size:64;not null;index"`
+	UserID     string `gorm:"size:64;not null;index"`
+	Status     string `gorm:"size:16;not null"`
+
+	Price        decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	Quantity     decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	LockedAmount decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	AllocatedQty decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	Cost         decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+
+	CreatedAt time.Time `gorm:"index"`
+	UpdatedAt time.Time
+}
+
+// FromEngine copia a listagem do engine
+func (m *ListingApplication) FromEngine(app *engine.ListingApplication) {
+	m.ID = app.ID
+	m.ArtistID = app.ArtistID
+	m.Symbol = app.Symbol
+	m.Name = app.Name
+	m.Offering = string(app.Offering)
+	m.Status = string(app.Status)
+	m.InitialPrice = app.InitialPrice
+	m.TotalSupply = app.TotalSupply
+	m.FreeFloatPercent = app.FreeFloatPercent
+	m.MinRaiseUSD = app.MinRaiseUSD
+	m.MaxRaiseUSD = app.MaxRaiseUSD
+	m.ProspectusURL = app.ProspectusURL
+	m.ExtraDocsURL = app.ExtraDocsURL
+	m.Notes = app.Notes
+	m.ReviewerID = app.ReviewerID
+	m.CommitteeLog = app.CommitteeLog
+	m.CreatedAt = app.CreatedAt
+	m.UpdatedAt = app.UpdatedAt
+}
+
+// ToEngine converte para o modelo do engine
+func (m *ListingApplication) ToEngine() *engine.ListingApplication {
+	return &engine.ListingApplication{
+		ID:               m.ID,
+		ArtistID:         m.ArtistID,
+		Symbol:           m.Symbol,
+		Name:             m.Name,
+		Offering:         engine.OfferingType(m.Offering),
+		Status:           engine.ListingStatus(m.Status),
+		InitialPrice:     m.InitialPrice,
+		TotalSupply:      m.TotalSupply,
+		FreeFloatPercent: m.FreeFloatPercent,
+		MinRaiseUSD:      m.MinRaiseUSD,
+		MaxRaiseUSD:      m.MaxRaiseUSD,
+		ProspectusURL:    m.ProspectusURL,
+		ExtraDocsURL:     m.ExtraDocsURL,
+		Notes:            m.Notes,
+		ReviewerID:       m.ReviewerID,
+		CommitteeLog:     m.CommitteeLog,
+		CreatedAt:        m.CreatedAt,
+		UpdatedAt:        m.UpdatedAt,
+	}
+}
+
+// FromEngine copia a oferta do engine
+func (m *Offering) FromEngine(o *engine.Offering) {
+	m.ID = o.ID
+	m.ListingID = o.ListingID
+	m.Symbol = o.Symbol
+	m.IssuerID = o.IssuerID
+	m.QuoteAsset = o.QuoteAsset
+	m.Method = string(o.Method)
+	m.Status = string(o.Status)
+	m.OfferedQty = o.OfferedQty
+	m.AllocationStep = o.AllocationStep
+	m.Price = o.Price
+	m.MinPrice = o.MinPrice
+	m.MaxPrice = o.MaxPrice
+	m.MinRaise = o.MinRaise
+	m.MaxRaise = o.MaxRaise
+	m.StartsAt = o.StartsAt
+	m.EndsAt = o.EndsAt
+	m.AllocatedQty = o.AllocatedQty
+	m.RaisedAmount = o.RaisedAmount
+	m.CreatedAt = o.CreatedAt
+	m.UpdatedAt = o.UpdatedAt
+}
+
+// ToEngine converte para o modelo do engine
+func (m *Offering) ToEngine() *engine.Offering {
+	return &engine.Offering{
+		ID:             m.ID,
+		ListingID:      m.ListingID,
+		Symbol:         m.Symbol,
+		IssuerID:       m.IssuerID,
+		QuoteAsset:     m.QuoteAsset,
+		Method:         engine.AllocationMethod(m.Method),
+		Status:         engine.OfferingStatus(m.Status),
+		OfferedQty:     m.OfferedQty,
+		AllocationStep: m.AllocationStep,
+		Price:          m.Price,
+		MinPrice:       m.MinPrice,
+		MaxPrice:       m.MaxPrice,
+		MinRaise:       m.MinRaise,
+		MaxRaise:       m.MaxRaise,
+		StartsAt:       m.StartsAt,
+		EndsAt:         m.EndsAt,
+		AllocatedQty:   m.AllocatedQty,
+		RaisedAmount:   m.RaisedAmount,
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+	}
+}
+
+// FromEngine copia o lance do engine
+func (m *OfferingBid) FromEngine(b *engine.OfferingBid) {
+	m.ID = b.ID
+	m.OfferingID = b.OfferingID
+	m.UserID = b.UserID
+	m.Status = string(b.Status)
+	m.Price = b.Price
+	m.Quantity = b.Quantity
+	m.LockedAmount = b.LockedAmount
+	m.AllocatedQty = b.AllocatedQty
+	m.Cost = b.Cost
+	m.CreatedAt = b.CreatedAt
+	m.UpdatedAt = b.UpdatedAt
+}
+
+// ToEngine converte para o modelo do engine
+func (m *OfferingBid) ToEngine() *engine.OfferingBid {
+	return &engine.OfferingBid{
+		ID:           m.ID,
+		OfferingID:   m.OfferingID,
+		UserID:       m.UserID,
+		Status:       engine.OfferingBidStatus(m.Status),
+		Price:        m.Price,
+		Quantity:     m.Quantity,
+		LockedAmount: m.LockedAmount,
+		AllocatedQty: m.AllocatedQty,
+		Cost:         m.Cost,
+		CreatedAt:    m.CreatedAt,
+		UpdatedAt:    m.UpdatedAt,
+	}
+}
@@ -0,0 +1,213 @@
+package models
+
+import (
+	"time"
+
+	"hearcap/server/internal/decimal"
+	"hearcap/server/internal/engine"
+)
+
+// WalletAsset é um ativo cadastrado na WalletEngine.
+type WalletAsset struct {
+	Symbol      string `gorm:"size:16;primaryKey"`
+	Type        string `gorm:"size:16;not null"`
+	Decimals    int    `gorm:"not null;default:8"`
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// WalletAccount é a conta de um usuário num ativo.
+type WalletAccount struct {
+	ID        string `gorm:"size:64;primaryKey"`
+	UserID    string `gorm:"size:64;not null;index:idx_wallet_account_user_asset,unique"`
+	Asset     string `gorm:"size:16;not null;index:idx_wallet_account_user_asset,unique"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// WalletBalance guarda o saldo disponível, travado e reservado de uma conta.
+type WalletBalance struct {
+	AccountID string          `gorm:"size:64;primaryKey"`
+	Available decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	Locked    decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	Reserved  decimal.Decimal `gorm:"type:numeric(19,8);not null;default:0"`
+	UpdatedAt time.Time
+}
+
+// LedgerEntry é um lançamento do ledger de uma conta.
+type LedgerEntry struct {
+	ID        string          `gorm:"size:64;primaryKey"`
+	AccountID string          `gorm:"size:64;not null;index:idx_ledger_account_created"`
+	Asset     string          `gorm:"size:16;not null"`
+	Type      string          `gorm:"size:32;not null"`
+	Amount    decimal.Decimal `gorm:"type:numeric(19,8);not null"`
+	Reference string          `gorm:"size:128;index"`
+	Key       *string         `gorm:"size:160;uniqueIndex"`
+	CreatedAt time.Time       `gorm:"index:idx_ledger_account_created"`
+}
+
+// DepositRequest é um depósito aguardando ou já confirmado.
+type DepositRequest struct {
+	ID        string          `gorm:"size:64;primaryKey"`
+	UserID    string          `gorm:"size:64;not null;index"`
+	Asset     string          `gorm:"size:16;not null"`
+	Amount    decimal.Decimal `gorm:"type:numeric(19,8);not null"`
+	Status    string          `gorm:"size:16;not null"`
+	TxHash    *string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// WithdrawalRequest é um pedido de saque.
+type WithdrawalRequest struct {
+	ID        string          `gorm:"size:64;primaryKey"`
+	UserID    string          `gorm:"size:64;not null;index"`
+	Asset     string          `gorm:"size:16;not null"`
+	Amount    decimal.Decimal `gorm:"type:numeric(19,8);not null"`
+	Address   string
+	Status    string `gorm:"size:16;not null"`
+	TxHash    *string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// FromEngine copia o ativo do engine
+func (m *WalletAsset) FromEngine(a *engine.Asset) {
+	m.Symbol = a.Symbol
+	m.Type = string(a.Type)
+	m.Decimals = a.Decimals
+	m.Description = a.Description
+	m.CreatedAt = a.CreatedAt
+	m.UpdatedAt = a.UpdatedAt
+}
+
+// ToEngine converte para o modelo do engine
+func (m *WalletAsset) ToEngine() *engine.Asset {
+	return &engine.Asset{
+		Symbol:      m.Symbol,
+		Type:        engine.AssetType(m.Type),
+		Decimals:    m.Decimals,
+		Description: m.Description,
+		CreatedAt:   m.CreatedAt,
+		UpdatedAt:   m.UpdatedAt,
+	}
+}
+
+// ToEngine converte para o modelo do engine
+func (m *WalletAccount) ToEngine() *engine.WalletAccount {
+	return &engine.WalletAccount{
+		ID:        m.ID,
+		UserID:    m.UserID,
+		Asset:     m.Asset,
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+	}
+}
+
+// FromEngine copia o saldo do engine
+func (m *WalletBalance) FromEngine(b *engine.Balance) {
+	m.AccountID = b.AccountID
+	m.Available = b.Available
+	m.Locked = b.Locked
+	m.Reserved = b.Reserved
+	m.UpdatedAt = b.UpdatedAt
+}
+
+// ToEngine converte para o modelo do engine
+func (m *WalletBalance) ToEngine() *engine.Balance {
+	return &engine.Balance{
+		AccountID: m.AccountID,
+		Available: m.Available,
+		Locked:    m.Locked,
+		Reserved:  m.Reserved,
+		UpdatedAt: m.UpdatedAt,
+	}
+}
+
+// FromEngine copia o lançamento do engine
+func (m *LedgerEntry) FromEngine(e *engine.LedgerEntry) {
+	m.ID = e.ID
+	m.AccountID = e.AccountID
+	m.Asset = e.Asset
+	m.Type = string(e.Type)
+	m.Amount = e.Amount
+	m.Reference = e.Reference
+	m.Key = nil
+	if e.Key != "" {
+		key := e.Key
+		m.Key = &key
+	}
+	m.CreatedAt = e.CreatedAt
+}
+
+// ToEngine converte para o modelo do engine
+func (m *LedgerEntry) ToEngine() *engine.LedgerEntry {
+	e := &engine.LedgerEntry{
+		ID:        m.ID,
+		AccountID: m.AccountID,
+		Asset:     m.Asset,
+		Type:      engine.LedgerEntryType(m.Type),
+		Amount:    m.Amount,
+		Reference: m.Reference,
+		CreatedAt: m.CreatedAt,
+	}
+	if m.Key != nil {
+		e.Key = *m.Key
+	}
+	return e
+}
+
+// FromEngine copia o depósito do engine
+func (m *DepositRequest) FromEngine(d *engine.DepositRequest) {
+	m.ID = d.ID
+	m.UserID = d.UserID
+	m.Asset = d.Asset
+	m.Amount = d.Amount
+	m.Status = string(d.Status)
+	m.TxHash = d.TxHash
+	m.CreatedAt = d.CreatedAt
+	m.UpdatedAt = d.UpdatedAt
+}
+
+// ToEngine converte para o modelo do engine
+func (m *DepositRequest) ToEngine() *engine.DepositRequest {
+	return &engine.DepositRequest{
+		ID:        m.ID,
+		UserID:    m.UserID,
+		Asset:     m.Asset,
+		Amount:    m.Amount,
+		Status:    engine.DepositStatus(m.Status),
+		TxHash:    m.TxHash,
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+	}
+}
+
+// FromEngine copia o saque do engine
+func (m *WithdrawalRequest) FromEngine(w *engine.WithdrawalRequest) {
+	m.ID = w.ID
+	m.UserID = w.UserID
+	m.Asset = w.Asset
+	m.Amount = w.Amount
+	m.Address = w.Address
+	m.Status = string(w.Status)
+	m.TxHash = w.TxHash
+	m.CreatedAt = w.CreatedAt
+	m.UpdatedAt = w.UpdatedAt
+}
+
+// ToEngine converte para o modelo do engine
+func (m *WithdrawalRequest) ToEngine() *engine.WithdrawalRequest {
+	return &engine.WithdrawalRequest{
+		ID:        m.ID,
+		UserID:    m.UserID,
+		Asset:     m.Asset,
+		Amount:    m.Amount,
+		Address:   m.Address,
+		Status:    engine.WithdrawalStatus(m.Status),
+		TxHash:    m.TxHash,
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+	}
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"time"
+
+	"hearcap/server/internal/engine"
+	"hearcap/server/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GORMClearingRepository implementa engine.ClearingRepository e o dead-letter
+// do pós-trade usando GORM
+type GORMClearingRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMClearingRepository(db *gorm.DB) *GORMClearingRepository {
+	return &GORMClearingRepository{db: db}
+}
+
+// -------- ClearingRepository --------
+
+// ApplyTrade grava a marca do trade e soma os deltas numa transação; a marca
+// já existente (ON CONFLICT DO NOTHING sem linhas) indica um trade aplicado.
+func (r *GORMClearingRepository) ApplyTrade(tradeID string, deltas []*engine.ClearingPosition) (bool, error) {
+	applied := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.ClearingTrade{TradeID: tradeID})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		for _, d := range deltas {
+			var m models.ClearingPosition
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("user_id = ? AND symbol = ? AND settlement_date = ? AND status = ?",
+					d.UserID, d.Symbol, d.SettlementDate, string(engine.SettlementStatusPending)).
+				First(&m).Error
+			if err == gorm.ErrRecordNotFound {
+				m.FromEngine(d)
+				if err := tx.Create(&m).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			m.BaseDelta = m.BaseDelta.Add(d.BaseDelta)
+			m.QuoteDelta = m.QuoteDelta.Add(d.QuoteDelta)
+			m.UpdatedAt = d.UpdatedAt
+			if err := tx.Save(&m).Error; err != nil {
+				return err
+			}
+		}
+		applied = true
+		return nil
+	})
+	return applied, err
+}
+
+func (r *GORMClearingRepository) UpdateClearingPosition(p *engine.ClearingPosition) error {
+	var m models.ClearingPosition
+	m.FromEngine(p)
+	return r.db.Save(&m).Error
+}
+
+// ListPositionsToSettle lista as posições pendentes com data de liquidação
+// até beforeOrEqual.
+func (r *GORMClearingRepository) ListPositionsToSettle(beforeOrEqual time.Time) ([]*engine.ClearingPosition, error) {
+	var ms []models.ClearingPosition
+	if err := r.db.Where("status = ? AND settlement_date <= ?", string(engine.SettlementStatusPending), beforeOrEqual).
+		Order("settlement_date").
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*engine.ClearingPosition, len(ms))
+	for i := range ms {
+		result[i] = ms[i].ToEngine()
+	}
+	return result, nil
+}
+
+func (r *GORMClearingRepository) SaveSettlementBatch(b *engine.SettlementBatch) error {
+	var m models.SettlementBatch
+	m.FromEngine(b)
+	return r.db.Create(&m).Error
+}
+
+func (r *GORMClearingRepository) UpdateSettlementBatch(b *engine.SettlementBatch) error {
+	var m models.SettlementBatch
+	m.FromEngine(b)
+	return r.db.Save(&m).Error
+}
+
+func (r *GORMClearingRepository) FindSettlementBatch(id string) (*engine.SettlementBatch, error) {
+	var m models.SettlementBatch
+	if err := r.db.Where("id = ?", id).First(&m).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return m.ToEngine(), nil
+}
+
+// ListSettlementBatches lista os lotes mais recentes primeiro.
+func (r *GORMClearingRepository) ListSettlementBatches(limit int) ([]*engine.SettlementBatch, error) {
+	var ms []models.SettlementBatch
+	if err := r.db.Order("created_at DESC").Limit(limit).Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*engine.SettlementBatch, len(ms))
+	for i := range ms {
+		result[i] = ms[i].ToEngine()
+	}
+	return result, nil
+}
+
+// ListOpenBatches lista os lotes não fechados, mais antigos primeiro.
+func (r *GORMClearingRepository) ListOpenBatches() ([]*engine.SettlementBatch, error) {
+	var ms []models.SettlementBatch
+	if err := r.db.Where("phase <> ?", string(engine.BatchPhaseClosed)).
+		Order("created_at ASC").
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*engine.SettlementBatch, len(ms))
+	for i := range ms {
+		result[i] = ms[i].ToEngine()
+	}
+	return result, nil
+}
+
+func (r *GORMClearingRepository) ListPositionsByBatch(batchID string) ([]*engine.ClearingPosition, error) {
+	var ms []models.ClearingPosition
+	if err := r.db.Where("batch_id = ?", batchID).Order("user_id, symbol").Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*engine.ClearingPosition, len(ms))
+	for i := range ms {
+		result[i] = ms[i].ToEngine()
+	}
+	return result, nil
+}
+
+func (r *GORMClearingRepository) SaveSettlementObligation(ob *engine.SettlementObligation) error {
+	var m models.SettlementObligation
+	m.FromEngine(ob)
+	return r.db.Create(&m).Error
+}
+
+func (r *GORMClearingRepository) UpdateSettlementObligation(ob *engine.SettlementObligation) error {
+	var m models.SettlementObligation
+	m.FromEngine(ob)
+	return r.db.Save(&m).Error
+}
+
+// ListSettlementObligations lista as obrigações do lote por usuário e ativo.
+func (r *GORMClearingRepository) ListSettlementObligations(batchID string) ([]*engine.SettlementObligation, error) {
+	var ms []models.SettlementObligation
+	if err := r.db.Where("batch_id = ?", batchID).Order("user_id, asset").Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*engine.SettlementObligation, len(ms))
+	for i := range ms {
+		result[i] = ms[i].ToEngine()
+	}
+	return result, nil
+}
+
+// ListOpenObligations lista os fails em aberto, mais antigos primeiro.
+func (r *GORMClearingRepository) ListOpenObligations() ([]*engine.SettlementObligation, error) {
+	var ms []models.SettlementObligation
+	open := []string{string(engine.SettlementStatusFailed), string(engine.SettlementStatusPartial)}
+	if err := r.db.Where("status IN ?", open).Order("failed_since").Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*engine.SettlementObligation, len(ms))
+	for i := range ms {
+		result[i] = ms[i].ToEngine()
+	}
+	return result, nil
+}
+
+// -------- PostTradeDeadLetterRepository --------
+
+// SaveDeadLetter grava a falha, substituindo a anterior do mesmo trade.
+func (r *GORMClearingRepository) SaveDeadLetter(f *engine.PostTradeFailure) error {
+	var m models.PostTradeDeadLetter
+	m.FromEngine(f)
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&m).Error
+}
+
+func (r *GORMClearingRepository) ListDeadLetters(limit int) ([]*engine.PostTradeFailure, error) {
+	var ms []models.PostTradeDeadLetter
+	if err := r.db.Order("failed_at").Limit(limit).Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*engine.PostTradeFailure, len(ms))
+	for i := range ms {
+		result[i] = ms[i].ToEngine()
+	}
+	return result, nil
+}
+
+func (r *GORMClearingRepository) DeleteDeadLetter(tradeID string) error {
+	return r.db.Where("trade_id = ?", tradeID).Delete(&models.PostTradeDeadLetter{}).Error
+}
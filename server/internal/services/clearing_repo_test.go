@@ -0,0 +1,53 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"hearcap/server/internal/decimal"
+	"hearcap/server/internal/engine"
+)
+
+func TestApplyTradeIsKeyedByTrade(t *testing.T) {
+	repo := NewGORMClearingRepository(openTestDB(t))
+	date := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	delta := func(id, qty string) []*engine.ClearingPosition {
+		return []*engine.ClearingPosition{{
+			ID: id, UserID: "alice", Symbol: "GNX", SettlementDate: date,
+			BaseDelta: decimal.RequireFromString(qty), QuoteDelta: decimal.RequireFromString(qty).Neg(),
+			Status: engine.SettlementStatusPending, CreatedAt: date, UpdatedAt: date,
+		}}
+	}
+
+	tests := []struct {
+		tradeID, positionID, qty string
+		applied                  bool
+	}{
+		{"apply-1", "pos-1", "2", true},
+		{"apply-1", "pos-2", "2", false},
+		{"apply-2", "pos-3", "3", true},
+	}
+	for _, tt := range tests {
+		applied, err := repo.ApplyTrade(tt.tradeID, delta(tt.positionID, tt.qty))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if applied != tt.applied {
+			t.Errorf("ApplyTrade(%s) applied = %v, want %v", tt.tradeID, applied, tt.applied)
+		}
+	}
+
+	positions, err := repo.ListPositionsToSettle(date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alice []*engine.ClearingPosition
+	for _, p := range positions {
+		if p.UserID == "alice" && p.Symbol == "GNX" {
+			alice = append(alice, p)
+		}
+	}
+	if len(alice) != 1 || alice[0].ID != "pos-1" || !alice[0].BaseDelta.Equal(decimal.RequireFromString("5")) {
+		t.Fatalf("alice positions = %+v, want pos-1 with 5 GNX", alice)
+	}
+}
@@ -9,11 +9,15 @@ import (
 	"time"
 
 	"hearcap/server/internal/config"
+	"hearcap/server/internal/decimal"
 	"hearcap/server/internal/models"
 
 	"gorm.io/gorm"
 )
 
+// minTradePrice é o piso do preço após o impacto de uma venda.
+var minTradePrice = decimal.RequireFromString("0.0001")
+
 // PriceEngine orquestra popularityScore, supply e candles.
 type PriceEngine struct {
 	db         *gorm.DB
@@ -70,7 +74,7 @@ func (p *PriceEngine) GeneratePrices(ctx context.Context) error {
 func (p *PriceEngine) createDefaultToken(ctx context.Context, artist *models.Artist) error {
 	token := models.Token{
 		ArtistID:          artist.ID,
-		BasePrice:         p.cfg.BasePriceMin,
+		BasePrice:         decimal.FromFloat(p.cfg.BasePriceMin).Round(4),
 		Supply:            int64(p.cfg.SupplyBase),
 		CirculatingSupply: int64(p.cfg.SupplyBase / 2),
 	}
@@ -82,8 +86,8 @@ func (p *PriceEngine) processToken(ctx context.Context, artist *models.Artist, t
 
 	lastPrice, err := p.fetchLastPrice(ctx, artist.Symbol)
 	var change float64
-	if err == nil && lastPrice.Price > 0 {
-		change = ((price - lastPrice.Price) / lastPrice.Price) * 100
+	if err == nil && lastPrice.Price.IsPositive() {
+		change = price.Sub(lastPrice.Price).QuoFloat(lastPrice.Price) * 100
 		change = math.Round(change*10000) / 10000
 	} else {
 		change = 0
@@ -108,7 +112,7 @@ func (p *PriceEngine) processToken(ctx context.Context, artist *models.Artist, t
 		return err
 	}
 
-	var previous float64
+	var previous decimal.Decimal
 	if err == nil {
 		previous = lastPrice.Price
 	}
@@ -131,34 +135,32 @@ func (p *PriceEngine) fetchLastPrice(ctx context.Context, symbol string) (models
 	return price, err
 }
 
-func (p *PriceEngine) buildCandle(symbol string, lastPrice, newPrice float64, popularity int) models.Candle {
+func (p *PriceEngine) buildCandle(symbol string, lastPrice, newPrice decimal.Decimal, popularity int) models.Candle {
 	now := time.Now()
 	open := newPrice
-	if lastPrice > 0 {
+	if lastPrice.IsPositive() {
 		open = lastPrice
 	}
 
-	high := math.Max(open, newPrice) + p.randomizer.Float64()*0.25
-	low := math.Min(open, newPrice) - p.randomizer.Float64()*0.25
-	if low < 0 {
-		low = 0
-	}
+	high := decimal.Max(open, newPrice).Add(decimal.FromFloat(p.randomizer.Float64() * 0.25))
+	low := decimal.Min(open, newPrice).Sub(decimal.FromFloat(p.randomizer.Float64() * 0.25))
+	low = decimal.Max(low, decimal.Zero)
 
-	volume := float64(popularity*10) + p.randomizer.Float64()*250
+	volume := decimal.FromFloat(float64(popularity*10) + p.randomizer.Float64()*250)
 
 	return models.Candle{
 		Symbol:    symbol,
 		Timestamp: now.Unix(),
-		Open:      math.Round(open*10000) / 10000,
-		High:      math.Round(high*10000) / 10000,
-		Low:       math.Round(low*10000) / 10000,
-		Close:     math.Round(newPrice*10000) / 10000,
-		Volume:    math.Round(volume*100) / 100,
+		Open:      open.Round(4),
+		High:      high.Round(4),
+		Low:       low.Round(4),
+		Close:     newPrice.Round(4),
+		Volume:    volume.Round(2),
 	}
 }
 
 // GetLatestPrice retorna o preço mais recente do símbolo ou o basePrice do token.
-func (p *PriceEngine) GetLatestPrice(db *gorm.DB, symbol string) (float64, error) {
+func (p *PriceEngine) GetLatestPrice(db *gorm.DB, symbol string) (decimal.Decimal, error) {
 	if db == nil {
 		db = p.db
 	}
@@ -170,13 +172,13 @@ func (p *PriceEngine) GetLatestPrice(db *gorm.DB, symbol string) (float64, error
 		Where("symbol = ?", symbol).
 		Order("created_at DESC").
 		First(&price).Error
-	if err == nil && price.Price > 0 {
+	if err == nil && price.Price.IsPositive() {
 		return price.Price, nil
 	}
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		type tokenWithPrice struct {
-			BasePrice float64
+			BasePrice decimal.Decimal
 		}
 		var token tokenWithPrice
 		if errToken := db.
@@ -185,22 +187,22 @@ func (p *PriceEngine) GetLatestPrice(db *gorm.DB, symbol string) (float64, error
 			Joins("JOIN artists ON artists.id = tokens.artist_id").
 			Where("artists.symbol = ?", symbol).
 			Order("tokens.created_at DESC").
-			First(&token).Error; errToken == nil && token.BasePrice > 0 {
+			First(&token).Error; errToken == nil && token.BasePrice.IsPositive() {
 			return token.BasePrice, nil
 		}
 	}
 
-	return 0, err
+	return decimal.Zero, err
 }
 
 // ApplyTradeImpact ajusta o preço após uma negociação e registra snapshot/candle.
-func (p *PriceEngine) ApplyTradeImpact(tx *gorm.DB, symbol string, side string, currentPrice, quantity, notional float64) (float64, *models.Price, *models.Candle, error) {
+func (p *PriceEngine) ApplyTradeImpact(tx *gorm.DB, symbol string, side string, currentPrice, quantity, notional decimal.Decimal) (decimal.Decimal, *models.Price, *models.Candle, error) {
 	if tx == nil {
 		tx = p.db
 	}
 
 	symbol = strings.ToUpper(symbol)
-	impact := p.cfg.TradeImpactAlpha * (quantity / p.cfg.TradeImpactLiquidity)
+	impact := p.cfg.TradeImpactAlpha * (quantity.Float64() / p.cfg.TradeImpactLiquidity)
 	if impact < 0 {
 		impact = 0
 	}
@@ -215,33 +217,33 @@ func (p *PriceEngine) ApplyTradeImpact(tx *gorm.DB, symbol string, side string,
 		}
 	}
 
-	newPrice := math.Max(currentPrice*multiplier, 0.0001)
+	newPrice := decimal.Max(currentPrice.MulFloat(multiplier).Round(4), minTradePrice)
 	changePct := 0.0
-	if currentPrice > 0 {
-		changePct = ((newPrice - currentPrice) / currentPrice) * 100
+	if currentPrice.IsPositive() {
+		changePct = newPrice.Sub(currentPrice).QuoFloat(currentPrice) * 100
 	}
 
 	priceEntry := models.Price{
 		Symbol:     symbol,
-		Price:      math.Round(newPrice*10000) / 10000,
+		Price:      newPrice,
 		Change24h:  math.Round(changePct*1000) / 1000,
 		Volatility: impact,
 	}
 	if err := tx.Create(&priceEntry).Error; err != nil {
-		return 0, nil, nil, err
+		return decimal.Zero, nil, nil, err
 	}
 
 	candle := models.Candle{
 		Symbol:    symbol,
 		Timestamp: time.Now().Unix(),
-		Open:      math.Round(currentPrice*10000) / 10000,
-		High:      math.Round(math.Max(currentPrice, newPrice)*10000) / 10000,
-		Low:       math.Round(math.Min(currentPrice, newPrice)*10000) / 10000,
-		Close:     math.Round(newPrice*10000) / 10000,
-		Volume:    math.Round(notional*100) / 100,
+		Open:      currentPrice.Round(4),
+		High:      decimal.Max(currentPrice, newPrice).Round(4),
+		Low:       decimal.Min(currentPrice, newPrice).Round(4),
+		Close:     newPrice,
+		Volume:    notional.Round(2),
 	}
 	if err := tx.Create(&candle).Error; err != nil {
-		return 0, nil, nil, err
+		return decimal.Zero, nil, nil, err
 	}
 
 	return priceEntry.Price, &priceEntry, &candle, nil
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"time"
+
+	"hearcap/server/internal/decimal"
+	"hearcap/server/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GORMFeeVolumeRepository implementa engine.FeeVolumeRepository com baldes
+// diários por usuário, como o MemoryFeeVolumes do engine.
+type GORMFeeVolumeRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMFeeVolumeRepository(db *gorm.DB) *GORMFeeVolumeRepository {
+	return &GORMFeeVolumeRepository{db: db}
+}
+
+func (r *GORMFeeVolumeRepository) AddVolume(userID string, at time.Time, notional decimal.Decimal) error {
+	m := models.FeeVolume{
+		UserID:   userID,
+		Day:      at.UTC().Truncate(24 * time.Hour),
+		Notional: notional,
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"notional": gorm.Expr("fee_volumes.notional + EXCLUDED.notional")}),
+	}).Create(&m).Error
+}
+
+func (r *GORMFeeVolumeRepository) VolumeSince(userID string, since time.Time) (decimal.Decimal, error) {
+	var total decimal.Decimal
+	err := r.db.Model(&models.FeeVolume{}).
+		Select("COALESCE(SUM(notional), 0)").
+		Where("user_id = ? AND day >= ?", userID, since.UTC().Truncate(24*time.Hour)).
+		Scan(&total).Error
+	return total, err
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"hearcap/server/internal/engine"
+	"hearcap/server/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GORMInstrumentRepository implementa engine.InstrumentRepository usando GORM
+type GORMInstrumentRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMInstrumentRepository(db *gorm.DB) *GORMInstrumentRepository {
+	return &GORMInstrumentRepository{db: db}
+}
+
+// SaveInstrument grava a especificação e o status do mercado, inserindo-o se
+// ainda não existir.
+func (r *GORMInstrumentRepository) SaveInstrument(inst *engine.Instrument) error {
+	var m models.MarketInstrument
+	m.FromEngine(inst)
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&m).Error
+}
+
+func (r *GORMInstrumentRepository) ListInstruments() ([]*engine.Instrument, error) {
+	var ms []models.MarketInstrument
+	if err := r.db.Order("symbol").Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*engine.Instrument, len(ms))
+	for i := range ms {
+		result[i] = ms[i].ToEngine()
+	}
+	return result, nil
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"time"
+
+	"hearcap/server/internal/engine"
+	"hearcap/server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// GORMOfferingRepository implementa engine.OfferingRepository e
+// engine.ListingRepository usando GORM
+type GORMOfferingRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMOfferingRepository(db *gorm.DB) *GORMOfferingRepository {
+	return &GORMOfferingRepository{db: db}
+}
+
+// -------- OfferingRepository --------
+
+func (r *GORMOfferingRepository) SaveOffering(o *engine.Offering) error {
+	var m models.Offering
+	m.FromEngine(o)
+	return r.db.Create(&m).Error
+}
+
+func (r *GORMOfferingRepository) UpdateOffering(o *engine.Offering) error {
+	var m models.Offering
+	m.FromEngine(o)
+	return r.db.Save(&m).Error
+}
+
+func (r *GORMOfferingRepository) FindOfferingByID(id string) (*engine.Offering, error) {
+	var m models.Offering
+	if err := r.db.Where("id = ?", id).First(&m).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, engine.ErrOfferingNotFound
+		}
+		return nil, err
+	}
+	return m.ToEngine(), nil
+}
+
+// ListOfferingsToClose lista as ofertas OPEN com fim até before e as que
+// ficaram em ALLOCATING.
+func (r *GORMOfferingRepository) ListOfferingsToClose(before time.Time) ([]*engine.Offering, error) {
+	var ms []models.Offering
+	if err := r.db.Where("(status = ? AND ends_at <= ?) OR status = ?",
+		string(engine.OfferingStatusOpen), before, string(engine.OfferingStatusAllocating)).
+		Order("ends_at").
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*engine.Offering, len(ms))
+	for i := range ms {
+		result[i] = ms[i].ToEngine()
+	}
+	return result, nil
+}
+
+func (r *GORMOfferingRepository) SaveBid(b *engine.OfferingBid) error {
+	var m models.OfferingBid
+	m.FromEngine(b)
+	return r.db.Create(&m).Error
+}
+
+func (r *GORMOfferingRepository) UpdateBid(b *engine.OfferingBid) error {
+	var m models.OfferingBid
+	m.FromEngine(b)
+	return r.db.Save(&m).Error
+}
+
+func (r *GORMOfferingRepository) FindBidByID(id string) (*engine.OfferingBid, error) {
+	var m models.OfferingBid
+	if err := r.db.Where("id = ?", id).First(&m).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, engine.ErrBidNotFound
+		}
+		return nil, err
+	}
+	return m.ToEngine(), nil
+}
+
+// ListBids lista os lances da oferta em ordem de chegada.
+func (r *GORMOfferingRepository) ListBids(offeringID string) ([]*engine.OfferingBid, error) {
+	var ms []models.OfferingBid
+	if err := r.db.Where("offering_id = ?", offeringID).
+		Order("created_at, id").
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*engine.OfferingBid, len(ms))
+	for i := range ms {
+		result[i] = ms[i].ToEngine()
+	}
+	return result, nil
+}
+
+// -------- ListingRepository --------
+
+func (r *GORMOfferingRepository) SaveListing(app *engine.ListingApplication) error {
+	var m models.ListingApplication
+	m.FromEngine(app)
+	return r.db.Create(&m).Error
+}
+
+func (r *GORMOfferingRepository) UpdateListing(app *engine.ListingApplication) error {
+	var m models.ListingApplication
+	m.FromEngine(app)
+	return r.db.Save(&m).Error
+}
+
+func (r *GORMOfferingRepository) FindListingByID(id string) (*engine.ListingApplication, error) {
+	return r.findListing("id = ?", id)
+}
+
+func (r *GORMOfferingRepository) FindListingBySymbol(symbol string) (*engine.ListingApplication, error) {
+	return r.findListing("symbol = ?", symbol)
+}
+
+func (r *GORMOfferingRepository) findListing(query string, arg string) (*engine.ListingApplication, error) {
+	var m models.ListingApplication
+	if err := r.db.Where(query, arg).Order("created_at DESC").First(&m).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, engine.ErrListingNotFound
+		}
+		return nil, err
+	}
+	return m.ToEngine(), nil
+}
+
+// ListActiveListings lista as listagens com mercado ativo.
+func (r *GORMOfferingRepository) ListActiveListings() ([]*engine.ListingApplication, error) {
+	var ms []models.ListingApplication
+	if err := r.db.Where("status = ?", string(engine.ListingStatusActive)).
+		Order("symbol").
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*engine.ListingApplication, len(ms))
+	for i := range ms {
+		result[i] = ms[i].ToEngine()
+	}
+	return result, nil
+}
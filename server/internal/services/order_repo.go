@@ -0,0 +1,157 @@
+package services
+
+import (
+	"hearcap/server/internal/engine"
+	"hearcap/server/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// openOrderStatuses são os status de ordens ainda ativas.
+var openOrderStatuses = []string{string(engine.OrderStatusNew), string(engine.OrderStatusPartFilled)}
+
+// GORMOrderRepository implementa engine.Repository usando GORM
+type GORMOrderRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMOrderRepository(db *gorm.DB) *GORMOrderRepository {
+	return &GORMOrderRepository{db: db}
+}
+
+func (r *GORMOrderRepository) SaveOrder(o *engine.Order) error {
+	var m models.ExchangeOrder
+	m.FromEngine(o)
+	return r.db.Create(&m).Error
+}
+
+// UpdateOrder grava o estado atual da ordem, inserindo-a se ainda não existir.
+func (r *GORMOrderRepository) UpdateOrder(o *engine.Order) error {
+	return upsertOrder(r.db, o)
+}
+
+// SaveTrade grava a execução e o estado das ordens envolvidas na mesma
+// transação.
+func (r *GORMOrderRepository) SaveTrade(t *engine.Trade, orders ...*engine.Order) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var fill models.ExchangeFill
+		fill.FromEngine(t)
+		fill.PostTradeStage = string(engine.PostTradeStageCounterparty)
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&fill).Error; err != nil {
+			return err
+		}
+		for _, o := range orders {
+			if err := upsertOrder(tx, o); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *GORMOrderRepository) SaveOrderGroup(g *engine.OrderGroup) error {
+	var m models.ExchangeOrderGroup
+	m.FromEngine(g)
+	return r.db.Create(&m).Error
+}
+
+func (r *GORMOrderRepository) UpdateOrderGroup(g *engine.OrderGroup) error {
+	var m models.ExchangeOrderGroup
+	m.FromEngine(g)
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&m).Error
+}
+
+func upsertOrder(db *gorm.DB, o *engine.Order) error {
+	var m models.ExchangeOrder
+	m.FromEngine(o)
+	return db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&m).Error
+}
+
+// FindTrade devolve o trade pelo ID (nil se não existir).
+func (r *GORMOrderRepository) FindTrade(id string) (*engine.Trade, error) {
+	var m models.ExchangeFill
+	if err := r.db.Where("id = ?", id).First(&m).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return m.ToEngine(), nil
+}
+
+// ListPendingPostTrades lista, na ordem de execução, os trades com etapa do
+// pós-trade pendente.
+func (r *GORMOrderRepository) ListPendingPostTrades() ([]*engine.PendingPostTrade, error) {
+	var ms []models.ExchangeFill
+	if err := r.db.Where("post_trade_stage <> ''").Order("created_at, seq").Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*engine.PendingPostTrade, len(ms))
+	for i := range ms {
+		result[i] = &engine.PendingPostTrade{
+			Trade: ms[i].ToEngine(),
+			Stage: engine.PostTradeStage(ms[i].PostTradeStage),
+		}
+	}
+	return result, nil
+}
+
+func (r *GORMOrderRepository) SetPostTradeStage(tradeID string, stage engine.PostTradeStage) error {
+	return r.db.Model(&models.ExchangeFill{}).
+		Where("id = ?", tradeID).
+		Update("post_trade_stage", string(stage)).Error
+}
+
+// FindOrder devolve a ordem pelo ID (nil se não existir).
+func (r *GORMOrderRepository) FindOrder(id string) (*engine.Order, error) {
+	var m models.ExchangeOrder
+	if err := r.db.Where("id = ?", id).First(&m).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return m.ToEngine(), nil
+}
+
+// ListOrdersByUser lista as ordens do usuário, mais recentes primeiro. symbol
+// vazio lista todos os mercados; openOnly restringe às ordens ativas.
+func (r *GORMOrderRepository) ListOrdersByUser(userID, symbol string, openOnly bool, limit int) ([]*engine.Order, error) {
+	q := r.db.Where("user_id = ?", userID)
+	if symbol != "" {
+		q = q.Where("symbol = ?", symbol)
+	}
+	if openOnly {
+		q = q.Where("status IN ?", openOrderStatuses)
+	}
+
+	var ms []models.ExchangeOrder
+	if err := q.Order("created_at DESC").Limit(limit).Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*engine.Order, len(ms))
+	for i := range ms {
+		result[i] = ms[i].ToEngine()
+	}
+	return result, nil
+}
+
+// ListFillsByUser lista as execuções em que o usuário foi comprador ou
+// vendedor, mais recentes primeiro.
+func (r *GORMOrderRepository) ListFillsByUser(userID, symbol string, limit int) ([]*engine.Trade, error) {
+	q := r.db.Where("(buyer_id = ? OR seller_id = ?)", userID, userID)
+	if symbol != "" {
+		q = q.Where("symbol = ?", symbol)
+	}
+
+	var ms []models.ExchangeFill
+	if err := q.Order("created_at DESC").Limit(limit).Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*engine.Trade, len(ms))
+	for i := range ms {
+		result[i] = ms[i].ToEngine()
+	}
+	return result, nil
+}
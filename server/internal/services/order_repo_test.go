@@ -0,0 +1,195 @@
+package services
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"hearcap/server/internal/database"
+	"hearcap/server/internal/decimal"
+	"hearcap/server/internal/engine"
+	"hearcap/server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// openTestDB abre o Postgres de TEST_DATABASE_URL, migrado, dentro de uma
+// transação desfeita ao fim do teste. Sem a variável o teste é pulado.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := database.New(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	tx := db.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+func testOrder(id, user string, side engine.Side, status engine.OrderStatus, at time.Time) *engine.Order {
+	return &engine.Order{
+		ID:        id,
+		UserID:    user,
+		Symbol:    "GNX",
+		Side:      side,
+		Type:      engine.OrderTypeLimit,
+		Price:     decimal.RequireFromString("10"),
+		Quantity:  decimal.RequireFromString("2"),
+		Status:    status,
+		CreatedAt: at,
+		UpdatedAt: at,
+	}
+}
+
+func TestSaveTradeCommitsFillAndOrders(t *testing.T) {
+	repo := NewGORMOrderRepository(openTestDB(t))
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	buy := testOrder("repo-buy", "alice", engine.SideBuy, engine.OrderStatusNew, now)
+	sell := testOrder("repo-sell", "bob", engine.SideSell, engine.OrderStatusNew, now)
+	for _, o := range []*engine.Order{buy, sell} {
+		if err := repo.SaveOrder(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buy.FilledQty, buy.Status = buy.Quantity, engine.OrderStatusFilled
+	sell.FilledQty, sell.Status = sell.Quantity, engine.OrderStatusFilled
+	trade := &engine.Trade{
+		ID: "repo-trade", Seq: 1, Symbol: "GNX", BuyOrder: buy.ID, SellOrder: sell.ID,
+		BuyerID: "alice", SellerID: "bob", TakerSide: engine.SideSell,
+		Price: buy.Price, Quantity: buy.Quantity, BuyerFee: decimal.RequireFromString("0.02"), FeeAsset: "BRL",
+		CreatedAt: now,
+	}
+	// repetir a gravação (replay) não duplica a execução
+	for i := 0; i < 2; i++ {
+		if err := repo.SaveTrade(trade, buy, sell); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := repo.FindTrade(trade.ID)
+	if err != nil || got == nil {
+		t.Fatalf("FindTrade = %v, %v", got, err)
+	}
+	if got.TakerSide != engine.SideSell || !got.BuyerFee.Equal(trade.BuyerFee) {
+		t.Fatalf("stored trade = %+v", got)
+	}
+	for _, id := range []string{buy.ID, sell.ID} {
+		o, err := repo.FindOrder(id)
+		if err != nil || o == nil || o.Status != engine.OrderStatusFilled {
+			t.Fatalf("order %s = %+v, %v; want FILLED", id, o, err)
+		}
+	}
+	for _, user := range []string{"alice", "bob"} {
+		fills, err := repo.ListFillsByUser(user, "GNX", 10)
+		if err != nil || len(fills) != 1 {
+			t.Fatalf("%s fills = %d, %v; want 1", user, len(fills), err)
+		}
+	}
+}
+
+func TestSaveTradeRollsBackOnOrderFailure(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewGORMOrderRepository(db)
+	now := time.Now().UTC()
+	buy := testOrder("repo-buy-2", "alice", engine.SideBuy, engine.OrderStatusFilled, now)
+	// símbolo maior que a coluna: a gravação da ordem falha
+	bad := testOrder("repo-sell-2", "bob", engine.SideSell, engine.OrderStatusFilled, now)
+	bad.Symbol = strings.Repeat("X", 32)
+
+	trade := &engine.Trade{
+		ID: "repo-trade-2", Symbol: "GNX", BuyOrder: buy.ID, SellOrder: bad.ID,
+		BuyerID: "alice", SellerID: "bob", TakerSide: engine.SideBuy,
+		Price: buy.Price, Quantity: buy.Quantity, CreatedAt: now,
+	}
+	if err := repo.SaveTrade(trade, buy, bad); err == nil {
+		t.Fatal("SaveTrade succeeded with an invalid order")
+	}
+	if got, err := repo.FindTrade(trade.ID); err != nil || got != nil {
+		t.Fatalf("fill persisted after the rollback: %+v, %v", got, err)
+	}
+	var count int64
+	db.Model(&models.ExchangeOrder{}).Where("id = ?", buy.ID).Count(&count)
+	if count != 0 {
+		t.Fatal("buy order persisted after the rollback")
+	}
+}
+
+func TestListOrdersByUser(t *testing.T) {
+	repo := NewGORMOrderRepository(openTestDB(t))
+	now := time.Now().UTC()
+	orders := []*engine.Order{
+		testOrder("repo-o1", "carol", engine.SideBuy, engine.OrderStatusFilled, now.Add(-2*time.Minute)),
+		testOrder("repo-o2", "carol", engine.SideBuy, engine.OrderStatusNew, now.Add(-time.Minute)),
+		testOrder("repo-o3", "carol", engine.SideSell, engine.OrderStatusPartFilled, now),
+		testOrder("repo-o4", "dave", engine.SideSell, engine.OrderStatusNew, now),
+	}
+	for _, o := range orders {
+		if err := repo.UpdateOrder(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := repo.ListOrdersByUser("carol", "", false, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[0].ID != "repo-o3" || all[2].ID != "repo-o1" {
+		t.Fatalf("carol orders = %d, want 3 newest first", len(all))
+	}
+	open, err := repo.ListOrdersByUser("carol", "GNX", true, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 2 {
+		t.Fatalf("carol open orders = %d, want 2", len(open))
+	}
+}
+
+func TestPostTradeOutbox(t *testing.T) {
+	repo := NewGORMOrderRepository(openTestDB(t))
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	for i, id := range []string{"outbox-1", "outbox-2"} {
+		trade := &engine.Trade{
+			ID: id, Seq: uint64(i + 1), Symbol: "GNX", BuyOrder: "b", SellOrder: "s",
+			BuyerID: "alice", SellerID: "bob", TakerSide: engine.SideBuy,
+			Price: decimal.RequireFromString("10"), Quantity: decimal.RequireFromString("1"),
+			CreatedAt: now.Add(time.Duration(i) * time.Second),
+		}
+		if err := repo.SaveTrade(trade); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.SetPostTradeStage("outbox-1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetPostTradeStage("outbox-2", engine.PostTradeStageRisk); err != nil {
+		t.Fatal(err)
+	}
+	// regravar o trade (replay) não o devolve ao início do pós-trade
+	if err := repo.SaveTrade(&engine.Trade{ID: "outbox-2", Symbol: "GNX", CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := repo.ListPendingPostTrades()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, p := range pending {
+		if strings.HasPrefix(p.Trade.ID, "outbox-") {
+			ids = append(ids, p.Trade.ID+"@"+string(p.Stage))
+		}
+	}
+	if got := strings.Join(ids, ","); got != "outbox-2@RISK" {
+		t.Fatalf("pending = %s, want outbox-2@RISK", got)
+	}
+}
@@ -1,11 +1,11 @@
 package services
 
 import (
-	"math"
 	"math/rand"
 	"time"
 
 	"hearcap/server/internal/config"
+	"hearcap/server/internal/decimal"
 )
 
 // PricingService aplica a fórmula de preço base + popularidade + volatilidade controlada.
@@ -23,13 +23,13 @@ func NewPricingService(cfg *config.Config) *PricingService {
 }
 
 // CalculatePrice retorna o novo preço e o fator de volatilidade aplicado.
-func (s *PricingService) CalculatePrice(base float64, popularity int) (float64, float64) {
-	if base <= 0 {
-		base = s.cfg.BasePriceMin + s.rand.Float64()*(s.cfg.BasePriceMax-s.cfg.BasePriceMin)
+func (s *PricingService) CalculatePrice(base decimal.Decimal, popularity int) (decimal.Decimal, float64) {
+	if !base.IsPositive() {
+		base = decimal.FromFloat(s.cfg.BasePriceMin + s.rand.Float64()*(s.cfg.BasePriceMax-s.cfg.BasePriceMin))
 	}
 
 	volatility := s.cfg.VolatilityMin + s.rand.Float64()*(s.cfg.VolatilityMax-s.cfg.VolatilityMin)
-	price := base + (float64(popularity) * 0.1) + volatility
+	price := base.Add(decimal.FromFloat(float64(popularity)*0.1 + volatility))
 
-	return math.Round(price*10000) / 10000, volatility
+	return price.Round(4), volatility
 }
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"hearcap/server/internal/config"
+	"hearcap/server/internal/decimal"
 	"hearcap/server/internal/models"
 
 	"github.com/google/uuid"
@@ -18,11 +19,11 @@ var (
 )
 
 type TradeResult struct {
-	Trade    models.Trade       `json:"trade"`
-	NewPrice float64            `json:"new_price"`
-	Wallets  map[string]float64 `json:"wallets"`
-	Snapshot *models.Price      `json:"snapshot"`
-	Candle   *models.Candle     `json:"candle"`
+	Trade    models.Trade               `json:"trade"`
+	NewPrice decimal.Decimal            `json:"new_price"`
+	Wallets  map[string]decimal.Decimal `json:"wallets"`
+	Snapshot *models.Price              `json:"snapshot"`
+	Candle   *models.Candle             `json:"candle"`
 }
 
 type TradeService struct {
@@ -41,16 +42,16 @@ func NewTradeService(db *gorm.DB, cfg *config.Config, walletSvc *WalletService,
 	}
 }
 
-func (s *TradeService) Buy(ctx context.Context, userID uuid.UUID, symbol string, quantity float64) (*TradeResult, error) {
+func (s *TradeService) Buy(ctx context.Context, userID uuid.UUID, symbol string, quantity decimal.Decimal) (*TradeResult, error) {
 	return s.executeTrade(ctx, userID, symbol, quantity, "buy")
 }
 
-func (s *TradeService) Sell(ctx context.Context, userID uuid.UUID, symbol string, quantity float64) (*TradeResult, error) {
+func (s *TradeService) Sell(ctx context.Context, userID uuid.UUID, symbol string, quantity decimal.Decimal) (*TradeResult, error) {
 	return s.executeTrade(ctx, userID, symbol, quantity, "sell")
 }
 
-func (s *TradeService) executeTrade(ctx context.Context, userID uuid.UUID, symbol string, quantity float64, side string) (*TradeResult, error) {
-	if quantity <= 0 {
+func (s *TradeService) executeTrade(ctx context.Context, userID uuid.UUID, symbol string, quantity decimal.Decimal, side string) (*TradeResult, error) {
+	if !quantity.IsPositive() {
 		return nil, errors.New("quantidade inválida")
 	}
 
@@ -77,24 +78,24 @@ func (s *TradeService) executeTrade(ctx context.Context, userID uuid.UUID, symbo
 		if err != nil {
 			return err
 		}
-		if currentPrice <= 0 {
+		if !currentPrice.IsPositive() {
 			return ErrSymbolNotSupported
 		}
 
-		notional := currentPrice * quantity
+		notional := currentPrice.Mul(quantity)
 
 		if side == "buy" {
-			if usdtWallet.Balance < notional {
+			if usdtWallet.Balance.LessThan(notional) {
 				return ErrInsufficientBalance
 			}
-			usdtWallet.Balance -= notional
-			tokenWallet.Balance += quantity
+			usdtWallet.Balance = usdtWallet.Balance.Sub(notional)
+			tokenWallet.Balance = tokenWallet.Balance.Add(quantity)
 		} else {
-			if tokenWallet.Balance < quantity {
+			if tokenWallet.Balance.LessThan(quantity) {
 				return ErrInsufficientBalance
 			}
-			tokenWallet.Balance -= quantity
-			usdtWallet.Balance += notional
+			tokenWallet.Balance = tokenWallet.Balance.Sub(quantity)
+			usdtWallet.Balance = usdtWallet.Balance.Add(notional)
 		}
 
 		if err := tx.Save(usdtWallet).Error; err != nil {
@@ -124,7 +125,7 @@ func (s *TradeService) executeTrade(ctx context.Context, userID uuid.UUID, symbo
 		result = &TradeResult{
 			Trade:    trade,
 			NewPrice: newPrice,
-			Wallets: map[string]float64{
+			Wallets: map[string]decimal.Decimal{
 				"USDT": usdtWallet.Balance,
 				symbol: tokenWallet.Balance,
 			},
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"hearcap/server/internal/config"
+	"hearcap/server/internal/decimal"
 	"hearcap/server/internal/models"
 
 	"github.com/google/uuid"
@@ -63,9 +64,9 @@ func (s *WalletService) GetAll(ctx context.Context, userID uuid.UUID) ([]models.
 	return wallets, nil
 }
 
-func (s *WalletService) initialBalance(symbol string) float64 {
+func (s *WalletService) initialBalance(symbol string) decimal.Decimal {
 	if strings.EqualFold(symbol, "USDT") {
-		return s.cfg.InitialUSDTBalance
+		return decimal.FromFloat(s.cfg.InitialUSDTBalance)
 	}
-	return 0
+	return decimal.Zero
 }
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"hearcap/server/internal/engine"
+	"hearcap/server/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GORMWalletRepository implementa os repositórios da WalletEngine (ativos,
+// contas/saldos, ledger, depósitos e saques) usando GORM
+type GORMWalletRepository struct {
+	db *gorm.DB
+}
+
+func NewGORMWalletRepository(db *gorm.DB) *GORMWalletRepository {
+	return &GORMWalletRepository{db: db}
+}
+
+// -------- AssetRepository --------
+
+func (r *GORMWalletRepository) GetAsset(symbol string) (*engine.Asset, error) {
+	var m models.WalletAsset
+	if err := r.db.Where("symbol = ?", symbol).First(&m).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return m.ToEngine(), nil
+}
+
+func (r *GORMWalletRepository) ListAssets() ([]*engine.Asset, error) {
+	var ms []models.WalletAsset
+	if err := r.db.Order("symbol").Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*engine.Asset, len(ms))
+	for i := range ms {
+		result[i] = ms[i].ToEngine()
+	}
+	return result, nil
+}
+
+func (r *GORMWalletRepository) SaveAsset(a *engine.Asset) error {
+	var m models.WalletAsset
+	m.FromEngine(a)
+	return r.db.Create(&m).Error
+}
+
+func (r *GORMWalletRepository) UpdateAsset(a *engine.Asset) error {
+	var m models.WalletAsset
+	m.FromEngine(a)
+	return r.db.Save(&m).Error
+}
+
+// -------- WalletRepository --------
+
+func (r *GORMWalletRepository) GetOrCreateAccount(userID, asset string) (*engine.WalletAccount, error) {
+	m := models.WalletAccount{ID: uuid.NewString(), UserID: userID, Asset: asset}
+	if err := r.db.Where("user_id = ? AND asset = ?", userID, asset).
+		FirstOrCreate(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEngine(), nil
+}
+
+func (r *GORMWalletRepository) GetAccount(userID, asset string) (*engine.WalletAccount, error) {
+	var m models.WalletAccount
+	if err := r.db.Where("user_id = ? AND asset = ?", userID, asset).First(&m).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return m.ToEngine(), nil
+}
+
+// GetBalance devolve nil sem erro quando a conta ainda não tem saldo.
+func (r *GORMWalletRepository) GetBalance(accountID string) (*engine.Balance, error) {
+	var m models.WalletBalance
+	if err := r.db.Where("account_id = ?", accountID).First(&m).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return m.ToEngine(), nil
+}
+
+func (r *GORMWalletRepository) SaveBalance(b *engine.Balance) error {
+	var m models.WalletBalance
+	m.FromEngine(b)
+	return r.db.Create(&m).Error
+}
+
+func (r *GORMWalletRepository) UpdateBalance(b *engine.Balance) error {
+	var m models.WalletBalance
+	m.FromEngine(b)
+	return r.db.Save(&m).Error
+}
+
+// -------- LedgerRepository --------
+
+func (r *GORMWalletRepository) SaveEntry(e *engine.LedgerEntry) error {
+	var m models.LedgerEntry
+	m.FromEngine(e)
+	return r.db.Create(&m).Error
+}
+
+func (r *GORMWalletRepository) ListEntriesByAccount(accountID string, limit int) ([]*engine.LedgerEntry, error) {
+	var ms []models.LedgerEntry
+	if err := r.db.Where("account_id = ?", accountID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*engine.LedgerEntry, len(ms))
+	for i := range ms {
+		result[i] = ms[i].ToEngine()
+	}
+	return result, nil
+}
+
+func (r *GORMWalletRepository) FindEntryByKey(key string) (*engine.LedgerEntry, error) {
+	var m models.LedgerEntry
+	if err := r.db.Where("key = ?", key).First(&m).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return m.ToEngine(), nil
+}
+
+func (r *GORMWalletRepository) PostEntry(e *engine.LedgerEntry, b *engine.Balance) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var entry models.LedgerEntry
+		entry.FromEngine(e)
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		var bal models.WalletBalance
+		bal.FromEngine(b)
+		return tx.Save(&bal).Error
+	})
+}
+
+// -------- DepositRepository --------
+
+func (r *GORMWalletRepository) SaveDeposit(d *engine.DepositRequest) error {
+	var m models.DepositRequest
+	m.FromEngine(d)
+	return r.db.Create(&m).Error
+}
+
+func (r *GORMWalletRepository) UpdateDeposit(d *engine.DepositRequest) error {
+	var m models.DepositRequest
+	m.FromEngine(d)
+	return r.db.Save(&m).Error
+}
+
+func (r *GORMWalletRepository) FindDepositByID(id string) (*engine.DepositRequest, error) {
+	var m models.DepositRequest
+	if err := r.db.Where("id = ?", id).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEngine(), nil
+}
+
+// -------- WithdrawalRepository --------
+
+func (r *GORMWalletRepository) SaveWithdrawal(w *engine.WithdrawalRequest) error {
+	var m models.WithdrawalRequest
+	m.FromEngine(w)
+	return r.db.Create(&m).Error
+}
+
+func (r *GORMWalletRepository) UpdateWithdrawal(w *engine.WithdrawalRequest) error {
+	var m models.WithdrawalRequest
+	m.FromEngine(w)
+	return r.db.Save(&m).Error
+}
+
+func (r *GORMWalletRepository) FindWithdrawalByID(id string) (*engine.WithdrawalRequest, error) {
+	var m models.WithdrawalRequest
+	if err := r.db.Where("id = ?", id).First(&m).Error; err != nil {
+		return nil, err
+	}
+	return m.ToEngine(), nil
+}